@@ -3,11 +3,14 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -81,20 +84,24 @@ func (api *APIServer) setupRoutes() {
 	api.router.HandleFunc("/blockchain/blocks/{index}", api.handleGetBlockByIndex).Methods("GET")
 	api.router.HandleFunc("/blockchain/blocks/hash/{hash}", api.handleGetBlockByHash).Methods("GET")
 	api.router.HandleFunc("/blockchain/length", api.handleChainLength).Methods("GET")
+	api.router.HandleFunc("/blockchain/state/check", api.handleCheckState).Methods("GET")
 
 	// Post endpoints
 	api.router.HandleFunc("/posts", api.handleGetPosts).Methods("GET")
 	api.router.HandleFunc("/posts/pending", api.handleGetPendingPosts).Methods("GET")
 	api.router.HandleFunc("/posts/{hash}", api.handleGetPostByHash).Methods("GET")
+	api.router.HandleFunc("/posts/{hash}/proof", api.handleGetPostProof).Methods("GET")
 
 	// Transfer endpoints
 	api.router.HandleFunc("/transfers", api.handleGetTransfers).Methods("GET")
 	api.router.HandleFunc("/transfers/pending", api.handleGetPendingTransfers).Methods("GET")
+	api.router.HandleFunc("/transfers/fees", api.handleEstimateFees).Methods("GET")
 
 	// Wallet endpoints
 	api.router.HandleFunc("/wallets", api.handleGetWallets).Methods("GET")
 	api.router.HandleFunc("/wallets/{address}", api.handleGetWallet).Methods("GET")
 	api.router.HandleFunc("/wallets/{address}/balance", api.handleGetBalance).Methods("GET")
+	api.router.HandleFunc("/wallets/{address}/proof", api.handleGetWalletProof).Methods("GET")
 
 	// Network endpoints
 	api.router.HandleFunc("/network/stats", api.handleNetworkStats).Methods("GET")
@@ -296,6 +303,26 @@ func (api *APIServer) handleChainLength(w http.ResponseWriter, r *http.Request)
 	api.sendJSON(w, response)
 }
 
+// handleCheckState replays the chain and compares the result with the live state
+// The replay is expensive, so only local clients may start one.
+func (api *APIServer) handleCheckState(w http.ResponseWriter, r *http.Request) {
+	if !isLocalRequest(r) {
+		api.sendError(w, "State check is only available locally", http.StatusForbidden)
+		return
+	}
+
+	report, err := api.blockchain.CheckStateConsistency()
+	if errors.Is(err, blockchain.ErrStateCheckRunning) {
+		api.sendError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		api.sendError(w, fmt.Sprintf("Failed to check state: %v", err), http.StatusInternalServerError)
+		return
+	}
+	api.sendJSON(w, report)
+}
+
 // handleGetPosts returns recent posts
 func (api *APIServer) handleGetPosts(w http.ResponseWriter, r *http.Request) {
 	// TODO: Implement post retrieval with pagination
@@ -316,6 +343,20 @@ func (api *APIServer) handleGetPostByHash(w http.ResponseWriter, r *http.Request
 	api.sendError(w, "Not implemented", http.StatusNotImplemented)
 }
 
+// handleGetPostProof returns the light-client inclusion proof of a post
+func (api *APIServer) handleGetPostProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hash := vars["hash"]
+
+	proof, err := api.blockchain.GetPostProof(hash)
+	if err != nil {
+		api.sendError(w, "Post not found in chain", http.StatusNotFound)
+		return
+	}
+
+	api.sendJSON(w, proof)
+}
+
 // handleGetTransfers returns recent transfers
 func (api *APIServer) handleGetTransfers(w http.ResponseWriter, r *http.Request) {
 	// TODO: Implement transfer retrieval
@@ -328,9 +369,23 @@ func (api *APIServer) handleGetPendingTransfers(w http.ResponseWriter, r *http.R
 	api.sendJSON(w, poolInfo)
 }
 
+// handleEstimateFees suggests transfer fees from recent blocks
+func (api *APIServer) handleEstimateFees(w http.ResponseWriter, r *http.Request) {
+	estimate, err := api.blockchain.EstimateFees()
+	if err != nil {
+		api.sendError(w, fmt.Sprintf("Failed to estimate fees: %v", err), http.StatusInternalServerError)
+		return
+	}
+	api.sendJSON(w, estimate)
+}
+
 // handleGetWallets returns all wallet states
 func (api *APIServer) handleGetWallets(w http.ResponseWriter, r *http.Request) {
-	stateInfo := api.blockchain.GetStateInfo()
+	stateInfo, err := api.blockchain.GetStateInfo()
+	if err != nil {
+		api.sendError(w, "Failed to get state info", http.StatusInternalServerError)
+		return
+	}
 	api.sendJSON(w, stateInfo)
 }
 
@@ -370,6 +425,31 @@ func (api *APIServer) handleGetBalance(w http.ResponseWriter, r *http.Request) {
 	api.sendJSON(w, response)
 }
 
+// handleGetWalletProof returns a wallet's state at a height with a proof against that block's header
+func (api *APIServer) handleGetWalletProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	address := vars["address"]
+
+	// Default to the latest block
+	height := -1
+	if param := r.URL.Query().Get("height"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 {
+			api.sendError(w, "Invalid height", http.StatusBadRequest)
+			return
+		}
+		height = parsed
+	}
+
+	proof, err := api.blockchain.GetWalletProof(address, height)
+	if err != nil {
+		api.sendError(w, "No state at that height", http.StatusNotFound)
+		return
+	}
+
+	api.sendJSON(w, proof)
+}
+
 // handleNetworkStats returns network statistics
 func (api *APIServer) handleNetworkStats(w http.ResponseWriter, r *http.Request) {
 	// TODO: Implement network stats when network is available
@@ -409,3 +489,17 @@ func (api *APIServer) sendError(w http.ResponseWriter, message string, statusCod
 
 	json.NewEncoder(w).Encode(response)
 }
+
+// isLocalRequest reports whether a request comes straight from this machine
+// Requests relayed by a proxy carry a forwarding header and are never local.
+func isLocalRequest(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
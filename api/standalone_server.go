@@ -84,6 +84,7 @@ func (api *StandaloneAPIServer) setupRoutes() {
 
 	// Transfer endpoints
 	api.router.HandleFunc("/transfers/pending", api.handleGetPendingTransfers).Methods("GET")
+	api.router.HandleFunc("/transfers/fees", api.handleEstimateFees).Methods("GET")
 
 	// Wallet endpoints
 	api.router.HandleFunc("/wallets", api.handleGetWallets).Methods("GET")
@@ -271,9 +272,23 @@ func (api *StandaloneAPIServer) handleGetPendingTransfers(w http.ResponseWriter,
 	api.sendJSON(w, poolInfo)
 }
 
+// handleEstimateFees suggests transfer fees from recent blocks
+func (api *StandaloneAPIServer) handleEstimateFees(w http.ResponseWriter, r *http.Request) {
+	estimate, err := api.blockchain.EstimateFees()
+	if err != nil {
+		api.sendError(w, fmt.Sprintf("Failed to estimate fees: %v", err), http.StatusInternalServerError)
+		return
+	}
+	api.sendJSON(w, estimate)
+}
+
 // handleGetWallets returns all wallet states
 func (api *StandaloneAPIServer) handleGetWallets(w http.ResponseWriter, r *http.Request) {
-	stateInfo := api.blockchain.GetStateInfo()
+	stateInfo, err := api.blockchain.GetStateInfo()
+	if err != nil {
+		api.sendError(w, "Failed to get state info", http.StatusInternalServerError)
+		return
+	}
 	api.sendJSON(w, stateInfo)
 }
 
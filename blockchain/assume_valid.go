@@ -0,0 +1,132 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// blockLink is the part of a block or header needed to follow ancestry
+type blockLink struct {
+	Index    int
+	Hash     string
+	PrevHash string
+}
+
+// blockLinks returns the ancestry links of the blocks that match their hash
+// A block's hash commits to its prev hash, so only checked links prove ancestry.
+func blockLinks(blocks []*chain.Block) []blockLink {
+	links := make([]blockLink, 0, len(blocks))
+	for _, block := range blocks {
+		if block.CalculateHash() != block.Hash {
+			continue
+		}
+		links = append(links, blockLink{Index: block.Index, Hash: block.Hash, PrevHash: block.PrevHash})
+	}
+	return links
+}
+
+// headerLinks returns the ancestry links of the headers that match their hash
+// Legacy headers cannot be hashed without their block, so they prove nothing.
+func headerLinks(headers []*chain.BlockHeader) []blockLink {
+	links := make([]blockLink, 0, len(headers))
+	for _, header := range headers {
+		if header.Version == chain.EncodingLegacy || header.CalculateHash() != header.Hash {
+			continue
+		}
+		links = append(links, blockLink{Index: header.Index, Hash: header.Hash, PrevHash: header.PrevHash})
+	}
+	return links
+}
+
+// SetAssumeValid sets the block whose ancestors skip signature checks during sync
+// An empty hash disables assume-valid so every signature is verified.
+func (bc *Blockchain) SetAssumeValid(checkpoint chain.Checkpoint) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.assumeValid = checkpoint
+	bc.assumeValidAncestors = make(map[string]bool)
+}
+
+// NoteHeaderChain records which blocks of a validated header chain are ancestors of the assume-valid block
+// Called by sync after downloading headers so blocks arriving in later batches
+// can skip signature checks.
+func (bc *Blockchain) NoteHeaderChain(headers []*chain.BlockHeader) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.markAssumeValidAncestors(headerLinks(headers))
+}
+
+// noteAssumeValidBatch marks the blocks of a batch that are ancestors of the assume-valid block (caller must hold the lock)
+// The assume-valid block must be in the batch and pass every check, signatures
+// included, before it vouches for the blocks below it.
+func (bc *Blockchain) noteAssumeValidBatch(blocks []*chain.Block) {
+	if bc.assumeValid.Hash == "" {
+		return
+	}
+	for _, block := range blocks {
+		if block.Hash != bc.assumeValid.Hash {
+			continue
+		}
+		if block.CalculateHash() != block.Hash || block.ValidateBlockWithParams(bc.paramsAt(block.Index)) != nil {
+			return
+		}
+		bc.markAssumeValidAncestors(blockLinks(blocks))
+		return
+	}
+}
+
+// markAssumeValidAncestors marks the ancestors of the assume-valid block found in links (caller must hold the lock)
+// Ancestry is proven by walking hash-checked prev hashes back from the assume-valid
+// block, so a block only qualifies if it is really part of the assume-valid chain.
+func (bc *Blockchain) markAssumeValidAncestors(links []blockLink) {
+	if bc.assumeValid.Hash == "" {
+		return
+	}
+
+	byHash := make(map[string]blockLink, len(links))
+	for _, link := range links {
+		byHash[link.Hash] = link
+	}
+
+	link, exists := byHash[bc.assumeValid.Hash]
+	if !exists || link.Index != bc.assumeValid.Height {
+		return
+	}
+
+	for {
+		bc.assumeValidAncestors[link.Hash] = true
+		prev, found := byHash[link.PrevHash]
+		if !found || prev.Index != link.Index-1 {
+			return
+		}
+		link = prev
+	}
+}
+
+// isAssumedValid reports whether a block is a proven ancestor of the assume-valid block (caller must hold the lock)
+func (bc *Blockchain) isAssumedValid(block *chain.Block) bool {
+	return bc.assumeValid.Hash != "" &&
+		block.Index <= bc.assumeValid.Height &&
+		bc.assumeValidAncestors[block.Hash]
+}
+
+// validateSyncedBlock validates a block received from a peer (caller must hold the lock)
+// The block must match its own hash and the checkpoints. Signature checks are
+// skipped for ancestors of the assume-valid block.
+func (bc *Blockchain) validateSyncedBlock(block *chain.Block) error {
+	if block.CalculateHash() != block.Hash {
+		return fmt.Errorf("block hash mismatch")
+	}
+	if err := chain.ValidateAgainstCheckpoints(bc.checkpoints, block.Index, block.Hash); err != nil {
+		return err
+	}
+
+	params := bc.paramsAt(block.Index)
+	if bc.isAssumedValid(block) {
+		return block.ValidateBlockAssumeValid(params)
+	}
+	return block.ValidateBlockWithParams(params)
+}
@@ -1,72 +1,88 @@
 package blockchain
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/blindxfish/truthchain/chain"
 	"github.com/blindxfish/truthchain/store"
 	"github.com/blindxfish/truthchain/wallet"
-	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
 )
 
+// BlockAnnouncer announces blocks this node creates to its peers
+type BlockAnnouncer interface {
+	BroadcastBlock(block *chain.Block) error
+}
+
 // Blockchain represents the TruthChain blockchain with persistent storage
 type Blockchain struct {
-	storage       store.Storage
-	stateManager  *chain.StateManager
-	PendingPosts  []chain.Post        `json:"pending_posts"`
-	TransferPool  *chain.TransferPool `json:"transfer_pool"`
-	PostThreshold int                 `json:"post_threshold"` // Number of posts needed to create a block
-	TimeInterval  time.Duration       `json:"time_interval"`  // Time interval for block creation (10 minutes)
-	lastBlockTime time.Time           `json:"last_block_time"`
-	mu            sync.RWMutex        `json:"-"`
+	storage        store.Storage
+	stateManager   *chain.StateManager
+	PostPool       *chain.PostPool      `json:"post_pool"`
+	PendingRewards []chain.UptimeReward `json:"pending_rewards"` // Uptime reward claims awaiting inclusion
+	Mempool        *chain.Mempool       `json:"mempool"`
+	PostThreshold  int                  `json:"post_threshold"` // Number of posts needed to create a block
+	TimeInterval   time.Duration        `json:"time_interval"`  // Time interval for block creation (10 minutes)
+	lastBlockTime  time.Time
+	mu             sync.RWMutex
+	announcements  chan *chain.Block // Blocks this node created, waiting to be announced
+	stateCheck     atomic.Bool       // Set while a state consistency check runs
+
+	// Sync validation
+	networkID            string
+	network              *chain.Network       // Genesis, defaults and rules of the network
+	params               *chain.NetworkParams // Consensus rules of the network by height
+	checkpoints          []chain.Checkpoint   // Blocks the chain must contain
+	assumeValid          chain.Checkpoint     // Ancestors of this block skip signature checks
+	assumeValidAncestors map[string]bool      // Hashes proven to be ancestors of assumeValid
 }
 
 // NewBlockchain creates a new blockchain with persistent storage
 func NewBlockchain(storage store.Storage, postThreshold int, networkID string) (*Blockchain, error) {
+	network, err := chain.GetNetwork(networkID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Validate mainnet rules if using mainnet
 	if err := chain.ValidateMainnetRules(postThreshold, networkID); err != nil {
 		return nil, fmt.Errorf("mainnet validation failed: %w", err)
 	}
 
 	bc := &Blockchain{
-		storage:       storage,
-		stateManager:  chain.NewStateManager(),
-		PendingPosts:  []chain.Post{},
-		TransferPool:  chain.NewTransferPool(),
-		PostThreshold: postThreshold,
-		TimeInterval:  10 * time.Minute, // Create blocks every 10 minutes if no posts
-		lastBlockTime: time.Now(),
+		storage:        storage,
+		stateManager:   chain.NewStateManagerWithStore(storage),
+		PostPool:       chain.NewPostPool(chain.DefaultPostPoolLimits, storage),
+		PendingRewards: []chain.UptimeReward{},
+		Mempool:        chain.NewMempool(chain.DefaultMempoolLimits, storage),
+		PostThreshold:  postThreshold,
+		TimeInterval:   chain.HeartbeatInterval, // Create blocks every 10 minutes if no posts
+		lastBlockTime:  time.Now(),
+
+		networkID:            networkID,
+		network:              network,
+		params:               network.Params(),
+		checkpoints:          chain.Checkpoints(networkID),
+		assumeValidAncestors: make(map[string]bool),
+	}
+	if err := bc.params.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid consensus params for %s: %w", networkID, err)
+	}
+	if assumeValid, exists := chain.DefaultAssumeValid(networkID); exists {
+		bc.assumeValid = assumeValid
 	}
 
 	// Bitcoin-style approach: Check for existing blockchain
-	_, err := storage.GetLatestBlock()
-	if err != nil {
-		// No blocks exist - check if this node has genesis authority
-		authority, authErr := chain.ValidateGenesisAuthority()
-		if authErr != nil {
-			// No authority - this node must sync from trusted peers
-			log.Printf("No blockchain found - will sync from trusted peers for network: %s", networkID)
-			log.Printf("Genesis authority not found - node must sync from mainnet.truth-chain.org")
-		} else {
-			// Has authority - create the genesis block
-			log.Printf("Genesis authority found - creating authorized genesis block")
-			genesis, err := chain.CreateAuthorizedGenesisBlock(authority)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create authorized genesis block: %w", err)
-			}
-
-			// Save the genesis block
-			if err := storage.SaveBlock(genesis); err != nil {
-				return nil, fmt.Errorf("failed to save genesis block: %w", err)
-			}
-
-			log.Printf("✅ Created authorized genesis block for network: %s", networkID)
-			log.Printf("🎉 Genesis authority confirmed - chain started successfully")
+	_, err = storage.GetLatestBlock()
+	if err != nil {
+		if err := bc.createGenesis(); err != nil {
+			return nil, err
 		}
 	} else {
 		// Genesis block exists - validate it's the canonical one
@@ -76,31 +92,82 @@ func NewBlockchain(storage store.Storage, postThreshold int, networkID string) (
 		}
 
 		// Enforce canonical genesis validation
-		if err := chain.ValidateCanonicalGenesis(genesis); err != nil {
+		if err := network.ValidateStoredGenesis(genesis); err != nil {
 			return nil, fmt.Errorf("invalid genesis block: %w", err)
 		}
 
 		log.Printf("Validated canonical genesis block for network: %s", networkID)
 	}
 
-	// Load pending posts from storage
-	pendingPosts, err := storage.GetPendingPosts()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load pending posts: %w", err)
-	}
-	bc.PendingPosts = pendingPosts
-
 	// Initialize state from latest block
 	if err := bc.initializeState(); err != nil {
 		return nil, fmt.Errorf("failed to initialize state: %w", err)
 	}
 
-	// Start background goroutine for time-based block creation
-	go bc.timeBasedBlockLoop()
+	// Reload pending transfers that still fit the state
+	loaded, err := bc.Mempool.Load(bc.stateManager.GetNonce, bc.checkTransfer)
+	if err != nil {
+		return nil, err
+	}
+	if loaded > 0 {
+		log.Printf("Loaded %d pending transfers", loaded)
+	}
+
+	// Reload pending posts the authors can still pay for on top of those transfers
+	loaded, err = bc.PostPool.Load(bc.checkPendingPost)
+	if err != nil {
+		return nil, err
+	}
+	if loaded > 0 {
+		log.Printf("Loaded %d pending posts", loaded)
+	}
+
+	// Start background goroutine for time-based block creation (regtest creates blocks on demand)
+	if !network.IsRegtest() {
+		go bc.timeBasedBlockLoop()
+	}
 
 	return bc, nil
 }
 
+// createGenesis starts an empty chain with the network's genesis block
+// A signed genesis network's block is imported from the file written by the
+// genesis CLI, or synced from peers. Test networks have a fixed genesis block
+// every node creates for itself.
+func (bc *Blockchain) createGenesis() error {
+	if bc.network.GenesisAuthority == "" {
+		if err := bc.storage.SaveBlock(bc.network.GenesisBlock()); err != nil {
+			return fmt.Errorf("failed to save genesis block: %w", err)
+		}
+		log.Printf("Created genesis block for network: %s", bc.networkID)
+		return nil
+	}
+
+	// No blocks exist - import the signed genesis block if one was provided
+	if _, err := os.Stat(chain.GenesisBlockFile); err != nil {
+		// No genesis file - this node must sync from trusted peers
+		log.Printf("No blockchain found - will sync from trusted peers for network: %s", bc.networkID)
+		log.Printf("No signed genesis block found - node must sync from %s", strings.Join(bc.network.Bootstrap, ", "))
+		return nil
+	}
+
+	genesis, err := chain.LoadGenesisBlock(chain.GenesisBlockFile)
+	if err != nil {
+		return err
+	}
+	if err := bc.network.ValidateGenesis(genesis); err != nil {
+		return fmt.Errorf("invalid genesis block in %s: %w", chain.GenesisBlockFile, err)
+	}
+
+	// Save the genesis block
+	if err := bc.storage.SaveBlock(genesis); err != nil {
+		return fmt.Errorf("failed to save genesis block: %w", err)
+	}
+
+	log.Printf("✅ Imported signed genesis block for network: %s", bc.networkID)
+	return nil
+}
+
 // initializeState loads the current state from the latest block
 func (bc *Blockchain) initializeState() error {
 	latestBlock, err := bc.storage.GetLatestBlock()
@@ -112,7 +179,7 @@ func (bc *Blockchain) initializeState() error {
 
 	// Load state from the latest block's state root
 	if latestBlock.StateRoot != nil {
-		if err := bc.stateManager.LoadStateFromStateRoot(latestBlock.StateRoot); err != nil {
+		if err := bc.stateManager.LoadStateFromStateRoot(latestBlock.StateRoot, bc.paramsAt(latestBlock.Index)); err != nil {
 			return fmt.Errorf("failed to load state from state root: %w", err)
 		}
 	}
@@ -135,24 +202,114 @@ func (bc *Blockchain) GetBlockByHash(hash string) (*chain.Block, error) {
 	return bc.storage.GetBlockByHash(hash)
 }
 
+// GetPostProof returns the inclusion proof of a post in the current chain
+func (bc *Blockchain) GetPostProof(postHash string) (*chain.PostProof, error) {
+	// Hold the read lock so a reorg cannot move the post between lookups
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	index, err := bc.storage.GetPostBlockIndex(postHash)
+	if err != nil {
+		return nil, fmt.Errorf("post not found in chain: %w", err)
+	}
+	block, err := bc.storage.GetBlock(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d: %w", index, err)
+	}
+	proof, err := block.PostInclusionProof(postHash)
+	if err != nil {
+		return nil, err
+	}
+	length, err := bc.storage.GetBlockCount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain length: %w", err)
+	}
+
+	return &chain.PostProof{
+		PostHash:      postHash,
+		Header:        block.Header(),
+		Proof:         proof,
+		Confirmations: length - block.Index,
+	}, nil
+}
+
+// GetWalletProof returns a wallet's state after the block at height with a proof against that block's header
+// A negative height proves against the latest block. The proof holds a nil wallet
+// state if the address had no state at that height.
+func (bc *Blockchain) GetWalletProof(address string, height int) (*chain.WalletProof, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var block *chain.Block
+	var err error
+	if height < 0 {
+		block, err = bc.storage.GetLatestBlock()
+	} else {
+		block, err = bc.storage.GetBlock(height)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d: %w", height, err)
+	}
+	if block.Index == 0 || block.StateRoot == nil || !bc.paramsAt(block.Index).StateTree {
+		return nil, fmt.Errorf("block %d has no state tree", block.Index)
+	}
+
+	state, proof, err := bc.stateManager.ProveWalletState(block.StateRoot, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chain.WalletProof{
+		Address: address,
+		Wallet:  state,
+		Header:  block.Header(),
+		Proof:   proof,
+	}, nil
+}
+
 // GetPendingCharacterCount returns the total characters in pending posts
 func (bc *Blockchain) GetPendingCharacterCount() int {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
+	params := bc.paramsAt(bc.nextBlockHeight())
 	count := 0
-	for _, post := range bc.PendingPosts {
-		count += post.GetCharacterCount()
+	for _, post := range bc.PostPool.Pending() {
+		count += post.GetCharacterCount(params)
 	}
 	return count
 }
 
+// paramsAt returns the consensus rules for the block at height
+// Networks that leave the post count open use the node's post threshold.
+func (bc *Blockchain) paramsAt(height int) chain.ConsensusParams {
+	params := bc.params.ParamsAt(height)
+	if params.PostsPerBlock == 0 {
+		params.PostsPerBlock = bc.PostThreshold
+	}
+	return params
+}
+
+// GetConsensusParams returns the consensus rules for the block at height
+func (bc *Blockchain) GetConsensusParams(height int) chain.ConsensusParams {
+	return bc.paramsAt(height)
+}
+
+// nextBlockHeight returns the height the next block will be created at (caller must hold the lock)
+func (bc *Blockchain) nextBlockHeight() int {
+	latestBlock, err := bc.storage.GetLatestBlock()
+	if err != nil {
+		return 0
+	}
+	return latestBlock.Index + 1
+}
+
 // GetPendingPostCount returns the number of pending posts
 func (bc *Blockchain) GetPendingPostCount() int {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	return len(bc.PendingPosts)
+	return bc.PostPool.Count()
 }
 
 // AddPost adds a post to the pending posts and validates it
@@ -160,20 +317,6 @@ func (bc *Blockchain) AddPost(post chain.Post) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	// Validate the post
-	if err := post.ValidatePost(); err != nil {
-		return fmt.Errorf("invalid post: %w", err)
-	}
-
-	// Verify the signature
-	valid, err := bc.VerifyPostSignature(post)
-	if err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
-	}
-	if !valid {
-		return fmt.Errorf("invalid signature for post")
-	}
-
 	// Set hash if not already set
 	if post.Hash == "" {
 		post.SetHash()
@@ -188,187 +331,406 @@ func (bc *Blockchain) AddPost(post chain.Post) error {
 		return fmt.Errorf("duplicate post: %s", post.Hash)
 	}
 
-	// Check for duplicate posts in pending posts
-	for _, existingPost := range bc.PendingPosts {
-		if existingPost.Hash == post.Hash {
-			return fmt.Errorf("duplicate pending post: %s", post.Hash)
-		}
+	if err := bc.checkPendingPost(post); err != nil {
+		return err
 	}
 
-	// Validate post author has sufficient balance for posting
-	// Posts cost 1 character per character in content
-	postCost := post.GetCharacterCount()
+	// Add to the post pool, which persists it, then save the post itself
+	if err := bc.PostPool.Add(post); err != nil {
+		return err
+	}
+	if err := bc.storage.SavePost(post); err != nil {
+		bc.PostPool.Remove(post.Hash)
+		return fmt.Errorf("failed to save post: %w", err)
+	}
 
-	// Check effective balance (considering pending transfers)
-	pendingTransfers := bc.TransferPool.GetTransfers()
-	effectiveBalance := bc.stateManager.GetEffectiveBalance(post.Author, pendingTransfers)
+	// Regtest blocks are only created on demand
+	params := bc.paramsAt(bc.nextBlockHeight())
+	if params.Regtest {
+		return nil
+	}
 
-	if effectiveBalance < postCost {
-		return fmt.Errorf("insufficient balance for post: %d characters needed, effective balance: %d", postCost, effectiveBalance)
+	// Check if the pending posts close a block
+	if bc.postBlockDue(params) {
+		return bc.createBlockFromPending()
 	}
 
-	// Save post to storage
-	if err := bc.storage.SavePost(post); err != nil {
-		return fmt.Errorf("failed to save post: %w", err)
+	return nil
+}
+
+// postBlockDue reports whether the pending posts close a block under params (caller must hold the lock)
+// Before the block budget a block closes at PostsPerBlock posts; after it, once the
+// posts fill the budget or the oldest has waited MainnetMaxWait.
+func (bc *Blockchain) postBlockDue(params chain.ConsensusParams) bool {
+	if !params.BlockBudget {
+		return bc.PostPool.Count() >= params.PostsPerBlock
 	}
 
-	// Save to pending posts storage
-	if err := bc.storage.SavePendingPost(post); err != nil {
-		return fmt.Errorf("failed to save pending post: %w", err)
+	oldest := bc.PostPool.Oldest(1)
+	if len(oldest) == 0 {
+		return false
+	}
+	if _, full := bc.PostPool.Assemble(params, chain.PostByteBudget(nil, nil), chain.CharacterThreshold); full {
+		return true
 	}
+	return time.Now().Unix()-oldest[0].Timestamp >= int64(chain.MainnetMaxWait.Seconds())
+}
 
-	// Add to pending posts
-	bc.PendingPosts = append(bc.PendingPosts, post)
+// blockPosts returns the oldest pending posts a block takes next to its transfers and rewards (caller must hold the lock)
+// Before the block budget a block takes exactly PostsPerBlock posts.
+func (bc *Blockchain) blockPosts(params chain.ConsensusParams, transfers []chain.Transfer, rewards []chain.UptimeReward) []chain.Post {
+	if !params.BlockBudget {
+		return bc.PostPool.Oldest(params.PostsPerBlock)
+	}
+	posts, _ := bc.PostPool.Assemble(params, chain.PostByteBudget(transfers, rewards), chain.CharacterThreshold)
+	return posts
+}
 
-	// Check if we should create a new block based on post count or time
-	if len(bc.PendingPosts) >= bc.PostThreshold {
-		return bc.createBlockFromPending()
+// checkPendingPost validates a post for the next block and reserves its cost (caller must hold the lock)
+// The author's balance must cover it on top of all their waiting posts and transfers.
+func (bc *Blockchain) checkPendingPost(post chain.Post) error {
+	// Validate the post
+	if err := post.ValidatePost(); err != nil {
+		return fmt.Errorf("invalid post: %w", err)
+	}
+
+	// Check the post against the rules of the block it will go into
+	params := bc.paramsAt(bc.nextBlockHeight())
+	if err := post.ValidateRules(params); err != nil {
+		return fmt.Errorf("invalid post: %w", err)
+	}
+
+	// Only NFC text is accepted so every node counts the same characters
+	if err := chain.ValidateContentEncoding(post.Content); err != nil {
+		return fmt.Errorf("invalid post: %w", err)
+	}
+
+	// Only authors with an address of this network can pay for posts here
+	if !wallet.ValidateAddressWithVersion(post.Author, params.AddressVersion) {
+		return fmt.Errorf("invalid post: author %s is not an address of %s", post.Author, bc.networkID)
+	}
+
+	// Verify the signature
+	valid, err := bc.VerifyPostSignature(post)
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature for post")
 	}
 
-	// Check if we should create a block based on time interval
-	if bc.shouldCreateTimeBasedBlock() {
-		return bc.createTimeBasedBlock()
+	// The hash must commit to the signed post
+	if post.Hash != post.CalculateHash() {
+		return fmt.Errorf("invalid post: hash mismatch")
+	}
+
+	return bc.reservePost(post, params)
+}
+
+// reservePost checks that a post is not in a block yet and its author can pay for it (caller must hold the lock)
+func (bc *Blockchain) reservePost(post chain.Post, params chain.ConsensusParams) error {
+	if _, err := bc.storage.GetPostBlockIndex(post.Hash); err == nil {
+		return fmt.Errorf("duplicate post: %s is already in a block", post.Hash)
+	}
+
+	// Posts cost 1 character per character in content, counted as the next block will
+	postCost := post.GetCharacterCount(params)
+	if available := bc.availableBalance(post.Author, params, -1); available < postCost {
+		return fmt.Errorf("insufficient balance for post: %d characters needed, %d available after pending posts and transfers", postCost, available)
 	}
 
 	return nil
 }
 
+// availableBalance returns what an address can still spend once its waiting posts and transfers are paid (caller must hold the lock)
+// The waiting transfer with nonce replacedNonce is left out, since it is being replaced.
+func (bc *Blockchain) availableBalance(address string, params chain.ConsensusParams, replacedNonce int64) int {
+	pendingTransfers := make([]chain.Transfer, 0)
+	for _, pending := range bc.Mempool.Pending() {
+		if pending.From == address && pending.Nonce == replacedNonce {
+			continue
+		}
+		pendingTransfers = append(pendingTransfers, pending)
+	}
+	return bc.stateManager.GetEffectiveBalance(address, pendingTransfers) - bc.PostPool.Cost(address, params)
+}
+
 // CreatePost creates a new post from content and wallet
 func (bc *Blockchain) CreatePost(content string, w *wallet.Wallet) (*chain.Post, error) {
 	if content == "" {
 		return nil, fmt.Errorf("post content cannot be empty")
 	}
 
-	// Create post data
-	postData := fmt.Sprintf("%s%s%d", w.GetAddress(), content, time.Now().Unix())
+	// Sign the normalized form so the post is accepted by every node
+	content = chain.NormalizeContent(content)
 
-	// Sign the post data
-	signature, err := w.Sign([]byte(postData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to sign post: %w", err)
-	}
-
-	// Create post
+	// Create post in the encoding of the block it will go into
 	post := chain.Post{
 		Author:    w.GetAddress(),
-		Signature: hex.EncodeToString(signature),
 		Content:   content,
 		Timestamp: time.Now().Unix(),
+		Version:   bc.paramsAt(bc.nextBlockHeight()).Encoding,
 	}
 
-	// Set hash
-	post.SetHash()
+	// Sign for this network and set the hash
+	if err := post.Sign(w, bc.networkID); err != nil {
+		return nil, err
+	}
 
 	return &post, nil
 }
 
-// VerifyPostSignature verifies a post's signature and validates authorship
+// VerifyPostSignature verifies a post's signature for this network and validates authorship
 func (bc *Blockchain) VerifyPostSignature(post chain.Post) (bool, error) {
-	message := fmt.Sprintf("%s%s%d", post.Author, post.Content, post.Timestamp)
-	hash := sha256.Sum256([]byte(message))
-
-	signatureBytes, err := hex.DecodeString(post.Signature)
-	if err != nil {
+	if _, err := hex.DecodeString(post.Signature); err != nil {
 		return false, fmt.Errorf("invalid signature encoding: %w", err)
 	}
-
-	// Recover public key
-	pubKey, wasCompressed, err := ecdsa.RecoverCompact(signatureBytes, hash[:])
-	if err != nil {
-		return false, fmt.Errorf("signature recovery failed: %w", err)
-	}
-
-	if !wasCompressed {
-		return false, fmt.Errorf("signature must be compressed format")
-	}
-
-	// Derive address from recovered public key
-	derivedAddress := wallet.DeriveAddress(pubKey)
-
-	// Compare with post.Author
-	if derivedAddress != post.Author {
-		return false, fmt.Errorf("address mismatch: expected %s, got %s", post.Author, derivedAddress)
+	if err := post.VerifySignature(bc.networkID); err != nil {
+		return false, err
 	}
-
-	// All good
 	return true, nil
 }
 
 // createBlockFromPending creates a new block from pending posts and saves to storage
 func (bc *Blockchain) createBlockFromPending() error {
-	if len(bc.PendingPosts) == 0 {
-		return fmt.Errorf("no pending posts to create block")
-	}
-
 	// Get the latest block from storage
 	latestBlock, err := bc.storage.GetLatestBlock()
 	if err != nil {
 		return fmt.Errorf("failed to get latest block: %w", err)
 	}
 
-	// Get pending transfers
-	pendingTransfers := bc.TransferPool.GetTransfers()
+	// Take the best paying transfers whose nonces follow their senders' state
+	params := bc.paramsAt(latestBlock.Index + 1)
+	pendingTransfers := bc.Mempool.Ready(bc.stateManager.GetNonce, chain.MaxBlockTransferBytes)
 
-	// Apply pending transfers to state
-	for _, transfer := range pendingTransfers {
-		if err := bc.stateManager.ApplyTransfer(transfer); err != nil {
-			return fmt.Errorf("failed to apply transfer %s: %w", transfer.Hash, err)
-		}
-	}
+	// Price pending uptime rewards at the block's timestamp
+	timestamp := time.Now().Unix()
+	rewards := bc.collectPendingRewards(timestamp)
 
-	// Apply post costs to state
-	for _, post := range bc.PendingPosts {
-		postCost := post.GetCharacterCount()
-		currentBalance, err := bc.storage.GetCharacterBalance(post.Author)
-		if err != nil {
-			return fmt.Errorf("failed to get balance for %s: %w", post.Author, err)
-		}
-
-		// Deduct post cost
-		if err := bc.storage.UpdateCharacterBalance(post.Author, -postCost); err != nil {
-			return fmt.Errorf("failed to deduct post cost for %s: %w", post.Author, err)
-		}
-
-		// Update state manager
-		bc.stateManager.UpdateWalletState(post.Author, currentBalance-postCost, 0)
+	// Take the oldest posts, as many as the block has room for
+	pendingPosts := bc.blockPosts(params, pendingTransfers, rewards)
+	if len(pendingPosts) == 0 {
+		return fmt.Errorf("no pending posts to create block")
 	}
 
-	// Calculate new state root
-	newStateRoot := bc.stateManager.CalculateStateRoot(latestBlock.Index + 1)
-
-	// Create new block
-	newBlock := chain.CreateBlock(
+	// Create new block under the rules of its height and commit its state
+	newBlock := chain.CreateBlockWithRewards(
+		params,
 		latestBlock.Index+1,
 		latestBlock.Hash,
-		bc.PendingPosts,
+		pendingPosts,
 		pendingTransfers,
-		newStateRoot,
+		rewards,
+		nil,
 	)
+	newBlock.Timestamp = timestamp
+	if err := bc.sealBlock(newBlock, latestBlock); err != nil {
+		return err
+	}
 
-	// Validate the new block with post threshold rules
-	if err := newBlock.ValidateBlockWithThreshold(bc.PostThreshold); err != nil {
+	// Validate the new block with the post count rules
+	if err := newBlock.ValidateBlockWithParams(params); err != nil {
+		bc.discardBlockState(latestBlock)
 		return fmt.Errorf("invalid block: %w", err)
 	}
 
 	// Save block to storage
 	if err := bc.storage.SaveBlock(newBlock); err != nil {
+		bc.discardBlockState(latestBlock)
 		return fmt.Errorf("failed to save block: %w", err)
 	}
 
-	// Clear pending posts from storage
-	if err := bc.storage.ClearPendingPosts(); err != nil {
-		return fmt.Errorf("failed to clear pending posts: %w", err)
+	// Drop the posts and transfers the block confirmed and clear minted rewards
+	bc.pruneMempools(newBlock)
+	bc.PendingRewards = []chain.UptimeReward{}
+	bc.announceBlock(newBlock)
+
+	return nil
+}
+
+// SetBlockAnnouncer sets where blocks this node creates are announced
+// Blocks are handed over in order from a background goroutine, so creating a block
+// never waits on the network. Set it once, before blocks are created.
+func (bc *Blockchain) SetBlockAnnouncer(announcer BlockAnnouncer) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	announcements := make(chan *chain.Block, MaxGenerateBlocks)
+	bc.announcements = announcements
+	go func() {
+		for block := range announcements {
+			if err := announcer.BroadcastBlock(block); err != nil {
+				log.Printf("Failed to announce block %d: %v", block.Index, err)
+			}
+		}
+	}()
+}
+
+// announceBlock queues a block this node created for announcement (caller must hold the lock)
+// Peers that miss an announcement still get the block through sync.
+func (bc *Blockchain) announceBlock(block *chain.Block) {
+	if bc.announcements == nil {
+		return
+	}
+	select {
+	case bc.announcements <- block:
+	default:
+		log.Printf("Announcement queue full, block %d left to sync", block.Index)
+	}
+}
+
+// SubmitUptimeReward queues an uptime reward claim for inclusion in the next block
+func (bc *Blockchain) SubmitUptimeReward(reward chain.UptimeReward) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	// Check the heartbeat evidence before accepting the claim
+	if err := reward.ValidateEvidence(); err != nil {
+		return fmt.Errorf("invalid reward claim: %w", err)
+	}
+	if err := reward.ValidateAnchors(bc.chainBlockAt(bc.nextBlockHeight(), nil)); err != nil {
+		return fmt.Errorf("invalid reward claim: %w", err)
+	}
+
+	// Enforce the per-node reward interval against current state
+	if err := bc.stateManager.ValidateReward(reward); err != nil {
+		return fmt.Errorf("reward claim rejected: %w", err)
+	}
+
+	// Keep only the latest claim per recipient
+	for i, pending := range bc.PendingRewards {
+		if pending.Recipient == reward.Recipient {
+			bc.PendingRewards[i] = reward
+			return nil
+		}
+	}
+
+	bc.PendingRewards = append(bc.PendingRewards, reward)
+	return nil
+}
+
+// collectPendingRewards prices the reward claims still valid for a block at timestamp by the emission schedule
+func (bc *Blockchain) collectPendingRewards(timestamp int64) []chain.UptimeReward {
+	maxAge := int64(chain.RewardClaimTTL.Seconds())
+	height := bc.nextBlockHeight()
+	params := bc.paramsAt(height)
+
+	// Drop expired claims and claims that are no longer valid against the rules, the chain or state
+	var rewards []chain.UptimeReward
+	var recipients []string
+	for _, reward := range bc.PendingRewards {
+		if timestamp-reward.Timestamp > maxAge {
+			continue
+		}
+		if err := reward.ValidateRules(params); err != nil {
+			log.Printf("Dropping reward claim for %s: %v", reward.Recipient, err)
+			continue
+		}
+		if err := reward.ValidateAnchors(bc.chainBlockAt(height, nil)); err != nil {
+			log.Printf("Dropping reward claim for %s: %v", reward.Recipient, err)
+			continue
+		}
+		if err := bc.stateManager.ValidateReward(reward); err != nil {
+			log.Printf("Dropping reward claim for %s: %v", reward.Recipient, err)
+			continue
+		}
+		rewards = append(rewards, reward)
+		recipients = append(recipients, reward.Recipient)
+	}
+
+	// Every entry in a block is minted the same per-batch amount, hashed in the block's encoding
+	amount := bc.stateManager.RewardAmount(recipients, timestamp)
+	for i := range rewards {
+		rewards[i].Amount = amount
+		rewards[i].Version = params.Encoding
+		rewards[i].SetHash()
 	}
 
-	// Clear transfer pool
-	bc.TransferPool.ClearPool()
+	return rewards
+}
+
+// HeartbeatAnchor returns the block new uptime heartbeats are anchored to
+// It is the chain tip, or false while the next block still takes unanchored heartbeats.
+func (bc *Blockchain) HeartbeatAnchor() (int, string, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	latestBlock, err := bc.storage.GetLatestBlock()
+	if err != nil || bc.paramsAt(latestBlock.Index+1).Encoding < chain.EncodingCanonical {
+		return 0, "", false
+	}
+	return latestBlock.Index, latestBlock.Hash, true
+}
 
-	// Clear pending posts
-	bc.PendingPosts = []chain.Post{}
+// chainBlockAt returns a lookup of the blocks below height on a chain (caller must hold the lock)
+// The chain is the stored one, with the unstored blocks of branch replacing stored
+// blocks from the branch's first index on.
+func (bc *Blockchain) chainBlockAt(height int, branch []*chain.Block) func(int) (*chain.Block, error) {
+	return func(index int) (*chain.Block, error) {
+		if index < 0 || index >= height {
+			return nil, fmt.Errorf("block %d is not below block %d", index, height)
+		}
+		if len(branch) > 0 && index >= branch[0].Index {
+			return branch[index-branch[0].Index], nil
+		}
+		return bc.storage.GetBlock(index)
+	}
+}
 
+// checkRewardAnchors checks the heartbeat anchors of a block's rewards against the chain below it (caller must hold the lock)
+func (bc *Blockchain) checkRewardAnchors(block *chain.Block, branch []*chain.Block) error {
+	blockAt := bc.chainBlockAt(block.Index, branch)
+	for i, reward := range block.Rewards {
+		if err := reward.ValidateAnchors(blockAt); err != nil {
+			return fmt.Errorf("invalid reward %d: %w", i, err)
+		}
+	}
 	return nil
 }
 
+// sealBlock applies a new block to the state, then sets its state root and hash (caller must hold the lock)
+func (bc *Blockchain) sealBlock(block *chain.Block, parent *chain.Block) error {
+	stateRoot, err := bc.executeBlock(block, parent)
+	if err != nil {
+		return fmt.Errorf("failed to apply block %d: %w", block.Index, err)
+	}
+
+	block.StateRoot = stateRoot
+	block.SetHash()
+	return nil
+}
+
+// executeBlock applies a block on top of its parent's state and commits the result (caller must hold the lock)
+// Nothing is left applied if the block is invalid against the state.
+func (bc *Blockchain) executeBlock(block *chain.Block, parent *chain.Block) (*chain.StateRoot, error) {
+	stateRoot, err := bc.applyBlockState(bc.stateManager, block, nil)
+	if err != nil {
+		bc.discardBlockState(parent)
+		return nil, err
+	}
+	return stateRoot, nil
+}
+
+// applyBlockState applies a block to state holding its parent's state and returns the resulting root
+// branch holds the unstored blocks below it during a reorg.
+func (bc *Blockchain) applyBlockState(state *chain.StateManager, block *chain.Block, branch []*chain.Block) (*chain.StateRoot, error) {
+	params := bc.paramsAt(block.Index)
+	if err := block.ValidateAfter(bc.chainBlockAt(block.Index, branch), time.Now().Unix(), params); err != nil {
+		return nil, err
+	}
+	if err := state.ApplyBlock(block, params); err != nil {
+		return nil, err
+	}
+	return state.CalculateStateRoot(block.Index, params)
+}
+
+// discardBlockState drops state applied on top of parent (caller must hold the lock)
+func (bc *Blockchain) discardBlockState(parent *chain.Block) {
+	if err := bc.loadStateFromBlock(parent); err != nil {
+		log.Printf("Failed to restore state of block %d: %v", parent.Index, err)
+	}
+}
+
 // ForceCreateBlock forces the creation of a block from pending posts
 func (bc *Blockchain) ForceCreateBlock() error {
 	bc.mu.Lock()
@@ -422,7 +784,7 @@ func (bc *Blockchain) GetTotalPostCount() (int, error) {
 
 // ValidateBlock validates a single block with post threshold rules
 func (bc *Blockchain) ValidateBlock(block *chain.Block) error {
-	return block.ValidateBlockWithThreshold(bc.PostThreshold)
+	return block.ValidateBlockWithParams(bc.paramsAt(block.Index))
 }
 
 // ValidateChain validates the entire blockchain from storage
@@ -444,7 +806,7 @@ func (bc *Blockchain) ValidateChain() error {
 		}
 
 		// Use enhanced validation with post threshold rules
-		if err := block.ValidateBlockWithThreshold(bc.PostThreshold); err != nil {
+		if err := block.ValidateBlockWithParams(bc.paramsAt(block.Index)); err != nil {
 			return fmt.Errorf("invalid block at index %d: %w", i, err)
 		}
 
@@ -462,6 +824,9 @@ func (bc *Blockchain) ValidateChain() error {
 			if block.PrevHash != prevBlock.Hash {
 				return fmt.Errorf("previous hash mismatch at block %d", i)
 			}
+			if err := block.ValidateAfter(bc.chainBlockAt(i, nil), time.Now().Unix(), bc.paramsAt(block.Index)); err != nil {
+				return fmt.Errorf("invalid block at index %d: %w", i, err)
+			}
 		}
 
 		// Check block hash
@@ -500,12 +865,15 @@ func (bc *Blockchain) GetBlockchainInfo() (map[string]interface{}, error) {
 	}
 
 	info := map[string]interface{}{
+		"network_id":              bc.networkID,
 		"chain_length":            chainLength,
 		"total_character_count":   totalCharCount,
 		"total_post_count":        totalPostCount,
-		"pending_post_count":      len(bc.PendingPosts),
+		"pending_post_count":      bc.PostPool.Count(),
 		"pending_character_count": bc.GetPendingCharacterCount(),
 		"post_threshold":          bc.PostThreshold,
+		"consensus_params":        bc.paramsAt(latestBlock.Index + 1),
+		"upgrades":                bc.params.Upgrades,
 		"latest_block_index":      latestBlock.Index,
 		"latest_block_hash":       latestBlock.Hash,
 		"latest_block_timestamp":  latestBlock.Timestamp,
@@ -517,18 +885,16 @@ func (bc *Blockchain) GetBlockchainInfo() (map[string]interface{}, error) {
 }
 
 // GetCharacterBalance returns the character balance for an address
+// Balances come only from the state of connected blocks.
 func (bc *Blockchain) GetCharacterBalance(address string) (int, error) {
-	return bc.storage.GetCharacterBalance(address)
-}
-
-// UpdateCharacterBalance updates the character balance for an address
-func (bc *Blockchain) UpdateCharacterBalance(address string, amount int) error {
-	return bc.storage.UpdateCharacterBalance(address, amount)
-}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 
-// UpdateWalletState updates the wallet state in the state manager
-func (bc *Blockchain) UpdateWalletState(address string, balance int, nonce int64) {
-	bc.stateManager.UpdateWalletState(address, balance, nonce)
+	wallet, exists := bc.stateManager.GetWalletState(address)
+	if !exists {
+		return 0, nil
+	}
+	return wallet.Balance, nil
 }
 
 // Close closes the storage connection
@@ -541,9 +907,7 @@ func (bc *Blockchain) GetPendingPosts() []chain.Post {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	posts := make([]chain.Post, len(bc.PendingPosts))
-	copy(posts, bc.PendingPosts)
-	return posts
+	return bc.PostPool.Pending()
 }
 
 // GetPendingPostByHash returns a specific pending post by hash
@@ -551,14 +915,11 @@ func (bc *Blockchain) GetPendingPostByHash(hash string) *chain.Post {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	for _, post := range bc.PendingPosts {
-		if post.Hash == hash {
-			// Return a copy to avoid race conditions
-			postCopy := post
-			return &postCopy
-		}
+	post, exists := bc.PostPool.Get(hash)
+	if !exists {
+		return nil
 	}
-	return nil
+	return &post
 }
 
 // RemovePendingPost removes a post from the pending pool (for editing/deletion)
@@ -566,47 +927,50 @@ func (bc *Blockchain) RemovePendingPost(hash string) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	for i, post := range bc.PendingPosts {
-		if post.Hash == hash {
-			// Remove from pending posts
-			bc.PendingPosts = append(bc.PendingPosts[:i], bc.PendingPosts[i+1:]...)
-			return nil
-		}
-	}
-	return fmt.Errorf("pending post not found: %s", hash)
+	return bc.PostPool.Remove(hash)
 }
 
 // UpdatePendingPost updates a pending post (for editing)
+// The edited post goes to the back of the queue; the original stays if the edit is refused.
 func (bc *Blockchain) UpdatePendingPost(hash string, newContent string, w *wallet.Wallet) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	// Find the post to update
-	for i, post := range bc.PendingPosts {
-		if post.Hash == hash {
-			// Verify the post belongs to this wallet
-			if post.Author != w.GetAddress() {
-				return fmt.Errorf("post does not belong to this wallet")
-			}
-
-			// Create new post with updated content
-			newPost, err := bc.CreatePost(newContent, w)
-			if err != nil {
-				return fmt.Errorf("failed to create updated post: %w", err)
-			}
-
-			// Replace the old post
-			bc.PendingPosts[i] = *newPost
+	// Find the post to update and verify it belongs to this wallet
+	post, exists := bc.PostPool.Get(hash)
+	if !exists {
+		return fmt.Errorf("pending post not found: %s", hash)
+	}
+	if post.Author != w.GetAddress() {
+		return fmt.Errorf("post does not belong to this wallet")
+	}
 
-			// Update in storage
-			if err := bc.storage.SavePost(*newPost); err != nil {
-				return fmt.Errorf("failed to save updated post: %w", err)
-			}
+	// Create new post with updated content
+	newPost, err := bc.CreatePost(newContent, w)
+	if err != nil {
+		return fmt.Errorf("failed to create updated post: %w", err)
+	}
 
-			return nil
+	// Check the edit without the cost of the post it replaces
+	if err := bc.PostPool.Remove(hash); err != nil {
+		return err
+	}
+	if err := bc.checkPendingPost(*newPost); err != nil {
+		if restoreErr := bc.PostPool.Add(post); restoreErr != nil {
+			log.Printf("Failed to restore pending post %s: %v", hash, restoreErr)
 		}
+		return err
 	}
-	return fmt.Errorf("pending post not found: %s", hash)
+
+	// Queue the edit and update storage
+	if err := bc.PostPool.Add(*newPost); err != nil {
+		return err
+	}
+	if err := bc.storage.SavePost(*newPost); err != nil {
+		bc.PostPool.Remove(newPost.Hash)
+		return fmt.Errorf("failed to save updated post: %w", err)
+	}
+	return nil
 }
 
 // GetMempoolInfo returns information about the mempool
@@ -614,25 +978,27 @@ func (bc *Blockchain) GetMempoolInfo() map[string]interface{} {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
+	pendingPosts := bc.PostPool.Pending()
 	info := map[string]interface{}{
-		"pending_post_count":      len(bc.PendingPosts),
+		"pending_post_count":      len(pendingPosts),
 		"pending_character_count": 0,
 		"post_threshold":          bc.PostThreshold,
 		"posts":                   []map[string]interface{}{},
 	}
 
 	// Calculate character count and build post list
+	params := bc.paramsAt(bc.nextBlockHeight())
 	charCount := 0
-	posts := make([]map[string]interface{}, len(bc.PendingPosts))
+	posts := make([]map[string]interface{}, len(pendingPosts))
 
-	for i, post := range bc.PendingPosts {
-		charCount += post.GetCharacterCount()
+	for i, post := range pendingPosts {
+		charCount += post.GetCharacterCount(params)
 		posts[i] = map[string]interface{}{
 			"hash":       post.Hash,
 			"author":     post.Author,
 			"content":    post.Content,
 			"timestamp":  post.Timestamp,
-			"characters": post.GetCharacterCount(),
+			"characters": post.GetCharacterCount(params),
 		}
 	}
 
@@ -642,105 +1008,101 @@ func (bc *Blockchain) GetMempoolInfo() map[string]interface{} {
 	return info
 }
 
-// CreateTransfer creates a new signed transfer transaction
+// CreateTransfer creates a new signed transfer transaction paying the gas fee
 func (bc *Blockchain) CreateTransfer(to string, amount int, w *wallet.Wallet) (*chain.Transfer, error) {
-	// Get next nonce for the sender
-	nonce := bc.stateManager.GetNextNonce(w.GetAddress())
-
-	// Create transfer without signature first
-	transfer := &chain.Transfer{
-		From:      w.GetAddress(),
-		To:        to,
-		Amount:    amount,
-		GasFee:    1, // Fixed 1 character gas fee
-		Timestamp: time.Now().Unix(),
-		Nonce:     nonce,
-	}
+	return bc.CreateTransferWithFee(to, amount, bc.paramsAt(bc.nextBlockHeight()).GasFee, w)
+}
 
-	// Calculate hash
-	hash, err := transfer.CalculateHash()
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate transfer hash: %w", err)
-	}
-	transfer.Hash = hash
+// CreateTransferWithFee creates a new signed transfer transaction paying fee
+func (bc *Blockchain) CreateTransferWithFee(to string, amount int, fee int, w *wallet.Wallet) (*chain.Transfer, error) {
+	// Get next nonce for the sender, after any transfers it already has waiting
+	nonce := bc.GetNextNonce(w.GetAddress())
 
-	// Sign the transfer using wallet's signing method
-	// Note: w.Sign() already hashes the data, so we pass the raw transfer data
-	transferData := fmt.Sprintf("%s:%s:%d:%d:%d:%d", transfer.From, transfer.To, transfer.Amount, transfer.GasFee, transfer.Timestamp, transfer.Nonce)
-	signatureBytes, err := w.Sign([]byte(transferData))
+	transfer, err := chain.NewTransferWithFee(bc.paramsAt(bc.nextBlockHeight()), w, to, amount, fee, nonce)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign transfer: %w", err)
+		return nil, fmt.Errorf("failed to create transfer: %w", err)
 	}
-
-	transfer.Signature = hex.EncodeToString(signatureBytes)
-
 	return transfer, nil
 }
 
-// AddTransfer adds a transfer to the pool
+// AddTransfer adds a transfer to the mempool
+// A transfer with the nonce of a waiting one replaces it if it pays a higher fee.
 func (bc *Blockchain) AddTransfer(transfer chain.Transfer) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	// Validate transfer
-	if err := transfer.Validate(); err != nil {
+	if err := bc.checkTransfer(transfer); err != nil {
+		return err
+	}
+
+	if err := bc.Mempool.Add(transfer, bc.stateManager.GetNonce(transfer.From)); err != nil {
+		return fmt.Errorf("failed to add transfer to pool: %w", err)
+	}
+
+	return nil
+}
+
+// checkTransfer validates a transfer against the next block's rules and the state (caller must hold the lock)
+// The sender's balance must cover it on top of its waiting posts and other waiting
+// transfers, not counting one it would replace.
+func (bc *Blockchain) checkTransfer(transfer chain.Transfer) error {
+	params := bc.paramsAt(bc.nextBlockHeight())
+	if err := transfer.ValidateRules(params); err != nil {
 		return fmt.Errorf("invalid transfer: %w", err)
 	}
 
-	// Validate against current state
-	pendingTransfers := bc.TransferPool.GetTransfers()
-	if err := bc.stateManager.ValidateTransfer(transfer, pendingTransfers); err != nil {
+	if err := bc.stateManager.ValidateTransfer(transfer, nil); err != nil {
 		return fmt.Errorf("transfer validation failed: %w", err)
 	}
-
-	// Add to transfer pool
-	if err := bc.TransferPool.AddTransfer(transfer); err != nil {
-		return fmt.Errorf("failed to add transfer to pool: %w", err)
+	if available := bc.availableBalance(transfer.From, params, transfer.Nonce); available < transfer.GetTotalCost() {
+		return fmt.Errorf("transfer validation failed: insufficient balance: %d available after pending posts and transfers, need %d", available, transfer.GetTotalCost())
 	}
 
 	return nil
 }
 
-// ProcessTransfers processes all transfers in the pool
-func (bc *Blockchain) ProcessTransfers() error {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
-
-	transfers := bc.TransferPool.GetTransfers()
-	if len(transfers) == 0 {
-		return nil // No transfers to process
+// pruneMempools drops the posts and transfers that blocks confirmed and those that expired (caller must hold the lock)
+// Posts the next block's rules no longer allow, such as legacy posts after the canonical encoding, are dropped too.
+func (bc *Blockchain) pruneMempools(blocks ...*chain.Block) {
+	posts := 0
+	for _, block := range blocks {
+		posts += bc.PostPool.RemoveConfirmed(block.Posts)
+	}
+	posts += bc.PostPool.Prune()
+	params := bc.paramsAt(bc.nextBlockHeight())
+	posts += bc.PostPool.Filter(func(post chain.Post) error { return post.ValidateRules(params) })
+	transfers := bc.Mempool.Prune(bc.stateManager.GetNonce)
+	if posts > 0 || transfers > 0 {
+		log.Printf("Pruned %d posts and %d transfers from the mempools", posts, transfers)
 	}
+}
 
-	// Process each transfer
-	for _, transfer := range transfers {
-		// Apply to state manager
-		if err := bc.stateManager.ApplyTransfer(transfer); err != nil {
-			return fmt.Errorf("failed to apply transfer %s: %w", transfer.Hash, err)
-		}
+// GetNextNonce gets the nonce an address's next transfer should use
+// Transfers it already has waiting are counted, so queuing several never leaves a gap.
+func (bc *Blockchain) GetNextNonce(address string) int64 {
+	return bc.Mempool.NextNonce(address, bc.stateManager.GetNonce(address))
+}
 
-		// Update storage
-		if err := bc.storage.UpdateCharacterBalance(transfer.From, -transfer.GetTotalCost()); err != nil {
-			return fmt.Errorf("failed to deduct from sender %s: %w", transfer.From, err)
-		}
+// EstimateFees suggests transfer fees for the next block from the most recent blocks
+func (bc *Blockchain) EstimateFees() (chain.FeeEstimate, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 
-		if err := bc.storage.UpdateCharacterBalance(transfer.To, transfer.Amount); err != nil {
-			// Rollback sender deduction
-			bc.storage.UpdateCharacterBalance(transfer.From, transfer.GetTotalCost())
-			return fmt.Errorf("failed to add to recipient %s: %w", transfer.To, err)
-		}
+	latestBlock, err := bc.storage.GetLatestBlock()
+	if err != nil {
+		return chain.FeeEstimate{}, fmt.Errorf("failed to get latest block: %w", err)
+	}
 
-		// Remove from pool
-		if err := bc.TransferPool.RemoveTransfer(transfer.Hash); err != nil {
-			return fmt.Errorf("failed to remove transfer from pool: %w", err)
+	blocks := make([]*chain.Block, 0, chain.FeeEstimateBlocks)
+	for index := latestBlock.Index; index > 0 && len(blocks) < chain.FeeEstimateBlocks; index-- {
+		block, err := bc.storage.GetBlock(index)
+		if err != nil {
+			return chain.FeeEstimate{}, fmt.Errorf("failed to get block %d: %w", index, err)
 		}
+		blocks = append(blocks, block)
 	}
 
-	return nil
-}
-
-// GetNextNonce gets the next nonce for an address
-func (bc *Blockchain) GetNextNonce(address string) int64 {
-	return bc.stateManager.GetNextNonce(address)
+	return chain.EstimateFees(bc.paramsAt(latestBlock.Index+1), blocks), nil
 }
 
 // GetTransferPoolInfo returns information about the transfer pool
@@ -748,10 +1110,10 @@ func (bc *Blockchain) GetTransferPoolInfo() map[string]interface{} {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	transfers := bc.TransferPool.GetTransfers()
+	transfers := bc.Mempool.Pending()
 	info := map[string]interface{}{
 		"transfer_count":         len(transfers),
-		"total_character_volume": bc.TransferPool.GetTotalCharacterVolume(),
+		"total_character_volume": bc.Mempool.TotalCost(),
 		"transfers":              []map[string]interface{}{},
 	}
 
@@ -774,11 +1136,14 @@ func (bc *Blockchain) GetTransferPoolInfo() map[string]interface{} {
 }
 
 // GetStateInfo returns information about the current state
-func (bc *Blockchain) GetStateInfo() map[string]interface{} {
+func (bc *Blockchain) GetStateInfo() (map[string]interface{}, error) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	wallets := bc.stateManager.GetAllWallets()
+	wallets, err := bc.stateManager.GetAllWallets()
+	if err != nil {
+		return nil, err
+	}
 	walletList := make([]map[string]interface{}, len(wallets))
 
 	for i, wallet := range wallets {
@@ -794,7 +1159,7 @@ func (bc *Blockchain) GetStateInfo() map[string]interface{} {
 		"wallet_count":           bc.stateManager.GetWalletCount(),
 		"total_character_supply": bc.stateManager.GetTotalCharacterSupply(),
 		"wallets":                walletList,
-	}
+	}, nil
 }
 
 // IntegrateBlocksFromSync integrates blocks received from a sync operation
@@ -802,9 +1167,25 @@ func (bc *Blockchain) IntegrateBlocksFromSync(blocks []*chain.Block) (int, int,
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	return bc.integrateBlocks(blocks)
+}
+
+// integrateBlocks appends blocks on top of the stored chain (caller must hold the lock)
+func (bc *Blockchain) integrateBlocks(blocks []*chain.Block) (int, int, error) {
 	blocksAdded := 0
 	blocksSkipped := 0
 
+	// Posts and transfers the connected blocks confirmed leave the mempools, even if a later block fails
+	var connected []*chain.Block
+	defer func() {
+		if len(connected) > 0 {
+			bc.pruneMempools(connected...)
+		}
+	}()
+
+	// The batch itself may prove some blocks are ancestors of the assume-valid block
+	bc.noteAssumeValidBatch(blocks)
+
 	for _, block := range blocks {
 		// Check if we already have this block
 		existingBlock, err := bc.storage.GetBlock(block.Index)
@@ -813,15 +1194,25 @@ func (bc *Blockchain) IntegrateBlocksFromSync(blocks []*chain.Block) (int, int,
 				blocksSkipped++
 				continue
 			}
+			// Overwriting a stored block would mix two forks - that needs a reorg
+			return blocksAdded, blocksSkipped, fmt.Errorf("block %d conflicts with local chain", block.Index)
 		}
 
 		// Validate block
-		if err := block.ValidateBlockWithThreshold(bc.PostThreshold); err != nil {
+		if err := bc.validateSyncedBlock(block); err != nil {
 			return blocksAdded, blocksSkipped, fmt.Errorf("invalid block %d: %w", block.Index, err)
 		}
 
-		// Check block index continuity
-		if block.Index > 0 {
+		// Genesis carries its state; every later block must reproduce its state root
+		if block.Index == 0 {
+			if err := bc.network.ValidateGenesis(block); err != nil {
+				return blocksAdded, blocksSkipped, fmt.Errorf("invalid genesis block: %w", err)
+			}
+			if err := bc.loadStateFromBlock(block); err != nil {
+				return blocksAdded, blocksSkipped, err
+			}
+		} else {
+			// Check block index continuity
 			prevBlock, err := bc.storage.GetBlock(block.Index - 1)
 			if err != nil {
 				return blocksAdded, blocksSkipped, fmt.Errorf("missing previous block %d: %w", block.Index-1, err)
@@ -829,6 +1220,13 @@ func (bc *Blockchain) IntegrateBlocksFromSync(blocks []*chain.Block) (int, int,
 			if block.PrevHash != prevBlock.Hash {
 				return blocksAdded, blocksSkipped, fmt.Errorf("previous hash mismatch at block %d", block.Index)
 			}
+			if err := bc.checkRewardAnchors(block, nil); err != nil {
+				return blocksAdded, blocksSkipped, fmt.Errorf("invalid block %d: %w", block.Index, err)
+			}
+
+			if err := bc.connectBlockState(block, prevBlock); err != nil {
+				return blocksAdded, blocksSkipped, fmt.Errorf("invalid block %d: %w", block.Index, err)
+			}
 		}
 
 		// Save block to storage
@@ -837,11 +1235,37 @@ func (bc *Blockchain) IntegrateBlocksFromSync(blocks []*chain.Block) (int, int,
 		}
 
 		blocksAdded++
+		connected = append(connected, block)
 	}
 
 	return blocksAdded, blocksSkipped, nil
 }
 
+// connectBlockState applies a received block and checks the state root it claims (caller must hold the lock)
+func (bc *Blockchain) connectBlockState(block *chain.Block, parent *chain.Block) error {
+	if err := bc.checkBlockState(bc.stateManager, block, nil); err != nil {
+		bc.discardBlockState(parent)
+		return err
+	}
+	return nil
+}
+
+// checkBlockState applies a received block to state holding its parent's state and checks the state root it claims
+func (bc *Blockchain) checkBlockState(state *chain.StateManager, block *chain.Block, branch []*chain.Block) error {
+	if block.StateRoot == nil {
+		return fmt.Errorf("missing state root")
+	}
+
+	stateRoot, err := bc.applyBlockState(state, block, branch)
+	if err != nil {
+		return err
+	}
+	if stateRoot.Hash != block.StateRoot.Hash {
+		return fmt.Errorf("state root mismatch: expected %s, got %s", stateRoot.Hash, block.StateRoot.Hash)
+	}
+	return nil
+}
+
 // ValidateAndIntegrateChain validates and integrates a complete chain
 // This is the Bitcoin-style chain validation with burn-weight comparison
 func (bc *Blockchain) ValidateAndIntegrateChain(blocks []*chain.Block) (int, int, error) {
@@ -850,15 +1274,26 @@ func (bc *Blockchain) ValidateAndIntegrateChain(blocks []*chain.Block) (int, int
 	}
 
 	// Validate genesis block first
-	if err := chain.ValidateCanonicalGenesis(blocks[0]); err != nil {
+	if err := bc.network.ValidateGenesis(blocks[0]); err != nil {
 		return 0, 0, fmt.Errorf("invalid genesis block: %w", err)
 	}
 
+	// A chain that conflicts with a checkpoint is never adopted, whatever its burn score
+	for _, block := range blocks {
+		if err := chain.ValidateAgainstCheckpoints(bc.checkpoints, block.Index, block.Hash); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Hold the lock for the whole comparison and reorg so no block sneaks in between
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
 	// Calculate burn score of incoming chain
 	incomingBurnScore := chain.CalculateChainBurnScore(blocks)
 
 	// Get current chain burn score
-	currentBlocks, err := bc.GetAllBlocks()
+	currentBlocks, err := bc.getAllBlocks()
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get current blocks: %w", err)
 	}
@@ -870,23 +1305,100 @@ func (bc *Blockchain) ValidateAndIntegrateChain(blocks []*chain.Block) (int, int
 			incomingBurnScore, currentBurnScore)
 	}
 
-	// If we have a better chain, perform reorg
-	if len(currentBlocks) > 0 {
-		log.Printf("Performing reorg: incoming chain has higher burn score (%d vs %d)",
-			incomingBurnScore, currentBurnScore)
+	// Nothing to reorg - just append
+	if len(currentBlocks) == 0 {
+		return bc.integrateBlocks(blocks)
+	}
 
-		// Find common ancestor
-		commonAncestor := bc.findCommonAncestor(blocks, currentBlocks)
-		if commonAncestor >= 0 {
-			// Rollback to common ancestor
-			if err := bc.rollbackToBlock(commonAncestor); err != nil {
-				return 0, 0, fmt.Errorf("failed to rollback to block %d: %w", commonAncestor, err)
-			}
+	// Find common ancestor
+	commonAncestor := bc.findCommonAncestor(blocks, currentBlocks)
+	if commonAncestor < 0 {
+		return 0, 0, fmt.Errorf("incoming chain shares no common ancestor")
+	}
+
+	// Incoming chain extends our tip
+	if commonAncestor == len(currentBlocks)-1 {
+		return bc.integrateBlocks(blocks)
+	}
+
+	log.Printf("Performing reorg: incoming chain has higher burn score (%d vs %d), common ancestor %d",
+		incomingBurnScore, currentBurnScore, commonAncestor)
+
+	blocksAdded, err := bc.reorganize(currentBlocks[commonAncestor], blocks[commonAncestor+1:])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return blocksAdded, commonAncestor + 1, nil
+}
+
+// CheckBranchHeaders checks that a competing branch forking after ancestor is worth downloading
+// The branch and the blocks it replaces may not exceed chain.MaxReorgBlocks, and
+// its headers must claim a higher burn score than our blocks after ancestor.
+func (bc *Blockchain) CheckBranchHeaders(ancestor int, headers []*chain.BlockHeader) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	local, err := bc.reorgCandidates(ancestor, len(headers))
+	if err != nil {
+		return err
+	}
+	incomingBurnScore := chain.CalculateHeaderBurnScore(headers)
+	currentBurnScore := chain.CalculateChainBurnScore(local)
+	if incomingBurnScore <= currentBurnScore {
+		return fmt.Errorf("branch has lower or equal burn score (%d vs %d)", incomingBurnScore, currentBurnScore)
+	}
+	return nil
+}
+
+// IntegrateBranch reorganizes onto a competing branch forking after ancestor if it has a higher burn score
+// Only the branch and our blocks after ancestor are compared, so neither chain is loaded whole.
+func (bc *Blockchain) IntegrateBranch(ancestor int, branch []*chain.Block) (int, error) {
+	for _, block := range branch {
+		if err := chain.ValidateAgainstCheckpoints(bc.checkpoints, block.Index, block.Hash); err != nil {
+			return 0, err
 		}
 	}
 
-	// Integrate the new chain
-	return bc.IntegrateBlocksFromSync(blocks)
+	// Hold the lock for the whole comparison and reorg so no block sneaks in between
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	local, err := bc.reorgCandidates(ancestor, len(branch))
+	if err != nil {
+		return 0, err
+	}
+	incomingBurnScore := chain.CalculateChainBurnScore(branch)
+	currentBurnScore := chain.CalculateChainBurnScore(local)
+	if incomingBurnScore <= currentBurnScore {
+		return 0, fmt.Errorf("branch has lower or equal burn score (%d vs %d)", incomingBurnScore, currentBurnScore)
+	}
+
+	ancestorBlock, err := bc.storage.GetBlock(ancestor)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get common ancestor %d: %w", ancestor, err)
+	}
+	log.Printf("Performing reorg: branch has higher burn score (%d vs %d), common ancestor %d",
+		incomingBurnScore, currentBurnScore, ancestor)
+	return bc.reorganize(ancestorBlock, branch)
+}
+
+// reorgCandidates returns our blocks after ancestor that a branch of branchLength blocks would replace (caller must hold the lock)
+func (bc *Blockchain) reorgCandidates(ancestor int, branchLength int) ([]*chain.Block, error) {
+	if branchLength > chain.MaxReorgBlocks {
+		return nil, fmt.Errorf("branch of %d blocks exceeds the reorg limit of %d", branchLength, chain.MaxReorgBlocks)
+	}
+	latestBlock, err := bc.storage.GetLatestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	if ancestor < 0 || ancestor > latestBlock.Index {
+		return nil, fmt.Errorf("common ancestor %d is not in our chain", ancestor)
+	}
+	if depth := latestBlock.Index - ancestor; depth > chain.MaxReorgBlocks {
+		return nil, fmt.Errorf("reorg of %d blocks exceeds the limit of %d", depth, chain.MaxReorgBlocks)
+	}
+	return bc.blocksAbove(ancestor)
 }
 
 // GetAllBlocks returns all blocks in the chain
@@ -894,6 +1406,11 @@ func (bc *Blockchain) GetAllBlocks() ([]*chain.Block, error) {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
+	return bc.getAllBlocks()
+}
+
+// getAllBlocks returns all blocks in the chain (caller must hold the lock)
+func (bc *Blockchain) getAllBlocks() ([]*chain.Block, error) {
 	chainLength, err := bc.GetChainLength()
 	if err != nil {
 		return nil, err
@@ -922,74 +1439,290 @@ func (bc *Blockchain) findCommonAncestor(newBlocks, currentBlocks []*chain.Block
 	return -1 // No common ancestor found
 }
 
-// rollbackToBlock rolls back the chain to the specified block
-func (bc *Blockchain) rollbackToBlock(blockIndex int) error {
-	// This is a simplified rollback - in production you'd need to handle state rollback
+// reorganize replaces the blocks above ancestor with branch (caller must hold the lock)
+// The branch is validated and executed on a copy of the ancestor's state first, then
+// the old blocks, the new blocks and the new state tree nodes are swapped in one
+// storage transaction, so storage never holds a mix of forks.
+func (bc *Blockchain) reorganize(ancestor *chain.Block, branch []*chain.Block) (int, error) {
+	// Validate the whole branch up front
+	bc.noteAssumeValidBatch(branch)
+	prev := ancestor
+	for _, block := range branch {
+		if block.Index != prev.Index+1 {
+			return 0, fmt.Errorf("branch index discontinuity at block %d", block.Index)
+		}
+		if block.PrevHash != prev.Hash {
+			return 0, fmt.Errorf("previous hash mismatch at block %d", block.Index)
+		}
+		if err := bc.validateSyncedBlock(block); err != nil {
+			return 0, fmt.Errorf("invalid block %d: %w", block.Index, err)
+		}
+		if err := bc.checkRewardAnchors(block, branch); err != nil {
+			return 0, fmt.Errorf("invalid block %d: %w", block.Index, err)
+		}
+		prev = block
+	}
+
+	// Execute the branch on the ancestor's state, buffering the state tree nodes it writes
+	nodes := chain.NewStateNodeBuffer(bc.storage)
+	state := chain.NewStateManagerWithStore(nodes)
+	if err := bc.loadBlockState(state, ancestor); err != nil {
+		return 0, err
+	}
+	prev = ancestor
+	for _, block := range branch {
+		if err := bc.checkBlockState(state, block, branch); err != nil {
+			return 0, fmt.Errorf("reorg aborted, invalid block %d: %w", block.Index, err)
+		}
+		prev = block
+	}
+
+	orphaned, err := bc.blocksAbove(ancestor.Index)
+	if err != nil {
+		return 0, err
+	}
+
+	// Swap the branches and adopt the state of the new tip
+	if err := bc.storage.ReplaceBlocks(ancestor.Index, branch, nodes.Nodes()); err != nil {
+		return 0, fmt.Errorf("failed to replace blocks above %d: %w", ancestor.Index, err)
+	}
+	if err := bc.loadStateFromBlock(prev); err != nil {
+		return 0, err
+	}
+
+	// Drop entries the branch confirmed and return orphaned ones to the mempools
+	bc.pruneMempools(branch...)
+	bc.requeueOrphaned(orphaned, branch)
+
+	log.Printf("Reorg complete: %d blocks orphaned, %d blocks added", len(orphaned), len(branch))
+	return len(branch), nil
+}
+
+// rollbackToBlock rolls back the chain to the specified block (caller must hold the lock)
+// It deletes every block above blockIndex in one storage transaction, restores
+// state from that block's StateRoot and returns the removed blocks in ascending order.
+func (bc *Blockchain) rollbackToBlock(blockIndex int) ([]*chain.Block, error) {
 	log.Printf("Rolling back chain to block %d", blockIndex)
 
-	// For now, we'll just truncate the database
-	// In a full implementation, you'd need to:
-	// 1. Rollback state changes
-	// 2. Rollback pending transactions
-	// 3. Handle orphaned blocks
+	target, err := bc.storage.GetBlock(blockIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d: %w", blockIndex, err)
+	}
 
+	orphaned, err := bc.blocksAbove(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.storage.ReplaceBlocks(blockIndex, nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to delete blocks above %d: %w", blockIndex, err)
+	}
+
+	// Restore state as of the target block
+	if err := bc.loadStateFromBlock(target); err != nil {
+		return nil, err
+	}
+
+	return orphaned, nil
+}
+
+// blocksAbove returns the stored blocks above blockIndex in ascending order
+func (bc *Blockchain) blocksAbove(blockIndex int) ([]*chain.Block, error) {
+	latestBlock, err := bc.storage.GetLatestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	blocks := make([]*chain.Block, 0, latestBlock.Index-blockIndex)
+	for i := blockIndex + 1; i <= latestBlock.Index; i++ {
+		block, err := bc.storage.GetBlock(i)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", i, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// loadStateFromBlock resets the state manager to the state committed by a block
+func (bc *Blockchain) loadStateFromBlock(block *chain.Block) error {
+	return bc.loadBlockState(bc.stateManager, block)
+}
+
+// loadBlockState resets state to the state committed by a block
+func (bc *Blockchain) loadBlockState(state *chain.StateManager, block *chain.Block) error {
+	stateRoot := block.StateRoot
+	if stateRoot == nil {
+		stateRoot = &chain.StateRoot{Hash: chain.EmptyStateRoot, BlockIndex: block.Index}
+	}
+
+	if err := state.LoadStateFromStateRoot(stateRoot, bc.paramsAt(block.Index)); err != nil {
+		return fmt.Errorf("failed to load state from block %d: %w", block.Index, err)
+	}
 	return nil
 }
 
-// shouldCreateTimeBasedBlock checks if we should create a block based on time interval
-func (bc *Blockchain) shouldCreateTimeBasedBlock() bool {
-	bc.mu.RLock()
-	defer bc.mu.RUnlock()
+// requeueOrphaned returns posts, transfers and rewards from orphaned blocks to the mempools
+// Entries already included in the new branch are removed from the mempools instead.
+func (bc *Blockchain) requeueOrphaned(orphaned, branch []*chain.Block) {
+	includedPosts := make(map[string]bool)
+	includedTransfers := make(map[string]bool)
+	for _, block := range branch {
+		for _, post := range block.Posts {
+			includedPosts[postHash(post)] = true
+		}
+		for _, transfer := range block.Transfers {
+			includedTransfers[transfer.Hash] = true
+		}
+	}
 
-	// Check if enough time has passed since the last block
-	return time.Since(bc.lastBlockTime) >= bc.TimeInterval
+	// Pending entries the new branch confirmed already left the mempools when it connected
+	for _, block := range orphaned {
+		for _, post := range block.Posts {
+			hash := postHash(post)
+			if includedPosts[hash] {
+				continue
+			}
+			if _, pending := bc.PostPool.Get(hash); pending {
+				continue
+			}
+			if post.Hash == "" {
+				post.Hash = hash
+			}
+			// Posts the authors can no longer pay for are dropped
+			if err := bc.reservePost(post, bc.paramsAt(bc.nextBlockHeight())); err != nil {
+				log.Printf("Dropping orphaned post %s: %v", hash, err)
+				continue
+			}
+			if err := bc.PostPool.Add(post); err != nil {
+				log.Printf("Failed to requeue orphaned post %s: %v", hash, err)
+			}
+		}
+
+		for _, transfer := range block.Transfers {
+			if includedTransfers[transfer.Hash] {
+				continue
+			}
+			// Transfers that no longer fit the new state are dropped
+			if err := bc.checkTransfer(transfer); err != nil {
+				log.Printf("Dropping orphaned transfer %s: %v", transfer.Hash, err)
+				continue
+			}
+			if err := bc.Mempool.Add(transfer, bc.stateManager.GetNonce(transfer.From)); err != nil {
+				log.Printf("Failed to requeue orphaned transfer %s: %v", transfer.Hash, err)
+			}
+		}
+
+		// Reward claims are re-priced and re-checked when the next block is built
+		for _, reward := range block.Rewards {
+			queued := false
+			for _, pending := range bc.PendingRewards {
+				if pending.Recipient == reward.Recipient {
+					queued = true
+					break
+				}
+			}
+			if !queued {
+				bc.PendingRewards = append(bc.PendingRewards, reward)
+			}
+		}
+	}
+}
+
+// postHash returns the hash of a post, computing it if it is not set
+func postHash(post chain.Post) string {
+	if post.Hash != "" {
+		return post.Hash
+	}
+	return post.CalculateHash()
+}
+
+// timeBasedBlockDue checks if a heartbeat block is due (caller must hold the lock)
+// Heartbeats exist only under the block budget, while no posts wait, and come at
+// least HeartbeatInterval after the tip.
+func (bc *Blockchain) timeBasedBlockDue() bool {
+	latestBlock, err := bc.storage.GetLatestBlock()
+	if err != nil {
+		return false
+	}
+	if !bc.paramsAt(latestBlock.Index+1).BlockBudget || bc.PostPool.Count() > 0 {
+		return false
+	}
+	return time.Since(time.Unix(latestBlock.Timestamp, 0)) >= chain.HeartbeatInterval &&
+		time.Since(bc.lastBlockTime) >= bc.TimeInterval
 }
 
-// createTimeBasedBlock creates a new block based on time interval (empty block for mining rewards)
+// createTimeBasedBlock creates the block time calls for: one for posts that waited long enough, or a heartbeat
 func (bc *Blockchain) createTimeBasedBlock() error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
+	params := bc.paramsAt(bc.nextBlockHeight())
+	if params.BlockBudget && bc.postBlockDue(params) {
+		return bc.createBlockFromPending()
+	}
+	if bc.timeBasedBlockDue() {
+		return bc.appendTimeBasedBlock()
+	}
+	return nil
+}
+
+// appendTimeBasedBlock creates a heartbeat block (caller must hold the lock)
+func (bc *Blockchain) appendTimeBasedBlock() error {
 	// Get the latest block
 	latestBlock, err := bc.storage.GetLatestBlock()
 	if err != nil {
 		return fmt.Errorf("failed to get latest block: %w", err)
 	}
 
-	// Create a new empty block for mining rewards
-	newBlock := &chain.Block{
-		Index:     latestBlock.Index + 1,
-		Timestamp: time.Now().Unix(),
-		PrevHash:  latestBlock.Hash,
-		Posts:     []chain.Post{},        // Empty block - no posts
-		Transfers: []chain.Transfer{},    // No transfers
-		StateRoot: latestBlock.StateRoot, // Keep same state root since no changes
-		CharCount: 0,                     // No characters in empty block
+	// Take ready transfers and price pending uptime rewards at the block's timestamp
+	params := bc.paramsAt(latestBlock.Index + 1)
+	transfers := bc.Mempool.Ready(bc.stateManager.GetNonce, chain.MaxBlockTransferBytes)
+	timestamp := time.Now().Unix()
+	rewards := bc.collectPendingRewards(timestamp)
+
+	// Create a new block with no posts that carries the transfers and mining rewards
+	newBlock := chain.CreateBlockWithRewards(
+		params,
+		latestBlock.Index+1,
+		latestBlock.Hash,
+		[]chain.Post{}, // Heartbeat block - no posts
+		transfers,
+		rewards,
+		nil,
+	)
+	newBlock.Timestamp = timestamp
+	if err := bc.sealBlock(newBlock, latestBlock); err != nil {
+		return err
 	}
 
-	// Calculate and set block hash
-	newBlock.SetHash()
+	// Heartbeat blocks follow the same rules peers check
+	if err := newBlock.ValidateBlockWithParams(params); err != nil {
+		bc.discardBlockState(latestBlock)
+		return fmt.Errorf("invalid block: %w", err)
+	}
 
 	// Save the block
 	if err := bc.storage.SaveBlock(newBlock); err != nil {
+		bc.discardBlockState(latestBlock)
 		return fmt.Errorf("failed to save time-based block: %w", err)
 	}
 
-	// Update last block time
+	// Update last block time, clear minted rewards and expire stale transfers
 	bc.lastBlockTime = time.Now()
+	bc.PendingRewards = []chain.UptimeReward{}
+	bc.pruneMempools(newBlock)
+	bc.announceBlock(newBlock)
 
-	fmt.Printf("Created time-based block %d (empty block for mining rewards)\n", newBlock.Index)
+	fmt.Printf("Created heartbeat block %d (%d transfers, %d mining rewards)\n", newBlock.Index, len(transfers), len(rewards))
 	return nil
 }
 
 // timeBasedBlockLoop is a background goroutine to check for time-based blocks and create them
 func (bc *Blockchain) timeBasedBlockLoop() {
 	for {
-		if bc.shouldCreateTimeBasedBlock() {
-			if err := bc.createTimeBasedBlock(); err != nil {
-				fmt.Printf("Error creating time-based block: %v\n", err)
-			}
+		if err := bc.createTimeBasedBlock(); err != nil {
+			fmt.Printf("Error creating time-based block: %v\n", err)
 		}
-		time.Sleep(1 * time.Minute) // Check every minute
+		time.Sleep(chain.MainnetMaxWait / 3) // Check often enough to honour the post wait
 	}
 }
@@ -0,0 +1,1425 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+	"github.com/blindxfish/truthchain/store"
+	"github.com/blindxfish/truthchain/wallet"
+	"go.etcd.io/bbolt"
+)
+
+// newTestBlockchain creates a testnet blockchain on a fresh database holding only the genesis block
+func newTestBlockchain(t *testing.T, dbPath string) (*Blockchain, *store.BoltDBStorage) {
+	return newNetworkTestBlockchain(t, dbPath, chain.TestnetNetworkID)
+}
+
+// newNetworkTestBlockchain creates a blockchain of a network on a fresh database
+func newNetworkTestBlockchain(t *testing.T, dbPath string, networkID string) (*Blockchain, *store.BoltDBStorage) {
+	os.Remove(dbPath)
+	t.Cleanup(func() { os.Remove(dbPath) })
+
+	storage, err := store.NewBoltDBStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	bc, err := NewBlockchain(storage, 1, networkID)
+	if err != nil {
+		t.Fatalf("Failed to create blockchain: %v", err)
+	}
+
+	return bc, storage
+}
+
+// testAuthorFunds is the balance every funding block gives the author of test posts
+const testAuthorFunds = 1000000
+
+// testAuthor signs the posts of test blocks, which are charged to testAuthorAddress
+var (
+	testAuthor, _     = wallet.ImportFromPrivateKeyWithMetadata(strings.Repeat("11", 32), "author", wallet.TruthChainTestnetVersion)
+	testAuthorAddress = testAuthor.GetAddress()
+)
+
+// newSignedPost creates a post by w in the encoding of params, signed for their network
+func newSignedPost(t *testing.T, params chain.ConsensusParams, w *wallet.Wallet, content string) chain.Post {
+	post := chain.Post{Author: w.GetAddress(), Content: content, Timestamp: time.Now().Unix(), Version: params.Encoding}
+	if err := post.Sign(w, params.NetworkID); err != nil {
+		t.Fatalf("Failed to sign post: %v", err)
+	}
+	return post
+}
+
+// newTestBlock builds a single-post block on top of parent with the state root it produces
+// The post is charged to testAuthor, who must be funded in the parent state.
+func newTestBlock(t *testing.T, bc *Blockchain, parent *chain.Block, content string, transfers []chain.Transfer) *chain.Block {
+	return buildTestBlock(t, bc, parent, content, transfers, nil)
+}
+
+// newFundingBlock builds a single-post block whose state also credits testAuthor and funds
+// Executing the block does not reproduce its state, so it may only be stored
+// directly with storeBlocks or used where it is rejected before execution.
+func newFundingBlock(t *testing.T, bc *Blockchain, parent *chain.Block, content string, funds map[string]int) *chain.Block {
+	credits := map[string]int{testAuthorAddress: testAuthorFunds}
+	for address, amount := range funds {
+		credits[address] += amount
+	}
+	return buildTestBlock(t, bc, parent, content, nil, credits)
+}
+
+// buildTestBlock builds a single-post block and seals it with the state of parent plus credits
+func buildTestBlock(t *testing.T, bc *Blockchain, parent *chain.Block, content string, transfers []chain.Transfer, credits map[string]int) *chain.Block {
+	params := bc.paramsAt(parent.Index + 1)
+	post := newSignedPost(t, params, testAuthor, content)
+
+	if transfers == nil {
+		transfers = []chain.Transfer{}
+	}
+	block := chain.CreateBlock(params, parent.Index+1, parent.Hash, []chain.Post{post}, transfers, nil)
+	sealTestBlock(t, bc, parent, block, credits)
+	return block
+}
+
+// sealTestBlock applies block to the state of parent plus credits and sets its state root
+// The state tree nodes are written to the blockchain's storage.
+func sealTestBlock(t *testing.T, bc *Blockchain, parent *chain.Block, block *chain.Block, credits map[string]int) {
+	state := chain.NewStateManagerWithStore(bc.storage)
+	if err := state.LoadStateFromStateRoot(parent.StateRoot, bc.paramsAt(parent.Index)); err != nil {
+		t.Fatalf("Failed to load state of block %d: %v", parent.Index, err)
+	}
+	for address, amount := range credits {
+		wallet, _ := state.GetWalletState(address)
+		if wallet == nil {
+			wallet = &chain.WalletState{}
+		}
+		state.UpdateWalletState(address, wallet.Balance+amount, wallet.Nonce)
+	}
+	if err := state.ApplyBlock(block, bc.paramsAt(block.Index)); err != nil {
+		t.Fatalf("Failed to apply block %d: %v", block.Index, err)
+	}
+
+	stateRoot, err := state.CalculateStateRoot(block.Index, bc.paramsAt(block.Index))
+	if err != nil {
+		t.Fatalf("Failed to calculate state root: %v", err)
+	}
+	block.StateRoot = stateRoot
+	block.SetHash()
+}
+
+// storeBlocks saves blocks directly to storage and adopts the state of the last one
+func storeBlocks(t *testing.T, bc *Blockchain, blocks ...*chain.Block) {
+	for _, block := range blocks {
+		if err := bc.storage.SaveBlock(block); err != nil {
+			t.Fatalf("Failed to save block %d: %v", block.Index, err)
+		}
+	}
+	if err := bc.loadStateFromBlock(blocks[len(blocks)-1]); err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+}
+
+func TestReorgToHeavierFork(t *testing.T) {
+	bc, storage := newTestBlockchain(t, "test_reorg.db")
+
+	sender, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	recipient, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	// Shared block 1 funds the sender
+	genesis, _ := storage.GetBlock(0)
+	shared := newFundingBlock(t, bc, genesis, "shared block", map[string]int{sender.GetAddress(): 100})
+	storeBlocks(t, bc, shared)
+
+	// Local fork A spends from the sender
+	transfer, err := bc.CreateTransfer(recipient.GetAddress(), 10, sender)
+	if err != nil {
+		t.Fatalf("Failed to create transfer: %v", err)
+	}
+	a2 := newTestBlock(t, bc, shared, "fork a", []chain.Transfer{*transfer})
+	storeBlocks(t, bc, a2)
+	if state, _ := bc.stateManager.GetWalletState(sender.GetAddress()); state == nil || state.Balance != 89 {
+		t.Fatalf("Expected sender balance 89 on fork A, got %+v", state)
+	}
+
+	// Competing fork B is heavier and does not include the transfer
+	b2 := newTestBlock(t, bc, shared, "fork b is heavier than fork a", nil)
+	b3 := newTestBlock(t, bc, b2, "and it keeps growing", nil)
+	incoming := []*chain.Block{genesis, shared, b2, b3}
+
+	added, skipped, err := bc.ValidateAndIntegrateChain(incoming)
+	if err != nil {
+		t.Fatalf("Reorg failed: %v", err)
+	}
+	if added != 2 || skipped != 2 {
+		t.Errorf("Expected 2 added and 2 skipped, got %d added and %d skipped", added, skipped)
+	}
+
+	// Storage holds only fork B
+	length, err := bc.GetChainLength()
+	if err != nil {
+		t.Fatalf("Failed to get chain length: %v", err)
+	}
+	if length != 4 {
+		t.Fatalf("Expected chain length 4, got %d", length)
+	}
+	for _, expected := range incoming {
+		block, err := bc.GetBlockByIndex(expected.Index)
+		if err != nil {
+			t.Fatalf("Failed to get block %d: %v", expected.Index, err)
+		}
+		if block.Hash != expected.Hash {
+			t.Errorf("Block %d hash mismatch: expected %s, got %s", expected.Index, expected.Hash, block.Hash)
+		}
+	}
+	if _, err := bc.GetBlockByHash(a2.Hash); err == nil {
+		t.Error("Orphaned block should no longer be stored by hash")
+	}
+
+	// State follows fork B
+	state, exists := bc.stateManager.GetWalletState(sender.GetAddress())
+	if !exists || state.Balance != 100 || state.Nonce != 0 {
+		t.Errorf("Expected sender balance 100 and nonce 0 after reorg, got %+v", state)
+	}
+	if _, exists := bc.stateManager.GetWalletState(recipient.GetAddress()); exists {
+		t.Error("Recipient should not exist in state after reorg")
+	}
+
+	// Orphaned post and transfer are back in the mempools
+	pending := bc.GetPendingPosts()
+	if len(pending) != 1 || pending[0].Hash != a2.Posts[0].Hash {
+		t.Errorf("Expected orphaned post in pending posts, got %d posts", len(pending))
+	}
+	storedPending, err := storage.GetPendingPosts()
+	if err != nil {
+		t.Fatalf("Failed to get stored pending posts: %v", err)
+	}
+	if len(storedPending) != 1 {
+		t.Errorf("Expected 1 stored pending post, got %d", len(storedPending))
+	}
+	transfers := bc.Mempool.Pending()
+	if len(transfers) != 1 || transfers[0].Hash != transfer.Hash {
+		t.Errorf("Expected orphaned transfer in transfer pool, got %d transfers", len(transfers))
+	}
+}
+
+func TestReorgRejectsLighterFork(t *testing.T) {
+	bc, storage := newTestBlockchain(t, "test_reorg_lighter.db")
+
+	genesis, _ := storage.GetBlock(0)
+	a1 := newFundingBlock(t, bc, genesis, "the local fork is heavier", nil)
+	storeBlocks(t, bc, a1)
+
+	b1 := newFundingBlock(t, bc, genesis, "lighter", nil)
+	if _, _, err := bc.ValidateAndIntegrateChain([]*chain.Block{genesis, b1}); err == nil {
+		t.Fatal("Expected lighter fork to be rejected")
+	}
+
+	latest, err := bc.GetLatestBlock()
+	if err != nil {
+		t.Fatalf("Failed to get latest block: %v", err)
+	}
+	if latest.Hash != a1.Hash {
+		t.Errorf("Local tip changed: expected %s, got %s", a1.Hash, latest.Hash)
+	}
+}
+
+func TestReorgRejectsInvalidBranch(t *testing.T) {
+	bc, storage := newTestBlockchain(t, "test_reorg_invalid.db")
+
+	genesis, _ := storage.GetBlock(0)
+	a1 := newFundingBlock(t, bc, genesis, "local fork", map[string]int{"local": 5})
+	storeBlocks(t, bc, a1)
+
+	// Heavier fork whose second block does not link to the first
+	b1 := newFundingBlock(t, bc, genesis, "heavier fork block one", nil)
+	b2 := newTestBlock(t, bc, b1, "heavier fork block two", nil)
+	b2.PrevHash = a1.Hash
+	b2.SetHash()
+
+	if _, _, err := bc.ValidateAndIntegrateChain([]*chain.Block{genesis, b1, b2}); err == nil {
+		t.Fatal("Expected invalid branch to be rejected")
+	}
+
+	// Nothing was rolled back
+	latest, err := bc.GetLatestBlock()
+	if err != nil {
+		t.Fatalf("Failed to get latest block: %v", err)
+	}
+	if latest.Hash != a1.Hash {
+		t.Errorf("Local tip changed: expected %s, got %s", a1.Hash, latest.Hash)
+	}
+	if state, exists := bc.stateManager.GetWalletState("local"); !exists || state.Balance != 5 {
+		t.Error("Local state changed after rejected reorg")
+	}
+
+	// A branch whose state does not replay is rejected before anything is replaced
+	if _, _, err := bc.ValidateAndIntegrateChain([]*chain.Block{genesis, b1}); err == nil {
+		t.Fatal("Expected branch with a bad state root to be rejected")
+	}
+	if latest, err := bc.GetLatestBlock(); err != nil || latest.Hash != a1.Hash {
+		t.Errorf("Local tip changed after rejected reorg: %v", err)
+	}
+	if _, err := bc.GetBlockByHash(b1.Hash); err == nil {
+		t.Error("Rejected branch block should not be stored")
+	}
+	if state, exists := bc.stateManager.GetWalletState("local"); !exists || state.Balance != 5 {
+		t.Error("Local state changed after rejected reorg")
+	}
+}
+
+func TestRollbackToBlock(t *testing.T) {
+	bc, storage := newTestBlockchain(t, "test_rollback.db")
+
+	genesis, _ := storage.GetBlock(0)
+	mined := map[string]int{"miner": 7}
+	b1 := newFundingBlock(t, bc, genesis, "block one", mined)
+	b2 := newFundingBlock(t, bc, b1, "block two", mined)
+	b3 := newFundingBlock(t, bc, b2, "block three", mined)
+	storeBlocks(t, bc, b1, b2, b3)
+
+	orphaned, err := bc.rollbackToBlock(1)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if len(orphaned) != 2 || orphaned[0].Hash != b2.Hash || orphaned[1].Hash != b3.Hash {
+		t.Errorf("Expected blocks 2 and 3 to be orphaned in order, got %d blocks", len(orphaned))
+	}
+
+	latest, err := bc.GetLatestBlock()
+	if err != nil {
+		t.Fatalf("Failed to get latest block: %v", err)
+	}
+	if latest.Hash != b1.Hash {
+		t.Errorf("Expected tip %s after rollback, got %s", b1.Hash, latest.Hash)
+	}
+	if state, exists := bc.stateManager.GetWalletState("miner"); !exists || state.Balance != 7 {
+		t.Errorf("Expected state of block 1 after rollback, got %+v", state)
+	}
+}
+
+func TestSyncRejectsCheckpointConflict(t *testing.T) {
+	bc, storage := newTestBlockchain(t, "test_checkpoint.db")
+
+	genesis, _ := storage.GetBlock(0)
+	funding := newFundingBlock(t, bc, genesis, "funding", nil)
+	storeBlocks(t, bc, funding)
+
+	b2 := newTestBlock(t, bc, funding, "not the checkpointed block", nil)
+	bc.checkpoints = append(bc.checkpoints, chain.Checkpoint{Height: 2, Hash: "checkpointed"})
+
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{b2}); err == nil {
+		t.Error("Expected sync to reject a block that conflicts with a checkpoint")
+	}
+	if _, _, err := bc.ValidateAndIntegrateChain([]*chain.Block{genesis, funding, b2}); err == nil {
+		t.Error("Expected chain that conflicts with a checkpoint to be rejected")
+	}
+
+	// The checkpointed block itself is accepted
+	bc.checkpoints[len(bc.checkpoints)-1].Hash = b2.Hash
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{b2}); err != nil {
+		t.Fatalf("Expected checkpointed block to be accepted: %v", err)
+	}
+}
+
+func TestAssumeValidSkipsSignatureChecks(t *testing.T) {
+	bc, storage := newNetworkTestBlockchain(t, "test_assume_valid.db", chain.RegtestNetworkID)
+
+	sender, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	forger, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	recipient, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+
+	// A transfer from sender signed with the wrong key
+	transfer, err := bc.CreateTransfer(recipient.GetAddress(), 10, forger)
+	if err != nil {
+		t.Fatalf("Failed to create transfer: %v", err)
+	}
+	transfer.From = sender.GetAddress()
+	if transfer.Hash, err = transfer.CalculateHash(); err != nil {
+		t.Fatalf("Failed to hash transfer: %v", err)
+	}
+
+	genesis, _ := storage.GetBlock(0)
+	funding := newFundingBlock(t, bc, genesis, "funding", map[string]int{sender.GetAddress(): 100})
+	storeBlocks(t, bc, funding)
+	b2 := newTestBlock(t, bc, funding, "badly signed transfer", []chain.Transfer{*transfer})
+	b3 := newTestBlock(t, bc, b2, "assume valid", nil)
+
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{b2, b3}); err == nil {
+		t.Fatal("Expected bad signature to be rejected without assume-valid")
+	}
+
+	// Assume-valid pointing elsewhere does not help
+	bc.SetAssumeValid(chain.Checkpoint{Height: 3, Hash: "some other block"})
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{b2, b3}); err == nil {
+		t.Fatal("Expected bad signature to be rejected for blocks not below assume-valid")
+	}
+
+	// Made-up links ending at the assume-valid hash prove nothing
+	forged := *b3
+	forged.Posts = []chain.Post{newSignedPost(t, bc.paramsAt(3), testAuthor, "forged")}
+	bc.SetAssumeValid(chain.Checkpoint{Height: 3, Hash: "forged"})
+	bc.NoteHeaderChain([]*chain.BlockHeader{b2.Header(), {Version: chain.EncodingCanonical, Index: 3, PrevHash: b2.Hash, Hash: "forged"}})
+	forged.Hash = "forged"
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{b2, &forged}); err == nil {
+		t.Fatal("Expected forged links to the assume-valid block to be ignored")
+	}
+	if latest, _ := bc.GetLatestBlock(); latest.Hash != funding.Hash {
+		t.Fatalf("Expected no block connected from a forged batch, tip is block %d", latest.Index)
+	}
+
+	// The hash-checked header chain proves b2 is an ancestor of the assume-valid block
+	bc.SetAssumeValid(chain.Checkpoint{Height: 3, Hash: b3.Hash})
+	bc.NoteHeaderChain([]*chain.BlockHeader{b2.Header(), b3.Header()})
+	added, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{b2})
+	if err != nil {
+		t.Fatalf("Expected assume-valid ancestor to be accepted: %v", err)
+	}
+	if added != 1 {
+		t.Errorf("Expected 1 block added, got %d", added)
+	}
+}
+
+func TestSyncExecutesBlockState(t *testing.T) {
+	bc, storage := newTestBlockchain(t, "test_state_exec.db")
+
+	genesis, _ := storage.GetBlock(0)
+	funding := newFundingBlock(t, bc, genesis, "funding", nil)
+	storeBlocks(t, bc, funding)
+
+	// A block claiming a state it does not produce is rejected
+	forged := newTestBlock(t, bc, funding, "forged state", nil)
+	forged.StateRoot = &chain.StateRoot{Hash: funding.StateRoot.Hash, BlockIndex: forged.Index}
+	forged.SetHash()
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{forged}); err == nil {
+		t.Fatal("Expected block with wrong state root to be rejected")
+	}
+
+	// So is a block whose posts the author cannot pay for
+	nobody, err := wallet.NewTestnetWallet("nobody")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	free := newSignedPost(t, bc.paramsAt(2), nobody, "free")
+	unfunded := chain.CreateBlock(bc.paramsAt(2), 2, funding.Hash, []chain.Post{free}, []chain.Transfer{}, &chain.StateRoot{Hash: funding.StateRoot.Hash, BlockIndex: 2})
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{unfunded}); err == nil {
+		t.Fatal("Expected block with unpaid posts to be rejected")
+	}
+	if state, _ := bc.stateManager.GetWalletState(testAuthorAddress); state == nil || state.Balance != testAuthorFunds-len("funding") {
+		t.Fatalf("Rejected blocks changed the state: %+v", state)
+	}
+
+	// The honest block is accepted and its post is charged
+	b2 := newTestBlock(t, bc, funding, "honest", nil)
+	if _, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{b2}); err != nil {
+		t.Fatalf("Failed to integrate block: %v", err)
+	}
+	if state, _ := bc.stateManager.GetWalletState(testAuthorAddress); state == nil || state.Balance != testAuthorFunds-len("funding")-len("honest") {
+		t.Errorf("Expected post cost to be charged, got %+v", state)
+	}
+
+	// Blocks before the state-tree upgrade still embed their wallets
+	if len(b2.StateRoot.Wallets) == 0 {
+		t.Error("Expected embedded wallets before the state-tree upgrade")
+	}
+
+	// A restarted node rebuilds its state from the stored block
+	restarted, err := NewBlockchain(storage, 1, chain.TestnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to reopen blockchain: %v", err)
+	}
+	if state, _ := restarted.stateManager.GetWalletState(testAuthorAddress); state == nil || state.Balance != testAuthorFunds-len("funding")-len("honest") {
+		t.Errorf("Expected state to survive a restart, got %+v", state)
+	}
+}
+
+func TestWalletStateProofs(t *testing.T) {
+	// Regtest headers commit to their state roots from genesis
+	bc, storage := newNetworkTestBlockchain(t, "test_state_proofs.db", chain.RegtestNetworkID)
+
+	// Enough wallets that paths share prefixes
+	funds := make(map[string]int)
+	for i := 0; i < 50; i++ {
+		funds[fmt.Sprintf("wallet-%d", i)] = i + 1
+	}
+	genesis, _ := storage.GetBlock(0)
+	b1 := newFundingBlock(t, bc, genesis, "block one", funds)
+	b2 := newFundingBlock(t, bc, b1, "block two", map[string]int{"wallet-7": 100})
+	storeBlocks(t, bc, b1, b2)
+	headers := []*chain.BlockHeader{genesis.Header(), b1.Header(), b2.Header()}
+
+	// Every wallet proves against the header chain at each height
+	for _, block := range []*chain.Block{b1, b2} {
+		for address, amount := range funds {
+			proof, err := bc.GetWalletProof(address, block.Index)
+			if err != nil {
+				t.Fatalf("Failed to prove %s at height %d: %v", address, block.Index, err)
+			}
+			state, err := chain.VerifyWalletProof(proof, headers, chain.RegtestNetworkID)
+			if err != nil {
+				t.Fatalf("Proof for %s at height %d failed: %v", address, block.Index, err)
+			}
+			expected := amount
+			if address == "wallet-7" && block.Index == 2 {
+				expected += 100
+			}
+			if state == nil || state.Balance != expected {
+				t.Errorf("Expected %s to hold %d at height %d, got %+v", address, expected, block.Index, state)
+			}
+		}
+	}
+
+	// A proof does not verify a different balance or against another block
+	proof, err := bc.GetWalletProof("wallet-7", 1)
+	if err != nil {
+		t.Fatalf("Failed to prove wallet: %v", err)
+	}
+	forged := *proof.Wallet
+	forged.Balance += 100
+	if err := chain.VerifyWalletState(b1.Header(), "wallet-7", &forged, proof.Proof); err == nil {
+		t.Error("Expected proof of a forged balance to fail")
+	}
+	if err := chain.VerifyWalletState(b2.Header(), "wallet-7", proof.Wallet, proof.Proof); err == nil {
+		t.Error("Expected proof to fail against another block")
+	}
+	moved := *proof
+	moved.Header = b2.Header()
+	if _, err := chain.VerifyWalletProof(&moved, headers, chain.RegtestNetworkID); err == nil {
+		t.Error("Expected proof moved to another header to fail")
+	}
+	forgedHeader := *b1.Header()
+	forgedHeader.StateRoot = b2.StateRoot.Hash
+	if _, err := chain.VerifyWalletProof(proof, []*chain.BlockHeader{genesis.Header(), &forgedHeader}, chain.RegtestNetworkID); err == nil {
+		t.Error("Expected header with a forged state root to be rejected")
+	}
+
+	// Absent wallets get exclusion proofs that cannot be passed off as inclusion
+	proof, err = bc.GetWalletProof("missing", -1)
+	if err != nil {
+		t.Fatalf("Failed to prove absence: %v", err)
+	}
+	if proof.Header.Index != 2 {
+		t.Errorf("Expected proof against the latest block, got block %d", proof.Header.Index)
+	}
+	state, err := chain.VerifyWalletProof(proof, headers, chain.RegtestNetworkID)
+	if err != nil || state != nil {
+		t.Errorf("Expected verified absence, got %+v (%v)", state, err)
+	}
+	if err := chain.VerifyWalletState(b2.Header(), "missing", &chain.WalletState{Address: "missing", Balance: 1}, proof.Proof); err == nil {
+		t.Error("Expected exclusion proof not to prove a balance")
+	}
+	included, _ := bc.GetWalletProof("wallet-3", 2)
+	if err := chain.VerifyWalletState(b2.Header(), "wallet-3", nil, included.Proof); err == nil {
+		t.Error("Expected inclusion proof not to prove absence")
+	}
+
+	// Genesis predates the state tree
+	if _, err := bc.GetWalletProof("wallet-3", 0); err == nil {
+		t.Error("Expected no proof at genesis")
+	}
+
+	// Legacy headers do not commit to their state roots
+	legacy := *b2.Header()
+	legacy.Version = chain.EncodingLegacy
+	if err := chain.VerifyWalletState(&legacy, "wallet-3", included.Wallet, included.Proof); err == nil {
+		t.Error("Expected proof against a legacy header to be rejected")
+	}
+}
+
+func TestStateConsistencyCheck(t *testing.T) {
+	bc, storage := newTestBlockchain(t, "test_state_check.db")
+
+	// Block 1 mints the author's funds through a reward so the chain replays
+	genesis, _ := storage.GetBlock(0)
+	minted := chain.CalculateBatchReward(1)
+	reward := chain.UptimeReward{Recipient: testAuthorAddress, Amount: minted, Timestamp: genesis.Timestamp + 1}
+	b1 := chain.CreateBlockWithRewards(bc.paramsAt(1), 1, genesis.Hash, []chain.Post{}, []chain.Transfer{}, []chain.UptimeReward{reward}, nil)
+	b1.Timestamp = reward.Timestamp
+	sealTestBlock(t, bc, genesis, b1, nil)
+	b2 := newTestBlock(t, bc, b1, "honest", nil)
+	storeBlocks(t, bc, b1, b2)
+
+	balance, err := bc.GetCharacterBalance(testAuthorAddress)
+	if err != nil || balance != minted-len("honest") {
+		t.Fatalf("Expected balance %d from connected blocks, got %d (%v)", minted-len("honest"), balance, err)
+	}
+
+	report, err := bc.CheckStateConsistency()
+	if err != nil {
+		t.Fatalf("Failed to check state: %v", err)
+	}
+	if !report.Consistent || report.BlocksReplayed != 2 || report.StateRoot != b2.StateRoot.Hash {
+		t.Fatalf("Expected honest chain to replay consistently, got %+v", report)
+	}
+
+	// State changed outside of blocks is reported
+	bc.stateManager.UpdateWalletState(testAuthorAddress, 5, 0)
+	report, err = bc.CheckStateConsistency()
+	if err != nil {
+		t.Fatalf("Failed to check state: %v", err)
+	}
+	if report.Consistent || len(report.Mismatches) != 1 {
+		t.Fatalf("Expected one mismatch, got %+v", report)
+	}
+	mismatch := report.Mismatches[0]
+	if mismatch.Address != testAuthorAddress || mismatch.ReplayedBalance != minted-len("honest") || mismatch.CurrentBalance != 5 {
+		t.Errorf("Unexpected mismatch: %+v", mismatch)
+	}
+
+	// Only one replay runs at a time
+	bc.stateCheck.Store(true)
+	if _, err := bc.CheckStateConsistency(); !errors.Is(err, ErrStateCheckRunning) {
+		t.Errorf("Expected a second check to be refused while one runs, got %v", err)
+	}
+	bc.stateCheck.Store(false)
+
+	// So is a block whose state root its contents do not produce
+	funded, fundedStorage := newTestBlockchain(t, "test_state_check_funded.db")
+	fundedGenesis, _ := fundedStorage.GetBlock(0)
+	storeBlocks(t, funded, newFundingBlock(t, funded, fundedGenesis, "funding", nil))
+	report, err = funded.CheckStateConsistency()
+	if err != nil {
+		t.Fatalf("Failed to check state: %v", err)
+	}
+	if report.Consistent || report.BlocksReplayed != 0 || report.BlockError == "" {
+		t.Errorf("Expected replay to stop at the funding block, got %+v", report)
+	}
+}
+
+func TestUnicodeCharacterCount(t *testing.T) {
+	bc, _ := newTestBlockchain(t, "test_unicode_count.db")
+
+	// Before activation posts cost one character per byte, after it one per code point
+	activation, scheduled := chain.Params(chain.TestnetNetworkID).ActivationHeight(chain.UpgradeUnicodeCount)
+	if !scheduled {
+		t.Fatal("Expected the Unicode count upgrade to be scheduled on testnet")
+	}
+	before, after := bc.paramsAt(activation-1), bc.paramsAt(activation)
+	for content, bytes := range map[string]int{"hello": 5, "привет": 12, "你好": 6, "👍": 4} {
+		if count := chain.CountCharacters(content, before); count != bytes {
+			t.Errorf("Expected %q to cost %d before activation, got %d", content, bytes, count)
+		}
+	}
+	for content, chars := range map[string]int{"hello": 5, "привет": 6, "你好": 2, "👍": 1} {
+		if count := chain.CountCharacters(content, after); count != chars {
+			t.Errorf("Expected %q to cost %d after activation, got %d", content, chars, count)
+		}
+	}
+
+	// Blocks count their posts by the rule at their own height
+	post := chain.Post{Author: "author", Content: "привет", Timestamp: time.Now().Unix(), Signature: "signature"}
+	post.SetHash()
+	emptyRoot := func(index int) *chain.StateRoot {
+		root := &chain.StateRoot{BlockIndex: index}
+		root.SetHash()
+		return root
+	}
+	stateRoot := emptyRoot(activation)
+	block := chain.CreateBlock(after, activation, "prev", []chain.Post{post}, []chain.Transfer{}, stateRoot)
+	if block.CharCount != 6 {
+		t.Errorf("Expected block char count 6, got %d", block.CharCount)
+	}
+	if err := block.ValidateBlockAssumeValid(after); err != nil {
+		t.Errorf("Expected block with NFC post to be valid: %v", err)
+	}
+
+	// Once active, blocks may only carry NFC text
+	decomposed := chain.Post{Author: "author", Content: "cafe\u0301", Timestamp: time.Now().Unix(), Signature: "signature"}
+	decomposed.SetHash()
+	block = chain.CreateBlock(after, activation, "prev", []chain.Post{decomposed}, []chain.Transfer{}, stateRoot)
+	if err := block.ValidateBlockAssumeValid(after); err == nil {
+		t.Error("Expected block with a non-NFC post to be rejected")
+	}
+	block = chain.CreateBlock(before, activation-1, "prev", []chain.Post{decomposed}, []chain.Transfer{}, emptyRoot(activation-1))
+	if err := block.ValidateBlockAssumeValid(before); err != nil {
+		t.Errorf("Expected non-NFC post to stay valid before activation: %v", err)
+	}
+
+	// Submitted posts are normalized when created and rejected otherwise
+	w, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	created, err := bc.CreatePost("cafe\u0301", w)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if created.Content != "caf\u00e9" {
+		t.Errorf("Expected content to be normalized, got %q", created.Content)
+	}
+	unnormalized := *created
+	unnormalized.Content = "cafe\u0301"
+	if err := bc.AddPost(unnormalized); err == nil || !strings.Contains(err.Error(), "NFC") {
+		t.Errorf("Expected non-NFC post to be rejected on submit, got %v", err)
+	}
+}
+
+func TestNodeConsensusParams(t *testing.T) {
+	// Nodes follow the network's post count and fee
+	bc, _ := newTestBlockchain(t, "test_consensus_params.db")
+	if params := bc.GetConsensusParams(1); params.PostsPerBlock != 1 {
+		t.Errorf("Expected testnet to use the node's post threshold, got %d", params.PostsPerBlock)
+	}
+	transfer := chain.Transfer{GasFee: 2}
+	if err := transfer.ValidateRules(bc.GetConsensusParams(1)); err == nil {
+		t.Error("Expected a transfer paying the wrong fee to be rejected")
+	}
+}
+
+func TestNodeNetworkGenesis(t *testing.T) {
+	// A chain of one network is never accepted by another
+	bc, storage := newTestBlockchain(t, "test_network_genesis.db")
+	genesis, _ := storage.GetBlock(0)
+	if genesis.Hash != chain.TestnetGenesisHash {
+		t.Fatalf("Expected the testnet genesis block, got %s", genesis.Hash)
+	}
+	if _, _, err := bc.ValidateAndIntegrateChain([]*chain.Block{chain.CreateGenesisBlock()}); err == nil {
+		t.Error("Expected testnet to reject a chain starting at the mainnet genesis block")
+	}
+	if _, err := NewBlockchain(storage, 1, chain.RegtestNetworkID); err == nil {
+		t.Error("Expected a regtest node to refuse a testnet database")
+	}
+	if _, err := NewBlockchain(storage, 1, "truthchain-unknown"); err == nil {
+		t.Error("Expected an unknown network to be rejected")
+	}
+}
+
+func TestRegtestBlocksOnDemand(t *testing.T) {
+	bc, _ := newNetworkTestBlockchain(t, "test_regtest.db", chain.RegtestNetworkID)
+
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	bob, err := wallet.NewTestnetWallet("bob")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	mainnetWallet, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+
+	// Wallets are funded locally, each funding in its own block
+	if _, err := bc.FundWallet(alice.GetAddress(), 500); err != nil {
+		t.Fatalf("Failed to fund wallet: %v", err)
+	}
+	if _, err := bc.FundWallet(alice.GetAddress(), 500); err != nil {
+		t.Fatalf("Failed to fund wallet twice: %v", err)
+	}
+	if balance, _ := bc.GetCharacterBalance(alice.GetAddress()); balance != 1000 {
+		t.Errorf("Expected funded balance 1000, got %d", balance)
+	}
+	if _, err := bc.FundWallet(mainnetWallet.GetAddress(), 500); err == nil {
+		t.Error("Expected funding a mainnet address on regtest to be rejected")
+	}
+
+	// Posts and transfers wait for a block to be generated
+	post, err := bc.CreatePost("hello regtest", alice)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if err := bc.AddPost(*post); err != nil {
+		t.Fatalf("Failed to add post: %v", err)
+	}
+	transfer, err := bc.CreateTransfer(bob.GetAddress(), 100, alice)
+	if err != nil {
+		t.Fatalf("Failed to create transfer: %v", err)
+	}
+	if err := bc.AddTransfer(*transfer); err != nil {
+		t.Fatalf("Failed to add transfer: %v", err)
+	}
+	if length, _ := bc.GetChainLength(); length != 3 {
+		t.Fatalf("Expected no block before generating, chain length %d", length)
+	}
+
+	blocks, err := bc.GenerateBlocks(2)
+	if err != nil {
+		t.Fatalf("Failed to generate blocks: %v", err)
+	}
+	if len(blocks) != 2 || len(blocks[0].Posts) != 1 || len(blocks[0].Transfers) != 1 || len(blocks[1].Posts) != 0 {
+		t.Fatalf("Expected the pending post and transfer in the first generated block, got %d blocks", len(blocks))
+	}
+	if balance, _ := bc.GetCharacterBalance(bob.GetAddress()); balance != 100 {
+		t.Errorf("Expected bob to receive 100, got %d", balance)
+	}
+	expected := 1000 - 100 - 1 - len("hello regtest")
+	if balance, _ := bc.GetCharacterBalance(alice.GetAddress()); balance != expected {
+		t.Errorf("Expected alice to have %d left, got %d", expected, balance)
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Expected the regtest chain to validate: %v", err)
+	}
+	if report, err := bc.CheckStateConsistency(); err != nil || !report.Consistent {
+		t.Errorf("Expected the regtest chain to replay consistently: %+v, %v", report, err)
+	}
+
+	// Addresses of other networks cannot receive transfers
+	foreign, err := chain.NewTransfer(bc.GetConsensusParams(6), bob, mainnetWallet.GetAddress(), 10, 1)
+	if err == nil {
+		t.Errorf("Expected a transfer to a mainnet address to be rejected, got %+v", foreign)
+	}
+
+	// Other networks neither generate blocks nor fund wallets on demand
+	testnet, _ := newTestBlockchain(t, "test_regtest_testnet.db")
+	if _, err := testnet.GenerateBlocks(1); err == nil {
+		t.Error("Expected testnet to refuse generating blocks")
+	}
+	if _, err := testnet.FundWallet(alice.GetAddress(), 10); err == nil {
+		t.Error("Expected testnet to refuse funding wallets")
+	}
+}
+
+func TestSignedGenesis(t *testing.T) {
+	authority, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	impostor, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	network := &chain.Network{
+		ID:               "truthchain-signed",
+		GenesisTimestamp: chain.MainnetGenesisTimestamp,
+		GenesisAuthority: authority.GetAddress(),
+	}
+	network.GenesisHash = network.GenesisBlock().Hash
+
+	// An unsigned genesis block is not canonical
+	genesis := network.GenesisBlock()
+	if err := network.ValidateGenesis(genesis); err == nil {
+		t.Error("Expected an unsigned genesis block to be rejected")
+	}
+	if err := chain.ValidateCanonicalGenesis(chain.MainnetNetworkID, chain.CreateGenesisBlock()); err == nil {
+		t.Error("Expected the unsigned mainnet genesis block to be rejected")
+	}
+
+	// The authority's signature leaves the hash unchanged and validates
+	if err := chain.SignGenesisBlock(genesis, network.ID, authority); err != nil {
+		t.Fatalf("Failed to sign genesis block: %v", err)
+	}
+	if genesis.Hash != network.GenesisHash || genesis.CalculateHash() != genesis.Hash {
+		t.Errorf("Expected signing to leave the genesis hash unchanged, got %s", genesis.Hash)
+	}
+	if err := network.ValidateGenesis(genesis); err != nil {
+		t.Errorf("Expected the signed genesis block to validate: %v", err)
+	}
+
+	// The signature survives the genesis file written by the CLI
+	path := "test_signed_genesis.json"
+	t.Cleanup(func() { os.Remove(path) })
+	if err := chain.SaveGenesisBlock(genesis, path); err != nil {
+		t.Fatalf("Failed to save genesis block: %v", err)
+	}
+	loaded, err := chain.LoadGenesisBlock(path)
+	if err != nil {
+		t.Fatalf("Failed to load genesis block: %v", err)
+	}
+	if err := network.ValidateGenesis(loaded); err != nil {
+		t.Errorf("Expected the loaded genesis block to validate: %v", err)
+	}
+
+	// Other keys and other networks' signatures are rejected
+	forged := network.GenesisBlock()
+	if err := chain.SignGenesisBlock(forged, network.ID, impostor); err != nil {
+		t.Fatalf("Failed to sign genesis block: %v", err)
+	}
+	if err := network.ValidateGenesis(forged); err == nil {
+		t.Error("Expected a genesis block signed by another key to be rejected")
+	}
+	replayed := *network
+	replayed.ID = "truthchain-other"
+	if err := replayed.ValidateGenesis(genesis); err == nil {
+		t.Error("Expected a genesis signature for another network to be rejected")
+	}
+
+	// An unsigned block is still refused when it no longer hashes to the genesis hash
+	tampered := network.GenesisBlock()
+	tampered.Timestamp++
+	if err := network.ValidateStoredGenesis(tampered); err == nil {
+		t.Error("Expected a stored genesis block with changed contents to be rejected")
+	}
+}
+
+// baselineGenesisJSON is the mainnet genesis block as the first release stored it
+const baselineGenesisJSON = `{"index":0,"timestamp":1751485627,"prev_hash":"","hash":"38025032e3f12e8270d7fdb2bf2dad92b9b3d5a53967f40eeebe4e7f52c1a934","posts":[],"transfers":[],"state_root":{"wallets":[],"hash":"c72dfd162ed2491bc174b5fe5761e0906f1896c2ae79d8baf39f85f03bcada1b","block_index":0},"char_count":0}`
+
+func TestBaselineGenesisDatabase(t *testing.T) {
+	// Write the database a first-release mainnet node left behind
+	dbPath := "test_baseline_genesis.db"
+	os.Remove(dbPath)
+	t.Cleanup(func() { os.Remove(dbPath) })
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		blocks, err := tx.CreateBucket([]byte("blocks"))
+		if err != nil {
+			return err
+		}
+		metadata, err := tx.CreateBucket([]byte("metadata"))
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{"0", chain.MainnetGenesisHash} {
+			if err := blocks.Put([]byte(key), []byte(baselineGenesisJSON)); err != nil {
+				return err
+			}
+		}
+		return metadata.Put([]byte("latest_block_index"), []byte("0"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to write baseline database: %v", err)
+	}
+
+	// Its unsigned genesis block still opens on mainnet
+	storage, err := store.NewBoltDBStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	defer storage.Close()
+	bc, err := NewBlockchain(storage, chain.MainnetMinPosts, chain.MainnetNetworkID)
+	if err != nil {
+		t.Fatalf("Expected mainnet to open a baseline database: %v", err)
+	}
+	if genesis, err := bc.GetBlockByIndex(0); err != nil || genesis.Hash != chain.MainnetGenesisHash {
+		t.Errorf("Expected the baseline genesis block, got %v (%v)", genesis, err)
+	}
+}
+
+func TestTransferSigningRoundTrip(t *testing.T) {
+	for _, networkID := range []string{chain.RegtestNetworkID, chain.TestnetNetworkID} {
+		bc, storage := newNetworkTestBlockchain(t, "test_transfer_signing_"+networkID+".db", networkID)
+
+		alice, err := wallet.NewTestnetWallet("alice")
+		if err != nil {
+			t.Fatalf("Failed to create wallet: %v", err)
+		}
+		bob, err := wallet.NewTestnetWallet("bob")
+		if err != nil {
+			t.Fatalf("Failed to create wallet: %v", err)
+		}
+
+		genesis, _ := storage.GetBlock(0)
+		funding := newFundingBlock(t, bc, genesis, "funding", map[string]int{alice.GetAddress(): 100})
+		storeBlocks(t, bc, funding)
+
+		// A transfer created by the node passes every check a peer runs
+		transfer, err := bc.CreateTransfer(bob.GetAddress(), 10, alice)
+		if err != nil {
+			t.Fatalf("%s: failed to create transfer: %v", networkID, err)
+		}
+		if transfer.Version != bc.paramsAt(2).Encoding {
+			t.Errorf("%s: expected the transfer in the encoding of the next block, got %d", networkID, transfer.Version)
+		}
+		if err := chain.NewMempool(chain.DefaultMempoolLimits, nil).Add(*transfer, 0); err != nil {
+			t.Errorf("%s: expected the transfer pool to accept the transfer: %v", networkID, err)
+		}
+		wire, err := chain.EncodeWire(transfer)
+		if err != nil {
+			t.Fatalf("%s: failed to encode transfer: %v", networkID, err)
+		}
+		relayed := &chain.Transfer{}
+		if err := chain.DecodeWire(wire, relayed); err != nil {
+			t.Fatalf("%s: failed to decode transfer: %v", networkID, err)
+		}
+		if err := relayed.Validate(); err != nil {
+			t.Errorf("%s: expected a relayed transfer to validate: %v", networkID, err)
+		}
+		if err := bc.AddTransfer(*relayed); err != nil {
+			t.Fatalf("%s: failed to add transfer: %v", networkID, err)
+		}
+
+		// ...and inside a block
+		block := newTestBlock(t, bc, funding, "transfer", []chain.Transfer{*transfer})
+		if err := block.ValidateBlockWithParams(bc.paramsAt(2)); err != nil {
+			t.Errorf("%s: expected the block carrying the transfer to validate: %v", networkID, err)
+		}
+		if added, _, err := bc.IntegrateBlocksFromSync([]*chain.Block{block}); err != nil || added != 1 {
+			t.Errorf("%s: expected the block to connect: added %d, %v", networkID, added, err)
+		}
+		if balance, _ := bc.GetCharacterBalance(bob.GetAddress()); balance != 10 {
+			t.Errorf("%s: expected bob to receive 10, got %d", networkID, balance)
+		}
+
+		// Changing any signed field or signing for someone else invalidates the transfer
+		tampered := *transfer
+		tampered.Amount = 50
+		tampered.Hash, _ = tampered.CalculateHash()
+		if err := tampered.Validate(); err == nil {
+			t.Errorf("%s: expected a tampered transfer to be rejected", networkID)
+		}
+		if err := tampered.Sign(bob); err == nil {
+			t.Errorf("%s: expected bob to be unable to sign alice's transfer", networkID)
+		}
+	}
+
+	// Transfers already on chain were signed over a colon-joined message; only legacy ones keep that
+	alice, _ := wallet.NewTestnetWallet("alice")
+	bob, _ := wallet.NewTestnetWallet("bob")
+	legacy := chain.Transfer{From: alice.GetAddress(), To: bob.GetAddress(), Amount: 10, GasFee: 1, Timestamp: time.Now().Unix(), Nonce: 1}
+	legacy.Hash, _ = legacy.CalculateHash()
+	signature, _ := alice.Sign([]byte(fmt.Sprintf("%s:%s:%d:%d:%d:%d", legacy.From, legacy.To, legacy.Amount, legacy.GasFee, legacy.Timestamp, legacy.Nonce)))
+	legacy.Signature = hex.EncodeToString(signature)
+	if err := legacy.Validate(); err != nil {
+		t.Errorf("Expected a legacy-signed transfer to stay valid: %v", err)
+	}
+	canonical := legacy
+	canonical.Version = chain.EncodingCanonical
+	canonical.Hash, _ = canonical.CalculateHash()
+	if err := canonical.Validate(); err == nil {
+		t.Error("Expected the legacy signing message to be rejected for canonical transfers")
+	}
+}
+
+func TestPostSigning(t *testing.T) {
+	bc, _ := newNetworkTestBlockchain(t, "test_post_signing.db", chain.RegtestNetworkID)
+
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	bob, err := wallet.NewTestnetWallet("bob")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	if _, err := bc.FundWallet(alice.GetAddress(), 100); err != nil {
+		t.Fatalf("Failed to fund wallet: %v", err)
+	}
+
+	// A post created by the node verifies from the post alone, after relaying too
+	post, err := bc.CreatePost("signed once", alice)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if err := post.VerifySignature(chain.RegtestNetworkID); err != nil {
+		t.Errorf("Expected the created post to verify: %v", err)
+	}
+	wire, err := chain.EncodeWire(post)
+	if err != nil {
+		t.Fatalf("Failed to encode post: %v", err)
+	}
+	relayed := &chain.Post{}
+	if err := chain.DecodeWire(wire, relayed); err != nil {
+		t.Fatalf("Failed to decode post: %v", err)
+	}
+	if err := bc.AddPost(*relayed); err != nil {
+		t.Fatalf("Expected a relayed post to be accepted: %v", err)
+	}
+
+	// The signature is bound to the network, the timestamp and the content
+	if err := post.VerifySignature(chain.TestnetNetworkID); err == nil {
+		t.Error("Expected a regtest post signature to be rejected on testnet")
+	}
+	tampered := *post
+	tampered.Timestamp++
+	if err := tampered.VerifySignature(chain.RegtestNetworkID); err == nil {
+		t.Error("Expected a post with a changed timestamp to be rejected")
+	}
+	tampered = *post
+	tampered.Content = "signed twice"
+	if err := tampered.VerifySignature(chain.RegtestNetworkID); err == nil {
+		t.Error("Expected a post with changed content to be rejected")
+	}
+	if err := post.Sign(bob, chain.RegtestNetworkID); err == nil {
+		t.Error("Expected bob to be unable to sign alice's post")
+	}
+
+	// Legacy posts are signed over author, content and timestamp, as the chain always signed them
+	legacy := chain.Post{Author: alice.GetAddress(), Content: "legacy", Timestamp: time.Now().Unix()}
+	if err := legacy.Sign(alice, chain.TestnetNetworkID); err != nil {
+		t.Fatalf("Failed to sign legacy post: %v", err)
+	}
+	signature, _ := alice.Sign([]byte(fmt.Sprintf("%s%s%d", legacy.Author, legacy.Content, legacy.Timestamp)))
+	if legacy.Signature != hex.EncodeToString(signature) {
+		t.Error("Expected a legacy post to be signed over author, content and timestamp")
+	}
+	if err := legacy.VerifySignature(chain.TestnetNetworkID); err != nil {
+		t.Errorf("Expected a legacy-signed post to stay valid: %v", err)
+	}
+	canonical := legacy
+	canonical.Version = chain.EncodingCanonical
+	canonical.SetHash()
+	if err := canonical.VerifySignature(chain.TestnetNetworkID); err == nil {
+		t.Error("Expected the legacy signing message to be rejected for canonical posts")
+	}
+
+	// Their signatures are not bound to a network, so they end with the legacy encoding
+	if err := bc.AddPost(legacy); err == nil {
+		t.Error("Expected a legacy post to be refused once blocks are canonical")
+	}
+}
+
+func TestPendingTransfers(t *testing.T) {
+	dbPath := "test_mempool.db"
+	bc, storage := newNetworkTestBlockchain(t, dbPath, chain.RegtestNetworkID)
+
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	bob, err := wallet.NewTestnetWallet("bob")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	if _, err := bc.FundWallet(alice.GetAddress(), 1000); err != nil {
+		t.Fatalf("Failed to fund wallet: %v", err)
+	}
+	params := bc.paramsAt(bc.nextBlockHeight())
+
+	// Reading the next nonce does not use it up
+	if first, second := bc.GetNextNonce(alice.GetAddress()), bc.GetNextNonce(alice.GetAddress()); first != 1 || second != 1 {
+		t.Errorf("Expected the next nonce to stay 1, got %d then %d", first, second)
+	}
+
+	// Queued transfers take consecutive nonces
+	for i := 0; i < 2; i++ {
+		transfer, err := bc.CreateTransfer(bob.GetAddress(), 10, alice)
+		if err != nil {
+			t.Fatalf("Failed to create transfer: %v", err)
+		}
+		if transfer.Nonce != int64(i+1) {
+			t.Errorf("Expected queued transfer %d to take nonce %d, got %d", i, i+1, transfer.Nonce)
+		}
+		if err := bc.AddTransfer(*transfer); err != nil {
+			t.Fatalf("Failed to add transfer: %v", err)
+		}
+	}
+
+	// A transfer after a nonce gap waits
+	future, _ := chain.NewTransfer(params, alice, bob.GetAddress(), 10, 4)
+	if err := bc.AddTransfer(*future); err != nil {
+		t.Fatalf("Failed to queue a future nonce: %v", err)
+	}
+
+	// The pool survives a restart
+	storage.Close()
+	storage, err = store.NewBoltDBStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	bc, err = NewBlockchain(storage, 1, chain.RegtestNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to reopen blockchain: %v", err)
+	}
+	if bc.Mempool.Count() != 3 {
+		t.Fatalf("Expected 3 transfers after restart, got %d", bc.Mempool.Count())
+	}
+
+	// A block takes the ready run; the transfer after the gap stays queued
+	blocks, err := bc.GenerateBlocks(1)
+	if err != nil {
+		t.Fatalf("Failed to generate block: %v", err)
+	}
+	if len(blocks[0].Transfers) != 2 {
+		t.Errorf("Expected the block to carry 2 transfers, got %d", len(blocks[0].Transfers))
+	}
+	if balance, _ := bc.GetCharacterBalance(bob.GetAddress()); balance != 20 {
+		t.Errorf("Expected bob to receive 20, got %d", balance)
+	}
+	if bc.Mempool.Count() != 1 || bc.GetNextNonce(alice.GetAddress()) != 3 {
+		t.Errorf("Expected only the gapped transfer left and nonce 3 next, got %d and %d", bc.Mempool.Count(), bc.GetNextNonce(alice.GetAddress()))
+	}
+	stale, _ := chain.NewTransfer(params, alice, bob.GetAddress(), 10, 1)
+	if err := bc.AddTransfer(*stale); err == nil {
+		t.Error("Expected a confirmed nonce to be refused")
+	}
+
+	// Filling the gap makes the queued transfer ready behind it
+	gap, _ := bc.CreateTransfer(bob.GetAddress(), 10, alice)
+	if err := bc.AddTransfer(*gap); err != nil {
+		t.Fatalf("Failed to fill the gap: %v", err)
+	}
+	if ready := bc.Mempool.Ready(bc.stateManager.GetNonce, 0); len(ready) != 2 || ready[1].Hash != future.Hash {
+		t.Errorf("Expected the gapped transfer ready after the gap, got %d transfers", len(ready))
+	}
+}
+
+func TestVariableFees(t *testing.T) {
+	// Transfers pay exactly the gas fee until fees become variable, then at least it
+	testnet := chain.Params(chain.TestnetNetworkID)
+	height, scheduled := testnet.ActivationHeight(chain.UpgradeVariableFees)
+	if !scheduled {
+		t.Fatal("Expected variable fees to be scheduled on testnet")
+	}
+	alice, _ := wallet.NewTestnetWallet("alice")
+	bob, _ := wallet.NewTestnetWallet("bob")
+	carol, _ := wallet.NewTestnetWallet("carol")
+	for _, tc := range []struct {
+		height int
+		fee    int
+		valid  bool
+	}{
+		{height - 1, 1, true},
+		{height - 1, 2, false},
+		{height, 2, true},
+		{height, chain.MaxGasFee, true},
+		{height, chain.MaxGasFee + 1, false},
+		{height, 0, false},
+	} {
+		transfer := chain.Transfer{From: alice.GetAddress(), To: bob.GetAddress(), Amount: 10, GasFee: tc.fee}
+		if err := transfer.ValidateRules(testnet.ParamsAt(tc.height)); (err == nil) != tc.valid {
+			t.Errorf("Fee %d at height %d: expected valid %v, got %v", tc.fee, tc.height, tc.valid, err)
+		}
+	}
+	if _, err := chain.NewTransferWithFee(testnet.ParamsAt(height-1), alice, bob.GetAddress(), 10, 5, 1); err == nil {
+		t.Error("Expected a raised fee to be refused before the upgrade")
+	}
+
+	// Blocks take the best fee per byte first, each sender in nonce order
+	bc, _ := newNetworkTestBlockchain(t, "test_variable_fees.db", chain.RegtestNetworkID)
+	for _, w := range []*wallet.Wallet{alice, carol} {
+		if _, err := bc.FundWallet(w.GetAddress(), 1000); err != nil {
+			t.Fatalf("Failed to fund wallet: %v", err)
+		}
+	}
+	queue := func(w *wallet.Wallet, fee int) *chain.Transfer {
+		transfer, err := bc.CreateTransferWithFee(bob.GetAddress(), 10, fee, w)
+		if err != nil {
+			t.Fatalf("Failed to create transfer: %v", err)
+		}
+		if err := bc.AddTransfer(*transfer); err != nil {
+			t.Fatalf("Failed to add transfer: %v", err)
+		}
+		return transfer
+	}
+	aliceFirst := queue(alice, 1)
+	aliceSecond := queue(alice, 9)
+	carolOnly := queue(carol, 5)
+	ready := bc.Mempool.Ready(bc.stateManager.GetNonce, 0)
+	if len(ready) != 3 || ready[0].Hash != carolOnly.Hash || ready[1].Hash != aliceFirst.Hash || ready[2].Hash != aliceSecond.Hash {
+		t.Errorf("Expected carol's transfer first, then alice's in nonce order, got %+v", ready)
+	}
+	encoded, _ := carolOnly.MarshalBinary()
+	if ready := bc.Mempool.Ready(bc.stateManager.GetNonce, len(encoded)); len(ready) != 1 || ready[0].Hash != carolOnly.Hash {
+		t.Errorf("Expected only the best paying transfer to fit one transfer's bytes, got %d", len(ready))
+	}
+
+	blocks, err := bc.GenerateBlocks(1)
+	if err != nil {
+		t.Fatalf("Failed to generate block: %v", err)
+	}
+	if len(blocks[0].Transfers) != 3 {
+		t.Errorf("Expected the block to carry 3 transfers, got %d", len(blocks[0].Transfers))
+	}
+	if balance, _ := bc.GetCharacterBalance(carol.GetAddress()); balance != 1000-15 {
+		t.Errorf("Expected carol to pay her raised fee, balance %d", balance)
+	}
+	estimate, err := bc.EstimateFees()
+	if err != nil {
+		t.Fatalf("Failed to estimate fees: %v", err)
+	}
+	if !estimate.VariableFees || estimate.Transfers != 3 || estimate.MinimumFee != 1 {
+		t.Errorf("Unexpected estimate: %+v", estimate)
+	}
+}
+
+func TestPendingPosts(t *testing.T) {
+	dbPath := "test_post_pool.db"
+	bc, storage := newNetworkTestBlockchain(t, dbPath, chain.RegtestNetworkID)
+
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	bob, err := wallet.NewTestnetWallet("bob")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	if _, err := bc.FundWallet(alice.GetAddress(), 100); err != nil {
+		t.Fatalf("Failed to fund wallet: %v", err)
+	}
+	post := func(characters int) *chain.Post {
+		post, err := bc.CreatePost(strings.Repeat("a", characters), alice)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		return post
+	}
+
+	// Every pending post and transfer reserves part of the author's balance
+	first := post(60)
+	if err := bc.AddPost(*first); err != nil {
+		t.Fatalf("Failed to add post: %v", err)
+	}
+	if err := bc.AddPost(*post(60)); err == nil {
+		t.Error("Expected a post beyond the balance left after pending posts to be refused")
+	}
+	transfer, _ := bc.CreateTransfer(bob.GetAddress(), 30, alice)
+	if err := bc.AddTransfer(*transfer); err != nil {
+		t.Fatalf("Failed to add transfer: %v", err)
+	}
+	if err := bc.AddPost(*post(10)); err == nil {
+		t.Error("Expected a post beyond the balance left after pending transfers to be refused")
+	}
+	tooMuch, _ := bc.CreateTransfer(bob.GetAddress(), 10, alice)
+	if err := bc.AddTransfer(*tooMuch); err == nil {
+		t.Error("Expected a transfer beyond the balance left after pending posts to be refused")
+	}
+
+	// The pool rebuilds from storage on restart, re-validating every entry
+	forged := *post(5)
+	forged.Content = "forged"
+	forged.SetHash()
+	if err := storage.SavePendingPost(forged); err != nil {
+		t.Fatalf("Failed to save pending post: %v", err)
+	}
+	storage.Close()
+	storage, err = store.NewBoltDBStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	bc, err = NewBlockchain(storage, 1, chain.RegtestNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to reopen blockchain: %v", err)
+	}
+	if pending := bc.GetPendingPosts(); len(pending) != 1 || pending[0].Hash != first.Hash || bc.Mempool.Count() != 1 {
+		t.Errorf("Expected the post and transfer back after restart, got %d posts and %d transfers", len(pending), bc.Mempool.Count())
+	}
+	if stored, _ := storage.GetPendingPosts(); len(stored) != 1 {
+		t.Errorf("Expected the forged post dropped from storage, %d stored", len(stored))
+	}
+
+	// Confirmed posts leave the pool and free nothing twice
+	if _, err := bc.GenerateBlocks(1); err != nil {
+		t.Fatalf("Failed to generate block: %v", err)
+	}
+	if bc.GetPendingPostCount() != 0 {
+		t.Errorf("Expected the confirmed post to leave the pool, %d left", bc.GetPendingPostCount())
+	}
+	if balance, _ := bc.GetCharacterBalance(alice.GetAddress()); balance != 100-60-31 {
+		t.Errorf("Expected alice charged for the post and transfer, balance %d", balance)
+	}
+	if err := bc.AddPost(*first); err == nil {
+		t.Error("Expected a confirmed post to be refused")
+	}
+}
+
+func TestBlockBudget(t *testing.T) {
+	testnet := chain.Params(chain.TestnetNetworkID)
+	height, _ := testnet.ActivationHeight(chain.UpgradeBlockBudget)
+	before, after := testnet.ParamsAt(height-1), testnet.ParamsAt(height)
+	before.PostsPerBlock = 1
+	if before.BlockBudget || !after.BlockBudget {
+		t.Fatalf("Expected the block budget to activate at height %d", height)
+	}
+
+	posts := func(count int, characters int) []chain.Post {
+		posts := make([]chain.Post, count)
+		for i := range posts {
+			posts[i] = newSignedPost(t, after, testAuthor, fmt.Sprintf("%02d%s", i, strings.Repeat("a", characters-2)))
+		}
+		return posts
+	}
+
+	// Before the upgrade a block carries exactly the post count, so heartbeats are invalid
+	if err := chain.CreateBlock(before, height, "parent", posts(2, 10), nil, nil).ValidateBlockWithParams(before); err == nil {
+		t.Error("Expected the exact post count to hold before the upgrade")
+	}
+	if err := chain.CreateBlock(before, height, "parent", []chain.Post{}, nil, nil).ValidateBlockWithParams(before); err == nil {
+		t.Error("Expected a heartbeat block to be rejected before the upgrade")
+	}
+
+	// After it blocks carry any number of posts up to the character budget
+	heartbeat := chain.CreateBlock(after, height, "parent", []chain.Post{}, nil, nil)
+	if err := heartbeat.ValidateBlockWithParams(after); err != nil || !heartbeat.IsHeartbeat() {
+		t.Errorf("Expected a heartbeat block to be valid after the upgrade: %v", err)
+	}
+	perBlock := chain.CharacterThreshold / chain.MaxPostSize
+	if err := chain.CreateBlock(after, height, "parent", posts(perBlock, chain.MaxPostSize), nil, nil).ValidateBlockWithParams(after); err != nil {
+		t.Errorf("Expected a block filling the character budget to be valid: %v", err)
+	}
+	if err := chain.CreateBlock(after, height, "parent", posts(perBlock+1, chain.MaxPostSize), nil, nil).ValidateBlockWithParams(after); err == nil {
+		t.Error("Expected a block past the character budget to be rejected")
+	}
+
+	// Heartbeats come at least HeartbeatInterval after their parent, and no block goes back past the median time
+	parent := &chain.Block{Index: height - 1, Timestamp: time.Now().Unix()}
+	below := func(int) (*chain.Block, error) { return parent, nil }
+	now := parent.Timestamp
+	spacing := int64(chain.HeartbeatInterval.Seconds())
+	heartbeat.Timestamp = parent.Timestamp + spacing - 1
+	if err := heartbeat.ValidateAfter(below, now, after); err == nil {
+		t.Error("Expected a heartbeat too soon after its parent to be rejected")
+	}
+	if err := heartbeat.ValidateAfter(below, now, before); err != nil {
+		t.Errorf("Expected no spacing rule before the upgrade: %v", err)
+	}
+	heartbeat.Timestamp = parent.Timestamp + spacing
+	if err := heartbeat.ValidateAfter(below, now, after); err != nil {
+		t.Errorf("Expected a heartbeat after the interval to be valid: %v", err)
+	}
+	block := chain.CreateBlock(after, height, "parent", posts(1, 10), nil, nil)
+	block.Timestamp = parent.Timestamp
+	if err := block.ValidateAfter(below, now, after); err != nil {
+		t.Errorf("Expected a block with posts to follow its parent at once: %v", err)
+	}
+	block.Timestamp = parent.Timestamp - 1
+	if err := block.ValidateAfter(below, now, after); err == nil {
+		t.Error("Expected a block older than its parent to be rejected")
+	}
+
+	// Nodes assemble blocks by the budget, oldest posts first
+	bc, _ := newNetworkTestBlockchain(t, "test_block_budget.db", chain.RegtestNetworkID)
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	if _, err := bc.FundWallet(alice.GetAddress(), 2*chain.CharacterThreshold); err != nil {
+		t.Fatalf("Failed to fund wallet: %v", err)
+	}
+	for i := 0; i <= perBlock; i++ {
+		post, err := bc.CreatePost(fmt.Sprintf("%02d%s", i, strings.Repeat("a", chain.MaxPostSize-2)), alice)
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		if err := bc.AddPost(*post); err != nil {
+			t.Fatalf("Failed to add post %d: %v", i, err)
+		}
+	}
+	params := bc.GetConsensusParams(2)
+	if assembled, full := bc.PostPool.Assemble(params, chain.PostByteBudget(nil, nil), chain.CharacterThreshold); len(assembled) != perBlock || !full {
+		t.Errorf("Expected %d posts to fill the budget, got %d (full %v)", perBlock, len(assembled), full)
+	}
+	blocks, err := bc.GenerateBlocks(2)
+	if err != nil {
+		t.Fatalf("Failed to generate blocks: %v", err)
+	}
+	if len(blocks[0].Posts) != perBlock || len(blocks[1].Posts) != 1 || !strings.HasPrefix(blocks[1].Posts[0].Content, fmt.Sprintf("%02d", perBlock)) {
+		t.Errorf("Expected the last post to wait for the second block, got %d and %d posts", len(blocks[0].Posts), len(blocks[1].Posts))
+	}
+	if err := bc.ValidateChain(); err != nil {
+		t.Errorf("Expected the chain to validate: %v", err)
+	}
+
+	// Testnet makes no heartbeat blocks before the upgrade
+	testnetChain, _ := newTestBlockchain(t, "test_block_budget_testnet.db")
+	testnetChain.lastBlockTime = time.Now().Add(-2 * chain.HeartbeatInterval)
+	if testnetChain.timeBasedBlockDue() {
+		t.Error("Expected no heartbeat block before the upgrade")
+	}
+}
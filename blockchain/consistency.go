@@ -0,0 +1,129 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// ErrStateCheckRunning is returned while another state consistency check is replaying the chain
+var ErrStateCheckRunning = errors.New("a state check is already running")
+
+// WalletMismatch is a wallet whose live state differs from the replayed state
+type WalletMismatch struct {
+	Address         string `json:"address"`
+	ReplayedBalance int    `json:"replayed_balance"`
+	CurrentBalance  int    `json:"current_balance"`
+	ReplayedNonce   int64  `json:"replayed_nonce"`
+	CurrentNonce    int64  `json:"current_nonce"`
+}
+
+// StateConsistencyReport is the result of replaying the chain against the live state
+type StateConsistencyReport struct {
+	Height         int              `json:"height"`          // Tip the replay ran to
+	BlocksReplayed int              `json:"blocks_replayed"` // Blocks that replayed to their committed root
+	StateRoot      string           `json:"state_root"`      // Root reached by the replay
+	Consistent     bool             `json:"consistent"`
+	BlockError     string           `json:"block_error,omitempty"` // Why the replay stopped early
+	Mismatches     []WalletMismatch `json:"mismatches,omitempty"`
+}
+
+// CheckStateConsistency recomputes every balance by replaying the chain from genesis
+// Each block must reproduce the state root it commits to, and the replayed
+// wallets must match the live state wallet for wallet. The replay is expensive,
+// so only one check runs at a time.
+func (bc *Blockchain) CheckStateConsistency() (*StateConsistencyReport, error) {
+	if !bc.stateCheck.CompareAndSwap(false, true) {
+		return nil, ErrStateCheckRunning
+	}
+	defer bc.stateCheck.Store(false)
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	latest, err := bc.storage.GetLatestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	report := &StateConsistencyReport{Height: latest.Index, StateRoot: chain.EmptyStateRoot}
+	replay := chain.NewStateManager()
+
+	for index := 1; index <= latest.Index; index++ {
+		block, err := bc.storage.GetBlock(index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", index, err)
+		}
+
+		params := bc.paramsAt(index)
+		if err := replay.ApplyBlock(block, params); err != nil {
+			report.BlockError = fmt.Sprintf("block %d does not apply: %v", index, err)
+			return report, nil
+		}
+		stateRoot, err := replay.CalculateStateRoot(index, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to commit replayed state at block %d: %w", index, err)
+		}
+		report.StateRoot = stateRoot.Hash
+
+		if block.StateRoot == nil || block.StateRoot.Hash != stateRoot.Hash {
+			committed := ""
+			if block.StateRoot != nil {
+				committed = block.StateRoot.Hash
+			}
+			report.BlockError = fmt.Sprintf("block %d commits to state root %s, replay reached %s", index, committed, stateRoot.Hash)
+			return report, nil
+		}
+		report.BlocksReplayed++
+	}
+
+	replayed, err := replay.GetAllWallets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replayed state: %w", err)
+	}
+	current, err := bc.stateManager.GetAllWallets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current state: %w", err)
+	}
+	report.Mismatches = compareWallets(replayed, current)
+	report.Consistent = len(report.Mismatches) == 0
+	return report, nil
+}
+
+// compareWallets lists the wallets whose balance or nonce differ between two states
+func compareWallets(replayed, current []chain.WalletState) []WalletMismatch {
+	byAddress := make(map[string]*WalletMismatch)
+	var addresses []string
+	entry := func(address string) *WalletMismatch {
+		mismatch, exists := byAddress[address]
+		if !exists {
+			mismatch = &WalletMismatch{Address: address}
+			byAddress[address] = mismatch
+			addresses = append(addresses, address)
+		}
+		return mismatch
+	}
+
+	for _, wallet := range replayed {
+		mismatch := entry(wallet.Address)
+		mismatch.ReplayedBalance = wallet.Balance
+		mismatch.ReplayedNonce = wallet.Nonce
+	}
+	for _, wallet := range current {
+		mismatch := entry(wallet.Address)
+		mismatch.CurrentBalance = wallet.Balance
+		mismatch.CurrentNonce = wallet.Nonce
+	}
+
+	sort.Strings(addresses)
+	var mismatches []WalletMismatch
+	for _, address := range addresses {
+		mismatch := byAddress[address]
+		if mismatch.ReplayedBalance != mismatch.CurrentBalance || mismatch.ReplayedNonce != mismatch.CurrentNonce {
+			mismatches = append(mismatches, *mismatch)
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// MaxGenerateBlocks caps the blocks one GenerateBlocks call creates
+const MaxGenerateBlocks = 1000
+
+// IsRegtest reports whether the chain runs on a regtest network
+func (bc *Blockchain) IsRegtest() bool {
+	return bc.network.IsRegtest()
+}
+
+// GenerateBlocks creates blocks on demand on a regtest network
+// Each block takes the reward claims, the ready transfers and the oldest posts its
+// budget has room for, so the first takes everything pending that fits. Regtest blocks need no posts.
+func (bc *Blockchain) GenerateBlocks(count int) ([]*chain.Block, error) {
+	if !bc.IsRegtest() {
+		return nil, fmt.Errorf("blocks are generated on demand only on regtest, not %s", bc.networkID)
+	}
+	if count <= 0 || count > MaxGenerateBlocks {
+		return nil, fmt.Errorf("block count must be between 1 and %d", MaxGenerateBlocks)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	blocks := make([]*chain.Block, 0, count)
+	for i := 0; i < count; i++ {
+		params := bc.paramsAt(bc.nextBlockHeight())
+		transfers := bc.Mempool.Ready(bc.stateManager.GetNonce, chain.MaxBlockTransferBytes)
+		rewards := bc.collectPendingRewards(time.Now().Unix())
+		block, err := bc.appendRegtestBlock(bc.blockPosts(params, transfers, rewards), transfers, rewards)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+		bc.PendingRewards = []chain.UptimeReward{}
+	}
+
+	return blocks, nil
+}
+
+// FundWallet mints characters to an address in a new block on a regtest network
+// Pending posts and transfers stay pending for the next generated block.
+func (bc *Blockchain) FundWallet(address string, amount int) (*chain.Block, error) {
+	if !bc.IsRegtest() {
+		return nil, fmt.Errorf("wallets are funded locally only on regtest, not %s", bc.networkID)
+	}
+	if amount <= 0 || amount > chain.MaxTransferAmount {
+		return nil, fmt.Errorf("funding amount must be between 1 and %d", chain.MaxTransferAmount)
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	params := bc.paramsAt(bc.nextBlockHeight())
+	if !wallet.ValidateAddressWithVersion(address, params.AddressVersion) {
+		return nil, fmt.Errorf("%s is not an address of %s", address, bc.networkID)
+	}
+
+	grant := chain.UptimeReward{
+		Recipient: address,
+		Amount:    amount,
+		Timestamp: time.Now().Unix(),
+		Version:   params.Encoding,
+	}
+	grant.SetHash()
+
+	return bc.appendRegtestBlock([]chain.Post{}, []chain.Transfer{}, []chain.UptimeReward{grant})
+}
+
+// appendRegtestBlock creates, validates and saves a regtest block (caller must hold the lock)
+func (bc *Blockchain) appendRegtestBlock(posts []chain.Post, transfers []chain.Transfer, rewards []chain.UptimeReward) (*chain.Block, error) {
+	latestBlock, err := bc.storage.GetLatestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	params := bc.paramsAt(latestBlock.Index + 1)
+	newBlock := chain.CreateBlockWithRewards(params, latestBlock.Index+1, latestBlock.Hash, posts, transfers, rewards, nil)
+	if err := bc.sealBlock(newBlock, latestBlock); err != nil {
+		return nil, err
+	}
+
+	if err := newBlock.ValidateBlockWithParams(params); err != nil {
+		bc.discardBlockState(latestBlock)
+		return nil, fmt.Errorf("invalid block: %w", err)
+	}
+
+	if err := bc.storage.SaveBlock(newBlock); err != nil {
+		bc.discardBlockState(latestBlock)
+		return nil, fmt.Errorf("failed to save block: %w", err)
+	}
+
+	bc.lastBlockTime = time.Now()
+	bc.pruneMempools(newBlock)
+	bc.announceBlock(newBlock)
+	return newBlock, nil
+}
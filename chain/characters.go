@@ -0,0 +1,37 @@
+package chain
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// CountCharacters returns the number of characters content costs under params
+// Before UpgradeUnicodeCount a character is one UTF-8 byte. After it a character
+// is one code point, so the same text costs the same in every script. Code points
+// are used rather than grapheme clusters because they do not depend on the
+// Unicode version a node ships.
+func CountCharacters(content string, params ConsensusParams) int {
+	if !params.UnicodeCount {
+		return len(content)
+	}
+	return utf8.RuneCountInString(content)
+}
+
+// NormalizeContent returns content in Unicode Normalization Form C
+// Posts are normalized before signing so the same text always has one encoding.
+func NormalizeContent(content string) string {
+	return norm.NFC.String(content)
+}
+
+// ValidateContentEncoding checks that content is valid UTF-8 in Normalization Form C
+func ValidateContentEncoding(content string) error {
+	if !utf8.ValidString(content) {
+		return fmt.Errorf("post content is not valid UTF-8")
+	}
+	if !norm.NFC.IsNormalString(content) {
+		return fmt.Errorf("post content is not NFC normalized")
+	}
+	return nil
+}
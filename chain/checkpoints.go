@@ -0,0 +1,55 @@
+package chain
+
+import "fmt"
+
+// Checkpoint pins the hash of the block at a height
+type Checkpoint struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// networkCheckpoints lists the blocks every node of a network must agree on
+// A chain that conflicts with any checkpoint is rejected no matter how much burn
+// it carries. New entries are added at release time as the chain grows.
+var networkCheckpoints = map[string][]Checkpoint{
+	MainnetNetworkID: {
+		{Height: 0, Hash: MainnetGenesisHash},
+	},
+	TestnetNetworkID: {
+		{Height: 0, Hash: TestnetGenesisHash},
+	},
+	RegtestNetworkID: {
+		{Height: 0, Hash: RegtestGenesisHash},
+	},
+}
+
+// defaultAssumeValid is the block per network whose ancestors skip signature checks during sync
+// Set at release time to a block every released node has fully verified; networks
+// without an entry verify every signature.
+var defaultAssumeValid = map[string]Checkpoint{}
+
+// Checkpoints returns the checkpoints of a network
+func Checkpoints(networkID string) []Checkpoint {
+	return append([]Checkpoint(nil), networkCheckpoints[networkID]...)
+}
+
+// DefaultAssumeValid returns the assume-valid block of a network, if it has one
+func DefaultAssumeValid(networkID string) (Checkpoint, bool) {
+	checkpoint, exists := defaultAssumeValid[networkID]
+	return checkpoint, exists
+}
+
+// ValidateAgainstCheckpoints checks that a block does not conflict with any checkpoint
+func ValidateAgainstCheckpoints(checkpoints []Checkpoint, height int, hash string) error {
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Height == height && checkpoint.Hash != hash {
+			return fmt.Errorf("block %d conflicts with checkpoint: expected %s, got %s", height, checkpoint.Hash, hash)
+		}
+	}
+	return nil
+}
+
+// ValidateCheckpoint checks a block against the checkpoints of a network
+func ValidateCheckpoint(networkID string, height int, hash string) error {
+	return ValidateAgainstCheckpoints(networkCheckpoints[networkID], height, hash)
+}
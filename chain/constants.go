@@ -1,18 +1,19 @@
 package chain
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 )
 
-// Mainnet consensus constants - DO NOT CHANGE without network upgrade
+// Mainnet launch constants - consensus rules change only through an upgrade in params.go
 const (
 	// Block creation rules
 	MainnetMinPosts    = 5                // Minimum posts per block
 	MainnetMaxWait     = 30 * time.Second // Maximum time to wait for posts
 	MainnetVersionByte = 0x42             // Mainnet version byte
+	HeartbeatInterval  = 10 * time.Minute // Minimum gap between a heartbeat block and its parent
+	MaxFutureBlockTime = 2 * time.Hour    // Maximum lead of a block timestamp over local time
+	MedianTimeSpan     = 11               // Blocks whose median timestamp a new block may not fall below
 
 	// Genesis block hash - DO NOT CHANGE (hardcoded for chain identity)
 	// This is the canonical genesis block hash that all nodes must accept
@@ -21,6 +22,7 @@ const (
 	// Network identifiers
 	MainnetNetworkID = "truthchain-mainnet"
 	TestnetNetworkID = "truthchain-testnet"
+	RegtestNetworkID = "truthchain-regtest"
 )
 
 // Genesis block timestamp (Unix timestamp when TruthChain was created)
@@ -35,15 +37,23 @@ const (
 	GenesisContent   = "Block 0 - This is where censorship died."
 
 	// Block configuration
-	MaxBlockSize = 1024 * 1024 // 1MB max block size
-	MaxPostSize  = 10000       // 10KB max post size
+	MaxBlockSize       = 1024 * 1024 // 1MB max block size (canonical encoding)
+	MaxPostSize        = 10000       // Maximum characters per post
+	BlockOverheadBytes = 4096        // Bytes block assembly leaves for the header and state root
 
 	// Character configuration
-	CharacterThreshold = 1000 // Characters needed for block creation
+	CharacterThreshold = 100000 // Characters a block carries at most; reaching them closes the block
 
 	// Transfer configuration
 	MaxTransferAmount = 1000000 // Maximum characters per transfer
 	MinTransferAmount = 1       // Minimum characters per transfer
+	MaxGasFee         = 10000   // Maximum fee a transfer may pay once fees are variable
+
+	// Bytes of transfers block assembly takes from the mempool, best fee per byte first
+	MaxBlockTransferBytes = MaxBlockSize / 2
+
+	// State configuration
+	MaxCachedWallets = 10000 // Committed wallet states kept decoded in memory
 
 	// Network configuration
 	MaxPeers   = 50
@@ -61,10 +71,19 @@ const (
 	MaxTrustScore     = 1.0
 
 	// Beacon configuration
-	BeaconRewardMultiplier = 1.5 // 50% bonus for beacon nodes
 	BeaconAnnounceInterval = 12 * time.Hour
 	MaxBeaconAnnounces     = 1 // Per 12-hour period
 
+	// Uptime reward configuration (emission schedule)
+	DailyCharacterCap     = 280000           // Total characters minted per day
+	RewardBatchesPerDay   = 144              // One reward batch every 10 minutes
+	UptimeRewardInterval  = 10 * time.Minute // Minimum time between rewards for one node
+	RewardWindow          = 24 * time.Hour   // Window covered by heartbeat evidence
+	RewardMinHeartbeats   = 20               // 80% of hourly heartbeats in the window
+	MinHeartbeatSpacing   = 50 * time.Minute // Minimum gap between counted heartbeats
+	RewardClaimTTL        = 1 * time.Hour    // Maximum age of a reward claim in a block
+	HeartbeatAnchorMaxAge = 1 * time.Hour    // Maximum gap between a heartbeat and its anchor block
+
 	// Mesh configuration
 	DefaultMeshPort = 9876
 	DefaultSyncPort = 9877
@@ -83,69 +102,21 @@ const (
 	MaxHeadersPerRequest = 2000             // Maximum headers per sync request
 	MaxBlocksPerRequest  = 100              // Maximum blocks per sync request
 	ReorgThreshold       = 6                // Blocks needed for reorg confirmation
+	MaxReorgBlocks       = 1000             // Longest branch a node replaces or downloads in a reorg
 )
 
-// Genesis Authority - Only this key can create the genesis block
+// Genesis Authority - Only this key can sign the mainnet genesis block
 const (
-	GenesisAuthorityAddress = "1HVfSHedQV5j489HoYFoaMweQpEZVX2qAB" // Your actual wallet address
-	GenesisAuthorityFile    = "genesis-authority.json"
+	GenesisAuthorityAddress = "1HVfSHedQV5j489HoYFoaMweQpEZVX2qAB"
+	GenesisBlockFile        = "genesis.json" // Signed genesis block written by the genesis CLI
 )
 
-// GenesisAuthority represents the authority that can create the genesis block
-type GenesisAuthority struct {
-	PrivateKey string `json:"authority_private_key"`
-	Address    string `json:"authority_address"`
-	Timestamp  int64  `json:"genesis_timestamp"`
-	NetworkID  string `json:"network_id"`
-}
-
-// ValidateGenesisAuthority checks if the current node has genesis authority
-func ValidateGenesisAuthority() (*GenesisAuthority, error) {
-	// Check if genesis authority file exists
-	data, err := os.ReadFile(GenesisAuthorityFile)
-	if err != nil {
-		return nil, fmt.Errorf("genesis authority file not found: %w", err)
-	}
-
-	var authority GenesisAuthority
-	if err := json.Unmarshal(data, &authority); err != nil {
-		return nil, fmt.Errorf("invalid genesis authority file: %w", err)
-	}
-
-	// Validate authority
-	if authority.PrivateKey == "" || authority.Address == "" {
-		return nil, fmt.Errorf("invalid genesis authority: missing private key or address")
-	}
-
-	if authority.NetworkID != MainnetNetworkID {
-		return nil, fmt.Errorf("invalid genesis authority: network mismatch")
-	}
-
-	return &authority, nil
-}
-
-// CreateAuthorizedGenesisBlock creates the genesis block with authority signature
-func CreateAuthorizedGenesisBlock(authority *GenesisAuthority) (*Block, error) {
-	// Create the canonical genesis block
-	genesis := CreateGenesisBlock()
-
-	// Verify the authority can sign this block
-	if authority.Address != GenesisAuthorityAddress {
-		return nil, fmt.Errorf("unauthorized genesis creation: expected %s, got %s",
-			GenesisAuthorityAddress, authority.Address)
-	}
-
-	// The genesis block is now authorized and can be saved
-	return genesis, nil
-}
-
-// ValidateMainnetRules checks if the given parameters match mainnet consensus
+// ValidateMainnetRules checks that a node's post threshold matches the network's consensus rules
+// Networks that fix the post count per block accept no other threshold.
 func ValidateMainnetRules(postThreshold int, networkID string) error {
-	if networkID == MainnetNetworkID {
-		if postThreshold != MainnetMinPosts {
-			return fmt.Errorf("mainnet requires exactly %d posts per block, got %d",
-				MainnetMinPosts, postThreshold)
-		}
+	if posts := Params(networkID).Base.PostsPerBlock; posts != 0 && postThreshold != posts {
+		return fmt.Errorf("%s requires exactly %d posts per block, got %d",
+			networkID, posts, postThreshold)
 	}
 	return nil
 }
@@ -157,22 +128,14 @@ func IsMainnetGenesis(block *Block) bool {
 		block.Timestamp == MainnetGenesisTimestamp
 }
 
-// ValidateCanonicalGenesis enforces the canonical genesis block
+// ValidateCanonicalGenesis enforces the canonical genesis block of a network
 // This is the Bitcoin-style security check that prevents fake forks
-func ValidateCanonicalGenesis(block *Block) error {
-	if block.Index != 0 {
-		return fmt.Errorf("not a genesis block (index %d)", block.Index)
-	}
-
-	if block.Hash != MainnetGenesisHash {
-		return fmt.Errorf("invalid genesis hash: expected %s, got %s", MainnetGenesisHash, block.Hash)
-	}
-
-	if block.Timestamp != MainnetGenesisTimestamp {
-		return fmt.Errorf("invalid genesis timestamp: expected %d, got %d", MainnetGenesisTimestamp, block.Timestamp)
+func ValidateCanonicalGenesis(networkID string, block *Block) error {
+	network, err := GetNetwork(networkID)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return network.ValidateGenesis(block)
 }
 
 // CalculateChainBurnScore calculates the total "burn" (characters) in a chain
@@ -185,18 +148,48 @@ func CalculateChainBurnScore(blocks []*Block) int64 {
 	return totalBurn
 }
 
+// CalculateHeaderBurnScore returns the burn score a header chain claims
+// The blocks prove it when they arrive, since each block's character count is checked against its posts.
+func CalculateHeaderBurnScore(headers []*BlockHeader) int64 {
+	var totalBurn int64
+	for _, header := range headers {
+		totalBurn += int64(header.CharCount)
+	}
+	return totalBurn
+}
+
 // ValidateChainHeaders validates a sequence of block headers
-// This is the Bitcoin-style header-first validation
-func ValidateChainHeaders(headers []*BlockHeader) error {
+// This is the Bitcoin-style header-first validation. Each header must hash to its
+// own hash, and headers that conflict with a checkpoint of the network are rejected.
+func ValidateChainHeaders(headers []*BlockHeader, networkID string) error {
 	if len(headers) == 0 {
 		return fmt.Errorf("no headers to validate")
 	}
 
 	// Validate genesis if present
 	if headers[0].Index == 0 {
-		if headers[0].Hash != MainnetGenesisHash {
+		network, err := GetNetwork(networkID)
+		if err != nil {
+			return err
+		}
+		if headers[0].Hash != network.GenesisHash {
 			return fmt.Errorf("invalid genesis header hash: expected %s, got %s",
-				MainnetGenesisHash, headers[0].Hash)
+				network.GenesisHash, headers[0].Hash)
+		}
+	}
+
+	// Validate header hashes and checkpoints
+	networkParams := Params(networkID)
+	for _, header := range headers {
+		if expected := networkParams.ParamsAt(header.Index).Encoding; header.Version != expected {
+			return fmt.Errorf("header %d has encoding version %d, expected %d", header.Index, header.Version, expected)
+		}
+		// A legacy hash covers the block body, so it is checked when the block is downloaded
+		if header.Version != EncodingLegacy && header.CalculateHash() != header.Hash {
+			return fmt.Errorf("header %d hash mismatch", header.Index)
+		}
+		if err := ValidateCheckpoint(networkID, header.Index, header.Hash); err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,694 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Encoding versions of hashed objects
+// Objects of version EncodingLegacy keep the ad-hoc hash formats they were created with,
+// so blocks from before the upgrade keep their original hashes; later versions hash
+// their canonical binary encoding.
+const (
+	EncodingLegacy    uint8 = 0
+	EncodingCanonical uint8 = 1
+
+	// LatestEncoding is the newest encoding version this node understands
+	LatestEncoding = EncodingCanonical
+)
+
+// Record tags, the first byte of every canonical encoding
+// The tag keeps an encoding of one type from ever hashing like another type.
+const (
+	tagPost      byte = 'P'
+	tagPostSig   byte = 'M'
+	tagTransfer  byte = 'T'
+	tagReward    byte = 'R'
+	tagBeacon    byte = 'A'
+	tagStateRoot byte = 'S'
+	tagHeader    byte = 'H'
+	tagBlock     byte = 'B'
+	tagHeartbeat byte = 'U'
+	tagWallet    byte = 'W'
+	tagTotals    byte = 'Z'
+)
+
+// checkEncoding checks an entry's encoding version is in force under params
+// Entries created before the upgrade keep their older encoding, but none may use a newer one.
+func checkEncoding(version uint8, params ConsensusParams) error {
+	if version > params.Encoding {
+		return fmt.Errorf("encoding version %d is not active (current %d)", version, params.Encoding)
+	}
+	return nil
+}
+
+// encoder writes the canonical encoding
+// Integers are fixed-width big-endian, strings and lists are prefixed with their
+// length as a uvarint, and optional values with a presence byte.
+type encoder struct {
+	buf bytes.Buffer
+}
+
+// newEncoder starts a record of a type and encoding version
+func newEncoder(tag byte, version uint8) *encoder {
+	e := &encoder{}
+	e.buf.WriteByte(tag)
+	e.buf.WriteByte(version)
+	return e
+}
+
+func (e *encoder) writeUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) writeInt(v int64) {
+	e.writeUint64(uint64(v))
+}
+
+func (e *encoder) writeFloat(v float64) {
+	e.writeUint64(math.Float64bits(v))
+}
+
+func (e *encoder) writeLength(n int) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeLength(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) writeBytes(data []byte) {
+	e.writeLength(len(data))
+	e.buf.Write(data)
+}
+
+func (e *encoder) writeBool(v bool) {
+	if v {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+// hash returns the hex SHA-256 of the record
+func (e *encoder) hash() string {
+	hash := sha256.Sum256(e.buf.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+// decoder reads the canonical encoding, remembering the first error
+type decoder struct {
+	data []byte
+	err  error
+}
+
+// newDecoder starts reading a record of a type and returns its encoding version
+func newDecoder(data []byte, tag byte) (*decoder, uint8) {
+	d := &decoder{data: data}
+	if got := d.readByte(); d.err == nil && got != tag {
+		d.err = fmt.Errorf("unexpected record tag %q, want %q", got, tag)
+	}
+	version := d.readByte()
+	if d.err == nil && version > LatestEncoding {
+		d.err = fmt.Errorf("unsupported encoding version %d", version)
+	}
+	return d, version
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = fmt.Errorf("truncated record")
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) readByte() byte {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) readUint64() uint64 {
+	b := d.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) readInt64() int64 {
+	return int64(d.readUint64())
+}
+
+func (d *decoder) readInt() int {
+	v := d.readInt64()
+	if d.err == nil && (v > math.MaxInt || v < math.MinInt) {
+		d.err = fmt.Errorf("integer out of range")
+	}
+	return int(v)
+}
+
+func (d *decoder) readFloat() float64 {
+	return math.Float64frombits(d.readUint64())
+}
+
+// readLength reads a length prefix; every element takes at least one byte, so no
+// length can exceed what is left of the record
+func (d *decoder) readLength() int {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 {
+		d.err = fmt.Errorf("invalid length prefix")
+		return 0
+	}
+	d.data = d.data[size:]
+	if n > uint64(len(d.data)) {
+		d.err = fmt.Errorf("length %d exceeds record", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) readString() string {
+	return string(d.take(d.readLength()))
+}
+
+func (d *decoder) readBytes() []byte {
+	return append([]byte(nil), d.take(d.readLength())...)
+}
+
+func (d *decoder) readBool() bool {
+	switch d.readByte() {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("invalid boolean")
+		}
+		return false
+	}
+}
+
+// finish returns the first error, or an error if bytes are left over
+func (d *decoder) finish() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%d trailing bytes after record", len(d.data))
+	}
+	return nil
+}
+
+// encodeHashedFields writes the fields a post's hash commits to
+func (p *Post) encodeHashedFields(e *encoder) {
+	e.writeString(p.Author)
+	e.writeString(p.Content)
+	e.writeInt(p.Timestamp)
+}
+
+// MarshalBinary returns the canonical encoding of the post, signature and hash included
+func (p *Post) MarshalBinary() ([]byte, error) {
+	e := newEncoder(tagPost, p.Version)
+	p.encodeHashedFields(e)
+	e.writeString(p.Signature)
+	e.writeString(p.Hash)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a post from its canonical encoding
+func (p *Post) UnmarshalBinary(data []byte) error {
+	d, version := newDecoder(data, tagPost)
+	post := Post{Version: version}
+	post.Author = d.readString()
+	post.Content = d.readString()
+	post.Timestamp = d.readInt64()
+	post.Signature = d.readString()
+	post.Hash = d.readString()
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid post encoding: %w", err)
+	}
+	*p = post
+	return nil
+}
+
+// encodeHashedFields writes the fields a transfer's hash (and signature) commits to
+func (t *Transfer) encodeHashedFields(e *encoder) {
+	e.writeString(t.From)
+	e.writeString(t.To)
+	e.writeInt(int64(t.Amount))
+	e.writeInt(int64(t.GasFee))
+	e.writeInt(t.Timestamp)
+	e.writeInt(t.Nonce)
+}
+
+// MarshalBinary returns the canonical encoding of the transfer, hash and signature included
+func (t *Transfer) MarshalBinary() ([]byte, error) {
+	e := newEncoder(tagTransfer, t.Version)
+	t.encodeHashedFields(e)
+	e.writeString(t.Hash)
+	e.writeString(t.Signature)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a transfer from its canonical encoding
+func (t *Transfer) UnmarshalBinary(data []byte) error {
+	d, version := newDecoder(data, tagTransfer)
+	transfer := Transfer{Version: version}
+	transfer.decodeFields(d)
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid transfer encoding: %w", err)
+	}
+	*t = transfer
+	return nil
+}
+
+func (t *Transfer) decodeFields(d *decoder) {
+	t.From = d.readString()
+	t.To = d.readString()
+	t.Amount = d.readInt()
+	t.GasFee = d.readInt()
+	t.Timestamp = d.readInt64()
+	t.Nonce = d.readInt64()
+	t.Hash = d.readString()
+	t.Signature = d.readString()
+}
+
+// encodeHashedFields writes the fields a reward entry's hash commits to
+func (r *UptimeReward) encodeHashedFields(e *encoder) {
+	e.writeString(r.Recipient)
+	e.writeInt(int64(r.Amount))
+	e.writeInt(r.Timestamp)
+	e.writeLength(len(r.Heartbeats))
+	for _, hb := range r.Heartbeats {
+		e.writeInt(hb.Timestamp)
+		e.writeInt(int64(hb.BlockIndex))
+		e.writeString(hb.BlockHash)
+		e.writeString(hb.Signature)
+	}
+}
+
+// MarshalBinary returns the canonical encoding of the reward entry, hash included
+func (r *UptimeReward) MarshalBinary() ([]byte, error) {
+	e := newEncoder(tagReward, r.Version)
+	r.encodeHashedFields(e)
+	e.writeString(r.Hash)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a reward entry from its canonical encoding
+func (r *UptimeReward) UnmarshalBinary(data []byte) error {
+	d, version := newDecoder(data, tagReward)
+	reward := UptimeReward{Version: version}
+	reward.decodeFields(d)
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid reward encoding: %w", err)
+	}
+	*r = reward
+	return nil
+}
+
+func (r *UptimeReward) decodeFields(d *decoder) {
+	r.Recipient = d.readString()
+	r.Amount = d.readInt()
+	r.Timestamp = d.readInt64()
+	count := d.readLength()
+	r.Heartbeats = make([]HeartbeatProof, 0, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		r.Heartbeats = append(r.Heartbeats, HeartbeatProof{Timestamp: d.readInt64(), BlockIndex: d.readInt(), BlockHash: d.readString(), Signature: d.readString()})
+	}
+	r.Hash = d.readString()
+}
+
+// MarshalBinary returns the canonical encoding of the beacon announcement
+// A block's canonical beacon hash is the hash of this encoding.
+func (ba *BeaconAnnounce) MarshalBinary() ([]byte, error) {
+	return ba.encode(EncodingCanonical).buf.Bytes(), nil
+}
+
+func (ba *BeaconAnnounce) encode(version uint8) *encoder {
+	e := newEncoder(tagBeacon, version)
+	e.writeString(ba.NodeID)
+	e.writeString(ba.IP)
+	e.writeInt(int64(ba.Port))
+	e.writeInt(ba.Timestamp)
+	e.writeFloat(ba.Uptime)
+	e.writeString(ba.Version)
+	e.writeString(ba.Sig)
+	return e
+}
+
+// UnmarshalBinary decodes a beacon announcement from its canonical encoding
+func (ba *BeaconAnnounce) UnmarshalBinary(data []byte) error {
+	d, _ := newDecoder(data, tagBeacon)
+	var beacon BeaconAnnounce
+	beacon.decodeFields(d)
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid beacon encoding: %w", err)
+	}
+	*ba = beacon
+	return nil
+}
+
+func (ba *BeaconAnnounce) decodeFields(d *decoder) {
+	ba.NodeID = d.readString()
+	ba.IP = d.readString()
+	ba.Port = d.readInt()
+	ba.Timestamp = d.readInt64()
+	ba.Uptime = d.readFloat()
+	ba.Version = d.readString()
+	ba.Sig = d.readString()
+}
+
+// encodeHashedFields writes the fields a state root's hash commits to, wallets sorted by address
+func (sr *StateRoot) encodeHashedFields(e *encoder) {
+	wallets := make([]WalletState, len(sr.Wallets))
+	copy(wallets, sr.Wallets)
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].Address < wallets[j].Address })
+
+	e.writeInt(int64(sr.BlockIndex))
+	e.writeLength(len(wallets))
+	for _, wallet := range wallets {
+		e.writeString(wallet.Address)
+		e.writeInt(int64(wallet.Balance))
+		e.writeInt(wallet.Nonce)
+		e.writeInt(wallet.LastTxTime)
+		e.writeInt(wallet.LastRewardTime)
+	}
+}
+
+// MarshalBinary returns the canonical encoding of the state root, hash included
+func (sr *StateRoot) MarshalBinary() ([]byte, error) {
+	e := newEncoder(tagStateRoot, EncodingCanonical)
+	sr.encodeHashedFields(e)
+	e.writeString(sr.Hash)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a state root from its canonical encoding
+func (sr *StateRoot) UnmarshalBinary(data []byte) error {
+	d, _ := newDecoder(data, tagStateRoot)
+	var stateRoot StateRoot
+	stateRoot.decodeFields(d)
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid state root encoding: %w", err)
+	}
+	*sr = stateRoot
+	return nil
+}
+
+func (sr *StateRoot) decodeFields(d *decoder) {
+	sr.BlockIndex = d.readInt()
+	count := d.readLength()
+	for i := 0; i < count && d.err == nil; i++ {
+		sr.Wallets = append(sr.Wallets, WalletState{
+			Address:        d.readString(),
+			Balance:        d.readInt(),
+			Nonce:          d.readInt64(),
+			LastTxTime:     d.readInt64(),
+			LastRewardTime: d.readInt64(),
+		})
+	}
+	sr.Hash = d.readString()
+}
+
+// encodeHashedFields writes the fields a block hash commits to
+func (h *BlockHeader) encodeHashedFields(e *encoder) {
+	e.writeInt(int64(h.Index))
+	e.writeInt(h.Timestamp)
+	e.writeString(h.PrevHash)
+	e.writeInt(int64(h.CharCount))
+	e.writeInt(int64(h.PostCount))
+	e.writeString(h.PostsRoot)
+	e.writeString(h.TransfersRoot)
+	e.writeString(h.RewardsRoot)
+	e.writeString(h.StateRoot)
+	e.writeString(h.BeaconHash)
+}
+
+// MarshalBinary returns the canonical encoding of the header, hash included
+func (h *BlockHeader) MarshalBinary() ([]byte, error) {
+	e := newEncoder(tagHeader, h.Version)
+	h.encodeHashedFields(e)
+	e.writeString(h.Hash)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a header from its canonical encoding
+func (h *BlockHeader) UnmarshalBinary(data []byte) error {
+	d, version := newDecoder(data, tagHeader)
+	header := BlockHeader{Version: version}
+	header.Index = d.readInt()
+	header.Timestamp = d.readInt64()
+	header.PrevHash = d.readString()
+	header.CharCount = d.readInt()
+	header.PostCount = d.readInt()
+	header.PostsRoot = d.readString()
+	header.TransfersRoot = d.readString()
+	header.RewardsRoot = d.readString()
+	header.StateRoot = d.readString()
+	header.BeaconHash = d.readString()
+	header.Hash = d.readString()
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid header encoding: %w", err)
+	}
+	*h = header
+	return nil
+}
+
+// MarshalBinary returns the canonical encoding of the whole block
+// Nested posts, transfers and rewards are length-prefixed records of their own,
+// so each keeps its own encoding version.
+func (b *Block) MarshalBinary() ([]byte, error) {
+	e := newEncoder(tagBlock, b.Version)
+	e.writeInt(int64(b.Index))
+	e.writeInt(b.Timestamp)
+	e.writeString(b.PrevHash)
+	e.writeString(b.Hash)
+	e.writeInt(int64(b.CharCount))
+	e.writeString(b.PostsRoot)
+	e.writeString(b.TransfersRoot)
+
+	e.writeLength(len(b.Posts))
+	for i := range b.Posts {
+		record, _ := b.Posts[i].MarshalBinary()
+		e.writeBytes(record)
+	}
+	e.writeLength(len(b.Transfers))
+	for i := range b.Transfers {
+		record, _ := b.Transfers[i].MarshalBinary()
+		e.writeBytes(record)
+	}
+	e.writeLength(len(b.Rewards))
+	for i := range b.Rewards {
+		record, _ := b.Rewards[i].MarshalBinary()
+		e.writeBytes(record)
+	}
+
+	e.writeBool(b.StateRoot != nil)
+	if b.StateRoot != nil {
+		record, _ := b.StateRoot.MarshalBinary()
+		e.writeBytes(record)
+	}
+	e.writeBool(b.BeaconAnnounce != nil)
+	if b.BeaconAnnounce != nil {
+		record, _ := b.BeaconAnnounce.MarshalBinary()
+		e.writeBytes(record)
+	}
+
+	e.writeString(b.AuthoritySignature)
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a block from its canonical encoding
+func (b *Block) UnmarshalBinary(data []byte) error {
+	d, version := newDecoder(data, tagBlock)
+	block := Block{Version: version}
+	block.Index = d.readInt()
+	block.Timestamp = d.readInt64()
+	block.PrevHash = d.readString()
+	block.Hash = d.readString()
+	block.CharCount = d.readInt()
+	block.PostsRoot = d.readString()
+	block.TransfersRoot = d.readString()
+
+	count := d.readLength()
+	block.Posts = make([]Post, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		if err := block.Posts[i].UnmarshalBinary(d.readBytes()); err != nil && d.err == nil {
+			d.err = fmt.Errorf("post %d: %w", i, err)
+		}
+	}
+	count = d.readLength()
+	block.Transfers = make([]Transfer, count)
+	for i := 0; i < count && d.err == nil; i++ {
+		if err := block.Transfers[i].UnmarshalBinary(d.readBytes()); err != nil && d.err == nil {
+			d.err = fmt.Errorf("transfer %d: %w", i, err)
+		}
+	}
+	if count = d.readLength(); count > 0 {
+		block.Rewards = make([]UptimeReward, count)
+	}
+	for i := 0; i < count && d.err == nil; i++ {
+		if err := block.Rewards[i].UnmarshalBinary(d.readBytes()); err != nil && d.err == nil {
+			d.err = fmt.Errorf("reward %d: %w", i, err)
+		}
+	}
+
+	if d.readBool() {
+		block.StateRoot = &StateRoot{}
+		if err := block.StateRoot.UnmarshalBinary(d.readBytes()); err != nil && d.err == nil {
+			d.err = fmt.Errorf("state root: %w", err)
+		}
+	}
+	if d.readBool() {
+		block.BeaconAnnounce = &BeaconAnnounce{}
+		if err := block.BeaconAnnounce.UnmarshalBinary(d.readBytes()); err != nil && d.err == nil {
+			d.err = fmt.Errorf("beacon announcement: %w", err)
+		}
+	}
+
+	block.AuthoritySignature = d.readString()
+	if err := d.finish(); err != nil {
+		return fmt.Errorf("invalid block encoding: %w", err)
+	}
+	*b = block
+	return nil
+}
+
+// isLegacyJSON reports whether stored or received data predates the canonical encoding
+func isLegacyJSON(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+// DecodeBlock decodes a block from its canonical encoding, or from the JSON older nodes wrote
+func DecodeBlock(data []byte) (*Block, error) {
+	block := &Block{}
+	if isLegacyJSON(data) {
+		return block, json.Unmarshal(data, block)
+	}
+	return block, block.UnmarshalBinary(data)
+}
+
+// DecodePost decodes a post from its canonical encoding, or from the JSON older nodes wrote
+func DecodePost(data []byte) (*Post, error) {
+	post := &Post{}
+	if isLegacyJSON(data) {
+		return post, json.Unmarshal(data, post)
+	}
+	return post, post.UnmarshalBinary(data)
+}
+
+// EncodeWire returns the JSON wire form of an entry: its canonical encoding as a base64 string
+func EncodeWire(v encoding.BinaryMarshaler) (json.RawMessage, error) {
+	data, err := v.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// DecodeWire decodes an entry from its JSON wire form
+// Older nodes send entries as JSON objects, which are still accepted.
+func DecodeWire(raw json.RawMessage, v encoding.BinaryUnmarshaler) error {
+	if isLegacyJSON(raw) {
+		return json.Unmarshal(raw, v)
+	}
+	var data []byte
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	return v.UnmarshalBinary(data)
+}
+
+// chainSyncResponseJSON is the wire form of a ChainSyncResponse
+type chainSyncResponseJSON struct {
+	Blocks    []json.RawMessage `json:"blocks"`
+	Headers   []json.RawMessage `json:"headers"`
+	PostProof *PostProof        `json:"post_proof,omitempty"`
+	FromIndex int               `json:"from_index"`
+	ToIndex   int               `json:"to_index"`
+	NodeID    string            `json:"node_id"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+// MarshalJSON sends blocks and headers in their canonical encoding
+func (r ChainSyncResponse) MarshalJSON() ([]byte, error) {
+	wire := chainSyncResponseJSON{
+		PostProof: r.PostProof,
+		FromIndex: r.FromIndex,
+		ToIndex:   r.ToIndex,
+		NodeID:    r.NodeID,
+		Timestamp: r.Timestamp,
+	}
+	for _, block := range r.Blocks {
+		raw, err := EncodeWire(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode block %d: %w", block.Index, err)
+		}
+		wire.Blocks = append(wire.Blocks, raw)
+	}
+	for _, header := range r.Headers {
+		raw, err := EncodeWire(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode header %d: %w", header.Index, err)
+		}
+		wire.Headers = append(wire.Headers, raw)
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON decodes blocks and headers from their wire form
+func (r *ChainSyncResponse) UnmarshalJSON(data []byte) error {
+	var wire chainSyncResponseJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	response := ChainSyncResponse{
+		PostProof: wire.PostProof,
+		FromIndex: wire.FromIndex,
+		ToIndex:   wire.ToIndex,
+		NodeID:    wire.NodeID,
+		Timestamp: wire.Timestamp,
+	}
+	for i, raw := range wire.Blocks {
+		block := &Block{}
+		if err := DecodeWire(raw, block); err != nil {
+			return fmt.Errorf("failed to decode block %d of response: %w", i, err)
+		}
+		response.Blocks = append(response.Blocks, block)
+	}
+	for i, raw := range wire.Headers {
+		header := &BlockHeader{}
+		if err := DecodeWire(raw, header); err != nil {
+			return fmt.Errorf("failed to decode header %d of response: %w", i, err)
+		}
+		response.Headers = append(response.Headers, header)
+	}
+	*r = response
+	return nil
+}
@@ -0,0 +1,179 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// encodingFixtures returns one of each canonically encoded entry, with fixed field values
+func encodingFixtures() (Post, Transfer, UptimeReward, *BeaconAnnounce, *StateRoot) {
+	post := Post{Author: "1TestAuthor", Content: "héllo, world", Timestamp: 1700000000, Signature: "post-sig", Version: EncodingCanonical}
+	post.SetHash()
+	transfer := Transfer{From: "1From", To: "1To", Amount: 25, GasFee: 1, Timestamp: 1700000001, Nonce: 3, Signature: "transfer-sig", Version: EncodingCanonical}
+	transfer.Hash, _ = transfer.CalculateHash()
+	reward := UptimeReward{
+		Recipient:  "1Miner",
+		Amount:     10,
+		Timestamp:  1700000002,
+		Heartbeats: []HeartbeatProof{{Timestamp: 1699990000, BlockIndex: 4, BlockHash: "anchor-1", Signature: "hb-1"}, {Timestamp: 1699993600, BlockIndex: 9, BlockHash: "anchor-2", Signature: "hb-2"}},
+		Version:    EncodingCanonical,
+	}
+	reward.SetHash()
+	beacon := &BeaconAnnounce{NodeID: "node", IP: "10.0.0.1", Port: 9876, Timestamp: 1700000003, Uptime: 99.5, Version: "1.0", Sig: "beacon-sig"}
+	stateRoot := &StateRoot{
+		Wallets:    []WalletState{{Address: "1B", Balance: 5, Nonce: 1}, {Address: "1A", Balance: 7, LastRewardTime: 1700000002}},
+		Hash:       "state",
+		BlockIndex: 1,
+	}
+	return post, transfer, reward, beacon, stateRoot
+}
+
+// sha256Hex returns the hex SHA-256 of an encoding
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func TestCanonicalEncodingGoldenVectors(t *testing.T) {
+	post, transfer, reward, beacon, stateRoot := encodingFixtures()
+	block := &Block{
+		Version:        EncodingCanonical,
+		Index:          1,
+		Timestamp:      1700000004,
+		PrevHash:       TestnetGenesisHash,
+		Posts:          []Post{post},
+		Transfers:      []Transfer{transfer},
+		Rewards:        []UptimeReward{reward},
+		StateRoot:      &StateRoot{Hash: EmptyStateRoot, BlockIndex: 1},
+		CharCount:      12,
+		BeaconAnnounce: beacon,
+	}
+	block.SetHash()
+
+	// The encodings and hashes below are consensus critical - changing any of them forks the chain
+	postEncoding, _ := post.MarshalBinary()
+	goldenPost := "5001" + "0b" + hex.EncodeToString([]byte("1TestAuthor")) + "0d" + hex.EncodeToString([]byte("héllo, world")) +
+		"000000006553f100" + "08" + hex.EncodeToString([]byte("post-sig")) + "40" + hex.EncodeToString([]byte(post.Hash))
+	if hex.EncodeToString(postEncoding) != goldenPost {
+		t.Errorf("Post encoding changed:\n got %x\nwant %s", postEncoding, goldenPost)
+	}
+
+	transferEncoding, _ := transfer.MarshalBinary()
+	rewardEncoding, _ := reward.MarshalBinary()
+	beaconEncoding, _ := beacon.MarshalBinary()
+	stateRootEncoding, _ := stateRoot.MarshalBinary()
+	headerEncoding, _ := block.Header().MarshalBinary()
+	blockEncoding, _ := block.MarshalBinary()
+
+	vectors := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"post hash", post.Hash, "09a80ffdae16c5f1e1c8183d7bfb58e9d5bf8bcac350d7af7cdf8e5b1500c81d"},
+		{"transfer hash", transfer.Hash, "4520b4b8c0a5c9c28efdd460a20dd2ee640aca5bc7beebff7057d0336388076d"},
+		{"transfer encoding", sha256Hex(transferEncoding), "5c995fbcb7afbac7f4f3281b2fd53e9f2d3c8a1b2b133dc0be7d7c5af92fead1"},
+		{"reward hash", reward.Hash, "b328d4c68ba2109c5e3e3e84133b3cd97f9157bbf587c622cfeca123f344b978"},
+		{"reward encoding", sha256Hex(rewardEncoding), "6e9c82bdd01aaf890acb5cdb8b25d695d274a9dd8cef78811df387ca27178373"},
+		{"beacon encoding", sha256Hex(beaconEncoding), "1ae8d0aa543b6ff6c15af75f9629c25a434cfcf44e307e775901794610f4720f"},
+		{"state root encoding", sha256Hex(stateRootEncoding), "5af80aa787c2d80ae32bd2e3cd74221d58f8947f37fc900f70bb22eac2d6acb9"},
+		{"header encoding", sha256Hex(headerEncoding), "deee45e519ec2c8f42a85169321d940e6222fe9f698de955a7f9dd9981def540"},
+		{"block hash", block.Hash, "4e7672687a6e3bc90d01d7b06e64194667a40eb4750bbf30fda1bbe918edc9d4"},
+		{"block encoding", sha256Hex(blockEncoding), "8f2b8621da34c2f6af598e98a1e4dd969678b220d4fc9ab381de8e652b0246f2"},
+	}
+	for _, vector := range vectors {
+		if vector.got != vector.want {
+			t.Errorf("Golden vector %q changed: got %s, want %s", vector.name, vector.got, vector.want)
+		}
+	}
+
+	// Entries created before the upgrade keep their legacy hashes
+	legacy := post
+	legacy.Version = EncodingLegacy
+	if legacy.CalculateHash() != sha256Hex([]byte(fmt.Sprintf("%s%s%d", post.Author, post.Content, post.Timestamp))) {
+		t.Error("Expected legacy posts to keep their legacy hash")
+	}
+
+	// Field boundaries are part of the canonical hash, so shifting bytes between fields changes it
+	first := Post{Author: "ab", Content: "c", Timestamp: 1}
+	second := Post{Author: "a", Content: "bc", Timestamp: 1}
+	if first.CalculateHash() != second.CalculateHash() {
+		t.Fatal("Expected the legacy post hash to be ambiguous at field boundaries")
+	}
+	first.Version, second.Version = EncodingCanonical, EncodingCanonical
+	if first.CalculateHash() == second.CalculateHash() {
+		t.Error("Expected canonical post hashes to commit to field boundaries")
+	}
+}
+
+func TestCanonicalEncodingRoundTrip(t *testing.T) {
+	post, transfer, reward, beacon, _ := encodingFixtures()
+	params := ConsensusParamsAt(RegtestNetworkID, 1)
+	block := CreateBlockWithBeacon(params, 1, RegtestGenesisHash, []Post{post}, []Transfer{transfer}, &StateRoot{Hash: EmptyStateRoot, BlockIndex: 1}, beacon)
+	block.Rewards = []UptimeReward{reward}
+	block.SetHash()
+	if block.Version != EncodingCanonical {
+		t.Fatalf("Expected blocks after the upgrade to use the canonical encoding, got %d", block.Version)
+	}
+
+	// Decoding and re-encoding reproduces the same bytes and hash
+	encoded, err := block.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode block: %v", err)
+	}
+	decoded, err := DecodeBlock(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode block: %v", err)
+	}
+	reencoded, _ := decoded.MarshalBinary()
+	if string(reencoded) != string(encoded) || decoded.CalculateHash() != block.Hash {
+		t.Error("Expected the block to round-trip through its canonical encoding")
+	}
+	if decoded.Posts[0].Hash != post.Hash || decoded.Rewards[0].Heartbeats[1].Signature != "hb-2" || decoded.Rewards[0].Heartbeats[1].BlockHash != "anchor-2" || decoded.BeaconAnnounce.Uptime != 99.5 {
+		t.Errorf("Decoded block lost fields: %+v", decoded)
+	}
+
+	// Truncated records, trailing bytes and unknown versions are rejected
+	if _, err := DecodeBlock(encoded[:len(encoded)-1]); err == nil {
+		t.Error("Expected a truncated block to be rejected")
+	}
+	if _, err := DecodeBlock(append(append([]byte(nil), encoded...), 0)); err == nil {
+		t.Error("Expected trailing bytes to be rejected")
+	}
+	future := append([]byte(nil), encoded...)
+	future[1] = LatestEncoding + 1
+	if _, err := DecodeBlock(future); err == nil {
+		t.Error("Expected an unknown encoding version to be rejected")
+	}
+
+	// Blocks stored as JSON by older nodes still decode
+	legacy := CreateGenesisBlock()
+	legacyJSON, _ := legacy.ToJSON()
+	decoded, err = DecodeBlock(legacyJSON)
+	if err != nil || decoded.Hash != MainnetGenesisHash {
+		t.Errorf("Expected a legacy JSON block to decode: %v", err)
+	}
+
+	// Blocks must use the encoding of their height, and entries no newer one
+	if err := block.ValidateBlock(ConsensusParamsAt(MainnetNetworkID, 1)); err == nil {
+		t.Error("Expected a canonical block to be rejected before the upgrade")
+	}
+	if err := post.ValidateRules(ConsensusParamsAt(MainnetNetworkID, 1)); err == nil {
+		t.Error("Expected a canonical post to be rejected before the upgrade")
+	}
+	tampered := *block
+	tampered.Posts = []Post{post}
+	tampered.Posts[0].Hash = legacyHash(post)
+	tampered.SetHash()
+	if err := tampered.ValidateBlock(params); err == nil {
+		t.Error("Expected a canonical block to check its post hashes")
+	}
+}
+
+// legacyHash returns the legacy hash of a post
+func legacyHash(post Post) string {
+	post.Version = EncodingLegacy
+	return post.CalculateHash()
+}
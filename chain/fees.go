@@ -0,0 +1,69 @@
+package chain
+
+import (
+	"math"
+	"sort"
+)
+
+// FeeEstimateBlocks is how many recent blocks fee estimates look at
+const FeeEstimateBlocks = 20
+
+// FeeEstimate suggests transfer fees from what recent blocks included
+type FeeEstimate struct {
+	MinimumFee   int  `json:"minimum_fee"`   // Lowest fee the next block accepts
+	Low          int  `json:"low"`           // Fee paid by the cheapest quarter of recent transfers
+	Medium       int  `json:"medium"`        // Median fee of recent transfers
+	High         int  `json:"high"`          // Fee that outbid nine in ten recent transfers
+	VariableFees bool `json:"variable_fees"` // Whether the next block accepts fees above the minimum
+	Blocks       int  `json:"blocks"`        // Blocks the estimate looked at
+	Transfers    int  `json:"transfers"`     // Transfers the estimate looked at
+}
+
+// EstimateFees estimates fees for the block params apply to from recent blocks
+// Fees are compared per byte of canonical encoding and priced for a transfer of
+// the median size. Without variable fees every estimate is the fixed gas fee.
+func EstimateFees(params ConsensusParams, blocks []*Block) FeeEstimate {
+	estimate := FeeEstimate{
+		MinimumFee:   params.GasFee,
+		Low:          params.GasFee,
+		Medium:       params.GasFee,
+		High:         params.GasFee,
+		VariableFees: params.VariableFees,
+		Blocks:       len(blocks),
+	}
+
+	var rates []float64
+	var sizes []int
+	for _, block := range blocks {
+		for _, transfer := range block.Transfers {
+			encoded, err := transfer.MarshalBinary()
+			if err != nil || len(encoded) == 0 {
+				continue
+			}
+			rates = append(rates, float64(transfer.GasFee)/float64(len(encoded)))
+			sizes = append(sizes, len(encoded))
+		}
+	}
+	estimate.Transfers = len(rates)
+	if !params.VariableFees || len(rates) == 0 {
+		return estimate
+	}
+
+	sort.Float64s(rates)
+	sort.Ints(sizes)
+	size := float64(sizes[len(sizes)/2])
+	feeAt := func(percentile int) int {
+		fee := int(math.Ceil(rates[(len(rates)-1)*percentile/100] * size))
+		if fee < params.GasFee {
+			return params.GasFee
+		}
+		if fee > MaxGasFee {
+			return MaxGasFee
+		}
+		return fee
+	}
+	estimate.Low = feeAt(25)
+	estimate.Medium = feeAt(50)
+	estimate.High = feeAt(90)
+	return estimate
+}
@@ -0,0 +1,26 @@
+package chain
+
+import "testing"
+
+func TestFeeEstimate(t *testing.T) {
+	// Ten transfers of the same size paying 1 to 10
+	block := &Block{}
+	for fee := 1; fee <= 10; fee++ {
+		block.Transfers = append(block.Transfers, Transfer{From: "a", To: "b", Amount: 10, GasFee: fee, Nonce: int64(fee)})
+	}
+
+	params := ConsensusParamsAt(RegtestNetworkID, 1)
+	estimate := EstimateFees(params, []*Block{block})
+	if estimate.Low != 3 || estimate.Medium != 5 || estimate.High != 9 || estimate.Transfers != 10 {
+		t.Errorf("Unexpected estimate from recent fees: %+v", estimate)
+	}
+
+	// Empty blocks and fixed fees estimate the minimum
+	if estimate := EstimateFees(params, []*Block{{}}); estimate.High != params.GasFee {
+		t.Errorf("Expected the minimum fee without recent transfers, got %+v", estimate)
+	}
+	fixed := ConsensusParamsAt(MainnetNetworkID, 1)
+	if estimate := EstimateFees(fixed, []*Block{block}); estimate.VariableFees || estimate.High != fixed.GasFee {
+		t.Errorf("Expected the fixed gas fee before the upgrade, got %+v", estimate)
+	}
+}
@@ -0,0 +1,75 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// genesisMessage returns the message a genesis authority signs
+// It commits to the network and to the genesis hash, which covers every header field.
+func genesisMessage(networkID string, hash string) []byte {
+	return []byte(fmt.Sprintf("truthchain-genesis:%s:%s", networkID, hash))
+}
+
+// SignGenesisBlock signs a network's genesis block with the authority's wallet
+// The signature is not part of the block hash, so signing leaves the genesis hash unchanged.
+func SignGenesisBlock(block *Block, networkID string, authority *wallet.Wallet) error {
+	if block.Index != 0 {
+		return fmt.Errorf("not a genesis block (index %d)", block.Index)
+	}
+
+	signature, err := authority.Sign(genesisMessage(networkID, block.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to sign genesis block: %w", err)
+	}
+	block.AuthoritySignature = hex.EncodeToString(signature)
+	return nil
+}
+
+// VerifyGenesisSignature checks that a genesis block is signed by the authority address
+func VerifyGenesisSignature(block *Block, networkID string, authority string) error {
+	if block.AuthoritySignature == "" {
+		return fmt.Errorf("genesis block is not signed by the genesis authority")
+	}
+
+	hash := sha256.Sum256(genesisMessage(networkID, block.Hash))
+	pubKey, err := wallet.RecoverPublicKeyFromSignature(hex.EncodeToString(hash[:]), block.AuthoritySignature)
+	if err != nil {
+		return fmt.Errorf("invalid genesis signature: %w", err)
+	}
+	if !wallet.PublicKeyMatchesAddress(pubKey, authority) {
+		return fmt.Errorf("genesis block is not signed by the genesis authority %s", authority)
+	}
+	return nil
+}
+
+// LoadGenesisBlock reads a signed genesis block written by the genesis CLI
+func LoadGenesisBlock(path string) (*Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genesis block: %w", err)
+	}
+
+	var block Block
+	if err := json.Unmarshal(data, &block); err != nil {
+		return nil, fmt.Errorf("invalid genesis block file: %w", err)
+	}
+	return &block, nil
+}
+
+// SaveGenesisBlock writes a signed genesis block for nodes to import
+func SaveGenesisBlock(block *Block, path string) error {
+	data, err := json.MarshalIndent(block, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode genesis block: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write genesis block: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package chain
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MempoolLimits bound the transfers a mempool holds
+type MempoolLimits struct {
+	MaxTransfers int           // Transfers held in total before the cheapest are evicted
+	MaxPerSender int           // Transfers one sender may have waiting
+	MaxNonceGap  int           // How far past its next nonce a sender may queue transfers
+	MaxAge       time.Duration // Transfers older than this are dropped
+}
+
+// DefaultMempoolLimits are the limits a node runs with
+var DefaultMempoolLimits = MempoolLimits{
+	MaxTransfers: 5000,
+	MaxPerSender: 64,
+	MaxNonceGap:  16,
+	MaxAge:       24 * time.Hour,
+}
+
+// PendingTransferStore persists the transfers waiting in the mempool
+type PendingTransferStore interface {
+	SavePendingTransfer(transfer Transfer) error
+	GetPendingTransfers() ([]Transfer, error)
+	RemovePendingTransfer(hash string) error
+}
+
+// Mempool holds pending transfers indexed by sender and nonce
+// A sender's transfers become ready in nonce order starting right after the
+// sender's nonce in state; transfers after a gap wait until the gap is filled.
+type Mempool struct {
+	mu       sync.RWMutex
+	limits   MempoolLimits
+	store    PendingTransferStore // nil keeps the pool in memory only
+	senders  map[string]map[int64]*mempoolEntry
+	byHash   map[string]*mempoolEntry
+	arrivals uint64
+}
+
+// mempoolEntry is a waiting transfer with what the pool ranks it by
+type mempoolEntry struct {
+	transfer Transfer
+	size     int    // Bytes of the transfer's canonical encoding
+	sequence uint64 // Arrival order, to break fee ties
+}
+
+// feeRateAbove reports whether e pays more per byte than other, or the same and arrived first
+func (e *mempoolEntry) feeRateAbove(other *mempoolEntry) bool {
+	mine, theirs := e.transfer.GasFee*other.size, other.transfer.GasFee*e.size
+	if mine != theirs {
+		return mine > theirs
+	}
+	return e.sequence < other.sequence
+}
+
+// NewMempool creates an empty mempool, persisted to store unless it is nil
+func NewMempool(limits MempoolLimits, store PendingTransferStore) *Mempool {
+	return &Mempool{
+		limits:  limits,
+		store:   store,
+		senders: make(map[string]map[int64]*mempoolEntry),
+		byHash:  make(map[string]*mempoolEntry),
+	}
+}
+
+// Load re-adds the persisted transfers that accept still allows, dropping the rest
+func (mp *Mempool) Load(stateNonce func(address string) int64, accept func(transfer Transfer) error) (int, error) {
+	if mp.store == nil {
+		return 0, nil
+	}
+	transfers, err := mp.store.GetPendingTransfers()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending transfers: %w", err)
+	}
+
+	// Re-add in nonce order so no sender's transfers look like they follow a gap
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].From != transfers[j].From {
+			return transfers[i].From < transfers[j].From
+		}
+		return transfers[i].Nonce < transfers[j].Nonce
+	})
+
+	loaded := 0
+	for _, transfer := range transfers {
+		err := accept(transfer)
+		if err == nil {
+			err = mp.Add(transfer, stateNonce(transfer.From))
+		}
+		if err != nil {
+			mp.store.RemovePendingTransfer(transfer.Hash)
+			continue
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// Add queues a transfer given its sender's nonce in state
+// A transfer with the nonce of a waiting one replaces it only if it pays a higher
+// fee. When the pool is full the cheapest last-in-line transfer is evicted.
+func (mp *Mempool) Add(transfer Transfer, stateNonce int64) error {
+	if err := transfer.Validate(); err != nil {
+		return fmt.Errorf("invalid transfer: %w", err)
+	}
+	encoded, err := transfer.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("invalid transfer: %w", err)
+	}
+	entry := &mempoolEntry{transfer: transfer, size: len(encoded)}
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, exists := mp.byHash[transfer.Hash]; exists {
+		return fmt.Errorf("transfer already exists in pool")
+	}
+	if transfer.Nonce <= stateNonce {
+		return fmt.Errorf("nonce %d already used (sender is at %d)", transfer.Nonce, stateNonce)
+	}
+	if transfer.Nonce > stateNonce+int64(mp.limits.MaxNonceGap) {
+		return fmt.Errorf("nonce %d too far ahead (sender is at %d)", transfer.Nonce, stateNonce)
+	}
+	if mp.expired(transfer, time.Now()) {
+		return fmt.Errorf("transfer expired")
+	}
+
+	// Find the transfer the new one displaces: the one it replaces, or one evicted to make room
+	queue := mp.senders[transfer.From]
+	var displaced *mempoolEntry
+	if existing, exists := queue[transfer.Nonce]; exists {
+		if transfer.GasFee <= existing.transfer.GasFee {
+			return fmt.Errorf("replacement for nonce %d must pay more than %d", transfer.Nonce, existing.transfer.GasFee)
+		}
+		displaced = existing
+	} else {
+		if len(queue) >= mp.limits.MaxPerSender {
+			return fmt.Errorf("sender has %d transfers waiting", len(queue))
+		}
+		if len(mp.byHash) >= mp.limits.MaxTransfers {
+			victim, err := mp.evictionVictim(entry)
+			if err != nil {
+				return err
+			}
+			displaced = victim
+		}
+	}
+
+	// Persist the new transfer before dropping the displaced one, so a failure loses neither
+	if mp.store != nil {
+		if err := mp.store.SavePendingTransfer(transfer); err != nil {
+			return fmt.Errorf("failed to save pending transfer: %w", err)
+		}
+	}
+	if displaced != nil {
+		if err := mp.remove(displaced.transfer.Hash); err != nil {
+			if mp.store != nil {
+				mp.store.RemovePendingTransfer(transfer.Hash)
+			}
+			return err
+		}
+	}
+	if mp.senders[transfer.From] == nil {
+		mp.senders[transfer.From] = make(map[int64]*mempoolEntry)
+	}
+	mp.arrivals++
+	entry.sequence = mp.arrivals
+	mp.senders[transfer.From][transfer.Nonce] = entry
+	mp.byHash[transfer.Hash] = entry
+	return nil
+}
+
+// evictionVictim returns the transfer to evict for an entry: the last-in-line one paying least per byte
+// Only the highest nonce of a sender is evicted, so eviction never opens a gap, and
+// only for an entry paying strictly more per byte.
+func (mp *Mempool) evictionVictim(entry *mempoolEntry) (*mempoolEntry, error) {
+	var victim *mempoolEntry
+	for _, queue := range mp.senders {
+		last := queue[maxNonce(queue)]
+		if victim == nil || victim.feeRateAbove(last) {
+			victim = last
+		}
+	}
+	if victim == nil || entry.transfer.GasFee*victim.size <= victim.transfer.GasFee*entry.size {
+		return nil, fmt.Errorf("mempool full (%d transfers)", len(mp.byHash))
+	}
+	return victim, nil
+}
+
+// remove drops a transfer by hash (caller must hold the lock)
+func (mp *Mempool) remove(hash string) error {
+	entry, exists := mp.byHash[hash]
+	if !exists {
+		return fmt.Errorf("transfer not found in pool: %s", hash)
+	}
+	transfer := entry.transfer
+	if mp.store != nil {
+		if err := mp.store.RemovePendingTransfer(hash); err != nil {
+			return fmt.Errorf("failed to remove pending transfer: %w", err)
+		}
+	}
+
+	queue := mp.senders[transfer.From]
+	delete(queue, transfer.Nonce)
+	if len(queue) == 0 {
+		delete(mp.senders, transfer.From)
+	}
+	delete(mp.byHash, hash)
+	return nil
+}
+
+// Remove drops a transfer from the pool
+func (mp *Mempool) Remove(hash string) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.remove(hash)
+}
+
+// Prune drops transfers whose nonce state has reached and transfers past the age limit
+// A sender's transfers after an expired one are dropped with it, since they could
+// never become ready.
+func (mp *Mempool) Prune(stateNonce func(address string) int64) int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	now := time.Now()
+	var drop []string
+	for sender, queue := range mp.senders {
+		nonce := stateNonce(sender)
+		nonces := sortedNonces(queue)
+		for i, n := range nonces {
+			transfer := queue[n].transfer
+			if n <= nonce {
+				drop = append(drop, transfer.Hash)
+				continue
+			}
+			if mp.expired(transfer, now) {
+				for _, later := range nonces[i:] {
+					drop = append(drop, queue[later].transfer.Hash)
+				}
+				break
+			}
+		}
+	}
+
+	for _, hash := range drop {
+		mp.remove(hash)
+	}
+	return len(drop)
+}
+
+// expired reports whether a transfer is past the age limit
+func (mp *Mempool) expired(transfer Transfer, now time.Time) bool {
+	return now.Unix()-transfer.Timestamp > int64(mp.limits.MaxAge.Seconds())
+}
+
+// Ready returns the transfers that can go into the next block, best fee per byte first
+// Each sender contributes its run of consecutive nonces after its nonce in state,
+// in nonce order. Transfers stop being taken from a sender once one would not fit
+// in maxBytes of canonical encoding; maxBytes of 0 takes every ready transfer.
+func (mp *Mempool) Ready(stateNonce func(address string) int64, maxBytes int) []Transfer {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	queues := &readyQueues{}
+	for sender, queue := range mp.senders {
+		var run []*mempoolEntry
+		for nonce := stateNonce(sender) + 1; ; nonce++ {
+			entry, exists := queue[nonce]
+			if !exists {
+				break
+			}
+			run = append(run, entry)
+		}
+		if len(run) > 0 {
+			queues.runs = append(queues.runs, run)
+		}
+	}
+	heap.Init(queues)
+
+	var ready []Transfer
+	used := 0
+	for queues.Len() > 0 {
+		run := queues.runs[0]
+		if maxBytes > 0 && used+run[0].size > maxBytes {
+			heap.Pop(queues)
+			continue
+		}
+		used += run[0].size
+		ready = append(ready, run[0].transfer)
+		if len(run) == 1 {
+			heap.Pop(queues)
+		} else {
+			queues.runs[0] = run[1:]
+			heap.Fix(queues, 0)
+		}
+	}
+	return ready
+}
+
+// readyQueues orders senders' runs by the fee per byte of their next transfer, then by arrival
+type readyQueues struct {
+	runs [][]*mempoolEntry
+}
+
+func (q *readyQueues) Len() int { return len(q.runs) }
+
+func (q *readyQueues) Less(i, j int) bool { return q.runs[i][0].feeRateAbove(q.runs[j][0]) }
+
+func (q *readyQueues) Swap(i, j int) { q.runs[i], q.runs[j] = q.runs[j], q.runs[i] }
+
+func (q *readyQueues) Push(x interface{}) { q.runs = append(q.runs, x.([]*mempoolEntry)) }
+
+func (q *readyQueues) Pop() interface{} {
+	last := q.runs[len(q.runs)-1]
+	q.runs = q.runs[:len(q.runs)-1]
+	return last
+}
+
+// NextNonce returns the nonce a sender's next transfer should use
+// It follows the sender's consecutive waiting transfers, so queuing several never leaves a gap.
+func (mp *Mempool) NextNonce(sender string, stateNonce int64) int64 {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	nonce := stateNonce + 1
+	for {
+		if _, exists := mp.senders[sender][nonce]; !exists {
+			return nonce
+		}
+		nonce++
+	}
+}
+
+// Get returns a waiting transfer by hash
+func (mp *Mempool) Get(hash string) (Transfer, bool) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	entry, exists := mp.byHash[hash]
+	if !exists {
+		return Transfer{}, false
+	}
+	return entry.transfer, true
+}
+
+// Pending returns every waiting transfer, by sender and nonce
+func (mp *Mempool) Pending() []Transfer {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	senders := make([]string, 0, len(mp.senders))
+	for sender := range mp.senders {
+		senders = append(senders, sender)
+	}
+	sort.Strings(senders)
+
+	transfers := make([]Transfer, 0, len(mp.byHash))
+	for _, sender := range senders {
+		queue := mp.senders[sender]
+		for _, nonce := range sortedNonces(queue) {
+			transfers = append(transfers, queue[nonce].transfer)
+		}
+	}
+	return transfers
+}
+
+// Count returns the number of waiting transfers
+func (mp *Mempool) Count() int {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return len(mp.byHash)
+}
+
+// TotalCost returns the characters the waiting transfers spend, fees included
+func (mp *Mempool) TotalCost() int {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	total := 0
+	for _, entry := range mp.byHash {
+		total += entry.transfer.GetTotalCost()
+	}
+	return total
+}
+
+// sortedNonces returns the nonces of a sender's queue in order
+func sortedNonces(queue map[int64]*mempoolEntry) []int64 {
+	nonces := make([]int64, 0, len(queue))
+	for nonce := range queue {
+		nonces = append(nonces, nonce)
+	}
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+	return nonces
+}
+
+// maxNonce returns the highest nonce of a sender's queue
+func maxNonce(queue map[int64]*mempoolEntry) int64 {
+	var highest int64
+	first := true
+	for nonce := range queue {
+		if first || nonce > highest {
+			highest = nonce
+			first = false
+		}
+	}
+	return highest
+}
@@ -0,0 +1,227 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+func TestTransferMempool(t *testing.T) {
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	bob, err := wallet.NewTestnetWallet("bob")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	params := Params(RegtestNetworkID).ParamsAt(1)
+	pool := NewMempool(DefaultMempoolLimits, nil)
+
+	// Queued transfers take consecutive nonces
+	for nonce := int64(1); nonce <= 2; nonce++ {
+		if next := pool.NextNonce(alice.GetAddress(), 0); next != nonce {
+			t.Errorf("Expected next nonce %d, got %d", nonce, next)
+		}
+		transfer, _ := NewTransfer(params, alice, bob.GetAddress(), 10, nonce)
+		if err := pool.Add(*transfer, 0); err != nil {
+			t.Fatalf("Failed to add transfer: %v", err)
+		}
+	}
+
+	// A transfer after a nonce gap waits; one too far ahead or already confirmed is refused
+	future, _ := NewTransfer(params, alice, bob.GetAddress(), 10, 4)
+	if err := pool.Add(*future, 0); err != nil {
+		t.Fatalf("Failed to queue a future nonce: %v", err)
+	}
+	tooFar, _ := NewTransfer(params, alice, bob.GetAddress(), 10, int64(DefaultMempoolLimits.MaxNonceGap)+1)
+	if err := pool.Add(*tooFar, 0); err == nil {
+		t.Error("Expected a nonce past the gap limit to be refused")
+	}
+	stale, _ := NewTransfer(params, alice, bob.GetAddress(), 10, 1)
+	if err := pool.Add(*stale, 1); err == nil {
+		t.Error("Expected a confirmed nonce to be refused")
+	}
+	noNonces := func(string) int64 { return 0 }
+	if ready := pool.Ready(noNonces, 0); len(ready) != 2 || ready[0].Nonce != 1 || ready[1].Nonce != 2 {
+		t.Errorf("Expected nonces 1 and 2 ready in order, got %d transfers", len(ready))
+	}
+
+	// A transfer with a waiting nonce replaces it only by paying a higher fee
+	sameFee, _ := NewTransfer(params, alice, bob.GetAddress(), 20, 2)
+	if err := pool.Add(*sameFee, 0); err == nil {
+		t.Error("Expected a replacement paying the same fee to be refused")
+	}
+	replacement, _ := NewTransfer(params, alice, bob.GetAddress(), 20, 2)
+	replacement.GasFee++
+	if err := replacement.Sign(alice); err != nil {
+		t.Fatalf("Failed to sign transfer: %v", err)
+	}
+	if err := pool.Add(*replacement, 0); err != nil {
+		t.Fatalf("Failed to replace nonce 2: %v", err)
+	}
+	if _, exists := pool.Get(replacement.Hash); !exists || pool.Count() != 3 {
+		t.Errorf("Expected the replacement to take nonce 2's place, pool holds %d", pool.Count())
+	}
+
+	// Filling the gap makes the queued transfer ready behind it
+	gap, _ := NewTransfer(params, alice, bob.GetAddress(), 10, 3)
+	if err := pool.Add(*gap, 0); err != nil {
+		t.Fatalf("Failed to fill the gap: %v", err)
+	}
+	if ready := pool.Ready(noNonces, 0); len(ready) != 4 || ready[3].Hash != future.Hash {
+		t.Errorf("Expected the gapped transfer ready after the gap, got %d transfers", len(ready))
+	}
+}
+
+// failingTransferStore keeps transfers in memory and fails saves while failSaves is set
+type failingTransferStore struct {
+	transfers map[string]Transfer
+	failSaves bool
+}
+
+func (s *failingTransferStore) SavePendingTransfer(transfer Transfer) error {
+	if s.failSaves {
+		return fmt.Errorf("disk full")
+	}
+	s.transfers[transfer.Hash] = transfer
+	return nil
+}
+
+func (s *failingTransferStore) GetPendingTransfers() ([]Transfer, error) {
+	transfers := make([]Transfer, 0, len(s.transfers))
+	for _, transfer := range s.transfers {
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+func (s *failingTransferStore) RemovePendingTransfer(hash string) error {
+	delete(s.transfers, hash)
+	return nil
+}
+
+func TestMempoolReplacementSurvivesFailedSave(t *testing.T) {
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	bob, err := wallet.NewTestnetWallet("bob")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	params := Params(RegtestNetworkID).ParamsAt(1)
+	store := &failingTransferStore{transfers: make(map[string]Transfer)}
+	pool := NewMempool(DefaultMempoolLimits, store)
+
+	original, _ := NewTransfer(params, alice, bob.GetAddress(), 10, 1)
+	if err := pool.Add(*original, 0); err != nil {
+		t.Fatalf("Failed to add transfer: %v", err)
+	}
+
+	// A replacement that cannot be saved leaves the original in the pool and on disk
+	replacement, _ := NewTransfer(params, alice, bob.GetAddress(), 10, 1)
+	replacement.GasFee++
+	if err := replacement.Sign(alice); err != nil {
+		t.Fatalf("Failed to sign transfer: %v", err)
+	}
+	store.failSaves = true
+	if err := pool.Add(*replacement, 0); err == nil {
+		t.Fatal("Expected the replacement to fail when it cannot be saved")
+	}
+	if _, exists := pool.Get(original.Hash); !exists {
+		t.Error("Expected the original transfer to stay in the pool")
+	}
+	if _, exists := store.transfers[original.Hash]; !exists {
+		t.Error("Expected the original transfer to stay on disk")
+	}
+
+	// Once saved, the replacement takes the original's place in both
+	store.failSaves = false
+	if err := pool.Add(*replacement, 0); err != nil {
+		t.Fatalf("Failed to replace transfer: %v", err)
+	}
+	if _, exists := store.transfers[original.Hash]; exists || len(store.transfers) != 1 {
+		t.Errorf("Expected only the replacement on disk, found %d transfers", len(store.transfers))
+	}
+}
+
+func TestMempoolLimits(t *testing.T) {
+	senders := make([]*wallet.Wallet, 4)
+	for i := range senders {
+		w, err := wallet.NewTestnetWallet(fmt.Sprintf("sender%d", i))
+		if err != nil {
+			t.Fatalf("Failed to create wallet: %v", err)
+		}
+		senders[i] = w
+	}
+	to := senders[3].GetAddress()
+	params := Params(RegtestNetworkID).ParamsAt(1)
+
+	// transfer signs a transfer paying fee
+	transfer := func(w *wallet.Wallet, nonce int64, fee int, timestamp int64) Transfer {
+		tx, err := NewTransfer(params, w, to, 10, nonce)
+		if err != nil {
+			t.Fatalf("Failed to create transfer: %v", err)
+		}
+		tx.GasFee = fee
+		tx.Timestamp = timestamp
+		if err := tx.Sign(w); err != nil {
+			t.Fatalf("Failed to sign transfer: %v", err)
+		}
+		return *tx
+	}
+	now := time.Now().Unix()
+
+	pool := NewMempool(MempoolLimits{MaxTransfers: 3, MaxPerSender: 2, MaxNonceGap: 4, MaxAge: time.Hour}, nil)
+	cheap := transfer(senders[1], 1, 1, now)
+	for _, tx := range []Transfer{cheap, transfer(senders[2], 1, 3, now), transfer(senders[2], 2, 3, now)} {
+		if err := pool.Add(tx, 0); err != nil {
+			t.Fatalf("Failed to add transfer: %v", err)
+		}
+	}
+	if err := pool.Add(transfer(senders[2], 3, 5, now), 0); err == nil {
+		t.Error("Expected a sender past its limit to be refused")
+	}
+
+	// A replacement must pay more than the fee it replaces
+	if err := pool.Add(transfer(senders[2], 2, 2, now), 0); err == nil {
+		t.Error("Expected a cheaper replacement to be refused")
+	}
+	if err := pool.Add(transfer(senders[2], 2, 3, now), 0); err == nil {
+		t.Error("Expected a replacement paying the same fee to be refused")
+	}
+
+	// A full pool evicts the cheapest transfer for a better paying one, never a worse one
+	if err := pool.Add(transfer(senders[0], 1, 1, now), 0); err == nil {
+		t.Error("Expected a transfer no better than the cheapest to be refused when full")
+	}
+	rich := transfer(senders[0], 1, 2, now)
+	if err := pool.Add(rich, 0); err != nil {
+		t.Fatalf("Expected a better paying transfer to evict the cheapest: %v", err)
+	}
+	if _, exists := pool.Get(cheap.Hash); exists || pool.Count() != 3 {
+		t.Errorf("Expected the cheapest transfer evicted, pool holds %d", pool.Count())
+	}
+
+	// Ready transfers come best fee first, each sender in nonce order
+	noNonces := func(string) int64 { return 0 }
+	ready := pool.Ready(noNonces, 0)
+	if len(ready) != 3 || ready[0].GasFee != 3 || ready[1].Nonce != 2 || ready[2].Hash != rich.Hash {
+		t.Errorf("Unexpected ready order: %+v", ready)
+	}
+
+	// Expired transfers are refused and pruned with the sender's later nonces
+	if err := pool.Add(transfer(senders[1], 1, 9, now-7200), 0); err == nil {
+		t.Error("Expected an expired transfer to be refused")
+	}
+	aging := NewMempool(MempoolLimits{MaxTransfers: 10, MaxPerSender: 10, MaxNonceGap: 10, MaxAge: time.Second}, nil)
+	aging.Add(transfer(senders[1], 1, 1, time.Now().Unix()), 0)
+	aging.Add(transfer(senders[1], 2, 1, time.Now().Unix()+60), 0)
+	time.Sleep(2 * time.Second)
+	if pruned := aging.Prune(noNonces); pruned != 2 || aging.Count() != 0 {
+		t.Errorf("Expected both transfers pruned, pruned %d with %d left", pruned, aging.Count())
+	}
+}
@@ -0,0 +1,233 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Domain separation prefixes so a leaf can never be passed off as an inner node
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleStep is one sibling on the path from a leaf to the root
+type MerkleStep struct {
+	Hash string `json:"hash"` // Sibling hash
+	Left bool   `json:"left"` // True if the sibling is the left child
+}
+
+// MerkleProof proves that a hash is a leaf of a Merkle tree
+type MerkleProof struct {
+	LeafHash string       `json:"leaf_hash"` // Post or transfer hash being proven
+	Index    int          `json:"index"`     // Position of the leaf in the block
+	Path     []MerkleStep `json:"path"`      // Siblings from the leaf up to the root
+}
+
+// merkleLeaf hashes a post or transfer hash into a tree leaf
+func merkleLeaf(hash string) string {
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, hash...))
+	return hex.EncodeToString(sum[:])
+}
+
+// merkleNode hashes two children into their parent
+func merkleNode(left, right string) string {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, merkleNodePrefix)
+	data = append(data, left...)
+	data = append(data, right...)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// merkleParents hashes one level of the tree into the next
+// An odd node at the end is promoted unchanged rather than paired with itself,
+// so two different leaf lists can never produce the same root.
+func merkleParents(level []string) []string {
+	parents := make([]string, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			parents = append(parents, level[i])
+			continue
+		}
+		parents = append(parents, merkleNode(level[i], level[i+1]))
+	}
+	return parents
+}
+
+// MerkleRoot returns the Merkle root of a list of hashes
+// An empty list has an empty root.
+func MerkleRoot(hashes []string) string {
+	if len(hashes) == 0 {
+		return ""
+	}
+
+	level := make([]string, len(hashes))
+	for i, hash := range hashes {
+		level[i] = merkleLeaf(hash)
+	}
+	for len(level) > 1 {
+		level = merkleParents(level)
+	}
+	return level[0]
+}
+
+// BuildMerkleProof builds the inclusion proof for the hash at index
+func BuildMerkleProof(hashes []string, index int) (*MerkleProof, error) {
+	if index < 0 || index >= len(hashes) {
+		return nil, fmt.Errorf("leaf index %d out of range (%d leaves)", index, len(hashes))
+	}
+
+	proof := &MerkleProof{LeafHash: hashes[index], Index: index}
+
+	level := make([]string, len(hashes))
+	for i, hash := range hashes {
+		level[i] = merkleLeaf(hash)
+	}
+	position := index
+	for len(level) > 1 {
+		sibling := position ^ 1
+		if sibling < len(level) {
+			proof.Path = append(proof.Path, MerkleStep{Hash: level[sibling], Left: sibling < position})
+		}
+		level = merkleParents(level)
+		position /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that a proof leads from its leaf to root
+func VerifyMerkleProof(proof *MerkleProof, root string) bool {
+	if proof == nil || proof.LeafHash == "" || root == "" {
+		return false
+	}
+
+	current := merkleLeaf(proof.LeafHash)
+	for _, step := range proof.Path {
+		if step.Left {
+			current = merkleNode(step.Hash, current)
+		} else {
+			current = merkleNode(current, step.Hash)
+		}
+	}
+	return current == root
+}
+
+// postHashes returns the hashes of the block's posts in order
+func (b *Block) postHashes() []string {
+	hashes := make([]string, len(b.Posts))
+	for i, post := range b.Posts {
+		hashes[i] = post.Hash
+	}
+	return hashes
+}
+
+// transferHashes returns the hashes of the block's transfers in order
+func (b *Block) transferHashes() []string {
+	hashes := make([]string, len(b.Transfers))
+	for i, transfer := range b.Transfers {
+		hashes[i] = transfer.Hash
+	}
+	return hashes
+}
+
+// SetMerkleRoots sets the post and transfer roots from the block body
+// Legacy blocks hash their body directly and carry no roots.
+func (b *Block) SetMerkleRoots() {
+	if b.Version == EncodingLegacy {
+		b.PostsRoot, b.TransfersRoot = "", ""
+		return
+	}
+	b.PostsRoot = MerkleRoot(b.postHashes())
+	b.TransfersRoot = MerkleRoot(b.transferHashes())
+}
+
+// validateMerkleRoots checks that the roots commit to the block body
+// Roots on a legacy block are not covered by its hash, so none are accepted.
+func (b *Block) validateMerkleRoots() error {
+	if b.Version == EncodingLegacy {
+		if b.PostsRoot != "" || b.TransfersRoot != "" {
+			return fmt.Errorf("legacy block %d cannot carry Merkle roots", b.Index)
+		}
+		return nil
+	}
+	if root := MerkleRoot(b.postHashes()); b.PostsRoot != root {
+		return fmt.Errorf("posts root mismatch: expected %s, got %s", root, b.PostsRoot)
+	}
+	if root := MerkleRoot(b.transferHashes()); b.TransfersRoot != root {
+		return fmt.Errorf("transfers root mismatch: expected %s, got %s", root, b.TransfersRoot)
+	}
+	return nil
+}
+
+// indexOfHash returns the position of hash in hashes (-1 if absent)
+func indexOfHash(hashes []string, hash string) int {
+	for i, h := range hashes {
+		if h == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// PostInclusionProof builds the proof that a post is in the block
+func (b *Block) PostInclusionProof(postHash string) (*MerkleProof, error) {
+	if b.Version == EncodingLegacy {
+		return nil, fmt.Errorf("block %d predates Merkle roots", b.Index)
+	}
+	hashes := b.postHashes()
+	index := indexOfHash(hashes, postHash)
+	if index < 0 {
+		return nil, fmt.Errorf("post %s not found in block %d", postHash, b.Index)
+	}
+	return BuildMerkleProof(hashes, index)
+}
+
+// TransferInclusionProof builds the proof that a transfer is in the block
+func (b *Block) TransferInclusionProof(transferHash string) (*MerkleProof, error) {
+	if b.Version == EncodingLegacy {
+		return nil, fmt.Errorf("block %d predates Merkle roots", b.Index)
+	}
+	hashes := b.transferHashes()
+	index := indexOfHash(hashes, transferHash)
+	if index < 0 {
+		return nil, fmt.Errorf("transfer %s not found in block %d", transferHash, b.Index)
+	}
+	return BuildMerkleProof(hashes, index)
+}
+
+// VerifyPostInclusion checks that a proof places a post in the block of header
+func VerifyPostInclusion(header *BlockHeader, postHash string, proof *MerkleProof) error {
+	if header == nil {
+		return fmt.Errorf("no block header")
+	}
+	if header.Version == EncodingLegacy {
+		return fmt.Errorf("block %d predates Merkle roots", header.Index)
+	}
+	if proof == nil || proof.LeafHash != postHash {
+		return fmt.Errorf("proof is not for post %s", postHash)
+	}
+	if !VerifyMerkleProof(proof, header.PostsRoot) {
+		return fmt.Errorf("post %s is not in block %d", postHash, header.Index)
+	}
+	return nil
+}
+
+// VerifyTransferInclusion checks that a proof places a transfer in the block of header
+func VerifyTransferInclusion(header *BlockHeader, transferHash string, proof *MerkleProof) error {
+	if header == nil {
+		return fmt.Errorf("no block header")
+	}
+	if header.Version == EncodingLegacy {
+		return fmt.Errorf("block %d predates Merkle roots", header.Index)
+	}
+	if proof == nil || proof.LeafHash != transferHash {
+		return fmt.Errorf("proof is not for transfer %s", transferHash)
+	}
+	if !VerifyMerkleProof(proof, header.TransfersRoot) {
+		return fmt.Errorf("transfer %s is not in block %d", transferHash, header.Index)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package chain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockMerkleInclusionProofs(t *testing.T) {
+	params := Params(RegtestNetworkID).ParamsAt(2)
+
+	var posts []Post
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		post := Post{Author: "author", Content: content, Timestamp: time.Now().Unix(), Signature: "signature", Version: params.Encoding}
+		post.SetHash()
+		posts = append(posts, post)
+	}
+	block := CreateBlock(params, 2, "parent", posts, []Transfer{}, nil)
+
+	// A body that no longer matches its roots is rejected
+	tampered := *block
+	tampered.Posts = []Post{posts[1], posts[0], posts[2], posts[3], posts[4]}
+	if err := tampered.validateMerkleRoots(); err == nil {
+		t.Fatal("Expected block with mismatched posts root to be rejected")
+	}
+	if err := block.validateMerkleRoots(); err != nil {
+		t.Fatalf("Expected roots to match the body: %v", err)
+	}
+
+	header := block.Header()
+	if header.PostsRoot == "" || header.TransfersRoot != "" {
+		t.Fatalf("Unexpected header roots: %+v", header)
+	}
+	if header.CalculateHash() != block.Hash {
+		t.Fatal("Expected the header alone to reproduce the block hash")
+	}
+
+	// Every post proves against the header alone
+	for _, post := range posts {
+		proof, err := block.PostInclusionProof(post.Hash)
+		if err != nil {
+			t.Fatalf("Failed to build proof: %v", err)
+		}
+		if err := VerifyPostInclusion(header, post.Hash, proof); err != nil {
+			t.Errorf("Proof for post %q failed: %v", post.Content, err)
+		}
+	}
+
+	// A proof does not carry over to another post or a corrupted path
+	proof, _ := block.PostInclusionProof(posts[2].Hash)
+	if err := VerifyPostInclusion(header, posts[3].Hash, proof); err == nil {
+		t.Error("Proof must not verify a different post")
+	}
+	proof.Path[0].Hash = posts[0].Hash
+	if err := VerifyPostInclusion(header, posts[2].Hash, proof); err == nil {
+		t.Error("Corrupted proof must not verify")
+	}
+	if _, err := block.PostInclusionProof("missing"); err == nil {
+		t.Error("Expected error for post not in block")
+	}
+}
+
+func TestLegacyBlocksCarryNoMerkleRoots(t *testing.T) {
+	params := Params(MainnetNetworkID).ParamsAt(2)
+
+	post := Post{Author: "author", Content: "legacy", Timestamp: time.Now().Unix(), Signature: "signature"}
+	post.SetHash()
+	block := CreateBlock(params, 2, "parent", []Post{post}, []Transfer{}, nil)
+	if block.PostsRoot != "" || block.TransfersRoot != "" {
+		t.Fatalf("Expected a legacy block without roots, got %q and %q", block.PostsRoot, block.TransfersRoot)
+	}
+	if err := block.validateMerkleRoots(); err != nil {
+		t.Errorf("Expected a legacy block without roots to validate: %v", err)
+	}
+
+	// Roots its hash does not cover are refused
+	withRoots := *block
+	withRoots.PostsRoot = MerkleRoot([]string{post.Hash})
+	if err := withRoots.validateMerkleRoots(); err == nil {
+		t.Error("Expected roots on a legacy block to be rejected")
+	}
+
+	// Legacy headers cannot back inclusion proofs
+	if _, err := block.PostInclusionProof(post.Hash); err == nil {
+		t.Error("Expected no inclusion proof from a legacy block")
+	}
+	proof, _ := BuildMerkleProof([]string{post.Hash}, 0)
+	header := withRoots.Header()
+	if err := VerifyPostInclusion(header, post.Hash, proof); err == nil {
+		t.Error("Expected a legacy header to be rejected for inclusion proofs")
+	}
+}
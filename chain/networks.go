@@ -0,0 +1,130 @@
+package chain
+
+import "fmt"
+
+// Genesis blocks of the test networks - DO NOT CHANGE (hardcoded for chain identity)
+const (
+	TestnetGenesisTimestamp = 1792108800
+	TestnetGenesisHash      = "c595b959532d9c4627ea6b427cbca18f0feb37f1030f9812a0ec2466b5b95d4e"
+
+	RegtestGenesisTimestamp = 1792108801
+	RegtestGenesisHash      = "f6b88db971fd0b5679dce7f8f76caf31a3face575a2cd6d882a941fa9a3097ec"
+)
+
+// Network defines one TruthChain network
+// Every network has its own genesis block, address version, frame magic and
+// consensus rules, so nodes of different networks never accept each other's blocks.
+type Network struct {
+	ID               string
+	GenesisTimestamp int64
+	GenesisHash      string
+	GenesisAuthority string   // Address that signs the genesis block ("" when every node creates it locally)
+	PostThreshold    int      // Default posts per block of a node
+	MeshPort         int      // Default mesh and sync port
+	SyncPort         int      // Default port of the legacy sync server
+	APIPort          int      // Default HTTP API port
+	BootstrapFile    string   // Bootstrap peer list of the network (empty for isolated networks)
+	Bootstrap        []string // Seed nodes as host:port, used when the bootstrap file lists none
+}
+
+// networks lists every network a node can join
+var networks = map[string]*Network{
+	MainnetNetworkID: {
+		ID:               MainnetNetworkID,
+		GenesisTimestamp: MainnetGenesisTimestamp,
+		GenesisHash:      MainnetGenesisHash,
+		GenesisAuthority: GenesisAuthorityAddress,
+		PostThreshold:    MainnetMinPosts,
+		MeshPort:         DefaultMeshPort,
+		SyncPort:         DefaultSyncPort,
+		APIPort:          DefaultAPIPort,
+		BootstrapFile:    "bootstrap.json",
+		Bootstrap:        []string{"mainnet.truth-chain.org:9876"},
+	},
+	TestnetNetworkID: {
+		ID:               TestnetNetworkID,
+		GenesisTimestamp: TestnetGenesisTimestamp,
+		GenesisHash:      TestnetGenesisHash,
+		PostThreshold:    3,
+		MeshPort:         19876,
+		SyncPort:         19877,
+		APIPort:          18080,
+		BootstrapFile:    "bootstrap-testnet.json",
+	},
+	RegtestNetworkID: {
+		ID:               RegtestNetworkID,
+		GenesisTimestamp: RegtestGenesisTimestamp,
+		GenesisHash:      RegtestGenesisHash,
+		PostThreshold:    1,
+		MeshPort:         29876,
+		SyncPort:         29877,
+		APIPort:          28080,
+	},
+}
+
+// GetNetwork returns the definition of a known network
+func GetNetwork(networkID string) (*Network, error) {
+	network, exists := networks[networkID]
+	if !exists {
+		return nil, fmt.Errorf("unknown network: %s", networkID)
+	}
+	return network, nil
+}
+
+// NetworkIDs returns the IDs of every known network, mainnet first
+func NetworkIDs() []string {
+	return []string{MainnetNetworkID, TestnetNetworkID, RegtestNetworkID}
+}
+
+// GenesisBlock creates the network's genesis block
+func (n *Network) GenesisBlock() *Block {
+	return createGenesisBlock(n.GenesisTimestamp, n.Params().ParamsAt(0).Encoding)
+}
+
+// Params returns the consensus rules of the network
+func (n *Network) Params() *NetworkParams {
+	return Params(n.ID)
+}
+
+// VersionByte returns the version byte of the network's wallet addresses
+func (n *Network) VersionByte() byte {
+	return n.Params().Base.AddressVersion
+}
+
+// IsRegtest reports whether blocks are created on demand and wallets funded locally
+func (n *Network) IsRegtest() bool {
+	return n.Params().Base.Regtest
+}
+
+// ValidateGenesis checks that a block is the network's genesis block
+func (n *Network) ValidateGenesis(block *Block) error {
+	if block.Index != 0 {
+		return fmt.Errorf("not a genesis block (index %d)", block.Index)
+	}
+
+	if block.Hash != n.GenesisHash {
+		return fmt.Errorf("invalid genesis hash for %s: expected %s, got %s", n.ID, n.GenesisHash, block.Hash)
+	}
+
+	if block.Timestamp != n.GenesisTimestamp {
+		return fmt.Errorf("invalid genesis timestamp for %s: expected %d, got %d", n.ID, n.GenesisTimestamp, block.Timestamp)
+	}
+
+	if n.GenesisAuthority != "" {
+		return VerifyGenesisSignature(block, n.ID, n.GenesisAuthority)
+	}
+
+	return nil
+}
+
+// ValidateStoredGenesis checks the genesis block a node has already stored
+// Nodes that ran before the genesis was signed stored the same block without the
+// authority's signature; it is accepted as long as it still hashes to the network's genesis hash.
+func (n *Network) ValidateStoredGenesis(block *Block) error {
+	if block.AuthoritySignature == "" && block.CalculateHash() == n.GenesisHash {
+		unsigned := *n
+		unsigned.GenesisAuthority = ""
+		return unsigned.ValidateGenesis(block)
+	}
+	return n.ValidateGenesis(block)
+}
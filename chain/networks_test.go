@@ -0,0 +1,34 @@
+package chain
+
+import "testing"
+
+func TestNetworkGenesis(t *testing.T) {
+	// Every network starts from its own genesis block
+	seen := make(map[string]string)
+	for _, networkID := range NetworkIDs() {
+		network, err := GetNetwork(networkID)
+		if err != nil {
+			t.Fatalf("Failed to get network %s: %v", networkID, err)
+		}
+		genesis := network.GenesisBlock()
+		if genesis.Hash != network.GenesisHash {
+			t.Errorf("Genesis block of %s hashes to %s, expected %s", networkID, genesis.Hash, network.GenesisHash)
+		}
+		if other, exists := seen[genesis.Hash]; exists {
+			t.Errorf("%s shares its genesis block with %s", networkID, other)
+		}
+		seen[genesis.Hash] = networkID
+	}
+	if CreateGenesisBlock().Hash != MainnetGenesisHash {
+		t.Error("Expected the mainnet genesis block to be unchanged")
+	}
+
+	// A genesis block of one network is never canonical on another
+	testnet, err := GetNetwork(TestnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to get testnet: %v", err)
+	}
+	if err := ValidateCanonicalGenesis(MainnetNetworkID, testnet.GenesisBlock()); err == nil {
+		t.Error("Expected mainnet to reject the testnet genesis block")
+	}
+}
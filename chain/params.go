@@ -0,0 +1,203 @@
+package chain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// Upgrade names a change to the consensus rules
+type Upgrade string
+
+// Known upgrades, in the order they were introduced
+const (
+	// UpgradeUnicodeCount counts post characters in code points of NFC text instead of UTF-8 bytes
+	UpgradeUnicodeCount Upgrade = "unicode-count"
+
+	// UpgradeCanonicalEncoding hashes blocks and their contents in the canonical binary encoding
+	UpgradeCanonicalEncoding Upgrade = "canonical-encoding"
+
+	// UpgradeVariableFees lets transfers pay more than the gas fee to be included sooner
+	UpgradeVariableFees Upgrade = "variable-fees"
+
+	// UpgradeBlockBudget bounds blocks by size and characters instead of a fixed post count
+	UpgradeBlockBudget Upgrade = "block-budget"
+
+	// UpgradeStateTree commits state to the sparse Merkle state tree instead of embedding every wallet in each block
+	UpgradeStateTree Upgrade = "state-tree"
+)
+
+// upgradeRules applies each upgrade to the rules it changes
+var upgradeRules = map[Upgrade]func(*ConsensusParams){
+	UpgradeUnicodeCount:      func(p *ConsensusParams) { p.UnicodeCount = true },
+	UpgradeCanonicalEncoding: func(p *ConsensusParams) { p.Encoding = EncodingCanonical },
+	UpgradeVariableFees:      func(p *ConsensusParams) { p.VariableFees = true },
+	UpgradeBlockBudget:       func(p *ConsensusParams) { p.BlockBudget = true },
+	UpgradeStateTree:         func(p *ConsensusParams) { p.StateTree = true },
+}
+
+// ConsensusParams are the consensus rules in force at one block height
+type ConsensusParams struct {
+	NetworkID      string `json:"network_id"` // Network the rules belong to; post signatures commit to it
+	Height         int    `json:"height"`
+	PostsPerBlock  int    `json:"posts_per_block"` // Posts every block must carry before UpgradeBlockBudget (0 leaves it to the node's post threshold)
+	MaxPostSize    int    `json:"max_post_size"`   // Maximum post content in characters, counted as posts are charged
+	GasFee         int    `json:"gas_fee"`         // Fee every transfer pays (the minimum once fees are variable)
+	AddressVersion byte   `json:"address_version"` // Version byte of the network's wallet addresses
+	Regtest        bool   `json:"regtest"`         // Blocks carry any number of posts and rewards need no uptime evidence
+	UnicodeCount   bool   `json:"unicode_count"`   // Posts are counted in code points (UpgradeUnicodeCount)
+	Encoding       uint8  `json:"encoding"`        // Encoding version of block hashes (UpgradeCanonicalEncoding)
+	VariableFees   bool   `json:"variable_fees"`   // Transfers may pay up to MaxGasFee (UpgradeVariableFees)
+	BlockBudget    bool   `json:"block_budget"`    // Blocks are bounded by MaxBlockSize and CharacterThreshold (UpgradeBlockBudget)
+	StateTree      bool   `json:"state_tree"`      // State roots are state tree roots rather than embedded wallets (UpgradeStateTree)
+}
+
+// Activation schedules an upgrade at a block height
+type Activation struct {
+	Upgrade Upgrade `json:"upgrade"`
+	Height  int     `json:"height"` // First block the upgrade applies to
+}
+
+// NetworkParams are the rules a network started with and the upgrades scheduled since
+type NetworkParams struct {
+	NetworkID string
+	Base      ConsensusParams
+	Upgrades  []Activation
+}
+
+// baseParams are the rules every network started with
+var baseParams = ConsensusParams{
+	MaxPostSize:    MaxPostSize,
+	GasFee:         1,
+	AddressVersion: wallet.TruthChainMainnetVersion,
+}
+
+// networkParams lists the consensus rules of each known network
+// Rules change only by adding an upgrade with an activation height ahead of the
+// tip, so blocks below it keep validating the way they always have.
+var networkParams = map[string]*NetworkParams{
+	MainnetNetworkID: {
+		NetworkID: MainnetNetworkID,
+		Base:      withPostsPerBlock(baseParams, MainnetMinPosts),
+		Upgrades: []Activation{
+			{Upgrade: UpgradeUnicodeCount, Height: 100000},
+			{Upgrade: UpgradeCanonicalEncoding, Height: 150000},
+			{Upgrade: UpgradeStateTree, Height: 150000},
+			{Upgrade: UpgradeVariableFees, Height: 200000},
+			{Upgrade: UpgradeBlockBudget, Height: 250000},
+		},
+	},
+	TestnetNetworkID: {
+		NetworkID: TestnetNetworkID,
+		Base:      withAddressVersion(baseParams, wallet.TruthChainTestnetVersion),
+		Upgrades: []Activation{
+			{Upgrade: UpgradeUnicodeCount, Height: 50000},
+			{Upgrade: UpgradeCanonicalEncoding, Height: 75000},
+			{Upgrade: UpgradeStateTree, Height: 75000},
+			{Upgrade: UpgradeVariableFees, Height: 100000},
+			{Upgrade: UpgradeBlockBudget, Height: 125000},
+		},
+	},
+	RegtestNetworkID: {
+		NetworkID: RegtestNetworkID,
+		Base:      regtestParams(),
+		Upgrades:  activateAtGenesis(),
+	},
+}
+
+// withPostsPerBlock returns params with a fixed post count
+func withPostsPerBlock(params ConsensusParams, posts int) ConsensusParams {
+	params.PostsPerBlock = posts
+	return params
+}
+
+// withAddressVersion returns params for a network with its own address version
+func withAddressVersion(params ConsensusParams, version byte) ConsensusParams {
+	params.AddressVersion = version
+	return params
+}
+
+// regtestParams returns the rules of the regtest network
+// Regtest uses testnet addresses so its wallets can never be mistaken for mainnet ones.
+func regtestParams() ConsensusParams {
+	params := withAddressVersion(baseParams, wallet.TruthChainTestnetVersion)
+	params.Regtest = true
+	return params
+}
+
+// activateAtGenesis schedules every known upgrade at height 0
+func activateAtGenesis() []Activation {
+	upgrades := make([]Upgrade, 0, len(upgradeRules))
+	for upgrade := range upgradeRules {
+		upgrades = append(upgrades, upgrade)
+	}
+	sort.Slice(upgrades, func(i, j int) bool { return upgrades[i] < upgrades[j] })
+
+	activations := make([]Activation, 0, len(upgrades))
+	for _, upgrade := range upgrades {
+		activations = append(activations, Activation{Upgrade: upgrade, Height: 0})
+	}
+	return activations
+}
+
+// Params returns the consensus rules of a network
+// Networks without an entry are development networks and run every upgrade from genesis.
+func Params(networkID string) *NetworkParams {
+	if params, exists := networkParams[networkID]; exists {
+		return params
+	}
+	return &NetworkParams{NetworkID: networkID, Base: baseParams, Upgrades: activateAtGenesis()}
+}
+
+// ParamsAt returns the rules that apply to the block at height
+func (np *NetworkParams) ParamsAt(height int) ConsensusParams {
+	params := np.Base
+	params.NetworkID = np.NetworkID
+	params.Height = height
+	for _, activation := range np.Upgrades {
+		if height >= activation.Height {
+			upgradeRules[activation.Upgrade](&params)
+		}
+	}
+	return params
+}
+
+// ActivationHeight returns the height an upgrade activates at on the network
+func (np *NetworkParams) ActivationHeight(upgrade Upgrade) (int, bool) {
+	for _, activation := range np.Upgrades {
+		if activation.Upgrade == upgrade {
+			return activation.Height, true
+		}
+	}
+	return 0, false
+}
+
+// IsActive reports whether an upgrade applies to the block at height
+func (np *NetworkParams) IsActive(upgrade Upgrade, height int) bool {
+	activationHeight, scheduled := np.ActivationHeight(upgrade)
+	return scheduled && height >= activationHeight
+}
+
+// Validate checks that every scheduled upgrade is known and scheduled once
+func (np *NetworkParams) Validate() error {
+	seen := make(map[Upgrade]bool)
+	for _, activation := range np.Upgrades {
+		if _, known := upgradeRules[activation.Upgrade]; !known {
+			return fmt.Errorf("unknown upgrade %q", activation.Upgrade)
+		}
+		if seen[activation.Upgrade] {
+			return fmt.Errorf("upgrade %q scheduled twice", activation.Upgrade)
+		}
+		if activation.Height < 0 {
+			return fmt.Errorf("upgrade %q has negative activation height", activation.Upgrade)
+		}
+		seen[activation.Upgrade] = true
+	}
+	return nil
+}
+
+// ConsensusParamsAt returns the rules of a network at a block height
+func ConsensusParamsAt(networkID string, height int) ConsensusParams {
+	return Params(networkID).ParamsAt(height)
+}
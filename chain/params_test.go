@@ -0,0 +1,42 @@
+package chain
+
+import "testing"
+
+func TestConsensusParamsUpgrades(t *testing.T) {
+	mainnet := Params(MainnetNetworkID)
+	if err := mainnet.Validate(); err != nil {
+		t.Fatalf("Invalid mainnet params: %v", err)
+	}
+
+	// Upgrades change the rules from their activation height on
+	height, _ := mainnet.ActivationHeight(UpgradeUnicodeCount)
+	if mainnet.ParamsAt(height-1).UnicodeCount || !mainnet.ParamsAt(height).UnicodeCount {
+		t.Errorf("Expected the Unicode count to activate at height %d", height)
+	}
+	if mainnet.IsActive(UpgradeUnicodeCount, height-1) || !mainnet.IsActive(UpgradeUnicodeCount, height) {
+		t.Errorf("Expected the upgrade to be active from height %d", height)
+	}
+	if params := mainnet.ParamsAt(0); params.PostsPerBlock != MainnetMinPosts || params.GasFee != 1 || params.MaxPostSize != MaxPostSize {
+		t.Errorf("Unexpected mainnet launch rules: %+v", params)
+	}
+
+	// Development networks run every upgrade from genesis
+	if !ConsensusParamsAt("truthchain-local", 0).UnicodeCount {
+		t.Error("Expected unknown networks to activate upgrades at genesis")
+	}
+
+	// Schedules must name known upgrades once
+	duplicate := &NetworkParams{Upgrades: []Activation{{Upgrade: UpgradeUnicodeCount}, {Upgrade: UpgradeUnicodeCount, Height: 5}}}
+	if err := duplicate.Validate(); err == nil {
+		t.Error("Expected an upgrade scheduled twice to be rejected")
+	}
+	unknown := &NetworkParams{Upgrades: []Activation{{Upgrade: "no-such-upgrade"}}}
+	if err := unknown.Validate(); err == nil {
+		t.Error("Expected an unknown upgrade to be rejected")
+	}
+
+	// Mainnet fixes the post count per block
+	if err := ValidateMainnetRules(3, MainnetNetworkID); err == nil {
+		t.Error("Expected mainnet to reject a post threshold other than its rule")
+	}
+}
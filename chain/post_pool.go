@@ -0,0 +1,307 @@
+package chain
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PostPoolLimits bound the posts a post pool holds
+type PostPoolLimits struct {
+	MaxPosts int           // Posts held in total
+	MaxBytes int           // Bytes of canonical encoding held in total
+	MaxAge   time.Duration // Posts older than this are dropped
+}
+
+// DefaultPostPoolLimits are the limits a node runs with
+var DefaultPostPoolLimits = PostPoolLimits{
+	MaxPosts: 5000,
+	MaxBytes: 4 * MaxBlockSize,
+	MaxAge:   24 * time.Hour,
+}
+
+// PendingPostStore persists the posts waiting in the post pool
+type PendingPostStore interface {
+	SavePendingPost(post Post) error
+	GetPendingPosts() ([]Post, error)
+	RemovePendingPost(hash string) error
+}
+
+// PostPool holds pending posts in the order they arrived
+type PostPool struct {
+	mu       sync.RWMutex
+	limits   PostPoolLimits
+	store    PendingPostStore // nil keeps the pool in memory only
+	byHash   map[string]*postEntry
+	bytes    int
+	arrivals uint64
+}
+
+// postEntry is a waiting post with its size and arrival order
+type postEntry struct {
+	post     Post
+	size     int
+	sequence uint64
+}
+
+// NewPostPool creates an empty post pool, persisted to store unless it is nil
+func NewPostPool(limits PostPoolLimits, store PendingPostStore) *PostPool {
+	return &PostPool{
+		limits: limits,
+		store:  store,
+		byHash: make(map[string]*postEntry),
+	}
+}
+
+// Load re-adds the persisted posts that accept still allows, oldest first, dropping the rest
+func (pp *PostPool) Load(accept func(post Post) error) (int, error) {
+	if pp.store == nil {
+		return 0, nil
+	}
+	posts, err := pp.store.GetPendingPosts()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending posts: %w", err)
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Timestamp < posts[j].Timestamp })
+
+	loaded := 0
+	for _, post := range posts {
+		err := accept(post)
+		if err == nil {
+			err = pp.Add(post)
+		}
+		if err != nil {
+			pp.store.RemovePendingPost(post.Hash)
+			continue
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// Add queues a post behind the ones already waiting
+func (pp *PostPool) Add(post Post) error {
+	if post.Hash == "" {
+		return fmt.Errorf("post hash cannot be empty")
+	}
+	encoded, err := post.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("invalid post: %w", err)
+	}
+
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	if _, exists := pp.byHash[post.Hash]; exists {
+		return fmt.Errorf("duplicate pending post: %s", post.Hash)
+	}
+	now := time.Now()
+	if pp.expired(post, now) {
+		return fmt.Errorf("post expired")
+	}
+	if len(pp.byHash) >= pp.limits.MaxPosts || pp.bytes+len(encoded) > pp.limits.MaxBytes {
+		pp.expire(now)
+		if len(pp.byHash) >= pp.limits.MaxPosts || pp.bytes+len(encoded) > pp.limits.MaxBytes {
+			return fmt.Errorf("post pool full (%d posts, %d bytes)", len(pp.byHash), pp.bytes)
+		}
+	}
+
+	if pp.store != nil {
+		if err := pp.store.SavePendingPost(post); err != nil {
+			return fmt.Errorf("failed to save pending post: %w", err)
+		}
+	}
+	pp.arrivals++
+	pp.byHash[post.Hash] = &postEntry{post: post, size: len(encoded), sequence: pp.arrivals}
+	pp.bytes += len(encoded)
+	return nil
+}
+
+// remove drops a post by hash (caller must hold the lock)
+func (pp *PostPool) remove(hash string) error {
+	entry, exists := pp.byHash[hash]
+	if !exists {
+		return fmt.Errorf("pending post not found: %s", hash)
+	}
+	if pp.store != nil {
+		if err := pp.store.RemovePendingPost(hash); err != nil {
+			return fmt.Errorf("failed to remove pending post: %w", err)
+		}
+	}
+	delete(pp.byHash, hash)
+	pp.bytes -= entry.size
+	return nil
+}
+
+// Remove drops a post from the pool
+func (pp *PostPool) Remove(hash string) error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.remove(hash)
+}
+
+// RemoveConfirmed drops the posts a block included, returning how many were waiting
+func (pp *PostPool) RemoveConfirmed(posts []Post) int {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	removed := 0
+	for _, post := range posts {
+		hash := post.Hash
+		if hash == "" {
+			hash = post.CalculateHash()
+		}
+		if _, exists := pp.byHash[hash]; exists && pp.remove(hash) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Prune drops the posts past the age limit
+func (pp *PostPool) Prune() int {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.expire(time.Now())
+}
+
+// Filter drops the posts accept refuses, returning how many were dropped
+func (pp *PostPool) Filter(accept func(post Post) error) int {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	var drop []string
+	for hash, entry := range pp.byHash {
+		if accept(entry.post) != nil {
+			drop = append(drop, hash)
+		}
+	}
+	for _, hash := range drop {
+		pp.remove(hash)
+	}
+	return len(drop)
+}
+
+// expire drops the posts past the age limit (caller must hold the lock)
+func (pp *PostPool) expire(now time.Time) int {
+	var drop []string
+	for hash, entry := range pp.byHash {
+		if pp.expired(entry.post, now) {
+			drop = append(drop, hash)
+		}
+	}
+	for _, hash := range drop {
+		pp.remove(hash)
+	}
+	return len(drop)
+}
+
+// expired reports whether a post is past the age limit
+func (pp *PostPool) expired(post Post, now time.Time) bool {
+	return now.Unix()-post.Timestamp > int64(pp.limits.MaxAge.Seconds())
+}
+
+// ordered returns the waiting posts in the order they arrived (caller must hold the lock)
+func (pp *PostPool) ordered() []*postEntry {
+	entries := make([]*postEntry, 0, len(pp.byHash))
+	for _, entry := range pp.byHash {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].sequence < entries[j].sequence })
+	return entries
+}
+
+// Oldest returns up to count posts in the order they arrived; a count of 0 returns every post
+func (pp *PostPool) Oldest(count int) []Post {
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+
+	entries := pp.ordered()
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+
+	posts := make([]Post, len(entries))
+	for i, entry := range entries {
+		posts[i] = entry.post
+	}
+	return posts
+}
+
+// Assemble returns the oldest posts that fit a byte and character budget, in the order they arrived
+// It stops at the first post that does not fit, so no post jumps the queue. full reports
+// whether the posts fill the budget, which closes a block without waiting.
+func (pp *PostPool) Assemble(params ConsensusParams, maxBytes, maxCharacters int) (posts []Post, full bool) {
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+
+	bytes, characters := 0, 0
+	for _, entry := range pp.ordered() {
+		size := entry.size + binary.MaxVarintLen32
+		count := entry.post.GetCharacterCount(params)
+		if bytes+size > maxBytes || characters+count > maxCharacters {
+			return posts, true
+		}
+		posts = append(posts, entry.post)
+		bytes += size
+		characters += count
+	}
+	return posts, bytes >= maxBytes || characters >= maxCharacters
+}
+
+// PostByteBudget returns the bytes a block can still spend on posts next to its transfers and rewards
+func PostByteBudget(transfers []Transfer, rewards []UptimeReward) int {
+	budget := MaxBlockSize - BlockOverheadBytes
+	for i := range transfers {
+		record, _ := transfers[i].MarshalBinary()
+		budget -= len(record) + binary.MaxVarintLen32
+	}
+	for i := range rewards {
+		record, _ := rewards[i].MarshalBinary()
+		budget -= len(record) + binary.MaxVarintLen32
+	}
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// Pending returns every waiting post in the order they arrived
+func (pp *PostPool) Pending() []Post {
+	return pp.Oldest(0)
+}
+
+// Get returns a waiting post by hash
+func (pp *PostPool) Get(hash string) (Post, bool) {
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+
+	entry, exists := pp.byHash[hash]
+	if !exists {
+		return Post{}, false
+	}
+	return entry.post, true
+}
+
+// Count returns the number of waiting posts
+func (pp *PostPool) Count() int {
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+	return len(pp.byHash)
+}
+
+// Cost returns the characters an author's waiting posts will be charged under params
+func (pp *PostPool) Cost(author string, params ConsensusParams) int {
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+
+	cost := 0
+	for _, entry := range pp.byHash {
+		if entry.post.Author == author {
+			cost += entry.post.GetCharacterCount(params)
+		}
+	}
+	return cost
+}
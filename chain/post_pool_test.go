@@ -0,0 +1,142 @@
+package chain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// memoryPostStore keeps pending posts in memory
+type memoryPostStore map[string]Post
+
+func (s memoryPostStore) SavePendingPost(post Post) error {
+	s[post.Hash] = post
+	return nil
+}
+
+func (s memoryPostStore) GetPendingPosts() ([]Post, error) {
+	posts := make([]Post, 0, len(s))
+	for _, post := range s {
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func (s memoryPostStore) RemovePendingPost(hash string) error {
+	delete(s, hash)
+	return nil
+}
+
+func TestPostPool(t *testing.T) {
+	alice, err := wallet.NewTestnetWallet("alice")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	params := Params(RegtestNetworkID).ParamsAt(1)
+	now := time.Now().Unix()
+	post := func(content string, timestamp int64) Post {
+		post := Post{Author: alice.GetAddress(), Content: content, Timestamp: timestamp, Signature: "signature", Version: params.Encoding}
+		post.SetHash()
+		return post
+	}
+
+	// Added posts are persisted, and a post is only queued once
+	store := memoryPostStore{}
+	pool := NewPostPool(DefaultPostPoolLimits, store)
+	first, second := post("first", now-2), post("second", now-1)
+	for _, p := range []Post{first, second} {
+		if err := pool.Add(p); err != nil {
+			t.Fatalf("Failed to add post: %v", err)
+		}
+	}
+	if err := pool.Add(first); err == nil {
+		t.Error("Expected a duplicate post to be refused")
+	}
+	if len(store) != 2 || pool.Count() != 2 {
+		t.Errorf("Expected 2 posts pooled and stored, got %d and %d", pool.Count(), len(store))
+	}
+
+	// A restarted pool reloads the posts accept allows, oldest first, and forgets the rest
+	forged := post("forged", now)
+	store[forged.Hash] = forged
+	reloaded := NewPostPool(DefaultPostPoolLimits, store)
+	loaded, err := reloaded.Load(func(p Post) error {
+		if p.Hash == forged.Hash {
+			return fmt.Errorf("forged")
+		}
+		return nil
+	})
+	if err != nil || loaded != 2 {
+		t.Fatalf("Expected 2 posts reloaded, got %d (%v)", loaded, err)
+	}
+	if oldest := reloaded.Oldest(2); len(oldest) != 2 || oldest[0].Hash != first.Hash {
+		t.Errorf("Expected the oldest post first after reload, got %+v", oldest)
+	}
+	if _, exists := store[forged.Hash]; exists {
+		t.Error("Expected the rejected post dropped from the store")
+	}
+
+	// Confirmed posts leave the pool and the store
+	if removed := reloaded.RemoveConfirmed([]Post{first, post("unknown", now)}); removed != 1 {
+		t.Errorf("Expected 1 confirmed post removed, got %d", removed)
+	}
+	if _, exists := store[first.Hash]; exists || reloaded.Count() != 1 {
+		t.Errorf("Expected only the unconfirmed post left, pool holds %d", reloaded.Count())
+	}
+	if cost := reloaded.Cost(alice.GetAddress(), params); cost != len("second") {
+		t.Errorf("Expected the author's pending posts to cost %d, got %d", len("second"), cost)
+	}
+
+	// Posts the rules no longer allow are dropped
+	legacy := post("legacy", now)
+	legacy.Version = EncodingLegacy
+	legacy.SetHash()
+	if err := reloaded.Add(legacy); err != nil {
+		t.Fatalf("Failed to add post: %v", err)
+	}
+	if dropped := reloaded.Filter(func(p Post) error { return p.ValidateRules(params) }); dropped != 1 || reloaded.Count() != 1 {
+		t.Errorf("Expected the legacy post dropped, dropped %d with %d left", dropped, reloaded.Count())
+	}
+}
+
+func TestPostPoolLimits(t *testing.T) {
+	alice, _ := wallet.NewTestnetWallet("alice")
+	post := func(content string, timestamp int64) Post {
+		post := Post{Author: alice.GetAddress(), Content: content, Timestamp: timestamp, Signature: "signature", Version: EncodingCanonical}
+		post.SetHash()
+		return post
+	}
+	now := time.Now().Unix()
+
+	// Posts past the age limit are refused
+	pool := NewPostPool(PostPoolLimits{MaxPosts: 2, MaxBytes: 1000, MaxAge: time.Hour}, nil)
+	if err := pool.Add(post("stale", now-7200)); err == nil {
+		t.Error("Expected an expired post to be refused")
+	}
+
+	// The pool caps its post count and size, and hands out posts in arrival order
+	for _, content := range []string{"second", "first"} {
+		if err := pool.Add(post(content, now)); err != nil {
+			t.Fatalf("Failed to add post: %v", err)
+		}
+	}
+	if err := pool.Add(post("third", now)); err == nil {
+		t.Error("Expected a post past the count limit to be refused")
+	}
+	if oldest := pool.Oldest(1); len(oldest) != 1 || oldest[0].Content != "second" {
+		t.Errorf("Expected the first post to arrive to go first, got %+v", oldest)
+	}
+	small := NewPostPool(PostPoolLimits{MaxPosts: 10, MaxBytes: 300, MaxAge: time.Hour}, nil)
+	if err := small.Add(post(strings.Repeat("a", 400), now)); err == nil {
+		t.Error("Expected a post past the size limit to be refused")
+	}
+
+	// A pending post reserves its author's characters
+	params := ConsensusParamsAt(RegtestNetworkID, 1)
+	if cost := pool.Cost(alice.GetAddress(), params); cost != len("second")+len("first") {
+		t.Errorf("Expected the author's pending posts to cost %d, got %d", len("second")+len("first"), cost)
+	}
+}
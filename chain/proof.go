@@ -0,0 +1,94 @@
+package chain
+
+import "fmt"
+
+// PostProof lets a light client check that a post is in the chain without downloading blocks
+type PostProof struct {
+	PostHash      string       `json:"post_hash"`     // Post being proven
+	Header        *BlockHeader `json:"header"`        // Header of the block containing the post
+	Proof         *MerkleProof `json:"proof"`         // Path from the post to the header's posts root
+	Confirmations int          `json:"confirmations"` // Blocks on top of and including the post's block, as reported by the node
+}
+
+// VerifyPostProof checks a post proof against a header chain and returns its confirmations
+// The headers must be a linked chain that passes ValidateChainHeaders and contains the
+// proof's block. Confirmations are counted from the header chain, not taken from the proof.
+func VerifyPostProof(proof *PostProof, headers []*BlockHeader, networkID string) (int, error) {
+	if proof == nil || proof.Header == nil {
+		return 0, fmt.Errorf("incomplete post proof")
+	}
+	if err := ValidateChainHeaders(headers, networkID); err != nil {
+		return 0, fmt.Errorf("invalid header chain: %w", err)
+	}
+
+	position, err := headerPosition(proof.Header, headers)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := VerifyPostInclusion(headers[position], proof.PostHash, proof.Proof); err != nil {
+		return 0, err
+	}
+
+	return len(headers) - position, nil
+}
+
+// headerPosition returns where a proof's header sits in a validated header chain
+func headerPosition(header *BlockHeader, headers []*BlockHeader) (int, error) {
+	first := headers[0].Index
+	position := header.Index - first
+	if position < 0 || position >= len(headers) {
+		return 0, fmt.Errorf("block %d is outside the header chain (%d-%d)", header.Index, first, headers[len(headers)-1].Index)
+	}
+	if headers[position].Hash != header.Hash {
+		return 0, fmt.Errorf("block %d in proof does not match header chain", header.Index)
+	}
+	return position, nil
+}
+
+// WalletProof lets a client check a wallet's balance and nonce without trusting the node it asks
+type WalletProof struct {
+	Address string       `json:"address"` // Wallet being proven
+	Wallet  *WalletState `json:"wallet"`  // State after the block, nil if the wallet did not exist
+	Header  *BlockHeader `json:"header"`  // Header whose state root the proof leads to
+	Proof   *StateProof  `json:"proof"`   // Inclusion or exclusion path in the state tree
+}
+
+// VerifyWalletProof checks a wallet proof against a header chain and returns the proven state
+// The headers must be a linked chain that passes ValidateChainHeaders and contains the
+// proof's block. A nil state without an error proves the wallet did not exist.
+func VerifyWalletProof(proof *WalletProof, headers []*BlockHeader, networkID string) (*WalletState, error) {
+	if proof == nil || proof.Header == nil {
+		return nil, fmt.Errorf("incomplete wallet proof")
+	}
+	if err := ValidateChainHeaders(headers, networkID); err != nil {
+		return nil, fmt.Errorf("invalid header chain: %w", err)
+	}
+
+	position, err := headerPosition(proof.Header, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifyWalletState(headers[position], proof.Address, proof.Wallet, proof.Proof); err != nil {
+		return nil, err
+	}
+	return proof.Wallet, nil
+}
+
+// VerifyWalletState checks that a wallet had a state (nil for absent) after the block of header
+func VerifyWalletState(header *BlockHeader, address string, wallet *WalletState, proof *StateProof) error {
+	if header == nil {
+		return fmt.Errorf("no block header")
+	}
+	if header.Index == 0 {
+		return fmt.Errorf("genesis state is not committed to a state tree")
+	}
+	if header.Version == EncodingLegacy {
+		return fmt.Errorf("legacy header %d does not commit to its state root", header.Index)
+	}
+	if err := VerifyWalletStateProof(header.StateRoot, address, wallet, proof); err != nil {
+		return fmt.Errorf("wallet %s does not match block %d: %w", address, header.Index, err)
+	}
+	return nil
+}
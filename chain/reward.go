@@ -0,0 +1,285 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// HeartbeatProof is a signed uptime heartbeat carried as reward evidence
+// From the canonical encoding on, a heartbeat names the chain tip it was made on,
+// so it cannot be signed before the chain reached that block.
+type HeartbeatProof struct {
+	Timestamp  int64  `json:"timestamp"`             // Unix timestamp of the heartbeat
+	BlockIndex int    `json:"block_index,omitempty"` // Index of the anchor block
+	BlockHash  string `json:"block_hash,omitempty"`  // Hash of the anchor block (empty on legacy heartbeats)
+	Signature  string `json:"signature"`             // Compact signature of the heartbeat's signing data
+}
+
+// UptimeReward is a coinbase entry that mints characters to an uptime miner
+type UptimeReward struct {
+	Recipient  string           `json:"recipient"`         // Rewarded wallet address
+	Amount     int              `json:"amount"`            // Characters minted (set by the emission schedule)
+	Timestamp  int64            `json:"timestamp"`         // Unix timestamp of the reward claim
+	Heartbeats []HeartbeatProof `json:"heartbeats"`        // Signed heartbeats from the last 24 hours
+	Hash       string           `json:"hash"`              // Hash of the reward entry
+	Version    uint8            `json:"version,omitempty"` // Encoding the hash is computed in
+}
+
+// SigningData returns the data a miner signs for a heartbeat
+// Anchored heartbeats sign a tagged canonical record; legacy heartbeats keep the
+// address+timestamp message they were created with.
+func (hb HeartbeatProof) SigningData(address string) []byte {
+	if hb.BlockHash == "" {
+		return []byte(fmt.Sprintf("%s%d", address, hb.Timestamp))
+	}
+
+	e := newEncoder(tagHeartbeat, EncodingCanonical)
+	e.writeString(address)
+	e.writeInt(hb.Timestamp)
+	e.writeInt(int64(hb.BlockIndex))
+	e.writeString(hb.BlockHash)
+	return e.buf.Bytes()
+}
+
+// CalculateHash calculates the hash of a reward entry in its encoding version
+func (r *UptimeReward) CalculateHash() string {
+	if r.Version != EncodingLegacy {
+		e := newEncoder(tagReward, r.Version)
+		r.encodeHashedFields(e)
+		return e.hash()
+	}
+
+	data := fmt.Sprintf("%s:%d:%d", r.Recipient, r.Amount, r.Timestamp)
+	for _, hb := range r.Heartbeats {
+		data += fmt.Sprintf(":%d:%s", hb.Timestamp, hb.Signature)
+	}
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
+
+// SetHash sets the hash field of the reward entry
+func (r *UptimeReward) SetHash() {
+	r.Hash = r.CalculateHash()
+}
+
+// ValidateEvidence checks the heartbeat evidence of a reward claim
+func (r *UptimeReward) ValidateEvidence() error {
+	return r.validateEvidence(true)
+}
+
+// validateEvidence checks the heartbeat evidence, optionally skipping signatures (assume-valid blocks)
+func (r *UptimeReward) validateEvidence(verifySignatures bool) error {
+	if !wallet.ValidateAddressFormat(r.Recipient) {
+		return fmt.Errorf("invalid reward recipient: %s", r.Recipient)
+	}
+	if r.Timestamp <= 0 {
+		return fmt.Errorf("reward timestamp must be positive")
+	}
+	if len(r.Heartbeats) < RewardMinHeartbeats {
+		return fmt.Errorf("insufficient uptime evidence: %d heartbeats, need %d", len(r.Heartbeats), RewardMinHeartbeats)
+	}
+
+	windowStart := r.Timestamp - int64(RewardWindow.Seconds())
+	minSpacing := int64(MinHeartbeatSpacing.Seconds())
+	var prev int64
+	for i, hb := range r.Heartbeats {
+		if hb.Timestamp <= windowStart || hb.Timestamp > r.Timestamp {
+			return fmt.Errorf("heartbeat %d outside reward window", i)
+		}
+		if i > 0 && hb.Timestamp-prev < minSpacing {
+			return fmt.Errorf("heartbeat %d too close to previous heartbeat", i)
+		}
+		prev = hb.Timestamp
+
+		if !verifySignatures {
+			continue
+		}
+		hash := sha256.Sum256(hb.SigningData(r.Recipient))
+		pubKey, err := wallet.RecoverPublicKeyFromSignature(hex.EncodeToString(hash[:]), hb.Signature)
+		if err != nil {
+			return fmt.Errorf("heartbeat %d signature recovery failed: %w", i, err)
+		}
+		if !wallet.PublicKeyMatchesAddress(pubKey, r.Recipient) {
+			return fmt.Errorf("heartbeat %d not signed by recipient", i)
+		}
+	}
+
+	return nil
+}
+
+// Validate validates a reward entry included in a block
+func (r *UptimeReward) Validate(blockTimestamp int64) error {
+	return r.validate(blockTimestamp, true)
+}
+
+// validate validates a reward entry, optionally skipping heartbeat signatures
+func (r *UptimeReward) validate(blockTimestamp int64, verifySignatures bool) error {
+	if err := r.validateEvidence(verifySignatures); err != nil {
+		return err
+	}
+	if r.Timestamp > blockTimestamp {
+		return fmt.Errorf("reward claim is newer than its block")
+	}
+	if blockTimestamp-r.Timestamp > int64(RewardClaimTTL.Seconds()) {
+		return fmt.Errorf("reward claim expired")
+	}
+	if r.Hash != r.CalculateHash() {
+		return fmt.Errorf("reward hash mismatch")
+	}
+	return nil
+}
+
+// ValidateRules checks a reward against the consensus rules of the block it goes into
+func (r *UptimeReward) ValidateRules(params ConsensusParams) error {
+	if err := checkEncoding(r.Version, params); err != nil {
+		return err
+	}
+	if !wallet.ValidateAddressWithVersion(r.Recipient, params.AddressVersion) {
+		return fmt.Errorf("reward recipient %s is not an address of this network", r.Recipient)
+	}
+
+	// Heartbeats are anchored to a block from the canonical encoding on
+	anchored := params.Encoding >= EncodingCanonical
+	for i, hb := range r.Heartbeats {
+		if hb.BlockHash == "" && anchored {
+			return fmt.Errorf("heartbeat %d is not anchored to a block", i)
+		}
+		if hb.BlockHash != "" && !anchored {
+			return fmt.Errorf("heartbeat %d anchor is not active", i)
+		}
+	}
+	return nil
+}
+
+// ValidateAnchors checks that each heartbeat names a block of the chain the reward is claimed on
+// blockAt returns the block at an index of that chain below the reward's block. A heartbeat
+// must come after its anchor and within HeartbeatAnchorMaxAge of it.
+func (r *UptimeReward) ValidateAnchors(blockAt func(index int) (*Block, error)) error {
+	maxAge := int64(HeartbeatAnchorMaxAge.Seconds())
+	for i, hb := range r.Heartbeats {
+		if hb.BlockHash == "" {
+			continue
+		}
+		anchor, err := blockAt(hb.BlockIndex)
+		if err != nil {
+			return fmt.Errorf("heartbeat %d anchor %d not found: %w", i, hb.BlockIndex, err)
+		}
+		if anchor.Hash != hb.BlockHash {
+			return fmt.Errorf("heartbeat %d anchor is not on this chain", i)
+		}
+		if hb.Timestamp < anchor.Timestamp || hb.Timestamp-anchor.Timestamp > maxAge {
+			return fmt.Errorf("heartbeat %d not within %v after its anchor", i, HeartbeatAnchorMaxAge)
+		}
+	}
+	return nil
+}
+
+// CalculateDailyReward returns the daily character reward per node for the given node count
+func CalculateDailyReward(nodeCount int) int {
+	if nodeCount <= 0 {
+		return 0
+	}
+
+	// Logarithmic decay formula from whitepaper
+	// For nodeCount = 1: reward = 1120
+	// For nodeCount = 1000: reward = 280
+	// For nodeCount > 1000: reward decreases further
+
+	if nodeCount == 1 {
+		return 1120
+	} else if nodeCount <= 1000 {
+		// Linear interpolation between known points
+		if nodeCount <= 10 {
+			// Between 1 and 10 nodes
+			ratio := float64(nodeCount-1) / 9.0
+			return int(1120 - ratio*(1120-1037))
+		} else if nodeCount <= 100 {
+			// Between 10 and 100 nodes
+			ratio := float64(nodeCount-10) / 90.0
+			return int(1037 - ratio*(1037-800))
+		} else if nodeCount <= 500 {
+			// Between 100 and 500 nodes
+			ratio := float64(nodeCount-100) / 400.0
+			return int(800 - ratio*(800-451))
+		} else {
+			// Between 500 and 1000 nodes
+			ratio := float64(nodeCount-500) / 500.0
+			return int(451 - ratio*(451-280))
+		}
+	} else {
+		// For more than 1000 nodes, share the daily cap
+		reward := float64(DailyCharacterCap) / float64(nodeCount)
+		if reward < 1 {
+			reward = 1
+		}
+		return int(reward)
+	}
+}
+
+// CalculateBatchReward returns the per-entry reward of a batch shared among nodeCount nodes
+func CalculateBatchReward(nodeCount int) int {
+	if nodeCount <= 0 {
+		return 0
+	}
+	batchReward := CalculateDailyReward(nodeCount) / RewardBatchesPerDay
+	if batchReward < 1 {
+		batchReward = 1
+	}
+	return batchReward
+}
+
+// ValidateBlockRewards checks the rewards of a block
+// Their amounts depend on state and are checked against the emission schedule when the block is applied.
+func ValidateBlockRewards(rewards []UptimeReward, blockTimestamp int64) error {
+	return validateBlockRewards(rewards, blockTimestamp, true)
+}
+
+// validateBlockRewards checks the rewards of a block, optionally skipping heartbeat signatures
+func validateBlockRewards(rewards []UptimeReward, blockTimestamp int64, verifySignatures bool) error {
+	seen := make(map[string]bool)
+
+	for i, reward := range rewards {
+		if seen[reward.Recipient] {
+			return fmt.Errorf("duplicate reward for %s", reward.Recipient)
+		}
+		seen[reward.Recipient] = true
+
+		if reward.Amount <= 0 {
+			return fmt.Errorf("reward %d amount must be positive", i)
+		}
+		if err := reward.validate(blockTimestamp, verifySignatures); err != nil {
+			return fmt.Errorf("invalid reward %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateRegtestRewards checks the rewards of a regtest block
+// Regtest rewards fund wallets on demand, so they need no uptime evidence and
+// may mint any positive amount.
+func validateRegtestRewards(rewards []UptimeReward, blockTimestamp int64) error {
+	seen := make(map[string]bool)
+
+	for i, reward := range rewards {
+		if seen[reward.Recipient] {
+			return fmt.Errorf("duplicate reward for %s", reward.Recipient)
+		}
+		seen[reward.Recipient] = true
+
+		if reward.Amount <= 0 {
+			return fmt.Errorf("reward %d amount must be positive", i)
+		}
+		if reward.Timestamp <= 0 || reward.Timestamp > blockTimestamp {
+			return fmt.Errorf("reward %d timestamp outside its block", i)
+		}
+		if reward.Hash != reward.CalculateHash() {
+			return fmt.Errorf("reward %d hash mismatch", i)
+		}
+	}
+
+	return nil
+}
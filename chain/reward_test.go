@@ -0,0 +1,86 @@
+package chain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// anchoredReward builds a reward claim with heartbeats signed by w, each anchored to a block of blocks
+func anchoredReward(t *testing.T, w *wallet.Wallet, blocks map[int]*Block) UptimeReward {
+	reward := UptimeReward{Recipient: w.GetAddress(), Amount: 1, Version: EncodingCanonical}
+	for i := 0; i < RewardMinHeartbeats; i++ {
+		anchor := &Block{Index: i, Hash: fmt.Sprintf("block-%d", i), Timestamp: 1700000000 + int64(i)*3600}
+		blocks[i] = anchor
+
+		hb := HeartbeatProof{Timestamp: anchor.Timestamp + 600, BlockIndex: anchor.Index, BlockHash: anchor.Hash}
+		signature, err := w.Sign(hb.SigningData(w.GetAddress()))
+		if err != nil {
+			t.Fatalf("Failed to sign heartbeat: %v", err)
+		}
+		hb.Signature = hex.EncodeToString(signature)
+		reward.Heartbeats = append(reward.Heartbeats, hb)
+		reward.Timestamp = hb.Timestamp + 60
+	}
+	reward.SetHash()
+	return reward
+}
+
+func TestHeartbeatAnchors(t *testing.T) {
+	miner, err := wallet.NewTestnetWallet("miner")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	blocks := make(map[int]*Block)
+	blockAt := func(index int) (*Block, error) {
+		block, exists := blocks[index]
+		if !exists {
+			return nil, fmt.Errorf("block %d not found", index)
+		}
+		return block, nil
+	}
+
+	reward := anchoredReward(t, miner, blocks)
+	if err := reward.ValidateEvidence(); err != nil {
+		t.Fatalf("Valid anchored heartbeats rejected: %v", err)
+	}
+	if err := reward.ValidateAnchors(blockAt); err != nil {
+		t.Fatalf("Valid anchors rejected: %v", err)
+	}
+
+	// Anchors are required from the canonical encoding on and refused before it
+	if err := reward.ValidateRules(ConsensusParamsAt(TestnetNetworkID, 75000)); err != nil {
+		t.Errorf("Anchored heartbeats rejected under the canonical encoding: %v", err)
+	}
+	if err := reward.ValidateRules(ConsensusParamsAt(TestnetNetworkID, 1)); err == nil {
+		t.Error("Expected anchored heartbeats to be rejected before the canonical encoding")
+	}
+	legacy := reward
+	legacy.Heartbeats = []HeartbeatProof{{Timestamp: reward.Timestamp - 60, Signature: "sig"}}
+	if err := legacy.ValidateRules(ConsensusParamsAt(TestnetNetworkID, 75000)); err == nil {
+		t.Error("Expected unanchored heartbeats to be rejected under the canonical encoding")
+	}
+
+	// The signature commits to the anchor
+	moved := anchoredReward(t, miner, blocks)
+	moved.Heartbeats[0].BlockHash = "block-1"
+	if err := moved.ValidateEvidence(); err == nil {
+		t.Error("Expected a heartbeat moved to another anchor to fail its signature")
+	}
+
+	// Anchors must be on the chain and shortly before the heartbeat
+	blocks[3] = &Block{Index: 3, Hash: "other-fork", Timestamp: blocks[3].Timestamp}
+	if err := reward.ValidateAnchors(blockAt); err == nil {
+		t.Error("Expected an anchor from another fork to be rejected")
+	}
+	blocks[3] = &Block{Index: 3, Hash: "block-3", Timestamp: reward.Heartbeats[3].Timestamp - int64(HeartbeatAnchorMaxAge.Seconds()) - 1}
+	if err := reward.ValidateAnchors(blockAt); err == nil {
+		t.Error("Expected a stale anchor to be rejected")
+	}
+	blocks[3] = &Block{Index: 3, Hash: "block-3", Timestamp: reward.Heartbeats[3].Timestamp + 1}
+	if err := reward.ValidateAnchors(blockAt); err == nil {
+		t.Error("Expected a heartbeat older than its anchor to be rejected")
+	}
+}
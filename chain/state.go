@@ -1,6 +1,8 @@
 package chain
 
 import (
+	"container/list"
+	"encoding/hex"
 	"fmt"
 	"sort"
 	"sync"
@@ -8,29 +10,102 @@ import (
 )
 
 // StateManager handles global state management and StateRoot calculation
+// Committed wallets live in the state tree and are read on demand through a
+// bounded cache; only wallets changed since the last commit are held in full.
 type StateManager struct {
 	mu sync.RWMutex
-	// Current state
+	// Wallets changed since the last state tree commit (every wallet before the first)
 	wallets map[string]*WalletState
-	// Nonce tracking per address
-	nonces map[string]int64
+	// Committed wallets recently read from the state tree
+	cache *walletCache
+
+	// Totals of the whole state, kept current so reading them needs no walk
+	walletCount int
+	supply      int
+	rewarded    map[string]int64 // Last reward time of every wallet ever rewarded
+
+	// Committed state tree
+	tree *StateTree
+	root [32]byte
 }
 
-// NewStateManager creates a new state manager
+// NewStateManager creates a new state manager with an in-memory state tree
 func NewStateManager() *StateManager {
+	return NewStateManagerWithStore(NewMemoryStateNodeStore())
+}
+
+// NewStateManagerWithStore creates a new state manager whose state tree lives in store
+func NewStateManagerWithStore(store StateNodeStore) *StateManager {
 	return &StateManager{
-		wallets: make(map[string]*WalletState),
-		nonces:  make(map[string]int64),
+		wallets:  make(map[string]*WalletState),
+		cache:    newWalletCache(MaxCachedWallets),
+		rewarded: make(map[string]int64),
+		tree:     NewStateTree(store),
+	}
+}
+
+// encodeWalletState returns the value stored in the state tree for a wallet
+func encodeWalletState(wallet WalletState) []byte {
+	e := newEncoder(tagWallet, EncodingCanonical)
+	e.writeString(wallet.Address)
+	e.writeInt(int64(wallet.Balance))
+	e.writeInt(wallet.Nonce)
+	e.writeInt(wallet.LastTxTime)
+	e.writeInt(wallet.LastRewardTime)
+	return e.buf.Bytes()
+}
+
+// decodeWalletState decodes a wallet from its state tree value
+func decodeWalletState(data []byte) (*WalletState, error) {
+	d, _ := newDecoder(data, tagWallet)
+	wallet := &WalletState{
+		Address:        d.readString(),
+		Balance:        d.readInt(),
+		Nonce:          d.readInt64(),
+		LastTxTime:     d.readInt64(),
+		LastRewardTime: d.readInt64(),
+	}
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode wallet state: %w", err)
+	}
+	return wallet, nil
+}
+
+// lookup returns the current state of a wallet (caller must hold the lock)
+// The result is shared and must not be modified.
+func (sm *StateManager) lookup(address string) (*WalletState, bool, error) {
+	if wallet, exists := sm.wallets[address]; exists {
+		return wallet, true, nil
 	}
+	if sm.root == emptyStateNode {
+		return nil, false, nil
+	}
+	if wallet, cached := sm.cache.get(address); cached {
+		return wallet, wallet != nil, nil
+	}
+
+	value, found, err := sm.tree.Get(sm.root, StateKey(address))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read state of %s: %w", address, err)
+	}
+	var wallet *WalletState
+	if found {
+		if wallet, err = decodeWalletState(value); err != nil {
+			return nil, false, err
+		}
+	}
+	sm.cache.add(address, wallet)
+	return wallet, found, nil
 }
 
 // GetWalletState returns the current state of a wallet
+// A wallet whose committed state cannot be read is reported as missing.
 func (sm *StateManager) GetWalletState(address string) (*WalletState, bool) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	wallet, exists := sm.wallets[address]
-	if !exists {
+	wallet, exists, err := sm.lookup(address)
+	if err != nil || !exists {
 		return nil, false
 	}
 
@@ -40,48 +115,42 @@ func (sm *StateManager) GetWalletState(address string) (*WalletState, bool) {
 }
 
 // UpdateWalletState updates the state of a wallet
-func (sm *StateManager) UpdateWalletState(address string, balance int, nonce int64) {
+func (sm *StateManager) UpdateWalletState(address string, balance int, nonce int64) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	now := time.Now().Unix()
 
-	wallet, exists := sm.wallets[address]
-	if !exists {
-		wallet = &WalletState{
-			Address:    address,
-			Balance:    balance,
-			Nonce:      nonce,
-			LastTxTime: now,
-		}
-		sm.wallets[address] = wallet
-	} else {
-		wallet.Balance = balance
-		wallet.Nonce = nonce
-		wallet.LastTxTime = now
+	view := sm.newStateView()
+	wallet, err := view.wallet(address, now)
+	if err != nil {
+		return err
 	}
+	wallet.Balance = balance
+	wallet.Nonce = nonce
+	wallet.LastTxTime = now
+	sm.commitView(view)
 
-	// Update nonce tracking
-	sm.nonces[address] = nonce
+	return nil
 }
 
-// GetNextNonce returns the next nonce for an address
-func (sm *StateManager) GetNextNonce(address string) int64 {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+// GetNonce returns the nonce of the last transfer an address made
+func (sm *StateManager) GetNonce(address string) int64 {
+	wallet, exists := sm.GetWalletState(address)
+	if !exists {
+		return 0
+	}
+	return wallet.Nonce
+}
 
-	currentNonce := sm.nonces[address]
-	nextNonce := currentNonce + 1
-	sm.nonces[address] = nextNonce
-	return nextNonce
+// GetNextNonce returns the nonce an address's next transfer should use
+func (sm *StateManager) GetNextNonce(address string) int64 {
+	return sm.GetNonce(address) + 1
 }
 
 // GetEffectiveBalance returns the effective balance considering pending transactions
 func (sm *StateManager) GetEffectiveBalance(address string, pendingTransfers []Transfer) int {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-
-	wallet, exists := sm.wallets[address]
+	wallet, exists := sm.GetWalletState(address)
 	if !exists {
 		return 0
 	}
@@ -129,131 +198,537 @@ func (sm *StateManager) ApplyTransfer(transfer Transfer) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	// Get sender wallet
-	senderWallet, exists := sm.wallets[transfer.From]
-	if !exists {
-		senderWallet = &WalletState{
-			Address:    transfer.From,
-			Balance:    0,
-			Nonce:      0,
-			LastTxTime: time.Now().Unix(),
+	view := sm.newStateView()
+	if err := view.applyTransfer(transfer); err != nil {
+		return err
+	}
+	sm.commitView(view)
+
+	return nil
+}
+
+// ValidateReward validates an uptime reward against current state
+func (sm *StateManager) ValidateReward(reward UptimeReward) error {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.validateReward(reward)
+}
+
+// validateReward enforces the per-node reward interval (caller must hold the lock)
+func (sm *StateManager) validateReward(reward UptimeReward) error {
+	lastReward, rewarded := sm.rewarded[reward.Recipient]
+	if !rewarded {
+		return nil
+	}
+
+	if reward.Timestamp-lastReward < int64(UptimeRewardInterval.Seconds()) {
+		return fmt.Errorf("reward too frequent for %s: last reward at %d", reward.Recipient, lastReward)
+	}
+
+	return nil
+}
+
+// RewardAmount returns what each uptime reward in a block at timestamp mints by the emission schedule
+func (sm *StateManager) RewardAmount(recipients []string, timestamp int64) int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return CalculateBatchReward(sm.rewardNodeCount(recipients, timestamp))
+}
+
+// rewardNodeCount returns how many nodes a block's rewards are shared among (caller must hold the lock)
+// These are the wallets rewarded within RewardWindow before the block plus the block's own
+// recipients, so the count does not depend on which claims the producer included.
+func (sm *StateManager) rewardNodeCount(recipients []string, timestamp int64) int {
+	windowStart := timestamp - int64(RewardWindow.Seconds())
+	active := make(map[string]bool)
+	for address, lastReward := range sm.rewarded {
+		if lastReward > windowStart {
+			active[address] = true
 		}
-		sm.wallets[transfer.From] = senderWallet
 	}
+	for _, recipient := range recipients {
+		active[recipient] = true
+	}
+	return len(active)
+}
 
-	// Get recipient wallet
-	recipientWallet, exists := sm.wallets[transfer.To]
-	if !exists {
-		recipientWallet = &WalletState{
-			Address:    transfer.To,
-			Balance:    0,
-			Nonce:      0,
-			LastTxTime: time.Now().Unix(),
+// ApplyReward credits an uptime reward to the current state
+func (sm *StateManager) ApplyReward(reward UptimeReward) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	view := sm.newStateView()
+	if err := view.applyReward(reward, true); err != nil {
+		return err
+	}
+	sm.commitView(view)
+
+	return nil
+}
+
+// ApplyBlock applies the state changes of a block: transfers, then post costs, then rewards
+// The block is applied in full or not at all. Every node applies blocks the same
+// way, so the resulting state root can be checked against the block's.
+func (sm *StateManager) ApplyBlock(block *Block, params ConsensusParams) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	view := sm.newStateView()
+	for i, transfer := range block.Transfers {
+		if err := view.applyTransfer(transfer); err != nil {
+			return fmt.Errorf("transfer %d: %w", i, err)
+		}
+	}
+	for i, post := range block.Posts {
+		if err := view.applyPostCost(post, params); err != nil {
+			return fmt.Errorf("post %d: %w", i, err)
+		}
+	}
+	// Rewards are priced from the nodes rewarded before the block (regtest funds any amount)
+	recipients := make([]string, len(block.Rewards))
+	for i, reward := range block.Rewards {
+		recipients[i] = reward.Recipient
+	}
+	expected := CalculateBatchReward(sm.rewardNodeCount(recipients, block.Timestamp))
+	for i, reward := range block.Rewards {
+		if !params.Regtest && reward.Amount != expected {
+			return fmt.Errorf("reward %d amount %d does not match emission schedule %d", i, reward.Amount, expected)
+		}
+		if err := view.applyReward(reward, !params.Regtest); err != nil {
+			return fmt.Errorf("reward %d: %w", i, err)
 		}
-		sm.wallets[transfer.To] = recipientWallet
+	}
+	sm.commitView(view)
+
+	return nil
+}
+
+// stateView collects changes to the state so they can be applied all at once
+type stateView struct {
+	sm       *StateManager
+	changed  map[string]*WalletState
+	previous map[string]*WalletState // State of each changed wallet before the view, nil if new
+}
+
+// newStateView starts a set of changes on top of the current state (caller must hold the lock)
+func (sm *StateManager) newStateView() *stateView {
+	return &stateView{sm: sm, changed: make(map[string]*WalletState), previous: make(map[string]*WalletState)}
+}
+
+// wallet returns the changeable copy of a wallet, creating it if needed
+func (v *stateView) wallet(address string, createdAt int64) (*WalletState, error) {
+	if wallet, exists := v.changed[address]; exists {
+		return wallet, nil
+	}
+
+	existing, exists, err := v.sm.lookup(address)
+	if err != nil {
+		return nil, err
+	}
+	wallet := &WalletState{Address: address, LastTxTime: createdAt}
+	if exists {
+		*wallet = *existing
+	}
+	v.changed[address] = wallet
+	v.previous[address] = existing
+	return wallet, nil
+}
+
+// applyTransfer moves characters from sender to recipient
+func (v *stateView) applyTransfer(transfer Transfer) error {
+	sender, err := v.wallet(transfer.From, transfer.Timestamp)
+	if err != nil {
+		return err
 	}
 
 	// Validate sender balance
-	if senderWallet.Balance < transfer.GetTotalCost() {
-		return fmt.Errorf("insufficient balance: %d, need %d", senderWallet.Balance, transfer.GetTotalCost())
+	if sender.Balance < transfer.GetTotalCost() {
+		return fmt.Errorf("insufficient balance: %d, need %d", sender.Balance, transfer.GetTotalCost())
 	}
 
 	// Validate nonce
-	if transfer.Nonce <= senderWallet.Nonce {
-		return fmt.Errorf("invalid nonce: expected > %d, got %d", senderWallet.Nonce, transfer.Nonce)
+	if transfer.Nonce <= sender.Nonce {
+		return fmt.Errorf("invalid nonce: expected > %d, got %d", sender.Nonce, transfer.Nonce)
+	}
+
+	// Apply transfer (timestamps come from the transfer so every node gets the same state)
+	sender.Balance -= transfer.GetTotalCost()
+	sender.Nonce = transfer.Nonce
+	sender.LastTxTime = transfer.Timestamp
+
+	recipient, err := v.wallet(transfer.To, transfer.Timestamp)
+	if err != nil {
+		return err
 	}
+	recipient.Balance += transfer.Amount
+	recipient.LastTxTime = transfer.Timestamp
 
-	// Apply transfer
-	senderWallet.Balance -= transfer.GetTotalCost()
-	senderWallet.Nonce = transfer.Nonce
-	senderWallet.LastTxTime = time.Now().Unix()
+	return nil
+}
 
-	recipientWallet.Balance += transfer.Amount
-	recipientWallet.LastTxTime = time.Now().Unix()
+// applyPostCost charges a post's author one character per character posted
+func (v *stateView) applyPostCost(post Post, params ConsensusParams) error {
+	author, err := v.wallet(post.Author, post.Timestamp)
+	if err != nil {
+		return err
+	}
 
-	// Update nonce tracking
-	sm.nonces[transfer.From] = transfer.Nonce
+	cost := post.GetCharacterCount(params)
+	if author.Balance < cost {
+		return fmt.Errorf("insufficient balance for post by %s: %d, need %d", post.Author, author.Balance, cost)
+	}
 
+	author.Balance -= cost
+	author.LastTxTime = post.Timestamp
 	return nil
 }
 
-// CalculateStateRoot calculates the StateRoot for the current state
-func (sm *StateManager) CalculateStateRoot(blockIndex int) *StateRoot {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+// applyReward credits an uptime reward
+// Regtest rewards fund wallets on demand and are not rate limited.
+func (v *stateView) applyReward(reward UptimeReward, rateLimited bool) error {
+	recipient, err := v.wallet(reward.Recipient, reward.Timestamp)
+	if err != nil {
+		return err
+	}
 
-	// Convert map to slice
-	wallets := make([]WalletState, 0, len(sm.wallets))
-	for _, wallet := range sm.wallets {
-		wallets = append(wallets, *wallet)
+	if rateLimited && recipient.LastRewardTime != 0 && reward.Timestamp-recipient.LastRewardTime < int64(UptimeRewardInterval.Seconds()) {
+		return fmt.Errorf("reward too frequent for %s: last reward at %d", reward.Recipient, recipient.LastRewardTime)
 	}
 
-	// Sort wallets by address for deterministic ordering
-	sort.Slice(wallets, func(i, j int) bool {
-		return wallets[i].Address < wallets[j].Address
-	})
+	recipient.Balance += reward.Amount
+	recipient.LastRewardTime = reward.Timestamp
+	return nil
+}
+
+// commitView writes a view's changes into the current state (caller must hold the lock)
+func (sm *StateManager) commitView(v *stateView) {
+	for address, wallet := range v.changed {
+		if previous := v.previous[address]; previous != nil {
+			sm.supply -= previous.Balance
+		} else {
+			sm.walletCount++
+		}
+		sm.supply += wallet.Balance
+		if wallet.LastRewardTime != 0 {
+			sm.rewarded[address] = wallet.LastRewardTime
+		}
+		sm.wallets[address] = wallet
+	}
+}
+
+// CalculateStateRoot returns the root of the current state for the block at blockIndex
+// From UpgradeStateTree the state is committed to the state tree and only wallets
+// changed since the last commit are rehashed; before it the root embeds every wallet.
+func (sm *StateManager) CalculateStateRoot(blockIndex int, params ConsensusParams) (*StateRoot, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if !params.StateTree {
+		return sm.embeddedStateRoot(blockIndex)
+	}
+
+	// Update in address order so the nodes written do not depend on map order
+	addresses := make([]string, 0, len(sm.wallets))
+	for address := range sm.wallets {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	root := sm.root
+	for _, address := range addresses {
+		var err error
+		root, err = sm.tree.Update(root, StateKey(address), encodeWalletState(*sm.wallets[address]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to update state of %s: %w", address, err)
+		}
+	}
+	sm.tree.putRecord(stateTotalsKey(root), sm.encodeTotals())
+	if err := sm.tree.Commit(); err != nil {
+		return nil, err
+	}
+
+	// The changed wallets are now committed under the new root
+	for _, address := range addresses {
+		sm.cache.add(address, sm.wallets[address])
+	}
+	sm.root = root
+	sm.wallets = make(map[string]*WalletState)
 
-	stateRoot := &StateRoot{
-		Wallets:    wallets,
+	return &StateRoot{
+		Hash:       hex.EncodeToString(root[:]),
 		BlockIndex: blockIndex,
+	}, nil
+}
+
+// embeddedStateRoot returns a legacy state root listing every wallet (caller must hold the lock)
+// The state tree is left as it is; wallets stay uncommitted until the first state tree root.
+func (sm *StateManager) embeddedStateRoot(blockIndex int) (*StateRoot, error) {
+	wallets, err := sm.allWallets()
+	if err != nil {
+		return nil, err
 	}
 
+	stateRoot := &StateRoot{Wallets: wallets, BlockIndex: blockIndex}
 	stateRoot.SetHash()
-	return stateRoot
+	return stateRoot, nil
+}
+
+// stateTreeRoot returns the state tree root a StateRoot refers to
+// The genesis block predates the state tree; its state is empty.
+func stateTreeRoot(stateRoot *StateRoot) ([32]byte, error) {
+	if stateRoot.BlockIndex == 0 {
+		return emptyStateNode, nil
+	}
+	return ParseStateRoot(stateRoot.Hash)
+}
+
+// stateTotalsKey is where the totals of the state under root are stored next to the tree
+func stateTotalsKey(root [32]byte) []byte {
+	return append([]byte("totals:"), root[:]...)
 }
 
-// LoadStateFromStateRoot loads the state from a StateRoot
-func (sm *StateManager) LoadStateFromStateRoot(stateRoot *StateRoot) error {
+// encodeTotals encodes the totals of the current state (caller must hold the lock)
+func (sm *StateManager) encodeTotals() []byte {
+	addresses := make([]string, 0, len(sm.rewarded))
+	for address := range sm.rewarded {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	e := newEncoder(tagTotals, EncodingCanonical)
+	e.writeInt(int64(sm.walletCount))
+	e.writeInt(int64(sm.supply))
+	e.writeLength(len(addresses))
+	for _, address := range addresses {
+		e.writeString(address)
+		e.writeInt(sm.rewarded[address])
+	}
+	return e.buf.Bytes()
+}
+
+// loadTotals restores the totals of the state under root (caller must hold the lock)
+// A root committed without its totals is walked once to recompute them.
+func (sm *StateManager) loadTotals(root [32]byte) error {
+	sm.walletCount, sm.supply = 0, 0
+	sm.rewarded = make(map[string]int64)
+	if root == emptyStateNode {
+		return nil
+	}
+
+	if data, err := sm.tree.getRecord(stateTotalsKey(root)); err == nil {
+		d, _ := newDecoder(data, tagTotals)
+		sm.walletCount = d.readInt()
+		sm.supply = d.readInt()
+		for i, n := 0, d.readLength(); i < n; i++ {
+			address := d.readString()
+			sm.rewarded[address] = d.readInt64()
+		}
+		if err := d.finish(); err != nil {
+			return fmt.Errorf("failed to decode state totals: %w", err)
+		}
+		return nil
+	}
+
+	return sm.tree.Walk(root, func(key [32]byte, value []byte) error {
+		wallet, err := decodeWalletState(value)
+		if err != nil {
+			return err
+		}
+		sm.walletCount++
+		sm.supply += wallet.Balance
+		if wallet.LastRewardTime != 0 {
+			sm.rewarded[wallet.Address] = wallet.LastRewardTime
+		}
+		return nil
+	})
+}
+
+// LoadStateFromStateRoot loads the state committed by a StateRoot
+// Roots from UpgradeStateTree are read from the state tree as wallets are needed;
+// earlier roots embed their wallets.
+func (sm *StateManager) LoadStateFromStateRoot(stateRoot *StateRoot, params ConsensusParams) error {
+	if !params.StateTree {
+		sm.loadEmbeddedState(stateRoot.Wallets)
+		return nil
+	}
+
+	root, err := stateTreeRoot(stateRoot)
+	if err != nil {
+		return err
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	// Clear current state
+	if err := sm.loadTotals(root); err != nil {
+		return fmt.Errorf("failed to load state tree %x: %w", root, err)
+	}
 	sm.wallets = make(map[string]*WalletState)
-	sm.nonces = make(map[string]int64)
+	sm.cache.reset()
+	sm.root = root
 
-	// Load wallets from state root
-	for _, wallet := range stateRoot.Wallets {
+	return nil
+}
+
+// loadEmbeddedState loads the wallets of a legacy state root
+// They are all uncommitted against an empty tree, so the first state tree root commits all of them.
+func (sm *StateManager) loadEmbeddedState(embedded []WalletState) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.wallets = make(map[string]*WalletState)
+	sm.walletCount, sm.supply = 0, 0
+	sm.rewarded = make(map[string]int64)
+	for _, wallet := range embedded {
 		walletCopy := wallet
 		sm.wallets[wallet.Address] = &walletCopy
-		sm.nonces[wallet.Address] = wallet.Nonce
+		sm.walletCount++
+		sm.supply += wallet.Balance
+		if wallet.LastRewardTime != 0 {
+			sm.rewarded[wallet.Address] = wallet.LastRewardTime
+		}
 	}
+	sm.cache.reset()
+	sm.root = emptyStateNode
+}
 
-	return nil
+// ProveWalletState returns a wallet's state under a StateRoot with a proof against its hash
+// A nil state with a proof means the wallet did not exist at that point.
+func (sm *StateManager) ProveWalletState(stateRoot *StateRoot, address string) (*WalletState, *StateProof, error) {
+	root, err := stateTreeRoot(stateRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, proof, found, err := sm.tree.Prove(root, StateKey(address))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prove state of %s: %w", address, err)
+	}
+	if !found {
+		return nil, proof, nil
+	}
+
+	wallet, err := decodeWalletState(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wallet, proof, nil
 }
 
-// GetAllWallets returns all wallet states
-func (sm *StateManager) GetAllWallets() []WalletState {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+// VerifyWalletStateProof checks a wallet's state (nil for absent) against a state tree root
+func VerifyWalletStateProof(root string, address string, wallet *WalletState, proof *StateProof) error {
+	var value []byte
+	if wallet != nil {
+		if wallet.Address != address {
+			return fmt.Errorf("proof is for wallet %s, not %s", wallet.Address, address)
+		}
+		value = encodeWalletState(*wallet)
+	}
+	return VerifyStateProof(root, StateKey(address), value, proof)
+}
 
-	wallets := make([]WalletState, 0, len(sm.wallets))
+// allWallets returns every wallet, committed or not, by address (caller must hold the lock)
+func (sm *StateManager) allWallets() ([]WalletState, error) {
+	wallets := make([]WalletState, 0, sm.walletCount)
 	for _, wallet := range sm.wallets {
 		wallets = append(wallets, *wallet)
 	}
+	err := sm.tree.Walk(sm.root, func(key [32]byte, value []byte) error {
+		wallet, err := decodeWalletState(value)
+		if err != nil {
+			return err
+		}
+		if _, changed := sm.wallets[wallet.Address]; !changed {
+			wallets = append(wallets, *wallet)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state tree %x: %w", sm.root, err)
+	}
 
 	// Sort by address for consistent ordering
 	sort.Slice(wallets, func(i, j int) bool {
 		return wallets[i].Address < wallets[j].Address
 	})
+	return wallets, nil
+}
 
-	return wallets
+// GetAllWallets returns all wallet states
+// Committed wallets are read from the state tree, so this walks the whole state.
+func (sm *StateManager) GetAllWallets() ([]WalletState, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.allWallets()
 }
 
 // GetWalletCount returns the number of wallets in the state
 func (sm *StateManager) GetWalletCount() int {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
-	return len(sm.wallets)
+	return sm.walletCount
 }
 
 // GetTotalCharacterSupply returns the total character supply
 func (sm *StateManager) GetTotalCharacterSupply() int {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
+	return sm.supply
+}
 
-	total := 0
-	for _, wallet := range sm.wallets {
-		total += wallet.Balance
+// walletCache keeps the most recently read committed wallets, nil for absent ones
+// It has its own lock so readers holding the state's read lock can fill it.
+type walletCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // Most recently used first
+}
+
+type cachedWallet struct {
+	address string
+	wallet  *WalletState
+}
+
+func newWalletCache(size int) *walletCache {
+	return &walletCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *walletCache) get(address string) (*WalletState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[address]
+	if !exists {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cachedWallet).wallet, true
+}
+
+func (c *walletCache) add(address string, wallet *WalletState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[address]; exists {
+		element.Value.(*cachedWallet).wallet = wallet
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[address] = c.order.PushFront(&cachedWallet{address: address, wallet: wallet})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedWallet).address)
 	}
-	return total
+}
+
+func (c *walletCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
 }
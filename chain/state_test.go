@@ -0,0 +1,178 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRewardPricing(t *testing.T) {
+	params := Params(TestnetNetworkID).ParamsAt(1)
+	sm := NewStateManager()
+	now := time.Now().Unix()
+
+	rewardBlock := func(timestamp int64, amount int, recipients ...string) *Block {
+		rewards := make([]UptimeReward, len(recipients))
+		for i, recipient := range recipients {
+			rewards[i] = UptimeReward{Recipient: recipient, Amount: amount, Timestamp: timestamp}
+			rewards[i].Hash = rewards[i].CalculateHash()
+		}
+		block := CreateBlockWithRewards(params, 1, "parent", []Post{}, []Transfer{}, rewards, nil)
+		block.Timestamp = timestamp
+		return block
+	}
+
+	// A hundred nodes share the first batch
+	nodes := make([]string, 100)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("node-%03d", i)
+	}
+	if err := sm.ApplyBlock(rewardBlock(now-3600, CalculateBatchReward(100), nodes...), params); err != nil {
+		t.Fatalf("Failed to apply first rewards: %v", err)
+	}
+
+	// A later block is priced for all of them even if it only carries one
+	if amount := sm.RewardAmount(nodes[:1], now); amount != CalculateBatchReward(100) {
+		t.Errorf("Expected amount %d for 100 active nodes, got %d", CalculateBatchReward(100), amount)
+	}
+	if err := sm.ApplyBlock(rewardBlock(now, CalculateBatchReward(1), nodes[0]), params); err == nil {
+		t.Error("Expected a reward priced for the block's recipients alone to be rejected")
+	}
+	if err := sm.ApplyBlock(rewardBlock(now, CalculateBatchReward(100), nodes[0]), params); err != nil {
+		t.Errorf("Failed to apply reward priced for active nodes: %v", err)
+	}
+
+	// Nodes not rewarded within the window no longer count
+	later := now + int64(RewardWindow.Seconds())
+	if amount := sm.RewardAmount(nodes[1:2], later); amount != CalculateBatchReward(1) {
+		t.Errorf("Expected amount %d once the window passed, got %d", CalculateBatchReward(1), amount)
+	}
+}
+
+func TestEmbeddedStateRoots(t *testing.T) {
+	// Blocks from before the state-tree upgrade embed their wallets
+	_, baseline := decodeBaselineBlocks(t)
+	if err := baseline.ValidateBlockWithParams(Params(MainnetNetworkID).ParamsAt(1)); err != nil {
+		t.Errorf("Expected baseline block with embedded wallets to be valid: %v", err)
+	}
+
+	activation, scheduled := Params(MainnetNetworkID).ActivationHeight(UpgradeStateTree)
+	if !scheduled {
+		t.Fatal("Expected the state-tree upgrade to be scheduled on mainnet")
+	}
+	before, after := Params(MainnetNetworkID).ParamsAt(activation-1), Params(MainnetNetworkID).ParamsAt(activation)
+
+	// Blocks before the block-budget upgrade carry exactly five posts
+	posts := func(version uint8) []Post {
+		posts := make([]Post, 5)
+		for i := range posts {
+			posts[i] = Post{Author: "author", Content: fmt.Sprintf("post %d", i), Timestamp: time.Now().Unix(), Signature: "signature", Version: version}
+			posts[i].SetHash()
+		}
+		return posts
+	}
+
+	sm := NewStateManager()
+	sm.UpdateWalletState("author", 100, 0)
+	embedded, _ := sm.CalculateStateRoot(activation-1, before)
+	if len(embedded.Wallets) != 1 {
+		t.Fatalf("Expected the wallet to be embedded before activation, got %d", len(embedded.Wallets))
+	}
+	block := CreateBlock(before, activation-1, "parent", posts(before.Encoding), []Transfer{}, embedded)
+	if err := block.ValidateBlockAssumeValid(before); err != nil {
+		t.Errorf("Expected embedded state root before activation to be valid: %v", err)
+	}
+
+	// From activation only the state tree root is committed
+	compact, _ := sm.CalculateStateRoot(activation, after)
+	if len(compact.Wallets) != 0 {
+		t.Fatalf("Expected no embedded wallets from activation, got %d", len(compact.Wallets))
+	}
+	block = CreateBlock(after, activation, "parent", posts(after.Encoding), []Transfer{}, compact)
+	if err := block.ValidateBlockAssumeValid(after); err != nil {
+		t.Errorf("Expected state tree root from activation to be valid: %v", err)
+	}
+	embedded.BlockIndex = activation
+	embedded.SetHash()
+	block = CreateBlock(after, activation, "parent", posts(after.Encoding), []Transfer{}, embedded)
+	if err := block.ValidateBlockAssumeValid(after); err == nil {
+		t.Error("Expected embedded state root from activation to be rejected")
+	}
+}
+
+func TestStateLoadsFromTreeOnDemand(t *testing.T) {
+	params := Params(TestnetNetworkID).ParamsAt(75000)
+	store := NewMemoryStateNodeStore()
+	sm := NewStateManagerWithStore(store)
+	now := time.Now().Unix()
+
+	if err := sm.UpdateWalletState("alice", 100, 3); err != nil {
+		t.Fatalf("Failed to update alice: %v", err)
+	}
+	if err := sm.ApplyReward(UptimeReward{Recipient: "node", Amount: 50, Timestamp: now}); err != nil {
+		t.Fatalf("Failed to apply reward: %v", err)
+	}
+	stateRoot, err := sm.CalculateStateRoot(75000, params)
+	if err != nil {
+		t.Fatalf("Failed to commit state: %v", err)
+	}
+
+	// Leaves are tagged canonical records
+	root, _ := ParseStateRoot(stateRoot.Hash)
+	value, found, err := sm.tree.Get(root, StateKey("alice"))
+	if err != nil || !found {
+		t.Fatalf("Expected alice in the state tree: %v", err)
+	}
+	if value[0] != tagWallet {
+		t.Errorf("Expected a wallet record, got tag %q", value[0])
+	}
+
+	// A fresh state manager reads wallets as needed and restores the totals
+	loaded := NewStateManagerWithStore(store)
+	if err := loaded.LoadStateFromStateRoot(stateRoot, params); err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if len(loaded.wallets) != 0 {
+		t.Errorf("Expected no wallets read on load, got %d", len(loaded.wallets))
+	}
+	if count, supply := loaded.GetWalletCount(), loaded.GetTotalCharacterSupply(); count != 2 || supply != 150 {
+		t.Errorf("Expected 2 wallets holding 150, got %d holding %d", count, supply)
+	}
+	if wallet, exists := loaded.GetWalletState("alice"); !exists || wallet.Balance != 100 || wallet.Nonce != 3 {
+		t.Errorf("Expected alice with 100 at nonce 3, got %+v", wallet)
+	}
+	if _, exists := loaded.GetWalletState("bob"); exists {
+		t.Error("Expected bob to be absent")
+	}
+	if err := loaded.ValidateReward(UptimeReward{Recipient: "node", Timestamp: now + 60}); err == nil {
+		t.Error("Expected the reward interval to survive a reload")
+	}
+
+	// Roots committed without totals are walked once to recompute them
+	delete(store.(memoryStateNodes), string(stateTotalsKey(root)))
+	walked := NewStateManagerWithStore(store)
+	if err := walked.LoadStateFromStateRoot(stateRoot, params); err != nil {
+		t.Fatalf("Failed to load state without totals: %v", err)
+	}
+	if count, supply := walked.GetWalletCount(), walked.GetTotalCharacterSupply(); count != 2 || supply != 150 {
+		t.Errorf("Expected recomputed totals of 2 wallets holding 150, got %d holding %d", count, supply)
+	}
+}
+
+func TestWalletCacheIsBounded(t *testing.T) {
+	cache := newWalletCache(2)
+	cache.add("a", &WalletState{Address: "a"})
+	cache.add("b", nil)
+	cache.get("a")
+	cache.add("c", &WalletState{Address: "c"})
+
+	if _, cached := cache.get("b"); cached {
+		t.Error("Expected the least recently used wallet to be evicted")
+	}
+	if wallet, cached := cache.get("a"); !cached || wallet == nil {
+		t.Error("Expected a recently used wallet to stay cached")
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("Expected 2 cached wallets, got %d", len(cache.entries))
+	}
+}
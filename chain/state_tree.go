@@ -0,0 +1,420 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// State tree node prefixes (also the first byte of each stored node)
+const (
+	stateLeafPrefix = 0x00
+	stateNodePrefix = 0x01
+)
+
+// stateKeyBits is the depth of the state tree (one level per bit of a key)
+const stateKeyBits = 256
+
+// EmptyStateRoot is the root of a state tree with no wallets
+var EmptyStateRoot = strings.Repeat("0", 64)
+
+// emptyStateNode is the hash of an empty subtree
+var emptyStateNode [32]byte
+
+// StateNodeStore persists state tree nodes by hash
+// Nodes are immutable, so every root ever committed stays readable.
+type StateNodeStore interface {
+	GetStateNode(hash []byte) ([]byte, error)
+	SaveStateNodes(nodes map[string][]byte) error
+}
+
+// memoryStateNodes keeps state tree nodes in memory
+type memoryStateNodes map[string][]byte
+
+// NewMemoryStateNodeStore returns a state node store that lives in memory
+func NewMemoryStateNodeStore() StateNodeStore {
+	return memoryStateNodes{}
+}
+
+func (m memoryStateNodes) GetStateNode(hash []byte) ([]byte, error) {
+	data, exists := m[string(hash)]
+	if !exists {
+		return nil, fmt.Errorf("state node not found: %x", hash)
+	}
+	return data, nil
+}
+
+func (m memoryStateNodes) SaveStateNodes(nodes map[string][]byte) error {
+	for hash, data := range nodes {
+		m[hash] = data
+	}
+	return nil
+}
+
+// StateNodeBuffer holds state tree nodes in memory on top of a store
+// Reads fall through to the store; writes stay in the buffer until the caller
+// persists Nodes, e.g. in the same transaction as the blocks that need them.
+type StateNodeBuffer struct {
+	base  StateNodeStore
+	nodes memoryStateNodes
+}
+
+// NewStateNodeBuffer returns a state node buffer reading through to base
+func NewStateNodeBuffer(base StateNodeStore) *StateNodeBuffer {
+	return &StateNodeBuffer{base: base, nodes: memoryStateNodes{}}
+}
+
+func (b *StateNodeBuffer) GetStateNode(hash []byte) ([]byte, error) {
+	if data, exists := b.nodes[string(hash)]; exists {
+		return data, nil
+	}
+	return b.base.GetStateNode(hash)
+}
+
+func (b *StateNodeBuffer) SaveStateNodes(nodes map[string][]byte) error {
+	return b.nodes.SaveStateNodes(nodes)
+}
+
+// Nodes returns the nodes written to the buffer
+func (b *StateNodeBuffer) Nodes() map[string][]byte {
+	return b.nodes
+}
+
+// StateTree is a compact sparse Merkle tree mapping addresses to wallet states
+// A subtree holding a single leaf is stored as that leaf, so paths are only as
+// deep as needed to tell keys apart. Updates write new nodes and never modify
+// old ones; a root hash identifies one version of the state.
+type StateTree struct {
+	store   StateNodeStore
+	pending map[string][]byte // Nodes written since the last Commit
+}
+
+// NewStateTree creates a state tree backed by store
+func NewStateTree(store StateNodeStore) *StateTree {
+	return &StateTree{store: store, pending: make(map[string][]byte)}
+}
+
+// StateKey returns the tree key of an address
+func StateKey(address string) [32]byte {
+	return sha256.Sum256([]byte(address))
+}
+
+// stateKeyBit returns the bit of key that picks the child at depth
+func stateKeyBit(key [32]byte, depth int) int {
+	return int(key[depth/8]>>(7-uint(depth%8))) & 1
+}
+
+// stateLeafHash hashes a leaf from its key and value hash
+func stateLeafHash(key [32]byte, valueHash [32]byte) [32]byte {
+	data := make([]byte, 0, 1+64)
+	data = append(data, stateLeafPrefix)
+	data = append(data, key[:]...)
+	data = append(data, valueHash[:]...)
+	return sha256.Sum256(data)
+}
+
+// stateNodeHash hashes an inner node from its children
+func stateNodeHash(left, right [32]byte) [32]byte {
+	data := make([]byte, 0, 1+64)
+	data = append(data, stateNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	return sha256.Sum256(data)
+}
+
+// ParseStateRoot decodes a hex state root
+func ParseStateRoot(root string) ([32]byte, error) {
+	hash, ok := parseStateHash(root)
+	if !ok {
+		return hash, fmt.Errorf("invalid state root: %q", root)
+	}
+	return hash, nil
+}
+
+// parseStateHash decodes a hex 32-byte hash
+func parseStateHash(s string) ([32]byte, bool) {
+	var hash [32]byte
+	decoded, err := hex.DecodeString(s)
+	if err != nil || len(decoded) != len(hash) {
+		return hash, false
+	}
+	copy(hash[:], decoded)
+	return hash, true
+}
+
+// putLeaf stores a leaf and returns its hash
+func (t *StateTree) putLeaf(key [32]byte, value []byte) [32]byte {
+	hash := stateLeafHash(key, sha256.Sum256(value))
+	data := make([]byte, 0, 1+len(key)+len(value))
+	data = append(data, stateLeafPrefix)
+	data = append(data, key[:]...)
+	data = append(data, value...)
+	t.pending[string(hash[:])] = data
+	return hash
+}
+
+// putNode stores an inner node and returns its hash
+func (t *StateTree) putNode(left, right [32]byte) [32]byte {
+	hash := stateNodeHash(left, right)
+	data := make([]byte, 0, 1+64)
+	data = append(data, stateNodePrefix)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	t.pending[string(hash[:])] = data
+	return hash
+}
+
+// stateNode is a decoded tree node
+type stateNode struct {
+	leaf  bool
+	key   [32]byte // Leaf key
+	value []byte   // Leaf value
+	left  [32]byte // Inner node children
+	right [32]byte
+}
+
+// getNode loads and decodes a node
+func (t *StateTree) getNode(hash [32]byte) (*stateNode, error) {
+	data, exists := t.pending[string(hash[:])]
+	if !exists {
+		var err error
+		if data, err = t.store.GetStateNode(hash[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(data) >= 33 && data[0] == stateLeafPrefix:
+		node := &stateNode{leaf: true, value: data[33:]}
+		copy(node.key[:], data[1:33])
+		return node, nil
+	case len(data) == 65 && data[0] == stateNodePrefix:
+		node := &stateNode{}
+		copy(node.left[:], data[1:33])
+		copy(node.right[:], data[33:65])
+		return node, nil
+	default:
+		return nil, fmt.Errorf("corrupt state node %x", hash)
+	}
+}
+
+// Update sets the value of key and returns the new root
+func (t *StateTree) Update(root [32]byte, key [32]byte, value []byte) ([32]byte, error) {
+	return t.update(root, 0, key, value)
+}
+
+func (t *StateTree) update(hash [32]byte, depth int, key [32]byte, value []byte) ([32]byte, error) {
+	if hash == emptyStateNode {
+		return t.putLeaf(key, value), nil
+	}
+
+	node, err := t.getNode(hash)
+	if err != nil {
+		return hash, err
+	}
+
+	if node.leaf {
+		if node.key == key {
+			return t.putLeaf(key, value), nil
+		}
+		// Push both leaves down until their keys differ
+		return t.split(hash, node.key, t.putLeaf(key, value), key, depth)
+	}
+
+	if stateKeyBit(key, depth) == 0 {
+		left, err := t.update(node.left, depth+1, key, value)
+		if err != nil {
+			return hash, err
+		}
+		return t.putNode(left, node.right), nil
+	}
+	right, err := t.update(node.right, depth+1, key, value)
+	if err != nil {
+		return hash, err
+	}
+	return t.putNode(node.left, right), nil
+}
+
+// split builds the inner nodes that separate two leaves below depth
+func (t *StateTree) split(a [32]byte, aKey [32]byte, b [32]byte, bKey [32]byte, depth int) ([32]byte, error) {
+	if depth >= stateKeyBits {
+		return emptyStateNode, fmt.Errorf("duplicate state key %x", aKey)
+	}
+
+	aBit, bBit := stateKeyBit(aKey, depth), stateKeyBit(bKey, depth)
+	if aBit != bBit {
+		if aBit == 0 {
+			return t.putNode(a, b), nil
+		}
+		return t.putNode(b, a), nil
+	}
+
+	child, err := t.split(a, aKey, b, bKey, depth+1)
+	if err != nil {
+		return emptyStateNode, err
+	}
+	if aBit == 0 {
+		return t.putNode(child, emptyStateNode), nil
+	}
+	return t.putNode(emptyStateNode, child), nil
+}
+
+// putRecord stores data that is not a tree node under key with the next commit
+// Keys must not be 32 bytes long, so they never collide with a node hash.
+func (t *StateTree) putRecord(key []byte, data []byte) {
+	t.pending[string(key)] = data
+}
+
+// getRecord loads data stored with putRecord
+func (t *StateTree) getRecord(key []byte) ([]byte, error) {
+	if data, exists := t.pending[string(key)]; exists {
+		return data, nil
+	}
+	return t.store.GetStateNode(key)
+}
+
+// Get returns the value of key under root
+func (t *StateTree) Get(root [32]byte, key [32]byte) ([]byte, bool, error) {
+	value, _, found, err := t.Prove(root, key)
+	return value, found, err
+}
+
+// Commit writes the nodes created since the last commit to the store
+func (t *StateTree) Commit() error {
+	if len(t.pending) == 0 {
+		return nil
+	}
+	if err := t.store.SaveStateNodes(t.pending); err != nil {
+		return fmt.Errorf("failed to save state nodes: %w", err)
+	}
+	t.pending = make(map[string][]byte)
+	return nil
+}
+
+// Walk calls fn for every key and value under root
+func (t *StateTree) Walk(root [32]byte, fn func(key [32]byte, value []byte) error) error {
+	if root == emptyStateNode {
+		return nil
+	}
+
+	node, err := t.getNode(root)
+	if err != nil {
+		return err
+	}
+	if node.leaf {
+		return fn(node.key, node.value)
+	}
+	if err := t.Walk(node.left, fn); err != nil {
+		return err
+	}
+	return t.Walk(node.right, fn)
+}
+
+// StateProof proves the value of one key, or its absence, under a state root
+type StateProof struct {
+	Siblings []string `json:"siblings"` // Sibling hashes from the root down to the end of the path
+
+	// Set for an exclusion proof whose path ends at another key's leaf
+	LeafKey       string `json:"leaf_key,omitempty"`
+	LeafValueHash string `json:"leaf_value_hash,omitempty"`
+}
+
+// Prove returns the value of key under root and a proof of it (or of its absence)
+func (t *StateTree) Prove(root [32]byte, key [32]byte) ([]byte, *StateProof, bool, error) {
+	proof := &StateProof{Siblings: []string{}}
+
+	hash := root
+	for depth := 0; ; depth++ {
+		if hash == emptyStateNode {
+			return nil, proof, false, nil
+		}
+
+		node, err := t.getNode(hash)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		if node.leaf {
+			if node.key == key {
+				return node.value, proof, true, nil
+			}
+			valueHash := sha256.Sum256(node.value)
+			proof.LeafKey = hex.EncodeToString(node.key[:])
+			proof.LeafValueHash = hex.EncodeToString(valueHash[:])
+			return nil, proof, false, nil
+		}
+
+		if depth >= stateKeyBits {
+			return nil, nil, false, fmt.Errorf("state tree deeper than %d levels", stateKeyBits)
+		}
+		if stateKeyBit(key, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, hex.EncodeToString(node.right[:]))
+			hash = node.left
+		} else {
+			proof.Siblings = append(proof.Siblings, hex.EncodeToString(node.left[:]))
+			hash = node.right
+		}
+	}
+}
+
+// VerifyStateProof checks a proof that key holds value under root
+// A nil value checks that key is absent.
+func VerifyStateProof(root string, key [32]byte, value []byte, proof *StateProof) error {
+	rootHash, err := ParseStateRoot(root)
+	if err != nil {
+		return err
+	}
+	if proof == nil {
+		return fmt.Errorf("no state proof")
+	}
+	if len(proof.Siblings) > stateKeyBits {
+		return fmt.Errorf("state proof too long: %d siblings", len(proof.Siblings))
+	}
+
+	// Hash of the node at the end of the path
+	var current [32]byte
+	switch {
+	case value != nil:
+		current = stateLeafHash(key, sha256.Sum256(value))
+	case proof.LeafKey != "":
+		otherKey, ok := parseStateHash(proof.LeafKey)
+		if !ok {
+			return fmt.Errorf("invalid leaf key in proof")
+		}
+		otherValueHash, ok := parseStateHash(proof.LeafValueHash)
+		if !ok {
+			return fmt.Errorf("invalid leaf value hash in proof")
+		}
+		if otherKey == key {
+			return fmt.Errorf("exclusion proof ends at the key itself")
+		}
+		// The other leaf must sit on the key's path to prove nothing else can
+		for depth := range proof.Siblings {
+			if stateKeyBit(otherKey, depth) != stateKeyBit(key, depth) {
+				return fmt.Errorf("exclusion proof leaf is not on the key's path")
+			}
+		}
+		current = stateLeafHash(otherKey, otherValueHash)
+	default:
+		current = emptyStateNode
+	}
+
+	for depth := len(proof.Siblings) - 1; depth >= 0; depth-- {
+		sibling, ok := parseStateHash(proof.Siblings[depth])
+		if !ok {
+			return fmt.Errorf("invalid sibling at depth %d", depth)
+		}
+		if stateKeyBit(key, depth) == 0 {
+			current = stateNodeHash(current, sibling)
+		} else {
+			current = stateNodeHash(sibling, current)
+		}
+	}
+
+	if !bytes.Equal(current[:], rootHash[:]) {
+		return fmt.Errorf("state proof does not match root %s", root)
+	}
+	return nil
+}
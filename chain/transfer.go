@@ -1,12 +1,10 @@
 package chain
 
 import (
-	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/blindxfish/truthchain/wallet"
@@ -14,33 +12,35 @@ import (
 
 // Transfer represents a signed character transfer transaction
 type Transfer struct {
-	From      string `json:"from"`      // Sender address
-	To        string `json:"to"`        // Recipient address
-	Amount    int    `json:"amount"`    // Number of characters to transfer
-	GasFee    int    `json:"gas_fee"`   // Gas fee (always 1 character)
-	Timestamp int64  `json:"timestamp"` // Unix timestamp
-	Nonce     int64  `json:"nonce"`     // Unique transaction number
-	Hash      string `json:"hash"`      // Transaction hash
-	Signature string `json:"signature"` // ECDSA signature
+	From      string `json:"from"`              // Sender address
+	To        string `json:"to"`                // Recipient address
+	Amount    int    `json:"amount"`            // Number of characters to transfer
+	GasFee    int    `json:"gas_fee"`           // Gas fee (at least the one set by the consensus rules)
+	Timestamp int64  `json:"timestamp"`         // Unix timestamp
+	Nonce     int64  `json:"nonce"`             // Unique transaction number
+	Hash      string `json:"hash"`              // Transaction hash
+	Signature string `json:"signature"`         // ECDSA signature
+	Version   uint8  `json:"version,omitempty"` // Encoding the hash is computed in
 }
 
-// TransferPool represents the mempool for pending transfers
-type TransferPool struct {
-	Transfers []Transfer `json:"transfers"`
-	mu        sync.RWMutex
+// NewTransfer creates a new transfer from the wallet, paying the gas fee of params
+func NewTransfer(params ConsensusParams, w *wallet.Wallet, to string, amount int, nonce int64) (*Transfer, error) {
+	return NewTransferWithFee(params, w, to, amount, params.GasFee, nonce)
 }
 
-// NewTransfer creates a new transfer transaction
-func NewTransfer(from, to string, amount int, nonce int64, privateKey *ecdsa.PrivateKey) (*Transfer, error) {
+// NewTransferWithFee creates a new transfer from the wallet paying fee
+// A fee above the gas fee of params is allowed only once fees are variable.
+func NewTransferWithFee(params ConsensusParams, w *wallet.Wallet, to string, amount int, fee int, nonce int64) (*Transfer, error) {
 	if amount <= 0 {
 		return nil, fmt.Errorf("transfer amount must be positive")
 	}
 
-	if !wallet.ValidateAddress(from) {
+	from := w.GetAddress()
+	if !wallet.ValidateAddressWithVersion(from, params.AddressVersion) {
 		return nil, fmt.Errorf("invalid sender address: %s", from)
 	}
 
-	if !wallet.ValidateAddress(to) {
+	if !wallet.ValidateAddressWithVersion(to, params.AddressVersion) {
 		return nil, fmt.Errorf("invalid recipient address: %s", to)
 	}
 
@@ -48,35 +48,35 @@ func NewTransfer(from, to string, amount int, nonce int64, privateKey *ecdsa.Pri
 		return nil, fmt.Errorf("cannot transfer to self")
 	}
 
-	// Create transfer
+	if err := checkGasFee(fee, params); err != nil {
+		return nil, err
+	}
+
+	// Create transfer in the encoding of the block it will go into
 	transfer := &Transfer{
 		From:      from,
 		To:        to,
 		Amount:    amount,
-		GasFee:    1, // Fixed 1 character gas fee
+		GasFee:    fee,
 		Timestamp: time.Now().Unix(),
 		Nonce:     nonce,
+		Version:   params.Encoding,
 	}
 
-	// Calculate hash
-	hash, err := transfer.CalculateHash()
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate transfer hash: %w", err)
-	}
-	transfer.Hash = hash
-
-	// Sign the transfer
-	signature, err := transfer.Sign(privateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to sign transfer: %w", err)
+	if err := transfer.Sign(w); err != nil {
+		return nil, err
 	}
-	transfer.Signature = signature
-
 	return transfer, nil
 }
 
-// CalculateHash calculates the hash of the transfer (excluding signature)
+// CalculateHash calculates the hash of the transfer (excluding signature) in its encoding version
 func (t *Transfer) CalculateHash() (string, error) {
+	if t.Version != EncodingLegacy {
+		e := newEncoder(tagTransfer, t.Version)
+		t.encodeHashedFields(e)
+		return e.hash(), nil
+	}
+
 	// Create a copy without signature for hashing
 	transferForHash := map[string]interface{}{
 		"from":      t.From,
@@ -98,26 +98,30 @@ func (t *Transfer) CalculateHash() (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
-// Sign signs the transfer with a private key
-func (t *Transfer) Sign(privateKey *ecdsa.PrivateKey) (string, error) {
+// Sign sets the transfer hash and signs it with the sender's wallet
+// The signature is a recoverable compact signature over the transfer hash itself.
+func (t *Transfer) Sign(w *wallet.Wallet) error {
+	if w.GetAddress() != t.From {
+		return fmt.Errorf("wallet %s cannot sign a transfer from %s", w.GetAddress(), t.From)
+	}
+
 	hash, err := t.CalculateHash()
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to calculate transfer hash: %w", err)
 	}
-
-	// Convert hash to bytes
 	hashBytes, err := hex.DecodeString(hash)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode hash: %w", err)
+		return fmt.Errorf("failed to decode hash: %w", err)
 	}
 
-	// Sign the hash
-	signature, err := wallet.SignMessage(hashBytes, privateKey)
+	signature, err := w.SignHash(hashBytes)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign transfer: %w", err)
+		return fmt.Errorf("failed to sign transfer: %w", err)
 	}
 
-	return signature, nil
+	t.Hash = hash
+	t.Signature = hex.EncodeToString(signature)
+	return nil
 }
 
 // VerifySignature verifies the transfer signature
@@ -133,28 +137,34 @@ func (t *Transfer) VerifySignature() (bool, error) {
 		return false, fmt.Errorf("transfer hash mismatch")
 	}
 
-	// Use the same data format as signing
-	transferData := fmt.Sprintf("%s:%s:%d:%d:%d:%d", t.From, t.To, t.Amount, t.GasFee, t.Timestamp, t.Nonce)
-
-	// Hash the data (same as wallet.Sign does)
-	hash := sha256.Sum256([]byte(transferData))
-	hashHex := hex.EncodeToString(hash[:])
+	if t.signedBySender(calculatedHash) {
+		return true, nil
+	}
 
-	// Use wallet package to recover public key
-	recoveredPubKey, err := wallet.RecoverPublicKeyFromSignature(hashHex, t.Signature)
-	if err != nil {
-		return false, fmt.Errorf("signature recovery failed: %w", err)
+	// Legacy transfers already on chain were signed over a colon-joined message instead
+	if t.Version == EncodingLegacy && t.signedBySender(t.legacySigningHash()) {
+		return true, nil
 	}
 
-	// Derive address from recovered public key
-	derivedAddress := wallet.PublicKeyToAddress(recoveredPubKey)
+	return false, fmt.Errorf("address mismatch: %s was not derived from the signing key", t.From)
+}
 
-	// Compare with transfer.From
-	if derivedAddress != t.From {
-		return false, fmt.Errorf("address mismatch: expected %s, got %s", t.From, derivedAddress)
+// signedBySender reports whether the signature over a hash recovers the sender's key
+func (t *Transfer) signedBySender(hash string) bool {
+	recoveredPubKey, err := wallet.RecoverPublicKeyFromSignature(hash, t.Signature)
+	if err != nil {
+		return false
 	}
 
-	return true, nil
+	// The recovered key must derive transfer.From under its own version byte
+	return wallet.PublicKeyMatchesAddress(recoveredPubKey, t.From)
+}
+
+// legacySigningHash returns the digest legacy transfers were signed over
+func (t *Transfer) legacySigningHash() string {
+	transferData := fmt.Sprintf("%s:%s:%d:%d:%d:%d", t.From, t.To, t.Amount, t.GasFee, t.Timestamp, t.Nonce)
+	hash := sha256.Sum256([]byte(transferData))
+	return hex.EncodeToString(hash[:])
 }
 
 // GetTotalCost returns the total cost including gas fee
@@ -162,8 +172,60 @@ func (t *Transfer) GetTotalCost() int {
 	return t.Amount + t.GasFee
 }
 
+// ValidateRules checks a transfer against the consensus rules of the block it goes into
+func (t *Transfer) ValidateRules(params ConsensusParams) error {
+	if err := checkEncoding(t.Version, params); err != nil {
+		return err
+	}
+	if err := checkGasFee(t.GasFee, params); err != nil {
+		return err
+	}
+	if !wallet.ValidateAddressWithVersion(t.From, params.AddressVersion) {
+		return fmt.Errorf("sender address %s is not an address of this network", t.From)
+	}
+	if !wallet.ValidateAddressWithVersion(t.To, params.AddressVersion) {
+		return fmt.Errorf("recipient address %s is not an address of this network", t.To)
+	}
+	return nil
+}
+
+// checkGasFee checks a transfer fee against the consensus rules
+// Before fees are variable every transfer pays exactly the gas fee; after, it is the minimum.
+func checkGasFee(fee int, params ConsensusParams) error {
+	if !params.VariableFees {
+		if fee != params.GasFee {
+			return fmt.Errorf("gas fee must be exactly %d characters, got %d", params.GasFee, fee)
+		}
+		return nil
+	}
+	if fee < params.GasFee || fee > MaxGasFee {
+		return fmt.Errorf("gas fee must be between %d and %d characters, got %d", params.GasFee, MaxGasFee, fee)
+	}
+	return nil
+}
+
 // Validate validates the transfer transaction
 func (t *Transfer) Validate() error {
+	if err := t.validateFields(); err != nil {
+		return err
+	}
+
+	// Verify signature
+	valid, err := t.VerifySignature()
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid transfer signature")
+	}
+
+	return nil
+}
+
+// validateFields validates everything except the signature
+// Used on its own for transfers in assume-valid blocks.
+func (t *Transfer) validateFields() error {
 	// Check basic fields
 	if t.From == "" {
 		return fmt.Errorf("sender address cannot be empty")
@@ -177,8 +239,8 @@ func (t *Transfer) Validate() error {
 		return fmt.Errorf("transfer amount must be positive")
 	}
 
-	if t.GasFee != 1 {
-		return fmt.Errorf("gas fee must be exactly 1 character")
+	if t.GasFee <= 0 {
+		return fmt.Errorf("gas fee must be positive")
 	}
 
 	if t.Timestamp <= 0 {
@@ -197,12 +259,12 @@ func (t *Transfer) Validate() error {
 		return fmt.Errorf("transfer signature cannot be empty")
 	}
 
-	// Validate addresses
-	if !wallet.ValidateAddress(t.From) {
+	// Validate addresses (the network's version byte is checked by ValidateRules)
+	if !wallet.ValidateAddressFormat(t.From) {
 		return fmt.Errorf("invalid sender address: %s", t.From)
 	}
 
-	if !wallet.ValidateAddress(t.To) {
+	if !wallet.ValidateAddressFormat(t.To) {
 		return fmt.Errorf("invalid recipient address: %s", t.To)
 	}
 
@@ -210,96 +272,13 @@ func (t *Transfer) Validate() error {
 		return fmt.Errorf("cannot transfer to self")
 	}
 
-	// Verify signature
-	valid, err := t.VerifySignature()
+	calculatedHash, err := t.CalculateHash()
 	if err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
-	}
-
-	if !valid {
-		return fmt.Errorf("invalid transfer signature")
-	}
-
-	return nil
-}
-
-// NewTransferPool creates a new transfer pool
-func NewTransferPool() *TransferPool {
-	return &TransferPool{
-		Transfers: make([]Transfer, 0),
-	}
-}
-
-// AddTransfer adds a transfer to the pool
-func (tp *TransferPool) AddTransfer(transfer Transfer) error {
-	tp.mu.Lock()
-	defer tp.mu.Unlock()
-
-	// Validate transfer
-	if err := transfer.Validate(); err != nil {
-		return fmt.Errorf("invalid transfer: %w", err)
+		return fmt.Errorf("failed to calculate hash: %w", err)
 	}
-
-	// Check for duplicate hash
-	for _, existing := range tp.Transfers {
-		if existing.Hash == transfer.Hash {
-			return fmt.Errorf("transfer already exists in pool")
-		}
+	if calculatedHash != t.Hash {
+		return fmt.Errorf("transfer hash mismatch")
 	}
 
-	// Add to pool
-	tp.Transfers = append(tp.Transfers, transfer)
 	return nil
 }
-
-// GetTransfers returns all transfers in the pool
-func (tp *TransferPool) GetTransfers() []Transfer {
-	tp.mu.RLock()
-	defer tp.mu.RUnlock()
-
-	// Return a copy to avoid race conditions
-	transfers := make([]Transfer, len(tp.Transfers))
-	copy(transfers, tp.Transfers)
-	return transfers
-}
-
-// RemoveTransfer removes a transfer from the pool
-func (tp *TransferPool) RemoveTransfer(hash string) error {
-	tp.mu.Lock()
-	defer tp.mu.Unlock()
-
-	for i, transfer := range tp.Transfers {
-		if transfer.Hash == hash {
-			tp.Transfers = append(tp.Transfers[:i], tp.Transfers[i+1:]...)
-			return nil
-		}
-	}
-
-	return fmt.Errorf("transfer not found in pool: %s", hash)
-}
-
-// ClearPool clears all transfers from the pool
-func (tp *TransferPool) ClearPool() {
-	tp.mu.Lock()
-	defer tp.mu.Unlock()
-	tp.Transfers = make([]Transfer, 0)
-}
-
-// GetTransferCount returns the number of transfers in the pool
-func (tp *TransferPool) GetTransferCount() int {
-	tp.mu.RLock()
-	defer tp.mu.RUnlock()
-	return len(tp.Transfers)
-}
-
-// GetTotalCharacterVolume returns the total character volume in the pool
-func (tp *TransferPool) GetTotalCharacterVolume() int {
-	tp.mu.RLock()
-	defer tp.mu.RUnlock()
-
-	total := 0
-	for _, transfer := range tp.Transfers {
-		total += transfer.GetTotalCost()
-	}
-	return total
-}
@@ -7,43 +7,56 @@ import (
 	"fmt"
 	"sort"
 	"time"
+
+	"github.com/blindxfish/truthchain/wallet"
 )
 
 // Post represents a user-submitted text post on the blockchain
 type Post struct {
-	Author    string `json:"author"`    // public key (wallet address)
-	Signature string `json:"signature"` // signed content hash
-	Content   string `json:"content"`   // text (counted in chars)
-	Timestamp int64  `json:"timestamp"` // Unix timestamp
-	Hash      string `json:"hash"`      // hash of the post
+	Author    string `json:"author"`            // public key (wallet address)
+	Signature string `json:"signature"`         // signed content hash
+	Content   string `json:"content"`           // text (counted in chars)
+	Timestamp int64  `json:"timestamp"`         // Unix timestamp
+	Hash      string `json:"hash"`              // hash of the post
+	Version   uint8  `json:"version,omitempty"` // Encoding the hash is computed in
 }
 
 // WalletState represents the state of a wallet at a given block
 type WalletState struct {
-	Address    string `json:"address"`      // Wallet address
-	Balance    int    `json:"balance"`      // Character balance
-	Nonce      int64  `json:"nonce"`        // Transaction nonce
-	LastTxTime int64  `json:"last_tx_time"` // Timestamp of last transaction
+	Address        string `json:"address"`                    // Wallet address
+	Balance        int    `json:"balance"`                    // Character balance
+	Nonce          int64  `json:"nonce"`                      // Transaction nonce
+	LastTxTime     int64  `json:"last_tx_time"`               // Timestamp of last transaction
+	LastRewardTime int64  `json:"last_reward_time,omitempty"` // Timestamp of last uptime reward
 }
 
 // StateRoot represents the global state at a given block
+// From UpgradeStateTree the hash is the root of the state tree, and wallets are looked
+// up (and proven) through the tree instead of being embedded in the block.
 type StateRoot struct {
-	Wallets    []WalletState `json:"wallets"`     // Sorted wallet states
-	Hash       string        `json:"hash"`        // Hash of the state root
-	BlockIndex int           `json:"block_index"` // Block this state belongs to
+	Wallets    []WalletState `json:"wallets,omitempty"` // Sorted wallet states (genesis and before UpgradeStateTree)
+	Hash       string        `json:"hash"`              // Hash of the state root
+	BlockIndex int           `json:"block_index"`       // Block this state belongs to
 }
 
 // Block represents a block in the TruthChain blockchain
 type Block struct {
+	Version        uint8           `json:"version,omitempty"`         // Encoding of the block hash (set by the consensus rules)
 	Index          int             `json:"index"`                     // block index
 	Timestamp      int64           `json:"timestamp"`                 // Unix timestamp
 	PrevHash       string          `json:"prev_hash"`                 // hash of previous block
 	Hash           string          `json:"hash"`                      // hash of this block
 	Posts          []Post          `json:"posts"`                     // posts in this block
 	Transfers      []Transfer      `json:"transfers"`                 // transfers in this block
+	PostsRoot      string          `json:"posts_root,omitempty"`      // Merkle root of post hashes
+	TransfersRoot  string          `json:"transfers_root,omitempty"`  // Merkle root of transfer hashes
 	StateRoot      *StateRoot      `json:"state_root"`                // global state root
 	CharCount      int             `json:"char_count"`                // total characters in this block
 	BeaconAnnounce *BeaconAnnounce `json:"beacon_announce,omitempty"` // Optional beacon announcement
+	Rewards        []UptimeReward  `json:"rewards,omitempty"`         // Uptime rewards minted in this block
+
+	// Genesis authority's signature over the network and genesis hash (genesis only, not hashed)
+	AuthoritySignature string `json:"authority_signature,omitempty"`
 }
 
 // BeaconAnnounce represents a beacon node announcement stored in a block
@@ -89,31 +102,39 @@ type PostRequest struct {
 
 // BlockHeader represents the header information of a block
 type BlockHeader struct {
-	Index     int    `json:"index"`
-	Timestamp int64  `json:"timestamp"`
-	PrevHash  string `json:"prev_hash"`
-	Hash      string `json:"hash"`
-	CharCount int    `json:"char_count"`
-	PostCount int    `json:"post_count"`
+	Version       uint8  `json:"version,omitempty"`
+	Index         int    `json:"index"`
+	Timestamp     int64  `json:"timestamp"`
+	PrevHash      string `json:"prev_hash"`
+	Hash          string `json:"hash"`
+	CharCount     int    `json:"char_count"`
+	PostCount     int    `json:"post_count"`
+	PostsRoot     string `json:"posts_root,omitempty"`
+	TransfersRoot string `json:"transfers_root,omitempty"`
+	RewardsRoot   string `json:"rewards_root,omitempty"`
+	StateRoot     string `json:"state_root,omitempty"`
+	BeaconHash    string `json:"beacon_hash,omitempty"`
 }
 
 // ChainSyncRequest represents a request to sync blocks from a peer
 type ChainSyncRequest struct {
-	FromIndex   int    `json:"from_index"`   // Start block index
-	ToIndex     int    `json:"to_index"`     // End block index (optional, -1 for latest)
-	NodeID      string `json:"node_id"`      // Requesting node's ID
-	Timestamp   int64  `json:"timestamp"`    // Request timestamp
-	HeadersOnly bool   `json:"headers_only"` // Request only headers (Bitcoin-style)
+	FromIndex     int    `json:"from_index"`                // Start block index
+	ToIndex       int    `json:"to_index"`                  // End block index (optional, -1 for latest)
+	NodeID        string `json:"node_id"`                   // Requesting node's ID
+	Timestamp     int64  `json:"timestamp"`                 // Request timestamp
+	HeadersOnly   bool   `json:"headers_only"`              // Request only headers (Bitcoin-style)
+	ProofPostHash string `json:"proof_post_hash,omitempty"` // Request an inclusion proof for this post instead of blocks
 }
 
 // ChainSyncResponse represents a response to a chain sync request
 type ChainSyncResponse struct {
-	Blocks    []*Block       `json:"blocks"`     // Requested blocks (if HeadersOnly=false)
-	Headers   []*BlockHeader `json:"headers"`    // Requested headers (if HeadersOnly=true)
-	FromIndex int            `json:"from_index"` // Actual start index
-	ToIndex   int            `json:"to_index"`   // Actual end index
-	NodeID    string         `json:"node_id"`    // Responding node's ID
-	Timestamp int64          `json:"timestamp"`  // Response timestamp
+	Blocks    []*Block       `json:"blocks"`               // Requested blocks (if HeadersOnly=false)
+	Headers   []*BlockHeader `json:"headers"`              // Requested headers (if HeadersOnly=true)
+	PostProof *PostProof     `json:"post_proof,omitempty"` // Inclusion proof (if ProofPostHash was set)
+	FromIndex int            `json:"from_index"`           // Actual start index
+	ToIndex   int            `json:"to_index"`             // Actual end index
+	NodeID    string         `json:"node_id"`              // Responding node's ID
+	Timestamp int64          `json:"timestamp"`            // Response timestamp
 }
 
 // BeaconDiscoveryRequest represents a request to discover beacon nodes
@@ -130,8 +151,14 @@ type BeaconDiscoveryResponse struct {
 	Timestamp int64             `json:"timestamp"` // Response timestamp
 }
 
-// CalculateHash calculates the hash of a post
+// CalculateHash calculates the hash of a post in its encoding version
 func (p *Post) CalculateHash() string {
+	if p.Version != EncodingLegacy {
+		e := newEncoder(tagPost, p.Version)
+		p.encodeHashedFields(e)
+		return e.hash()
+	}
+
 	// Create a deterministic string representation
 	data := fmt.Sprintf("%s%s%d", p.Author, p.Content, p.Timestamp)
 	hash := sha256.Sum256([]byte(data))
@@ -143,6 +170,64 @@ func (p *Post) SetHash() {
 	p.Hash = p.CalculateHash()
 }
 
+// SigningHash returns the digest an author signs for a post on a network
+// Canonical posts commit to the network, the author, the timestamp and the content hash,
+// so a signature is only valid for one post on one network. Legacy posts keep the
+// message they were always signed over: author, content and timestamp, their legacy hash.
+func (p *Post) SigningHash(networkID string) string {
+	if p.Version == EncodingLegacy {
+		return p.CalculateHash()
+	}
+
+	contentHash := sha256.Sum256([]byte(p.Content))
+	e := newEncoder(tagPostSig, EncodingCanonical)
+	e.writeString(networkID)
+	e.writeString(p.Author)
+	e.writeInt(p.Timestamp)
+	e.writeBytes(contentHash[:])
+	return e.hash()
+}
+
+// Sign sets the post hash and signs the post for a network with the author's wallet
+// The signature is a recoverable compact signature, so the author can be checked from the post alone.
+func (p *Post) Sign(w *wallet.Wallet, networkID string) error {
+	if w.GetAddress() != p.Author {
+		return fmt.Errorf("wallet %s cannot sign a post by %s", w.GetAddress(), p.Author)
+	}
+
+	hashBytes, err := hex.DecodeString(p.SigningHash(networkID))
+	if err != nil {
+		return fmt.Errorf("failed to decode signing hash: %w", err)
+	}
+	signature, err := w.SignHash(hashBytes)
+	if err != nil {
+		return fmt.Errorf("failed to sign post: %w", err)
+	}
+
+	p.Signature = hex.EncodeToString(signature)
+	p.SetHash()
+	return nil
+}
+
+// VerifySignature verifies that the post's author signed it for a network
+func (p *Post) VerifySignature(networkID string) error {
+	if p.signedByAuthor(p.SigningHash(networkID)) {
+		return nil
+	}
+	return fmt.Errorf("address mismatch: %s did not sign this post for %s", p.Author, networkID)
+}
+
+// signedByAuthor reports whether the signature over a hash recovers the author's key
+func (p *Post) signedByAuthor(hash string) bool {
+	recoveredPubKey, err := wallet.RecoverPublicKeyFromSignature(hash, p.Signature)
+	if err != nil {
+		return false
+	}
+
+	// The recovered key must derive post.Author under its own version byte
+	return wallet.PublicKeyMatchesAddress(recoveredPubKey, p.Author)
+}
+
 // ValidatePost validates a post structure
 func (p *Post) ValidatePost() error {
 	if p.Author == "" {
@@ -157,19 +242,48 @@ func (p *Post) ValidatePost() error {
 	if p.Timestamp <= 0 {
 		return fmt.Errorf("post timestamp must be positive")
 	}
-	if len(p.Content) > 10000 { // Reasonable limit
-		return fmt.Errorf("post content too long: %d characters", len(p.Content))
+	return nil
+}
+
+// ValidateRules checks a post against the consensus rules of the block it goes into
+func (p *Post) ValidateRules(params ConsensusParams) error {
+	if err := checkEncoding(p.Version, params); err != nil {
+		return err
+	}
+	// Legacy signatures are not bound to a network, so they end with the legacy encoding
+	if p.Version < params.Encoding {
+		return fmt.Errorf("post encoding version %d is no longer accepted (current %d)", p.Version, params.Encoding)
+	}
+	if count := CountCharacters(p.Content, params); count > params.MaxPostSize {
+		return fmt.Errorf("post content too large: %d characters, limit %d", count, params.MaxPostSize)
+	}
+	if params.UnicodeCount {
+		if err := ValidateContentEncoding(p.Content); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// GetCharacterCount returns the number of characters in the post
-func (p *Post) GetCharacterCount() int {
-	return len(p.Content)
+// GetCharacterCount returns the number of characters the post costs under params
+func (p *Post) GetCharacterCount(params ConsensusParams) int {
+	return CountCharacters(p.Content, params)
 }
 
-// CalculateHash calculates the hash of a state root
+// CalculateHash calculates the legacy hash of a state root from its embedded wallets
+// Genesis and blocks before UpgradeStateTree hash their state roots this way; later roots come from the state tree.
 func (sr *StateRoot) CalculateHash() string {
+	return sr.calculateHash(EncodingLegacy)
+}
+
+// calculateHash calculates the hash of a state root in the encoding of its block
+func (sr *StateRoot) calculateHash(version uint8) string {
+	if version != EncodingLegacy {
+		e := newEncoder(tagStateRoot, version)
+		sr.encodeHashedFields(e)
+		return e.hash()
+	}
+
 	// Sort wallets by address for deterministic hashing
 	sortedWallets := make([]WalletState, len(sr.Wallets))
 	copy(sortedWallets, sr.Wallets)
@@ -220,7 +334,13 @@ func (sr *StateRoot) UpdateWalletState(wallet WalletState) {
 }
 
 // CalculateHash calculates the hash of a block
+// A canonical hash covers only header fields, so a header can be checked without its
+// body. Legacy blocks keep their original hash over every entry hash in the body.
 func (b *Block) CalculateHash() string {
+	if b.Version != EncodingLegacy {
+		return b.Header().CalculateHash()
+	}
+
 	// Create a deterministic string representation
 	data := fmt.Sprintf("%d%d%s%d", b.Index, b.Timestamp, b.PrevHash, b.CharCount)
 
@@ -234,34 +354,99 @@ func (b *Block) CalculateHash() string {
 		data += transfer.Hash
 	}
 
+	// Include reward hashes for immutability
+	for _, reward := range b.Rewards {
+		data += reward.Hash
+	}
+
 	// Include state root hash
 	if b.StateRoot != nil {
 		data += b.StateRoot.Hash
 	}
 
 	// Include beacon announcement hash if present
-	if b.BeaconAnnounce != nil {
-		beaconData := fmt.Sprintf("%s%s%d%f%s",
-			b.BeaconAnnounce.NodeID,
-			b.BeaconAnnounce.IP,
-			b.BeaconAnnounce.Port,
-			b.BeaconAnnounce.Uptime,
-			b.BeaconAnnounce.Version)
-		beaconHash := sha256.Sum256([]byte(beaconData))
-		data += hex.EncodeToString(beaconHash[:])
-	}
+	data += b.beaconHash()
 
 	hash := sha256.Sum256([]byte(data))
 	return hex.EncodeToString(hash[:])
 }
 
-// SetHash sets the hash field of the block
+// CalculateHash recomputes the hash of the block this header belongs to
+// A legacy hash covers the block body, so it cannot be recomputed from the header
+// and an empty hash is returned; such headers are checked once their block arrives.
+func (h *BlockHeader) CalculateHash() string {
+	if h.Version == EncodingLegacy {
+		return ""
+	}
+
+	e := newEncoder(tagHeader, h.Version)
+	h.encodeHashedFields(e)
+	return e.hash()
+}
+
+// rewardsRoot returns the Merkle root of the block's reward hashes
+func (b *Block) rewardsRoot() string {
+	hashes := make([]string, len(b.Rewards))
+	for i, reward := range b.Rewards {
+		hashes[i] = reward.Hash
+	}
+	return MerkleRoot(hashes)
+}
+
+// beaconHash returns the hash of the block's beacon announcement ("" if none)
+func (b *Block) beaconHash() string {
+	if b.BeaconAnnounce == nil {
+		return ""
+	}
+	if b.Version != EncodingLegacy {
+		return b.BeaconAnnounce.encode(b.Version).hash()
+	}
+	beaconData := fmt.Sprintf("%s%s%d%f%s",
+		b.BeaconAnnounce.NodeID,
+		b.BeaconAnnounce.IP,
+		b.BeaconAnnounce.Port,
+		b.BeaconAnnounce.Uptime,
+		b.BeaconAnnounce.Version)
+	beaconHash := sha256.Sum256([]byte(beaconData))
+	return hex.EncodeToString(beaconHash[:])
+}
+
+// SetHash sets the Merkle roots and the hash field of the block
 func (b *Block) SetHash() {
+	b.SetMerkleRoots()
 	b.Hash = b.CalculateHash()
 }
 
-// ValidateBlock validates a block structure
-func (b *Block) ValidateBlock() error {
+// Header returns the header of the block
+func (b *Block) Header() *BlockHeader {
+	stateRootHash := ""
+	if b.StateRoot != nil {
+		stateRootHash = b.StateRoot.Hash
+	}
+
+	return &BlockHeader{
+		Version:       b.Version,
+		Index:         b.Index,
+		Timestamp:     b.Timestamp,
+		PrevHash:      b.PrevHash,
+		Hash:          b.Hash,
+		CharCount:     b.CharCount,
+		PostCount:     b.GetPostCount(),
+		PostsRoot:     b.PostsRoot,
+		TransfersRoot: b.TransfersRoot,
+		RewardsRoot:   b.rewardsRoot(),
+		StateRoot:     stateRootHash,
+		BeaconHash:    b.beaconHash(),
+	}
+}
+
+// ValidateBlock validates a block structure against the rules at its height
+func (b *Block) ValidateBlock(params ConsensusParams) error {
+	return b.validateBlock(params, true)
+}
+
+// validateBlock validates a block structure, optionally skipping signature checks
+func (b *Block) validateBlock(params ConsensusParams, verifySignatures bool) error {
 	if b.Index < 0 {
 		return fmt.Errorf("block index cannot be negative")
 	}
@@ -274,31 +459,92 @@ func (b *Block) ValidateBlock() error {
 	if b.PrevHash != "" && b.Index == 0 {
 		return fmt.Errorf("non-genesis block must have prev_hash")
 	}
+	if b.AuthoritySignature != "" && b.Index != 0 {
+		return fmt.Errorf("only the genesis block carries an authority signature")
+	}
+	if err := b.validateEncoding(params); err != nil {
+		return err
+	}
+
+	// The header roots must commit to exactly these posts and transfers
+	if err := b.validateMerkleRoots(); err != nil {
+		return err
+	}
 
 	// Validate all posts in the block
 	for i, post := range b.Posts {
 		if err := post.ValidatePost(); err != nil {
 			return fmt.Errorf("invalid post at index %d: %v", i, err)
 		}
+		if err := post.ValidateRules(params); err != nil {
+			return fmt.Errorf("invalid post at index %d: %v", i, err)
+		}
+		if verifySignatures {
+			if err := post.VerifySignature(params.NetworkID); err != nil {
+				return fmt.Errorf("invalid post at index %d: %v", i, err)
+			}
+		}
 	}
 
 	// Validate all transfers in the block
 	for i, transfer := range b.Transfers {
-		if err := transfer.Validate(); err != nil {
+		validate := transfer.Validate
+		if !verifySignatures {
+			validate = transfer.validateFields
+		}
+		if err := validate(); err != nil {
+			return fmt.Errorf("invalid transfer at index %d: %v", i, err)
+		}
+		if err := transfer.ValidateRules(params); err != nil {
 			return fmt.Errorf("invalid transfer at index %d: %v", i, err)
 		}
 	}
 
+	// Validate uptime rewards against the emission schedule
+	if len(b.Rewards) > 0 {
+		if b.Index == 0 {
+			return fmt.Errorf("genesis block cannot mint rewards")
+		}
+		for i, reward := range b.Rewards {
+			if err := reward.ValidateRules(params); err != nil {
+				return fmt.Errorf("invalid reward at index %d: %v", i, err)
+			}
+		}
+		if params.Regtest {
+			if err := validateRegtestRewards(b.Rewards, b.Timestamp); err != nil {
+				return fmt.Errorf("invalid rewards: %w", err)
+			}
+		} else if err := validateBlockRewards(b.Rewards, b.Timestamp, verifySignatures); err != nil {
+			return fmt.Errorf("invalid rewards: %w", err)
+		}
+	}
+
 	// Validate state root if present
 	if b.StateRoot != nil {
 		if b.StateRoot.BlockIndex != b.Index {
 			return fmt.Errorf("state root block index mismatch: expected %d, got %d", b.Index, b.StateRoot.BlockIndex)
 		}
 
-		// Verify state root hash
-		calculatedHash := b.StateRoot.CalculateHash()
-		if b.StateRoot.Hash != calculatedHash {
-			return fmt.Errorf("state root hash mismatch: expected %s, got %s", calculatedHash, b.StateRoot.Hash)
+		if b.Index == 0 {
+			// Verify the embedded genesis state
+			calculatedHash := b.StateRoot.calculateHash(b.Version)
+			if b.StateRoot.Hash != calculatedHash {
+				return fmt.Errorf("state root hash mismatch: expected %s, got %s", calculatedHash, b.StateRoot.Hash)
+			}
+		} else if !params.StateTree {
+			// Verify the embedded state; its wallets are checked when the block is applied to the parent state
+			calculatedHash := b.StateRoot.CalculateHash()
+			if b.StateRoot.Hash != calculatedHash {
+				return fmt.Errorf("state root hash mismatch: expected %s, got %s", calculatedHash, b.StateRoot.Hash)
+			}
+		} else {
+			// The tree root itself is checked when the block is applied to the parent state
+			if len(b.StateRoot.Wallets) > 0 {
+				return fmt.Errorf("state root must not embed wallets from the state-tree upgrade")
+			}
+			if _, err := ParseStateRoot(b.StateRoot.Hash); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -310,10 +556,7 @@ func (b *Block) ValidateBlock() error {
 	}
 
 	// Validate character count
-	calculatedCharCount := 0
-	for _, post := range b.Posts {
-		calculatedCharCount += post.GetCharacterCount()
-	}
+	calculatedCharCount := b.CountCharacters(params)
 	if calculatedCharCount != b.CharCount {
 		return fmt.Errorf("block char_count mismatch: expected %d, got %d", calculatedCharCount, b.CharCount)
 	}
@@ -321,10 +564,38 @@ func (b *Block) ValidateBlock() error {
 	return nil
 }
 
-// ValidateBlockWithThreshold validates a block structure with post count threshold rules
-func (b *Block) ValidateBlockWithThreshold(postThreshold int) error {
+// validateEncoding checks the block uses the encoding of its height
+// Canonical blocks also check every post hash, which legacy blocks never did.
+func (b *Block) validateEncoding(params ConsensusParams) error {
+	if b.Version != params.Encoding {
+		return fmt.Errorf("block %d has encoding version %d, expected %d", b.Index, b.Version, params.Encoding)
+	}
+
+	if b.Version != EncodingLegacy {
+		for i, post := range b.Posts {
+			if post.Hash != post.CalculateHash() {
+				return fmt.Errorf("post at index %d hash mismatch", i)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateBlockWithParams validates a block structure with the post count rules of params
+func (b *Block) ValidateBlockWithParams(params ConsensusParams) error {
+	return b.validateBlockWithParams(params, true)
+}
+
+// ValidateBlockAssumeValid validates a block like ValidateBlockWithParams but skips signature checks
+// Only for blocks known to be ancestors of an assume-valid block.
+func (b *Block) ValidateBlockAssumeValid(params ConsensusParams) error {
+	return b.validateBlockWithParams(params, false)
+}
+
+// validateBlockWithParams applies the post count rules on top of validateBlock
+func (b *Block) validateBlockWithParams(params ConsensusParams, verifySignatures bool) error {
 	// First run basic validation
-	if err := b.ValidateBlock(); err != nil {
+	if err := b.validateBlock(params, verifySignatures); err != nil {
 		return err
 	}
 
@@ -333,18 +604,24 @@ func (b *Block) ValidateBlockWithThreshold(postThreshold int) error {
 		return nil
 	}
 
-	// Enforce post count threshold rules
+	// Enforce post count threshold rules (regtest blocks are made on demand and carry any number)
 	postCount := len(b.Posts)
+	if params.BlockBudget {
+		// Blocks carry any number of posts within the budget; one without posts is a heartbeat
+		if err := b.validateBudget(); err != nil {
+			return err
+		}
+	} else if !params.Regtest {
+		// Block must have exactly the required number of posts (unless it's a forced block)
+		if postCount != params.PostsPerBlock {
+			return fmt.Errorf("block %d has invalid post count: expected %d, got %d (fork protection)",
+				b.Index, params.PostsPerBlock, postCount)
+		}
 
-	// Block must have exactly the threshold number of posts (unless it's a forced block)
-	if postCount != postThreshold {
-		return fmt.Errorf("block %d has invalid post count: expected %d, got %d (fork protection)",
-			b.Index, postThreshold, postCount)
-	}
-
-	// Additional security: ensure posts are not empty
-	if postCount == 0 {
-		return fmt.Errorf("block %d has no posts (fork protection)", b.Index)
+		// Additional security: ensure posts are not empty
+		if postCount == 0 {
+			return fmt.Errorf("block %d has no posts (fork protection)", b.Index)
+		}
 	}
 
 	// Validate that all posts have valid content
@@ -360,11 +637,81 @@ func (b *Block) ValidateBlockWithThreshold(postThreshold int) error {
 	return nil
 }
 
+// validateBudget checks the block fits MaxBlockSize bytes and CharacterThreshold characters
+func (b *Block) validateBudget() error {
+	encoded, err := b.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode block %d: %w", b.Index, err)
+	}
+	if len(encoded) > MaxBlockSize {
+		return fmt.Errorf("block %d is too large: %d bytes, limit %d", b.Index, len(encoded), MaxBlockSize)
+	}
+	if b.CharCount > CharacterThreshold {
+		return fmt.Errorf("block %d carries too many characters: %d, limit %d", b.Index, b.CharCount, CharacterThreshold)
+	}
+	return nil
+}
+
+// ValidateAfter checks the rules that relate a block to the chain below it and to local time
+// blockAt returns the blocks below it. Under the block budget a timestamp may not fall
+// below the median of the last MedianTimeSpan blocks nor lead now by more than
+// MaxFutureBlockTime, and a heartbeat block comes at least HeartbeatInterval after its
+// parent. Regtest blocks are made on demand.
+func (b *Block) ValidateAfter(blockAt func(index int) (*Block, error), now int64, params ConsensusParams) error {
+	if !params.BlockBudget || params.Regtest {
+		return nil
+	}
+	if b.Timestamp > now+int64(MaxFutureBlockTime.Seconds()) {
+		return fmt.Errorf("block %d timestamp %d is more than %s ahead of local time", b.Index, b.Timestamp, MaxFutureBlockTime)
+	}
+
+	recent := make([]int64, 0, MedianTimeSpan)
+	for i := b.Index - 1; i >= 0 && i >= b.Index-MedianTimeSpan; i-- {
+		block, err := blockAt(i)
+		if err != nil {
+			return fmt.Errorf("missing block %d below block %d: %w", i, b.Index, err)
+		}
+		recent = append(recent, block.Timestamp)
+	}
+	if len(recent) == 0 {
+		return nil
+	}
+	if median := MedianTimestamp(recent); b.Timestamp < median {
+		return fmt.Errorf("block %d timestamp %d is before the median time past %d", b.Index, b.Timestamp, median)
+	}
+
+	parent := recent[0]
+	if b.IsHeartbeat() && b.Timestamp-parent < int64(HeartbeatInterval.Seconds()) {
+		return fmt.Errorf("heartbeat block %d follows its parent after %ds, minimum %s",
+			b.Index, b.Timestamp-parent, HeartbeatInterval)
+	}
+	return nil
+}
+
+// MedianTimestamp returns the median of block timestamps (the upper one of an even count)
+func MedianTimestamp(timestamps []int64) int64 {
+	sorted := append([]int64(nil), timestamps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// IsHeartbeat reports whether the block is a heartbeat block, one that carries no posts
+// Heartbeats keep the chain moving and mint uptime rewards while nobody posts.
+func (b *Block) IsHeartbeat() bool {
+	return b.Index > 0 && len(b.Posts) == 0
+}
+
 // GetCharacterCount returns the total number of characters in the block
+// This is the header's count, which validation checks against the posts.
 func (b *Block) GetCharacterCount() int {
+	return b.CharCount
+}
+
+// CountCharacters counts the characters of the block's posts under params
+func (b *Block) CountCharacters(params ConsensusParams) int {
 	count := 0
 	for _, post := range b.Posts {
-		count += post.GetCharacterCount()
+		count += post.GetCharacterCount(params)
 	}
 	return count
 }
@@ -374,16 +721,28 @@ func (b *Block) GetPostCount() int {
 	return len(b.Posts)
 }
 
+// GetRewardTotal returns the total characters minted by the block
+func (b *Block) GetRewardTotal() int {
+	total := 0
+	for _, reward := range b.Rewards {
+		total += reward.Amount
+	}
+	return total
+}
+
 // GetTransferCount returns the number of transfers in the block
 func (b *Block) GetTransferCount() int {
 	return len(b.Transfers)
 }
 
 // AddPost adds a post to the block and updates the character count
-func (b *Block) AddPost(post Post) error {
+func (b *Block) AddPost(post Post, params ConsensusParams) error {
 	if err := post.ValidatePost(); err != nil {
 		return fmt.Errorf("invalid post: %w", err)
 	}
+	if err := post.ValidateRules(params); err != nil {
+		return fmt.Errorf("invalid post: %w", err)
+	}
 
 	// Set the post hash if not already set
 	if post.Hash == "" {
@@ -391,7 +750,7 @@ func (b *Block) AddPost(post Post) error {
 	}
 
 	b.Posts = append(b.Posts, post)
-	b.CharCount = b.GetCharacterCount()
+	b.CharCount = b.CountCharacters(params)
 
 	return nil
 }
@@ -430,11 +789,17 @@ func FromJSON(data []byte) (*Block, error) {
 	return &block, nil
 }
 
-// CreateGenesisBlock creates the first block in the chain
+// CreateGenesisBlock creates the first block of the mainnet chain
 func CreateGenesisBlock() *Block {
+	return createGenesisBlock(MainnetGenesisTimestamp, EncodingLegacy)
+}
+
+// createGenesisBlock creates an empty genesis block; the timestamp and encoding set the network's genesis hash
+func createGenesisBlock(timestamp int64, version uint8) *Block {
 	block := &Block{
+		Version:   version,
 		Index:     0,
-		Timestamp: MainnetGenesisTimestamp,
+		Timestamp: timestamp,
 		PrevHash:  "",
 		Posts:     []Post{},
 		Transfers: []Transfer{},
@@ -444,14 +809,16 @@ func CreateGenesisBlock() *Block {
 		},
 		CharCount: 0,
 	}
-	block.StateRoot.SetHash()
+	block.StateRoot.Hash = block.StateRoot.calculateHash(version)
 	block.SetHash()
 	return block
 }
 
-// CreateBlock creates a new block with the given posts and transfers
-func CreateBlock(index int, prevHash string, posts []Post, transfers []Transfer, stateRoot *StateRoot) *Block {
+// CreateBlock creates a new block with the given posts and transfers, counted under params
+// The state root must already be the result of applying the block to its parent state.
+func CreateBlock(params ConsensusParams, index int, prevHash string, posts []Post, transfers []Transfer, stateRoot *StateRoot) *Block {
 	block := &Block{
+		Version:   params.Encoding,
 		Index:     index,
 		Timestamp: time.Now().Unix(),
 		PrevHash:  prevHash,
@@ -462,22 +829,26 @@ func CreateBlock(index int, prevHash string, posts []Post, transfers []Transfer,
 	}
 
 	// Calculate character count
-	for _, post := range posts {
-		block.CharCount += post.GetCharacterCount()
-	}
+	block.CharCount = block.CountCharacters(params)
 
-	// Set state root hash if provided
-	if block.StateRoot != nil {
-		block.StateRoot.SetHash()
-	}
+	block.SetHash()
+	return block
+}
 
+// CreateBlockWithRewards creates a new block that mints the given uptime rewards
+func CreateBlockWithRewards(params ConsensusParams, index int, prevHash string, posts []Post, transfers []Transfer, rewards []UptimeReward, stateRoot *StateRoot) *Block {
+	block := CreateBlock(params, index, prevHash, posts, transfers, stateRoot)
+	block.Rewards = rewards
+
+	// Recalculate hash to include rewards
 	block.SetHash()
+
 	return block
 }
 
 // CreateBlockWithBeacon creates a new block with an optional beacon announcement
-func CreateBlockWithBeacon(index int, prevHash string, posts []Post, transfers []Transfer, stateRoot *StateRoot, beaconAnnounce *BeaconAnnounce) *Block {
-	block := CreateBlock(index, prevHash, posts, transfers, stateRoot)
+func CreateBlockWithBeacon(params ConsensusParams, index int, prevHash string, posts []Post, transfers []Transfer, stateRoot *StateRoot, beaconAnnounce *BeaconAnnounce) *Block {
+	block := CreateBlock(params, index, prevHash, posts, transfers, stateRoot)
 	block.BeaconAnnounce = beaconAnnounce
 
 	// Recalculate hash to include beacon announcement
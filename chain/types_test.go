@@ -0,0 +1,157 @@
+package chain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// Blocks as written by the first release, before any consensus upgrade
+const (
+	baselineGenesisJSON = `{"index":0,"timestamp":1751485627,"prev_hash":"","hash":"38025032e3f12e8270d7fdb2bf2dad92b9b3d5a53967f40eeebe4e7f52c1a934","posts":[],"transfers":[],"state_root":{"wallets":[],"hash":"c72dfd162ed2491bc174b5fe5761e0906f1896c2ae79d8baf39f85f03bcada1b","block_index":0},"char_count":0}`
+	baselineBlockJSON   = `{"index":1,"timestamp":1751328010,"prev_hash":"38025032e3f12e8270d7fdb2bf2dad92b9b3d5a53967f40eeebe4e7f52c1a934","hash":"e7d4da2cf1912c581cd87a19c65624499f69517ee4371a62e72b38dfa6a686b5","posts":[{"author":"1Q1pE5vPGEEMqRcVRMbtBK842Y6Pzo6nK9","signature":"1f40ad47926393b81d49975a7fdb563f7c63c062d5db72d8833a3169bcedd52f76290561f77afac0d329fda9b89c6865dbeeb28248981e340e5c31de3be5218d74","content":"baseline post 1","timestamp":1751328000,"hash":"5055bf9438ad7ed681f3fb88146dd1cfe7947f3e53ad2cfd0578e892157e880e"},{"author":"1Q1pE5vPGEEMqRcVRMbtBK842Y6Pzo6nK9","signature":"1f31a0cc6ac5500f187796ad65f23e6c4f6a3f795b636a2a90b4d833133f76ea7014dcd0861dc05e31d6c28f01c59e4abb24e8ac9ae9ba862991c4aa89f7c05f83","content":"baseline post 2","timestamp":1751328001,"hash":"22b5c441f61c1e14eb8855b2c2363f3b5e58f5e0671445067adb79593aa5ab92"},{"author":"1Q1pE5vPGEEMqRcVRMbtBK842Y6Pzo6nK9","signature":"1f513da5f4c0d93c055ed227f65fa757c732d2d8d53db2a50f9c6840cc954c94b25b0758f1b381c29899d0aa6149677f3c5e0c261007b119a58f555d5ccdc3a70e","content":"baseline post 3","timestamp":1751328002,"hash":"08acd06c3d6612547b70740499096cc2eed735fe0482d7d1d27dd976d855fb20"},{"author":"1Q1pE5vPGEEMqRcVRMbtBK842Y6Pzo6nK9","signature":"206c767fa703aecfae2e867a45c0e2fff799d4b6c67a99647e0a0a9f4a1e7551a70db3dbba06563d4c940fcfebaf1835a75e7c7851b07e16c064f0f25364f82476","content":"baseline post 4","timestamp":1751328003,"hash":"828413336c299cb75bd33b950ca9dd9136482d8b3bf414eda23f0ce0208823e6"},{"author":"1Q1pE5vPGEEMqRcVRMbtBK842Y6Pzo6nK9","signature":"207225a02f61fc356bf1a5448ad4104d1fd3b0e4d95f37b7327ebf081087aeddfc1c8a322228944c167ff6ccafca456e5a5214ac2b7c22fc49ece8263c18edc4a5","content":"baseline post 5","timestamp":1751328004,"hash":"a73dc34757610dde00e6de7e8f0482b68ed0eed78b15e56dffbe9783eef7663a"}],"transfers":[],"state_root":{"wallets":[{"address":"1Q1pE5vPGEEMqRcVRMbtBK842Y6Pzo6nK9","balance":925,"nonce":0,"last_tx_time":0}],"hash":"70ffafffd42dc4675b37b4429427894cf1a412607896903387cbd0d6d665c2a0","block_index":1},"char_count":75}`
+)
+
+// decodeBaselineBlocks decodes the baseline genesis and block 1
+func decodeBaselineBlocks(t *testing.T) (*Block, *Block) {
+	genesis, err := DecodeBlock([]byte(baselineGenesisJSON))
+	if err != nil {
+		t.Fatalf("Failed to decode baseline genesis: %v", err)
+	}
+	block, err := DecodeBlock([]byte(baselineBlockJSON))
+	if err != nil {
+		t.Fatalf("Failed to decode baseline block: %v", err)
+	}
+	return genesis, block
+}
+
+func TestBaselineBlockHash(t *testing.T) {
+	genesis, block := decodeBaselineBlocks(t)
+
+	if genesis.CalculateHash() != MainnetGenesisHash {
+		t.Errorf("Baseline genesis hashes to %s, expected %s", genesis.CalculateHash(), MainnetGenesisHash)
+	}
+	if block.CalculateHash() != block.Hash {
+		t.Fatalf("Baseline block hashes to %s, expected %s", block.CalculateHash(), block.Hash)
+	}
+
+	// The hash survives the canonical storage encoding
+	data, err := block.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to encode block: %v", err)
+	}
+	stored, err := DecodeBlock(data)
+	if err != nil {
+		t.Fatalf("Failed to decode stored block: %v", err)
+	}
+	if stored.CalculateHash() != block.Hash {
+		t.Error("Stored baseline block no longer hashes to its hash")
+	}
+
+	// Its header links to the genesis header, and a changed post breaks the hash
+	if err := ValidateChainHeaders([]*BlockHeader{genesis.Header(), block.Header()}, MainnetNetworkID); err != nil {
+		t.Errorf("Baseline header chain rejected: %v", err)
+	}
+	block.Posts[0].Hash = block.Posts[1].Hash
+	if block.CalculateHash() == block.Hash {
+		t.Error("Expected a changed post to change the legacy block hash")
+	}
+}
+
+func TestBlockPostSignatures(t *testing.T) {
+	// Baseline posts verify against the message they were signed over
+	_, block := decodeBaselineBlocks(t)
+	params := Params(MainnetNetworkID).ParamsAt(1)
+	if err := block.ValidateBlockWithParams(params); err != nil {
+		t.Fatalf("Expected baseline post signatures to verify: %v", err)
+	}
+
+	// A post whose signature does not recover its author is rejected, unless signatures are assumed valid
+	block.Posts[0].Signature = block.Posts[1].Signature
+	if err := block.ValidateBlockWithParams(params); err == nil {
+		t.Error("Expected a block with a badly signed post to be rejected")
+	}
+	if err := block.ValidateBlockAssumeValid(params); err != nil {
+		t.Errorf("Expected assume-valid blocks to skip post signatures: %v", err)
+	}
+
+	// Canonical posts must be signed for the block's network
+	author, err := wallet.NewTestnetWallet("author")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	regtest := Params(RegtestNetworkID).ParamsAt(1)
+	post := Post{Author: author.GetAddress(), Content: "hello", Timestamp: time.Now().Unix(), Version: regtest.Encoding}
+	if err := post.Sign(author, TestnetNetworkID); err != nil {
+		t.Fatalf("Failed to sign post: %v", err)
+	}
+	if err := CreateBlock(regtest, 1, RegtestGenesisHash, []Post{post}, []Transfer{}, nil).ValidateBlockWithParams(regtest); err == nil {
+		t.Error("Expected a post signed for another network to be rejected")
+	}
+	if err := post.Sign(author, RegtestNetworkID); err != nil {
+		t.Fatalf("Failed to sign post: %v", err)
+	}
+	if err := CreateBlock(regtest, 1, RegtestGenesisHash, []Post{post}, []Transfer{}, nil).ValidateBlockWithParams(regtest); err != nil {
+		t.Errorf("Expected a post signed for the block's network to be valid: %v", err)
+	}
+}
+
+func TestBlockTimestampRules(t *testing.T) {
+	params := ConsensusParamsAt(TestnetNetworkID, 125000)
+	if !params.BlockBudget {
+		t.Fatal("Expected the block budget to be active")
+	}
+
+	// The last MedianTimeSpan blocks have the median timestamp 1100 and a parent running ahead at 5000
+	blocks := make([]*Block, MedianTimeSpan+1)
+	for i := range blocks {
+		blocks[i] = &Block{Index: i, Timestamp: int64(500 + i*100)}
+	}
+	blocks[MedianTimeSpan].Timestamp = 5000
+	blockAt := func(index int) (*Block, error) {
+		return blocks[index], nil
+	}
+	now := int64(5000)
+
+	block := &Block{Index: MedianTimeSpan + 1, Posts: []Post{{Content: "post"}}}
+	block.Timestamp = 1100
+	if err := block.ValidateAfter(blockAt, now, params); err != nil {
+		t.Errorf("Expected a block before its parent but past the median time to be valid: %v", err)
+	}
+	block.Timestamp = 1099
+	if err := block.ValidateAfter(blockAt, now, params); err == nil {
+		t.Error("Expected a block before the median time past to be rejected")
+	}
+	block.Timestamp = now + int64(MaxFutureBlockTime.Seconds())
+	if err := block.ValidateAfter(blockAt, now, params); err != nil {
+		t.Errorf("Expected a block at the future limit to be valid: %v", err)
+	}
+	block.Timestamp++
+	if err := block.ValidateAfter(blockAt, now, params); err == nil {
+		t.Error("Expected a block too far in the future to be rejected")
+	}
+
+	// Regtest blocks are made on demand
+	if err := block.ValidateAfter(blockAt, now, ConsensusParamsAt(RegtestNetworkID, 1)); err != nil {
+		t.Errorf("Expected no timestamp rules on regtest: %v", err)
+	}
+}
+
+func TestPostSizeCountsCharacters(t *testing.T) {
+	// Two bytes per character: within the limit once characters are counted, twice over it in bytes
+	post := Post{Author: "author", Content: strings.Repeat("é", MaxPostSize), Timestamp: time.Now().Unix()}
+
+	if err := post.ValidateRules(ConsensusParamsAt(TestnetNetworkID, 50000)); err != nil {
+		t.Errorf("Expected a post of %d characters to be accepted: %v", MaxPostSize, err)
+	}
+	if err := post.ValidateRules(ConsensusParamsAt(TestnetNetworkID, 1)); err == nil {
+		t.Error("Expected the post to be measured in bytes before the unicode-count upgrade")
+	}
+
+	post.Content += "é"
+	if err := post.ValidateRules(ConsensusParamsAt(TestnetNetworkID, 50000)); err == nil {
+		t.Error("Expected a post over the character limit to be rejected")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/blindxfish/truthchain/chain"
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+func main() {
+	// Parse command line flags
+	var (
+		walletPath = flag.String("wallet", "", "Path to the genesis authority's wallet file")
+		networkID  = flag.String("network", chain.MainnetNetworkID, "Network whose genesis block to sign")
+		outPath    = flag.String("out", chain.GenesisBlockFile, "Where to write the signed genesis block")
+		help       = flag.Bool("help", false, "Show help message")
+	)
+	flag.Parse()
+
+	if *help || *walletPath == "" {
+		fmt.Println("TruthChain Genesis Signer")
+		fmt.Println("Signs a network's genesis block offline with the genesis authority's wallet.")
+		fmt.Println("Usage: genesis -wallet <wallet.pem> [options]")
+		fmt.Println()
+		fmt.Println("Options:")
+		flag.PrintDefaults()
+		fmt.Println()
+		fmt.Println("Copy the output file next to a node as genesis.json to start the chain.")
+		fmt.Println("The wallet is only needed here; nodes never read the authority key.")
+		return
+	}
+
+	network, err := chain.GetNetwork(*networkID)
+	if err != nil {
+		log.Fatalf("Unknown network: %v", err)
+	}
+	if network.GenesisAuthority == "" {
+		log.Fatalf("%s has no genesis authority - every node creates its genesis block locally", network.ID)
+	}
+
+	authority, err := wallet.LoadWallet(*walletPath)
+	if err != nil {
+		log.Fatalf("Failed to load wallet: %v", err)
+	}
+	if !wallet.PublicKeyMatchesAddress(authority.PublicKey, network.GenesisAuthority) {
+		log.Fatalf("Wallet is not the genesis authority of %s (%s)", network.ID, network.GenesisAuthority)
+	}
+
+	genesis := network.GenesisBlock()
+	if err := chain.SignGenesisBlock(genesis, network.ID, authority); err != nil {
+		log.Fatalf("Failed to sign genesis block: %v", err)
+	}
+	if err := network.ValidateGenesis(genesis); err != nil {
+		log.Fatalf("Signed genesis block does not validate: %v", err)
+	}
+
+	if err := chain.SaveGenesisBlock(genesis, *outPath); err != nil {
+		log.Fatalf("Failed to save genesis block: %v", err)
+	}
+
+	fmt.Printf("✅ Signed genesis block for %s\n", network.ID)
+	fmt.Printf("  Genesis hash: %s\n", genesis.Hash)
+	fmt.Printf("  Authority: %s\n", network.GenesisAuthority)
+	fmt.Printf("  Signature: %s\n", genesis.AuthoritySignature)
+	fmt.Printf("  Written to: %s\n", *outPath)
+}
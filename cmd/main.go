@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -57,6 +59,7 @@ type NodeConfig struct {
 	ImportWallet      bool
 	PrivateKey        string
 	ConfigureFirewall bool
+	AssumeValid       *chain.Checkpoint `json:",omitempty"` // Block whose ancestors skip signature checks during sync (network default if unset, none if its hash is empty)
 }
 
 func clearScreen() {
@@ -250,18 +253,13 @@ func runInteractiveSetup() *NodeConfig {
 		return nil
 	}
 
-	// Set post threshold based on network
-	var postThreshold int
-	switch networkID {
-	case "truthchain-mainnet":
-		postThreshold = 5
-	case "truthchain-testnet":
-		postThreshold = 3
-	case "truthchain-local":
-		postThreshold = 2
-	default:
-		postThreshold = 5
+	// Post threshold and default ports come from the network definition
+	selectedNetwork, err := chain.GetNetwork(networkID)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return nil
 	}
+	postThreshold := selectedNetwork.PostThreshold
 
 	// Node Mode Selection
 	modes := selectNodeModes(reader)
@@ -270,7 +268,7 @@ func runInteractiveSetup() *NodeConfig {
 	}
 
 	// Port Configuration
-	ports := configurePorts(reader, modes)
+	ports := configurePorts(reader, modes, selectedNetwork)
 	if ports == nil {
 		return nil
 	}
@@ -345,8 +343,8 @@ func selectNetwork(reader *bufio.Reader) string {
 	for {
 		fmt.Println("🌍 Select Network:")
 		fmt.Println("1. Mainnet (Production - Real TruthChain network)")
-		fmt.Println("2. Testnet (Development - Testing environment)")
-		fmt.Println("3. Local (Isolated - Your own private network)")
+		fmt.Println("2. Testnet (Development - Public testing network)")
+		fmt.Println("3. Regtest (Local - Create blocks and fund wallets on demand)")
 		fmt.Println()
 		fmt.Print("Enter your choice (1-3): ")
 
@@ -357,15 +355,15 @@ func selectNetwork(reader *bufio.Reader) string {
 		case "1":
 			fmt.Println("✅ Selected: Mainnet")
 			fmt.Println("ℹ️  Using mainnet consensus rules (post threshold: 5)")
-			return "truthchain-mainnet"
+			return chain.MainnetNetworkID
 		case "2":
 			fmt.Println("✅ Selected: Testnet")
 			fmt.Println("ℹ️  Using testnet consensus rules (post threshold: 3)")
-			return "truthchain-testnet"
+			return chain.TestnetNetworkID
 		case "3":
-			fmt.Println("✅ Selected: Local")
-			fmt.Println("ℹ️  Using local consensus rules (post threshold: 2)")
-			return "truthchain-local"
+			fmt.Println("✅ Selected: Regtest")
+			fmt.Println("ℹ️  Blocks are created only through the /regtest API endpoints")
+			return chain.RegtestNetworkID
 		default:
 			fmt.Println("❌ Invalid choice. Please enter 1, 2, or 3.")
 			fmt.Println()
@@ -410,7 +408,7 @@ func selectNodeModes(reader *bufio.Reader) *NodeModes {
 	return modes
 }
 
-func configurePorts(reader *bufio.Reader, modes *NodeModes) *PortConfig {
+func configurePorts(reader *bufio.Reader, modes *NodeModes, selected *chain.Network) *PortConfig {
 	fmt.Println()
 	fmt.Println("🔌 Port Configuration:")
 	fmt.Println()
@@ -419,12 +417,12 @@ func configurePorts(reader *bufio.Reader, modes *NodeModes) *PortConfig {
 
 	// API Port
 	if modes.APIMode {
-		ports.APIPort = getPort(reader, "API Server Port", 8080)
+		ports.APIPort = getPort(reader, "API Server Port", selected.APIPort)
 	}
 
 	// Mesh Port (handles both mesh communication and chain sync)
 	if modes.MeshMode {
-		ports.MeshPort = getPort(reader, "Mesh Network Port", 9876)
+		ports.MeshPort = getPort(reader, "Mesh Network Port", selected.MeshPort)
 		fmt.Println("ℹ️  Note: Chain sync is handled through the mesh network on the same port")
 	}
 
@@ -617,17 +615,31 @@ func NewTruthChainNode(config *NodeConfig) (*TruthChainNode, error) {
 		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
+	networkDef, err := chain.GetNetwork(config.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize blockchain
 	blockchain, err := blockchain.NewBlockchain(storage, config.PostThreshold, config.NetworkID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize blockchain: %w", err)
 	}
 
+	// A configured assume-valid block replaces the network default
+	if config.AssumeValid != nil {
+		if err := chain.ValidateCheckpoint(config.NetworkID, config.AssumeValid.Height, config.AssumeValid.Hash); config.AssumeValid.Hash != "" && err != nil {
+			return nil, fmt.Errorf("invalid assume-valid block: %w", err)
+		}
+		blockchain.SetAssumeValid(*config.AssumeValid)
+		log.Printf("Assume-valid block set to %d %s", config.AssumeValid.Height, config.AssumeValid.Hash)
+	}
+
 	// Initialize wallet
 	var myWallet *wallet.Wallet
 	if config.ImportWallet && config.PrivateKey != "" {
 		// Import existing wallet from private key
-		myWallet, err = wallet.ImportFromPrivateKey(config.PrivateKey)
+		myWallet, err = wallet.ImportFromPrivateKeyWithMetadata(config.PrivateKey, "", networkDef.VersionByte())
 		if err != nil {
 			return nil, fmt.Errorf("failed to import wallet: %w", err)
 		}
@@ -644,8 +656,8 @@ func NewTruthChainNode(config *NodeConfig) (*TruthChainNode, error) {
 
 		log.Printf("Wallet imported and saved successfully: %s", myWallet.GetAddress())
 	} else {
-		// Create new wallet
-		myWallet, err = wallet.NewWallet()
+		// Create new wallet with the network's address version
+		myWallet, err = wallet.NewWalletWithMetadata("", networkDef.VersionByte())
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize wallet: %w", err)
 		}
@@ -671,8 +683,13 @@ func NewTruthChainNode(config *NodeConfig) (*TruthChainNode, error) {
 		nil, // UptimeTracker (set later if mining enabled)
 		blockchain,
 		config.MeshPort,
-		"bootstrap.json", // Bootstrap config file
+		networkDef.BootstrapFile,
 	)
+	trustNet.NetworkID = config.NetworkID
+	trustNet.BootstrapManager.AddSeeds(networkDef.Bootstrap)
+
+	// Announce the blocks this node creates to its peers
+	blockchain.SetBlockAnnouncer(trustNet)
 
 	// Create router for API
 	router := mux.NewRouter()
@@ -756,6 +773,10 @@ func (n *TruthChainNode) initializeBeacon() error {
 func (n *TruthChainNode) initializeMiner() error {
 	beaconChecker := &beaconCheckerAdapter{beacon: n.beacon}
 	miner := miner.NewUptimeTracker(n.wallet, n.storage, beaconChecker)
+	// Reward claims are minted through blocks so every node agrees on them
+	miner.SetRewardSubmitter(n.blockchain)
+	miner.SetBalanceSource(n.blockchain)
+	miner.SetAnchorSource(n.blockchain)
 	n.miner = miner
 	// Attach miner to trust network for uptime tracking
 	if n.trustNetwork != nil {
@@ -793,25 +814,35 @@ func (n *TruthChainNode) setupAPIRoutes() {
 	// Blockchain endpoints
 	n.router.HandleFunc("/blockchain/latest", n.handleLatestBlock).Methods("GET")
 	n.router.HandleFunc("/blockchain/length", n.handleChainLength).Methods("GET")
+	n.router.HandleFunc("/blockchain/state/check", n.handleCheckState).Methods("GET")
 
 	// Post endpoints
 	n.router.HandleFunc("/posts", n.handleCreatePost).Methods("POST")
 	n.router.HandleFunc("/posts/pending", n.handleGetPendingPosts).Methods("GET")
+	n.router.HandleFunc("/posts/{hash}/proof", n.handleGetPostProof).Methods("GET")
 
 	// Transfer endpoints
 	n.router.HandleFunc("/transfers", n.handleCreateTransfer).Methods("POST")
 	n.router.HandleFunc("/transfers/pending", n.handleGetPendingTransfers).Methods("GET")
+	n.router.HandleFunc("/transfers/fees", n.handleEstimateFees).Methods("GET")
 
 	// Wallet endpoints
 	n.router.HandleFunc("/wallets", n.handleGetWallets).Methods("GET")
 	n.router.HandleFunc("/wallets/{address}", n.handleGetWallet).Methods("GET")
 	n.router.HandleFunc("/wallets/{address}/balance", n.handleGetBalance).Methods("GET")
+	n.router.HandleFunc("/wallets/{address}/proof", n.handleGetWalletProof).Methods("GET")
 	n.router.HandleFunc("/wallets/{address}/backup", n.handleWalletBackup).Methods("GET")
 
 	// Network endpoints
 	n.router.HandleFunc("/network/stats", n.handleNetworkStats).Methods("GET")
 	n.router.HandleFunc("/network/peers", n.handleGetPeers).Methods("GET")
 
+	// Regtest endpoints (blocks on demand and local funding)
+	if n.blockchain.IsRegtest() {
+		n.router.HandleFunc("/regtest/generate", n.handleGenerateBlocks).Methods("POST")
+		n.router.HandleFunc("/regtest/fund", n.handleFundWallet).Methods("POST")
+	}
+
 	// Add CORS headers
 	n.router.Use(n.corsMiddleware)
 }
@@ -857,7 +888,7 @@ func (n *TruthChainNode) Start() error {
 			return fmt.Errorf("failed to get genesis block: %w", err)
 		}
 
-		if err := chain.ValidateCanonicalGenesis(genesis); err != nil {
+		if err := chain.ValidateCanonicalGenesis(n.config.NetworkID, genesis); err != nil {
 			return fmt.Errorf("invalid genesis block: %w", err)
 		}
 
@@ -977,7 +1008,7 @@ func (n *TruthChainNode) performInitialSync() error {
 					return fmt.Errorf("failed to get genesis after sync: %w", err)
 				}
 
-				if err := chain.ValidateCanonicalGenesis(genesis); err != nil {
+				if err := chain.ValidateCanonicalGenesis(n.config.NetworkID, genesis); err != nil {
 					return fmt.Errorf("invalid genesis block after sync: %w", err)
 				}
 
@@ -1121,6 +1152,80 @@ func (n *TruthChainNode) handleChainLength(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleCheckState replays the chain against the live state for local clients only
+func (n *TruthChainNode) handleCheckState(w http.ResponseWriter, r *http.Request) {
+	if !isLocalRequest(r) {
+		http.Error(w, "State check is only available locally", http.StatusForbidden)
+		return
+	}
+
+	report, err := n.blockchain.CheckStateConsistency()
+	if errors.Is(err, blockchain.ErrStateCheckRunning) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check state: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (n *TruthChainNode) handleGenerateBlocks(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Blocks int `json:"blocks"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	blocks, err := n.blockchain.GenerateBlocks(req.Blocks)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to generate blocks: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	hashes := make([]string, len(blocks))
+	for i, block := range blocks {
+		hashes[i] = block.Hash
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"blocks": hashes,
+	})
+}
+
+func (n *TruthChainNode) handleFundWallet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Address string `json:"address"`
+		Amount  int    `json:"amount"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	block, err := n.blockchain.FundWallet(req.Address, req.Amount)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fund wallet: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"address": req.Address,
+		"amount":  req.Amount,
+		"block":   block.Index,
+		"hash":    block.Hash,
+	})
+}
+
 func (n *TruthChainNode) handleCreatePost(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Content string `json:"content"`
@@ -1147,10 +1252,50 @@ func (n *TruthChainNode) handleGetPendingPosts(w http.ResponseWriter, r *http.Re
 	json.NewEncoder(w).Encode(posts)
 }
 
+func (n *TruthChainNode) handleGetPostProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hash := vars["hash"]
+
+	proof, err := n.blockchain.GetPostProof(hash)
+	if err != nil {
+		http.Error(w, "Post not found in chain", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
+}
+
+func (n *TruthChainNode) handleGetWalletProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	address := vars["address"]
+
+	// Default to the latest block
+	height := -1
+	if param := r.URL.Query().Get("height"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid height", http.StatusBadRequest)
+			return
+		}
+		height = parsed
+	}
+
+	proof, err := n.blockchain.GetWalletProof(address, height)
+	if err != nil {
+		http.Error(w, "No state at that height", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
+}
+
 func (n *TruthChainNode) handleCreateTransfer(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		To     string `json:"to"`
 		Amount int    `json:"amount"`
+		GasFee int    `json:"gas_fee"` // Optional, defaults to the minimum fee
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1158,12 +1303,29 @@ func (n *TruthChainNode) handleCreateTransfer(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	transfer, err := n.blockchain.CreateTransfer(req.To, req.Amount, n.wallet)
+	var transfer *chain.Transfer
+	var err error
+	if req.GasFee > 0 {
+		transfer, err = n.blockchain.CreateTransferWithFee(req.To, req.Amount, req.GasFee, n.wallet)
+	} else {
+		transfer, err = n.blockchain.CreateTransfer(req.To, req.Amount, n.wallet)
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create transfer: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// Queue the transfer and relay it, checked the same way peers will check it
+	if err := n.blockchain.AddTransfer(*transfer); err != nil {
+		http.Error(w, fmt.Sprintf("Transfer rejected: %v", err), http.StatusBadRequest)
+		return
+	}
+	if n.trustNetwork != nil {
+		if err := n.trustNetwork.BroadcastTransfer(transfer); err != nil {
+			log.Printf("Failed to broadcast transfer %s: %v", transfer.Hash, err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(transfer)
 }
@@ -1174,8 +1336,22 @@ func (n *TruthChainNode) handleGetPendingTransfers(w http.ResponseWriter, r *htt
 	json.NewEncoder(w).Encode(poolInfo)
 }
 
+func (n *TruthChainNode) handleEstimateFees(w http.ResponseWriter, r *http.Request) {
+	estimate, err := n.blockchain.EstimateFees()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to estimate fees: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(estimate)
+}
+
 func (n *TruthChainNode) handleGetWallets(w http.ResponseWriter, r *http.Request) {
-	stateInfo := n.blockchain.GetStateInfo()
+	stateInfo, err := n.blockchain.GetStateInfo()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get state info: %v", err), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stateInfo)
 }
@@ -1305,6 +1481,19 @@ func (n *TruthChainNode) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// isLocalRequest reports whether a request was made on this machine and not relayed by a proxy
+func isLocalRequest(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func printHelp() {
 	fmt.Println("🌐 TruthChain Node")
 	fmt.Println("==================")
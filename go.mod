@@ -6,12 +6,13 @@ require (
 	github.com/btcsuite/btcd/btcec/v2 v2.3.5
 	github.com/btcsuite/btcutil v1.0.2
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.4.0
+	github.com/gorilla/mux v1.8.1
 	go.etcd.io/bbolt v1.4.2
 	golang.org/x/crypto v0.39.0
+	golang.org/x/text v0.26.0
 )
 
 require (
 	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
-	github.com/gorilla/mux v1.8.1 // indirect
 	golang.org/x/sys v0.33.0 // indirect
 )
@@ -5,9 +5,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/blindxfish/truthchain/chain"
 	"github.com/blindxfish/truthchain/store"
 	"github.com/blindxfish/truthchain/wallet"
 )
@@ -18,16 +20,35 @@ type BeaconChecker interface {
 	GetBeaconUptime() float64
 }
 
+// RewardSubmitter accepts uptime reward claims for inclusion in a block
+type RewardSubmitter interface {
+	SubmitUptimeReward(reward chain.UptimeReward) error
+}
+
+// BalanceSource reports the on-chain character balance of an address
+type BalanceSource interface {
+	GetCharacterBalance(address string) (int, error)
+}
+
+// AnchorSource reports the block new heartbeats are anchored to
+// It returns false while the chain still takes unanchored heartbeats.
+type AnchorSource interface {
+	HeartbeatAnchor() (int, string, bool)
+}
+
 // UptimeTracker manages node uptime tracking and character rewards
 type UptimeTracker struct {
-	wallet        *wallet.Wallet
-	storage       store.Storage
-	beaconChecker BeaconChecker // Beacon checker for incentive calculation
-	mu            sync.RWMutex
-	startTime     time.Time
-	lastReward    time.Time
-	heartbeats    []Heartbeat
-	config        UptimeConfig
+	wallet          *wallet.Wallet
+	storage         store.Storage
+	beaconChecker   BeaconChecker   // Beacon checker for incentive calculation
+	rewardSubmitter RewardSubmitter // Receives reward claims for on-chain minting
+	balanceSource   BalanceSource   // Reports the balance earned so far
+	anchorSource    AnchorSource    // Chain tip heartbeats are anchored to
+	mu              sync.RWMutex
+	startTime       time.Time
+	lastReward      time.Time
+	heartbeats      []Heartbeat
+	config          UptimeConfig
 }
 
 // UptimeConfig contains configuration for the uptime tracker
@@ -40,9 +61,11 @@ type UptimeConfig struct {
 
 // Heartbeat represents a single uptime heartbeat
 type Heartbeat struct {
-	Timestamp int64  `json:"timestamp"`
-	Signature string `json:"signature"`
-	Hash      string `json:"hash"`
+	Timestamp  int64  `json:"timestamp"`
+	BlockIndex int    `json:"block_index,omitempty"`
+	BlockHash  string `json:"block_hash,omitempty"`
+	Signature  string `json:"signature"`
+	Hash       string `json:"hash"`
 }
 
 // DefaultUptimeConfig returns the default configuration for mainnet
@@ -68,6 +91,27 @@ func NewUptimeTracker(w *wallet.Wallet, s store.Storage, beaconChecker BeaconChe
 	}
 }
 
+// SetRewardSubmitter sets where reward claims are submitted for minting
+func (ut *UptimeTracker) SetRewardSubmitter(submitter RewardSubmitter) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	ut.rewardSubmitter = submitter
+}
+
+// SetBalanceSource sets where the node's character balance is read from
+func (ut *UptimeTracker) SetBalanceSource(source BalanceSource) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	ut.balanceSource = source
+}
+
+// SetAnchorSource sets where the block new heartbeats are anchored to is read from
+func (ut *UptimeTracker) SetAnchorSource(source AnchorSource) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	ut.anchorSource = source
+}
+
 // Start begins the uptime tracking process
 func (ut *UptimeTracker) Start() error {
 	ut.mu.Lock()
@@ -116,21 +160,30 @@ func (ut *UptimeTracker) logHeartbeat() error {
 	ut.mu.Lock()
 	defer ut.mu.Unlock()
 
-	// Create heartbeat data
-	timestamp := time.Now().Unix()
-	heartbeatData := fmt.Sprintf("%s%d", ut.wallet.GetAddress(), timestamp)
+	// Create heartbeat data, anchored to the chain tip once the chain takes anchors
+	proof := chain.HeartbeatProof{Timestamp: time.Now().Unix()}
+	if ut.anchorSource != nil {
+		if index, hash, ok := ut.anchorSource.HeartbeatAnchor(); ok {
+			proof.BlockIndex = index
+			proof.BlockHash = hash
+		}
+	}
+	heartbeatData := proof.SigningData(ut.wallet.GetAddress())
 
 	// Sign the heartbeat
-	signature, err := ut.wallet.Sign([]byte(heartbeatData))
+	signature, err := ut.wallet.Sign(heartbeatData)
 	if err != nil {
 		return fmt.Errorf("failed to sign heartbeat: %w", err)
 	}
 
 	// Create heartbeat
+	timestamp := proof.Timestamp
 	heartbeat := Heartbeat{
-		Timestamp: timestamp,
-		Signature: hex.EncodeToString(signature),
-		Hash:      ut.calculateHeartbeatHash(heartbeatData),
+		Timestamp:  timestamp,
+		BlockIndex: proof.BlockIndex,
+		BlockHash:  proof.BlockHash,
+		Signature:  hex.EncodeToString(signature),
+		Hash:       ut.calculateHeartbeatHash(heartbeatData),
 	}
 
 	// Add to heartbeats
@@ -146,8 +199,8 @@ func (ut *UptimeTracker) logHeartbeat() error {
 }
 
 // calculateHeartbeatHash calculates the hash of a heartbeat
-func (ut *UptimeTracker) calculateHeartbeatHash(data string) string {
-	hash := sha256.Sum256([]byte(data))
+func (ut *UptimeTracker) calculateHeartbeatHash(data []byte) string {
+	hash := sha256.Sum256(data)
 	return hex.EncodeToString(hash[:])
 }
 
@@ -189,11 +242,17 @@ func (ut *UptimeTracker) LoadHeartbeats() error {
 	return nil
 }
 
-// distributeRewards calculates and distributes character rewards every 10 minutes
+// distributeRewards submits an uptime reward claim every 10 minutes
+// The claim carries signed heartbeats as evidence; the block producer sets the
+// minted amount from the emission schedule and consensus validates it.
 func (ut *UptimeTracker) distributeRewards() error {
 	ut.mu.Lock()
 	defer ut.mu.Unlock()
 
+	if ut.rewardSubmitter == nil {
+		return fmt.Errorf("no reward submitter configured")
+	}
+
 	// Calculate uptime percentage for the last 24 hours
 	uptimePercent := ut.calculateUptimePercent()
 	if uptimePercent < ut.config.MinUptimePercent {
@@ -202,47 +261,56 @@ func (ut *UptimeTracker) distributeRewards() error {
 		return nil
 	}
 
-	// Calculate daily reward based on node count
-	nodeCount := 1 // For now, assume we're the only node
-	dailyReward := ut.calculateReward(nodeCount)
-
-	// Distribute daily reward across 144 batches (every 10 minutes)
-	// 24 hours × 6 batches per hour = 144 batches per day
-	batchReward := dailyReward / 144
+	// Build the reward claim from our signed heartbeats
+	reward := chain.UptimeReward{
+		Recipient:  ut.wallet.GetAddress(),
+		Timestamp:  time.Now().Unix(),
+		Heartbeats: ut.collectHeartbeatProofs(time.Now()),
+	}
+	reward.SetHash()
 
-	// Ensure minimum reward of 1 character per batch
-	if batchReward < 1 {
-		batchReward = 1
+	if err := ut.rewardSubmitter.SubmitUptimeReward(reward); err != nil {
+		return fmt.Errorf("failed to submit reward claim: %w", err)
 	}
 
-	// Apply beacon bonus if this node is a beacon
-	beaconBonus := 0
-	isBeacon := false
-	if ut.beaconChecker != nil {
-		isBeacon = ut.beaconChecker.IsBeaconMode()
-		if isBeacon {
-			// +50% bonus for beacon nodes as specified in NetworkDesign.txt
-			beaconBonus = batchReward / 2 // 50% of base reward
-			batchReward += beaconBonus
-			fmt.Printf("Beacon bonus applied: +%d characters (50%% bonus)\n", beaconBonus)
+	fmt.Printf("Reward claim submitted: %d heartbeats (uptime: %.2f%%)\n",
+		len(reward.Heartbeats), uptimePercent)
+	ut.lastReward = time.Now()
+
+	return nil
+}
+
+// collectHeartbeatProofs returns the heartbeats in the reward window as consensus evidence
+func (ut *UptimeTracker) collectHeartbeatProofs(now time.Time) []chain.HeartbeatProof {
+	windowStart := now.Add(-chain.RewardWindow).Unix()
+
+	heartbeats := make([]Heartbeat, 0, len(ut.heartbeats))
+	for _, hb := range ut.heartbeats {
+		if hb.Timestamp > windowStart && hb.Timestamp <= now.Unix() {
+			heartbeats = append(heartbeats, hb)
 		}
 	}
 
-	// Mint characters to the wallet
-	if err := ut.mintCharacters(batchReward); err != nil {
-		return fmt.Errorf("failed to mint characters: %w", err)
-	}
+	// Order by time and skip heartbeats logged too close together
+	sort.Slice(heartbeats, func(i, j int) bool {
+		return heartbeats[i].Timestamp < heartbeats[j].Timestamp
+	})
 
-	bonusInfo := ""
-	if isBeacon {
-		bonusInfo = fmt.Sprintf(" (includes +%d beacon bonus)", beaconBonus)
+	minSpacing := int64(chain.MinHeartbeatSpacing.Seconds())
+	proofs := []chain.HeartbeatProof{}
+	for _, hb := range heartbeats {
+		if len(proofs) > 0 && hb.Timestamp-proofs[len(proofs)-1].Timestamp < minSpacing {
+			continue
+		}
+		proofs = append(proofs, chain.HeartbeatProof{
+			Timestamp:  hb.Timestamp,
+			BlockIndex: hb.BlockIndex,
+			BlockHash:  hb.BlockHash,
+			Signature:  hb.Signature,
+		})
 	}
 
-	fmt.Printf("Reward distributed: %d characters%s (uptime: %.2f%%, daily rate: %d chars/day)\n",
-		batchReward, bonusInfo, uptimePercent, dailyReward)
-	ut.lastReward = time.Now()
-
-	return nil
+	return proofs
 }
 
 // calculateUptimePercent calculates the uptime percentage for the last 24 hours
@@ -276,59 +344,7 @@ func (ut *UptimeTracker) calculateUptimePercent() float64 {
 
 // calculateReward calculates the daily reward based on node count
 func (ut *UptimeTracker) calculateReward(nodeCount int) int {
-	if nodeCount <= 0 {
-		return 0
-	}
-
-	// Logarithmic decay formula from whitepaper
-	// For nodeCount = 1: reward = 1120
-	// For nodeCount = 1000: reward = 280
-	// For nodeCount > 1000: reward decreases further
-
-	if nodeCount == 1 {
-		return 1120
-	} else if nodeCount <= 1000 {
-		// Linear interpolation between known points
-		if nodeCount <= 10 {
-			// Between 1 and 10 nodes
-			ratio := float64(nodeCount-1) / 9.0
-			return int(1120 - ratio*(1120-1037))
-		} else if nodeCount <= 100 {
-			// Between 10 and 100 nodes
-			ratio := float64(nodeCount-10) / 90.0
-			return int(1037 - ratio*(1037-800))
-		} else if nodeCount <= 500 {
-			// Between 100 and 500 nodes
-			ratio := float64(nodeCount-100) / 400.0
-			return int(800 - ratio*(800-451))
-		} else {
-			// Between 500 and 1000 nodes
-			ratio := float64(nodeCount-500) / 500.0
-			return int(451 - ratio*(451-280))
-		}
-	} else {
-		// For more than 1000 nodes, use logarithmic decay
-		// This ensures we never exceed the daily cap
-		reward := float64(ut.config.DailyCap) / float64(nodeCount)
-		if reward < 1 {
-			reward = 1
-		}
-		return int(reward)
-	}
-}
-
-// mintCharacters adds characters to the wallet balance
-func (ut *UptimeTracker) mintCharacters(amount int) error {
-	if amount <= 0 {
-		return fmt.Errorf("invalid character amount: %d", amount)
-	}
-
-	// Update balance in storage
-	if err := ut.storage.UpdateCharacterBalance(ut.wallet.GetAddress(), amount); err != nil {
-		return fmt.Errorf("failed to update character balance: %w", err)
-	}
-
-	return nil
+	return chain.CalculateDailyReward(nodeCount)
 }
 
 // GetUptimeInfo returns information about the node's uptime
@@ -351,9 +367,11 @@ func (ut *UptimeTracker) GetUptimeInfo() map[string]interface{} {
 	}
 
 	// Get current balance
-	balance, err := ut.storage.GetCharacterBalance(ut.wallet.GetAddress())
-	if err != nil {
-		balance = 0
+	balance := 0
+	if ut.balanceSource != nil {
+		if b, err := ut.balanceSource.GetCharacterBalance(ut.wallet.GetAddress()); err == nil {
+			balance = b
+		}
 	}
 
 	// Check beacon status
@@ -364,12 +382,6 @@ func (ut *UptimeTracker) GetUptimeInfo() map[string]interface{} {
 		beaconUptime = ut.beaconChecker.GetBeaconUptime()
 	}
 
-	// Calculate beacon bonus rate
-	beaconBonusRate := 0.0
-	if isBeacon {
-		beaconBonusRate = 50.0 // +50% bonus as specified in NetworkDesign.txt
-	}
-
 	return map[string]interface{}{
 		"start_time":           ut.startTime.Format("2006-01-02 15:04:05"),
 		"last_reward":          ut.lastReward.Format("2006-01-02 15:04:05"),
@@ -383,7 +395,6 @@ func (ut *UptimeTracker) GetUptimeInfo() map[string]interface{} {
 		"min_uptime_percent":   ut.config.MinUptimePercent,
 		"is_beacon":            isBeacon,
 		"beacon_uptime":        beaconUptime,
-		"beacon_bonus_rate":    beaconBonusRate,
 	}
 }
 
@@ -1,11 +1,13 @@
 package miner
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/blindxfish/truthchain/chain"
 	"github.com/blindxfish/truthchain/store"
 	"github.com/blindxfish/truthchain/wallet"
 )
@@ -168,60 +170,6 @@ func TestCalculateUptimePercent(t *testing.T) {
 	}
 }
 
-func TestMintCharacters(t *testing.T) {
-	// Create temporary database file
-	dbPath := "test_mint.db"
-	defer os.Remove(dbPath)
-
-	// Create storage
-	storage, err := store.NewBoltDBStorage(dbPath)
-	if err != nil {
-		t.Fatalf("Failed to create storage: %v", err)
-	}
-	defer storage.Close()
-
-	// Create wallet
-	wallet, err := wallet.NewWallet()
-	if err != nil {
-		t.Fatalf("Failed to create wallet: %v", err)
-	}
-
-	// Create uptime tracker
-	ut := NewUptimeTracker(wallet, storage, nil)
-
-	// Test initial balance
-	balance, err := storage.GetCharacterBalance(wallet.GetAddress())
-	if err != nil {
-		t.Fatalf("Failed to get initial balance: %v", err)
-	}
-	if balance != 0 {
-		t.Errorf("Expected initial balance 0, got %d", balance)
-	}
-
-	// Mint some characters
-	amount := 1000
-	if err := ut.mintCharacters(amount); err != nil {
-		t.Fatalf("Failed to mint characters: %v", err)
-	}
-
-	// Check balance
-	balance, err = storage.GetCharacterBalance(wallet.GetAddress())
-	if err != nil {
-		t.Fatalf("Failed to get balance: %v", err)
-	}
-	if balance != amount {
-		t.Errorf("Expected balance %d, got %d", amount, balance)
-	}
-
-	// Test invalid amount
-	if err := ut.mintCharacters(0); err == nil {
-		t.Error("Expected error for zero amount")
-	}
-	if err := ut.mintCharacters(-100); err == nil {
-		t.Error("Expected error for negative amount")
-	}
-}
-
 func TestGetUptimeInfo(t *testing.T) {
 	// Create temporary database file
 	dbPath := "test_info.db"
@@ -323,10 +271,47 @@ func TestHeartbeatLogging(t *testing.T) {
 
 	// Test heartbeat hash calculation
 	expectedData := fmt.Sprintf("%s%d", wallet.GetAddress(), heartbeat.Timestamp)
-	expectedHash := ut.calculateHeartbeatHash(expectedData)
+	expectedHash := ut.calculateHeartbeatHash([]byte(expectedData))
 	if heartbeat.Hash != expectedHash {
 		t.Errorf("Heartbeat hash mismatch: expected %s, got %s", expectedHash, heartbeat.Hash)
 	}
+
+	// Once the chain takes anchors, heartbeats name its tip
+	ut.SetAnchorSource(fakeAnchorSource{index: 7, hash: "tip"})
+	if err := ut.logHeartbeat(); err != nil {
+		t.Fatalf("Failed to log heartbeat: %v", err)
+	}
+	anchored := ut.heartbeats[1]
+	if anchored.BlockIndex != 7 || anchored.BlockHash != "tip" {
+		t.Errorf("Expected heartbeat anchored to block 7, got %d %q", anchored.BlockIndex, anchored.BlockHash)
+	}
+	proof := chain.HeartbeatProof{Timestamp: anchored.Timestamp, BlockIndex: 7, BlockHash: "tip"}
+	if anchored.Hash != ut.calculateHeartbeatHash(proof.SigningData(wallet.GetAddress())) {
+		t.Error("Anchored heartbeat does not sign its anchor")
+	}
+}
+
+// fakeAnchorSource reports a fixed chain tip
+type fakeAnchorSource struct {
+	index int
+	hash  string
+}
+
+func (f fakeAnchorSource) HeartbeatAnchor() (int, string, bool) {
+	return f.index, f.hash, true
+}
+
+// fakeRewardSubmitter records submitted reward claims
+type fakeRewardSubmitter struct {
+	rewards []chain.UptimeReward
+}
+
+func (f *fakeRewardSubmitter) SubmitUptimeReward(reward chain.UptimeReward) error {
+	if err := reward.ValidateEvidence(); err != nil {
+		return err
+	}
+	f.rewards = append(f.rewards, reward)
+	return nil
 }
 
 func TestDistributeRewards(t *testing.T) {
@@ -342,36 +327,32 @@ func TestDistributeRewards(t *testing.T) {
 	defer storage.Close()
 
 	// Create wallet
-	wallet, err := wallet.NewWallet()
+	w, err := wallet.NewWallet()
 	if err != nil {
 		t.Fatalf("Failed to create wallet: %v", err)
 	}
 
-	// Create uptime tracker with shorter intervals for testing
-	ut := NewUptimeTracker(wallet, storage, nil)
-	ut.config.HeartbeatInterval = 1 * time.Hour // Keep default 1 hour interval
-	ut.config.RewardInterval = 1 * time.Minute  // 1 minute for testing
-	ut.config.MinUptimePercent = 50.0           // Lower threshold for testing
-
-	// Add enough heartbeats to ensure uptime requirement is met
-	// We need at least 50% of expected heartbeats in the last 24 hours
-	// Expected: 24 heartbeats (one per hour for 24 hours)
-	// We'll add 20 heartbeats (83.33% uptime, above 50% threshold)
-	now := time.Now()
-	for i := 0; i < 20; i++ { // Add 20 heartbeats (one per hour for 20 hours)
-		heartbeatTime := now.Add(-time.Duration(i) * time.Hour)
-		heartbeat := Heartbeat{
-			Timestamp: heartbeatTime.Unix(),
-			Signature: "test_signature",
-			Hash:      "test_hash",
-		}
-		ut.heartbeats = append(ut.heartbeats, heartbeat)
+	// Create uptime tracker without a submitter
+	ut := NewUptimeTracker(w, storage, nil)
+	if err := ut.distributeRewards(); err == nil {
+		t.Error("Expected error without a reward submitter")
 	}
 
-	// Get initial balance
-	initialBalance, err := storage.GetCharacterBalance(wallet.GetAddress())
-	if err != nil {
-		t.Fatalf("Failed to get initial balance: %v", err)
+	submitter := &fakeRewardSubmitter{}
+	ut.SetRewardSubmitter(submitter)
+
+	// Add 20 signed heartbeats, one per hour (83.33% uptime)
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		timestamp := now.Add(-time.Duration(i) * time.Hour).Unix()
+		signature, err := w.Sign(chain.HeartbeatProof{Timestamp: timestamp}.SigningData(w.GetAddress()))
+		if err != nil {
+			t.Fatalf("Failed to sign heartbeat: %v", err)
+		}
+		ut.heartbeats = append(ut.heartbeats, Heartbeat{
+			Timestamp: timestamp,
+			Signature: hex.EncodeToString(signature),
+		})
 	}
 
 	// Distribute rewards
@@ -379,28 +360,23 @@ func TestDistributeRewards(t *testing.T) {
 		t.Fatalf("Failed to distribute rewards: %v", err)
 	}
 
-	// Check that balance increased
-	finalBalance, err := storage.GetCharacterBalance(wallet.GetAddress())
-	if err != nil {
-		t.Fatalf("Failed to get final balance: %v", err)
+	if len(submitter.rewards) != 1 {
+		t.Fatalf("Expected 1 reward claim, got %d", len(submitter.rewards))
 	}
-
-	if finalBalance <= initialBalance {
-		t.Errorf("Balance should have increased: initial %d, final %d", initialBalance, finalBalance)
+	reward := submitter.rewards[0]
+	if reward.Recipient != w.GetAddress() {
+		t.Errorf("Expected recipient %s, got %s", w.GetAddress(), reward.Recipient)
 	}
-
-	// Verify reward amount (should be daily reward / 144 for single node)
-	// Daily reward for 1 node: 1120 characters
-	// Batch reward: 1120 / 144 ≈ 7.78, but minimum is 1
-	expectedDailyReward := 1120
-	expectedBatchReward := expectedDailyReward / 144
-	if expectedBatchReward < 1 {
-		expectedBatchReward = 1
+	if len(reward.Heartbeats) != 20 {
+		t.Errorf("Expected 20 heartbeat proofs, got %d", len(reward.Heartbeats))
 	}
 
-	actualReward := finalBalance - initialBalance
-	if actualReward != expectedBatchReward {
-		t.Errorf("Expected batch reward %d, got %d (daily rate: %d chars/day)",
-			expectedBatchReward, actualReward, expectedDailyReward)
+	// Low uptime should not produce a claim
+	ut.heartbeats = ut.heartbeats[:10]
+	if err := ut.distributeRewards(); err != nil {
+		t.Fatalf("Unexpected error with low uptime: %v", err)
+	}
+	if len(submitter.rewards) != 1 {
+		t.Errorf("Expected no new claim with low uptime, got %d claims", len(submitter.rewards))
 	}
 }
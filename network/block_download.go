@@ -0,0 +1,313 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// Sync phases reported in SyncProgress
+const (
+	SyncPhaseIdle    = "idle"
+	SyncPhaseHeaders = "headers"
+	SyncPhaseBlocks  = "blocks"
+	SyncPhaseDone    = "done"
+	SyncPhaseFailed  = "failed"
+)
+
+// maxPeerDownloadFailures is how many failed ranges a peer may return before it is dropped from a download
+const maxPeerDownloadFailures = 3
+
+// SyncProgress reports the state of the current (or last) headers-first sync
+type SyncProgress struct {
+	Phase             string    `json:"phase"`
+	HeaderPeer        string    `json:"header_peer"`
+	TargetHeight      int       `json:"target_height"`
+	HeadersDownloaded int       `json:"headers_downloaded"`
+	BlocksRequested   int       `json:"blocks_requested"`
+	BlocksDownloaded  int       `json:"blocks_downloaded"`
+	BlocksConnected   int       `json:"blocks_connected"`
+	PendingRanges     int       `json:"pending_ranges"`
+	DownloadPeers     int       `json:"download_peers"`
+	Retries           int       `json:"retries"`
+	StartedAt         time.Time `json:"started_at"`
+}
+
+// blockRange is an inclusive range of block indexes requested from one peer
+type blockRange struct {
+	start int
+	end   int
+}
+
+// rangeResult is the outcome of requesting one range
+type rangeResult struct {
+	rng     blockRange
+	blocks  []*chain.Block
+	err     error
+	peer    string
+	retired bool // The peer failed too often and its worker stopped
+}
+
+// updateProgress applies a change to the sync progress
+func (msm *MeshSyncManager) updateProgress(update func(p *SyncProgress)) {
+	msm.mu.Lock()
+	defer msm.mu.Unlock()
+	update(&msm.progress)
+}
+
+// GetSyncProgress returns a copy of the sync progress
+func (msm *MeshSyncManager) GetSyncProgress() SyncProgress {
+	msm.mu.RLock()
+	defer msm.mu.RUnlock()
+	return msm.progress
+}
+
+// fetchHeaderChain downloads and validates headers from a peer in batches
+// Each batch must continue the previous one, so the result is a linked header chain.
+func (msm *MeshSyncManager) fetchHeaderChain(peer *MeshPeer, fromIndex, toIndex int) ([]*chain.BlockHeader, error) {
+	var headers []*chain.BlockHeader
+	next := fromIndex
+
+	for toIndex < 0 || next <= toIndex {
+		batchEnd := next + msm.headerBatchSize - 1
+		if toIndex >= 0 && batchEnd > toIndex {
+			batchEnd = toIndex
+		}
+
+		resp, err := msm.sendSyncRequest(peer, chain.ChainSyncRequest{
+			FromIndex:   next,
+			ToIndex:     batchEnd,
+			NodeID:      msm.trustNetwork.NodeID,
+			Timestamp:   time.Now().Unix(),
+			HeadersOnly: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get headers %d-%d: %w", next, batchEnd, err)
+		}
+		if len(resp.Headers) == 0 {
+			break
+		}
+		if len(resp.Headers) > batchEnd-next+1 {
+			return nil, fmt.Errorf("peer sent %d headers for %d-%d", len(resp.Headers), next, batchEnd)
+		}
+
+		if err := chain.ValidateChainHeaders(resp.Headers, msm.trustNetwork.NetworkID); err != nil {
+			return nil, fmt.Errorf("invalid headers: %w", err)
+		}
+		if resp.Headers[0].Index != next {
+			return nil, fmt.Errorf("header batch starts at %d, expected %d", resp.Headers[0].Index, next)
+		}
+		if len(headers) > 0 && resp.Headers[0].PrevHash != headers[len(headers)-1].Hash {
+			return nil, fmt.Errorf("header batch at %d does not link to previous batch", next)
+		}
+
+		headers = append(headers, resp.Headers...)
+		msm.updateProgress(func(p *SyncProgress) {
+			p.HeadersDownloaded = len(headers)
+			p.TargetHeight = headers[len(headers)-1].Index
+		})
+
+		// A short batch means we reached the peer's tip
+		if len(resp.Headers) < batchEnd-next+1 {
+			break
+		}
+		next = batchEnd + 1
+	}
+
+	return headers, nil
+}
+
+// findHeaderAncestor returns the highest local block index the header chain agrees with (-1 if none)
+func (msm *MeshSyncManager) findHeaderAncestor(headers []*chain.BlockHeader, currentLength int) (int, error) {
+	ancestor := -1
+
+	// The first header may link to a block we already have
+	if first := headers[0]; first.Index > 0 && first.Index-1 < currentLength {
+		local, err := msm.blockchain.GetBlockByIndex(first.Index - 1)
+		if err != nil {
+			return -1, fmt.Errorf("failed to get local block %d: %w", first.Index-1, err)
+		}
+		if local.Hash == first.PrevHash {
+			ancestor = first.Index - 1
+		}
+	}
+
+	// Walk the overlapping headers until the chains diverge
+	for _, header := range headers {
+		if header.Index >= currentLength || header.Index != ancestor+1 {
+			break
+		}
+		local, err := msm.blockchain.GetBlockByIndex(header.Index)
+		if err != nil {
+			return -1, fmt.Errorf("failed to get local block %d: %w", header.Index, err)
+		}
+		if local.Hash != header.Hash {
+			break
+		}
+		ancestor = header.Index
+	}
+
+	return ancestor, nil
+}
+
+// splitRanges splits the blocks covered by a header chain into download ranges
+func splitRanges(headers []*chain.BlockHeader, size int) []blockRange {
+	var ranges []blockRange
+	for i := 0; i < len(headers); i += size {
+		end := i + size - 1
+		if end >= len(headers) {
+			end = len(headers) - 1
+		}
+		ranges = append(ranges, blockRange{start: headers[i].Index, end: headers[end].Index})
+	}
+	return ranges
+}
+
+// fetchRange requests one range of blocks and checks it against the header chain
+func (msm *MeshSyncManager) fetchRange(peer *MeshPeer, rng blockRange, headerAt func(index int) *chain.BlockHeader) ([]*chain.Block, error) {
+	resp, err := msm.sendSyncRequest(peer, chain.ChainSyncRequest{
+		FromIndex: rng.start,
+		ToIndex:   rng.end,
+		NodeID:    msm.trustNetwork.NodeID,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Blocks) != rng.end-rng.start+1 {
+		return nil, fmt.Errorf("got %d blocks for range %d-%d", len(resp.Blocks), rng.start, rng.end)
+	}
+	for i, block := range resp.Blocks {
+		header := headerAt(rng.start + i)
+		if block == nil || block.Index != header.Index || block.Hash != header.Hash || block.PrevHash != header.PrevHash ||
+			block.PostsRoot != header.PostsRoot || block.TransfersRoot != header.TransfersRoot {
+			return nil, fmt.Errorf("block %d does not match header chain", rng.start+i)
+		}
+		if block.CalculateHash() != block.Hash {
+			return nil, fmt.Errorf("block %d has invalid hash", block.Index)
+		}
+	}
+
+	return resp.Blocks, nil
+}
+
+// downloadBlocks fetches the blocks for a header chain from several peers in parallel
+// Ranges are handed out to one worker per peer; a range that fails or times out is
+// requeued for any worker. Completed ranges are passed to connect strictly in order.
+func (msm *MeshSyncManager) downloadBlocks(headers []*chain.BlockHeader, peers []*MeshPeer, connect func(blocks []*chain.Block) error) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	if len(peers) == 0 {
+		return fmt.Errorf("no peers to download blocks from")
+	}
+
+	firstIndex := headers[0].Index
+	headerAt := func(index int) *chain.BlockHeader {
+		return headers[index-firstIndex]
+	}
+
+	ranges := splitRanges(headers, msm.blockBatchSize)
+	queue := make(chan blockRange, len(ranges))
+	for _, rng := range ranges {
+		queue <- rng
+	}
+	results := make(chan rangeResult)
+	done := make(chan struct{})
+	defer close(done)
+
+	msm.updateProgress(func(p *SyncProgress) {
+		p.Phase = SyncPhaseBlocks
+		p.BlocksRequested = len(headers)
+		p.PendingRanges = len(ranges)
+		p.DownloadPeers = len(peers)
+	})
+
+	worker := func(peer *MeshPeer) {
+		failures := 0
+		for {
+			var rng blockRange
+			select {
+			case <-done:
+				return
+			case rng = <-queue:
+			}
+
+			blocks, err := msm.fetchRange(peer, rng, headerAt)
+			if err != nil {
+				failures++
+			}
+			result := rangeResult{rng: rng, blocks: blocks, err: err, peer: peer.Address, retired: failures >= maxPeerDownloadFailures}
+			select {
+			case <-done:
+				return
+			case results <- result:
+			}
+			if result.retired {
+				return
+			}
+		}
+	}
+	for _, peer := range peers {
+		go worker(peer)
+	}
+
+	activeWorkers := len(peers)
+	ready := make(map[int][]*chain.Block)
+	next := firstIndex
+	lastIndex := headers[len(headers)-1].Index
+
+	for next <= lastIndex {
+		if activeWorkers == 0 {
+			return fmt.Errorf("all download peers failed with blocks %d-%d outstanding", next, lastIndex)
+		}
+
+		result := <-results
+		if result.retired {
+			activeWorkers--
+			log.Printf("[MeshSync] Dropping %s from block download after repeated failures", result.peer)
+		}
+		if result.err != nil {
+			log.Printf("[MeshSync] Range %d-%d from %s failed, re-requesting: %v", result.rng.start, result.rng.end, result.peer, result.err)
+			msm.updatePeerTrust(result.peer, false)
+			msm.updateProgress(func(p *SyncProgress) { p.Retries++ })
+			queue <- result.rng
+			continue
+		}
+
+		ready[result.rng.start] = result.blocks
+		msm.updateProgress(func(p *SyncProgress) {
+			p.BlocksDownloaded += len(result.blocks)
+			p.PendingRanges--
+		})
+
+		// Connect every range that is now contiguous with the chain
+		for blocks, ok := ready[next]; ok; blocks, ok = ready[next] {
+			delete(ready, next)
+			if err := connect(blocks); err != nil {
+				return err
+			}
+			next += len(blocks)
+			msm.updateProgress(func(p *SyncProgress) { p.BlocksConnected += len(blocks) })
+		}
+	}
+
+	return nil
+}
+
+// downloadPeers returns the peers to download blocks from, starting with the header peer
+func (msm *MeshSyncManager) downloadPeers(headerPeer *MeshPeer) []*MeshPeer {
+	peers := []*MeshPeer{headerPeer}
+	for _, peer := range msm.getBestPeersForSync(msm.maxConcurrentSync) {
+		if len(peers) >= msm.maxConcurrentSync {
+			break
+		}
+		if peer.Address != headerPeer.Address {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
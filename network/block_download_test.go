@@ -0,0 +1,181 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// copyChain integrates all of src's blocks after genesis into dst
+func copyChain(t *testing.T, src, dst *TrustNetwork) {
+	blocks, err := src.Blockchain.GetAllBlocks()
+	if err != nil {
+		t.Fatalf("Failed to get blocks: %v", err)
+	}
+	if _, _, err := dst.Blockchain.IntegrateBlocksFromSync(blocks[1:]); err != nil {
+		t.Fatalf("Failed to copy chain: %v", err)
+	}
+}
+
+// addSyncPeer registers a connected peer in the node's peer table
+func addSyncPeer(tn *TrustNetwork, address string) {
+	tn.PeerTable.AddPeer(address, 1, "", 0.8)
+	tn.PeerTable.MarkConnected(address)
+}
+
+func TestHeadersFirstParallelDownload(t *testing.T) {
+	nodeA := newTestTrustNetwork(t, "ibd_a")
+	nodeC := newTestTrustNetwork(t, "ibd_c")
+	nodeB := newTestTrustNetwork(t, "ibd_b")
+
+	var tip *chain.Block
+	for _, content := range []string{"one", "two", "three", "four", "five", "six", "seven"} {
+		tip = appendTestBlock(t, nodeA, content)
+	}
+	copyChain(t, nodeA, nodeC)
+
+	connectTestNetworks(nodeA, nodeB)
+	connectTestNetworks(nodeC, nodeB)
+	addSyncPeer(nodeB, nodeA.NodeID)
+	addSyncPeer(nodeB, nodeC.NodeID)
+
+	// Small batches so headers and blocks both take several requests
+	msm := nodeB.MeshSyncManager
+	msm.headerBatchSize = 3
+	msm.blockBatchSize = 2
+
+	result, err := msm.SyncFromPeer(&MeshPeer{Address: nodeA.NodeID}, 2, -1)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.BlocksAdded != 7 {
+		t.Errorf("Expected 7 blocks added, got %d", result.BlocksAdded)
+	}
+
+	latest, err := nodeB.Blockchain.GetLatestBlock()
+	if err != nil || latest.Hash != tip.Hash {
+		t.Fatalf("Expected node B to reach tip %s", tip.Hash)
+	}
+
+	progress := msm.GetSyncProgress()
+	if progress.Phase != SyncPhaseDone || progress.HeadersDownloaded != 7 || progress.BlocksConnected != 7 || progress.TargetHeight != 8 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+	if progress.DownloadPeers != 2 || progress.PendingRanges != 0 {
+		t.Errorf("Expected 2 download peers and no pending ranges: %+v", progress)
+	}
+	if stats := msm.GetSyncStats(); stats["mesh_sync_progress"].(SyncProgress).BlocksConnected != 7 {
+		t.Errorf("Expected progress in sync stats, got %+v", stats["mesh_sync_progress"])
+	}
+}
+
+func TestBlockDownloadRerequestsTimedOutRanges(t *testing.T) {
+	nodeA := newTestTrustNetwork(t, "ibd_timeout_a")
+	nodeB := newTestTrustNetwork(t, "ibd_timeout_b")
+
+	var tip *chain.Block
+	for _, content := range []string{"one", "two", "three", "four", "five", "six"} {
+		tip = appendTestBlock(t, nodeA, content)
+	}
+	connectTestNetworks(nodeA, nodeB)
+	addSyncPeer(nodeB, nodeA.NodeID)
+
+	// A connected peer that never answers
+	local, remote := net.Pipe()
+	t.Cleanup(func() { local.Close(); remote.Close() })
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := remote.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	nodeB.MeshManager.mu.Lock()
+	nodeB.MeshManager.connections["silent"] = &MeshConnection{Address: "silent", Conn: local, IsConnected: true}
+	nodeB.MeshManager.mu.Unlock()
+	addSyncPeer(nodeB, "silent")
+
+	msm := nodeB.MeshSyncManager
+	msm.blockBatchSize = 1
+	msm.syncTimeout = 200 * time.Millisecond
+
+	result, err := msm.SyncFromPeer(&MeshPeer{Address: nodeA.NodeID}, 2, -1)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.BlocksAdded != 6 {
+		t.Errorf("Expected 6 blocks added, got %d", result.BlocksAdded)
+	}
+
+	latest, err := nodeB.Blockchain.GetLatestBlock()
+	if err != nil || latest.Hash != tip.Hash {
+		t.Fatalf("Expected node B to reach tip %s", tip.Hash)
+	}
+	if progress := msm.GetSyncProgress(); progress.Retries == 0 {
+		t.Errorf("Expected ranges from the silent peer to be re-requested: %+v", progress)
+	}
+}
+
+func TestHeadersFirstSyncReorganizesToPeerFork(t *testing.T) {
+	nodeA := newTestTrustNetwork(t, "ibd_fork_a")
+	nodeB := newTestTrustNetwork(t, "ibd_fork_b")
+
+	// Node B has its own block 2; node A has a longer chain forking at the shared block 1
+	appendTestBlock(t, nodeB, "local")
+	appendTestBlock(t, nodeA, "remote one")
+	appendTestBlock(t, nodeA, "remote two")
+	tip := appendTestBlock(t, nodeA, "remote three")
+
+	connectTestNetworks(nodeA, nodeB)
+
+	// Periodic sync asks for blocks past our tip; the headers do not connect
+	result, err := nodeB.MeshSyncManager.SyncFromPeer(&MeshPeer{Address: nodeA.NodeID}, 3, -1)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.BlocksAdded != 3 {
+		t.Errorf("Expected 3 blocks added, got %d", result.BlocksAdded)
+	}
+
+	latest, err := nodeB.Blockchain.GetLatestBlock()
+	if err != nil || latest.Hash != tip.Hash {
+		t.Fatalf("Expected node B to reorganize to node A's tip %s", tip.Hash)
+	}
+}
+
+func TestHeadersFirstSyncSkipsLighterFork(t *testing.T) {
+	nodeA := newTestTrustNetwork(t, "ibd_light_a")
+	nodeB := newTestTrustNetwork(t, "ibd_light_b")
+
+	// Node A's fork is longer but burns fewer characters than node B's block 2
+	local := appendTestBlock(t, nodeB, "a local post burning many more characters")
+	appendTestBlock(t, nodeA, "one")
+	appendTestBlock(t, nodeA, "two")
+	appendTestBlock(t, nodeA, "six")
+
+	connectTestNetworks(nodeA, nodeB)
+
+	// The branch is refused on its headers, before any block is downloaded
+	if _, err := nodeB.MeshSyncManager.SyncFromPeer(&MeshPeer{Address: nodeA.NodeID}, 3, -1); err == nil || !strings.Contains(err.Error(), "burn score") {
+		t.Fatalf("Expected the lighter fork to be refused on its burn score, got %v", err)
+	}
+	if progress := nodeB.MeshSyncManager.GetSyncProgress(); progress.BlocksConnected != 0 {
+		t.Errorf("Expected no blocks downloaded for a lighter fork: %+v", progress)
+	}
+	if latest, err := nodeB.Blockchain.GetLatestBlock(); err != nil || latest.Hash != local.Hash {
+		t.Error("Expected node B to keep its own chain")
+	}
+
+	// Branches longer than the reorg limit are refused outright
+	headers := make([]*chain.BlockHeader, chain.MaxReorgBlocks+1)
+	for i := range headers {
+		headers[i] = &chain.BlockHeader{Index: i + 2, CharCount: 1000}
+	}
+	if err := nodeB.Blockchain.CheckBranchHeaders(1, headers); err == nil {
+		t.Error("Expected a branch past the reorg limit to be refused")
+	}
+}
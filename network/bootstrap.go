@@ -111,6 +111,25 @@ func (bm *BootstrapManager) AddNode(address, description, region string, isBeaco
 	return bm.SaveConfig()
 }
 
+// AddSeeds falls back to a network's seed nodes when the config file lists none
+// Seeds are not written back to the config file.
+func (bm *BootstrapManager) AddSeeds(addresses []string) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if len(bm.Nodes) > 0 {
+		return
+	}
+	for _, address := range addresses {
+		bm.Nodes = append(bm.Nodes, &BootstrapNode{
+			Address:     address,
+			Description: "Network seed node",
+			IsBeacon:    true,
+			TrustScore:  0.9,
+		})
+	}
+}
+
 // RemoveNode removes a bootstrap node
 func (bm *BootstrapManager) RemoveNode(address string) error {
 	bm.mu.Lock()
@@ -0,0 +1,158 @@
+package network
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// MessageEnvelope is the wire form of a NetworkMessage
+// The payload is kept raw until a decoder registered for the message type turns it
+// back into the concrete type the handlers expect.
+type MessageEnvelope struct {
+	Type      MessageType
+	Source    string
+	Payload   json.RawMessage
+	Timestamp int64
+	TTL       int
+}
+
+// PayloadDecoder decodes the raw payload of a network message into its typed form
+type PayloadDecoder func(raw json.RawMessage) (interface{}, error)
+
+var (
+	payloadDecoders   = make(map[MessageType]PayloadDecoder)
+	payloadDecodersMu sync.RWMutex
+)
+
+func init() {
+	RegisterPayloadDecoder(MessageTypeGossip, func(raw json.RawMessage) (interface{}, error) {
+		var peers []*MeshPeer
+		if err := unmarshalPayload(raw, &peers); err != nil {
+			return nil, err
+		}
+		return peers, nil
+	})
+	RegisterPayloadDecoder(MessageTypePost, func(raw json.RawMessage) (interface{}, error) {
+		post := &chain.Post{}
+		if err := unmarshalEntryPayload(raw, post); err != nil {
+			return nil, err
+		}
+		return post, nil
+	})
+	RegisterPayloadDecoder(MessageTypeTransfer, func(raw json.RawMessage) (interface{}, error) {
+		transfer := &chain.Transfer{}
+		if err := unmarshalEntryPayload(raw, transfer); err != nil {
+			return nil, err
+		}
+		return transfer, nil
+	})
+	RegisterPayloadDecoder(MessageTypeBlock, func(raw json.RawMessage) (interface{}, error) {
+		block := &chain.Block{}
+		if err := unmarshalEntryPayload(raw, block); err != nil {
+			return nil, err
+		}
+		return block, nil
+	})
+	RegisterPayloadDecoder(MessageTypeSyncRequest, func(raw json.RawMessage) (interface{}, error) {
+		req := &SyncRequestMessage{}
+		if err := unmarshalPayload(raw, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	})
+	RegisterPayloadDecoder(MessageTypeSyncResponse, func(raw json.RawMessage) (interface{}, error) {
+		resp := &SyncResponseMessage{}
+		if err := unmarshalPayload(raw, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+	RegisterPayloadDecoder(MessageTypePing, decodeNoPayload)
+	RegisterPayloadDecoder(MessageTypePong, decodeNoPayload)
+}
+
+// RegisterPayloadDecoder registers the payload decoder for a message type
+func RegisterPayloadDecoder(msgType MessageType, decoder PayloadDecoder) {
+	payloadDecodersMu.Lock()
+	defer payloadDecodersMu.Unlock()
+	payloadDecoders[msgType] = decoder
+}
+
+// unmarshalPayload decodes a required payload
+func unmarshalPayload(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return fmt.Errorf("missing payload")
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// unmarshalEntryPayload decodes a required post, transfer or block payload from its wire form
+func unmarshalEntryPayload(raw json.RawMessage, v encoding.BinaryUnmarshaler) error {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return fmt.Errorf("missing payload")
+	}
+	return chain.DecodeWire(raw, v)
+}
+
+// decodeNoPayload is used for message types that carry no payload
+func decodeNoPayload(raw json.RawMessage) (interface{}, error) {
+	return nil, nil
+}
+
+// EncodeNetworkMessage encodes a NetworkMessage into its wire form
+// Chain entries are sent in their canonical encoding, everything else as JSON.
+func EncodeNetworkMessage(msg *NetworkMessage) ([]byte, error) {
+	var payload json.RawMessage
+	var err error
+	switch entry := msg.Payload.(type) {
+	case *chain.Post, *chain.Transfer, *chain.Block:
+		payload, err = chain.EncodeWire(entry.(encoding.BinaryMarshaler))
+	default:
+		payload, err = json.Marshal(msg.Payload)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	envelope := MessageEnvelope{
+		Type:      msg.Type,
+		Source:    msg.Source,
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		TTL:       msg.TTL,
+	}
+	return json.Marshal(envelope)
+}
+
+// DecodeNetworkMessage decodes a NetworkMessage and its typed payload from its wire form
+func DecodeNetworkMessage(data []byte) (NetworkMessage, error) {
+	var envelope MessageEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return NetworkMessage{}, fmt.Errorf("failed to unmarshal envelope: %w", err)
+	}
+
+	payloadDecodersMu.RLock()
+	decoder, exists := payloadDecoders[envelope.Type]
+	payloadDecodersMu.RUnlock()
+	if !exists {
+		return NetworkMessage{}, fmt.Errorf("no payload decoder for message type %d", envelope.Type)
+	}
+
+	payload, err := decoder(envelope.Payload)
+	if err != nil {
+		return NetworkMessage{}, fmt.Errorf("failed to decode payload for message type %d: %w", envelope.Type, err)
+	}
+
+	return NetworkMessage{
+		Type:      envelope.Type,
+		Source:    envelope.Source,
+		Payload:   payload,
+		Timestamp: envelope.Timestamp,
+		TTL:       envelope.TTL,
+	}, nil
+}
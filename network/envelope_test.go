@@ -0,0 +1,235 @@
+package network
+
+import (
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/blockchain"
+	"github.com/blindxfish/truthchain/chain"
+	"github.com/blindxfish/truthchain/store"
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+func TestEnvelopeDecodesTypedPayloads(t *testing.T) {
+	post := &chain.Post{Author: "author", Content: "hello", Timestamp: 1, Signature: "sig"}
+	post.SetHash()
+	transfer := &chain.Transfer{From: "from", To: "to", Amount: 5, GasFee: 1, Timestamp: 1, Nonce: 1, Hash: "hash"}
+	block := chain.CreateGenesisBlock()
+	peers := []*MeshPeer{{Address: "10.0.0.1:9876", HopDistance: 1, TrustScore: 0.7}}
+
+	testCases := []struct {
+		msgType MessageType
+		payload interface{}
+		check   func(payload interface{}) bool
+	}{
+		{MessageTypeGossip, peers, func(p interface{}) bool {
+			decoded, ok := p.([]*MeshPeer)
+			return ok && len(decoded) == 1 && decoded[0].Address == "10.0.0.1:9876"
+		}},
+		{MessageTypePost, post, func(p interface{}) bool {
+			decoded, ok := p.(*chain.Post)
+			return ok && decoded.Hash == post.Hash
+		}},
+		{MessageTypeTransfer, transfer, func(p interface{}) bool {
+			decoded, ok := p.(*chain.Transfer)
+			return ok && decoded.Hash == transfer.Hash && decoded.Amount == 5
+		}},
+		{MessageTypeBlock, block, func(p interface{}) bool {
+			decoded, ok := p.(*chain.Block)
+			return ok && decoded.Hash == block.Hash
+		}},
+		{MessageTypePing, nil, func(p interface{}) bool { return p == nil }},
+		{MessageTypePong, nil, func(p interface{}) bool { return p == nil }},
+	}
+
+	for _, tc := range testCases {
+		data, err := EncodeNetworkMessage(&NetworkMessage{Type: tc.msgType, Source: "node", Payload: tc.payload, Timestamp: 42, TTL: 3})
+		if err != nil {
+			t.Fatalf("Failed to encode message type %d: %v", tc.msgType, err)
+		}
+
+		msg, err := DecodeNetworkMessage(data)
+		if err != nil {
+			t.Fatalf("Failed to decode message type %d: %v", tc.msgType, err)
+		}
+		if msg.Type != tc.msgType || msg.Source != "node" || msg.Timestamp != 42 || msg.TTL != 3 {
+			t.Errorf("Envelope fields mismatch for message type %d: %+v", tc.msgType, msg)
+		}
+		if !tc.check(msg.Payload) {
+			t.Errorf("Payload for message type %d decoded as %T", tc.msgType, msg.Payload)
+		}
+	}
+
+	// Missing payloads and unknown types are rejected
+	data, _ := EncodeNetworkMessage(&NetworkMessage{Type: MessageTypePost})
+	if _, err := DecodeNetworkMessage(data); err == nil {
+		t.Error("Expected post message without payload to be rejected")
+	}
+	data, _ = EncodeNetworkMessage(&NetworkMessage{Type: MessageType(99)})
+	if _, err := DecodeNetworkMessage(data); err == nil {
+		t.Error("Expected unknown message type to be rejected")
+	}
+}
+
+// newTestTrustNetwork creates a running trust network backed by a fresh blockchain
+var (
+	testAuthorOnce   sync.Once
+	testAuthorWallet *wallet.Wallet
+	testAuthorErr    error
+)
+
+// testNetworkID is the network test nodes run; its blocks carry Merkle roots from genesis
+const testNetworkID = chain.RegtestNetworkID
+
+// testAuthor returns the wallet funded by block 1 of every test node
+func testAuthor(t *testing.T) *wallet.Wallet {
+	testAuthorOnce.Do(func() {
+		testAuthorWallet, testAuthorErr = wallet.NewTestnetWallet("")
+	})
+	if testAuthorErr != nil {
+		t.Fatalf("Failed to create wallet: %v", testAuthorErr)
+	}
+	return testAuthorWallet
+}
+
+// saveTestFundingBlock stores the block 1 shared by every test node, which mints the test author's funds
+// The block is identical on every node, so syncing nodes skip it rather than execute it.
+func saveTestFundingBlock(t *testing.T, storage *store.BoltDBStorage, genesis *chain.Block) {
+	funds := chain.UptimeReward{Recipient: testAuthor(t).GetAddress(), Amount: 1000000, Timestamp: genesis.Timestamp + 1}
+	funds.SetHash()
+
+	state := chain.NewStateManagerWithStore(storage)
+	if err := state.ApplyReward(funds); err != nil {
+		t.Fatalf("Failed to fund test author: %v", err)
+	}
+	stateRoot, err := state.CalculateStateRoot(1, chain.ConsensusParamsAt(testNetworkID, 1))
+	if err != nil {
+		t.Fatalf("Failed to calculate state root: %v", err)
+	}
+
+	block := chain.CreateBlockWithRewards(chain.ConsensusParamsAt(testNetworkID, 1), 1, genesis.Hash, []chain.Post{}, []chain.Transfer{}, []chain.UptimeReward{funds}, stateRoot)
+	block.Timestamp = funds.Timestamp
+	block.SetHash()
+	if err := storage.SaveBlock(block); err != nil {
+		t.Fatalf("Failed to save funding block: %v", err)
+	}
+}
+
+func newTestTrustNetwork(t *testing.T, nodeID string) *TrustNetwork {
+	dbPath := "test_" + nodeID + ".db"
+	os.Remove(dbPath)
+	t.Cleanup(func() { os.Remove(dbPath) })
+
+	storage, err := store.NewBoltDBStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	network, _ := chain.GetNetwork(testNetworkID)
+	genesis := network.GenesisBlock()
+	if err := storage.SaveBlock(genesis); err != nil {
+		t.Fatalf("Failed to save genesis block: %v", err)
+	}
+	saveTestFundingBlock(t, storage, genesis)
+	bc, err := blockchain.NewBlockchain(storage, 2, testNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to create blockchain: %v", err)
+	}
+
+	w, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+
+	tn := NewTrustNetwork(nodeID, w, storage, nil, bc, 0, "missing-bootstrap.json")
+	tn.NetworkID = testNetworkID
+	tn.MeshManager = NewMeshManager(tn)
+	tn.IsRunning = true
+	return tn
+}
+
+// connectTestNetworks links two trust networks over an in-memory mesh connection
+func connectTestNetworks(a, b *TrustNetwork) {
+	connA, connB := net.Pipe()
+	meshA := &MeshConnection{Address: b.NodeID, Conn: connA, IsConnected: true, LastPing: time.Now()}
+	meshB := &MeshConnection{Address: a.NodeID, Conn: connB, IsConnected: true, LastPing: time.Now()}
+
+	a.MeshManager.connections[meshA.Address] = meshA
+	b.MeshManager.connections[meshB.Address] = meshB
+	go a.MeshManager.handleConnection(meshA)
+	go b.MeshManager.handleConnection(meshB)
+}
+
+// waitFor polls until condition holds or the timeout expires
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func TestMessagesBetweenTrustNetworks(t *testing.T) {
+	nodeA := newTestTrustNetwork(t, "node_a")
+	nodeB := newTestTrustNetwork(t, "node_b")
+	connectTestNetworks(nodeA, nodeB)
+	go nodeB.messageProcessor()
+	t.Cleanup(func() { close(nodeB.StopChan) })
+
+	author := testAuthor(t)
+	recipient, err := wallet.NewTestnetWallet("")
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+
+	// Post
+	post, err := nodeA.Blockchain.CreatePost("hello from node a", author)
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if err := nodeA.BroadcastPost(post); err != nil {
+		t.Fatalf("Failed to broadcast post: %v", err)
+	}
+	waitFor(t, "post on node b", func() bool {
+		return nodeB.Blockchain.GetPendingPostByHash(post.Hash) != nil
+	})
+
+	// Transfer
+	transfer, err := nodeA.Blockchain.CreateTransfer(recipient.GetAddress(), 10, author)
+	if err != nil {
+		t.Fatalf("Failed to create transfer: %v", err)
+	}
+	if err := nodeA.BroadcastTransfer(transfer); err != nil {
+		t.Fatalf("Failed to broadcast transfer: %v", err)
+	}
+	waitFor(t, "transfer on node b", func() bool {
+		return nodeB.Blockchain.Mempool.Count() == 1
+	})
+
+	// Gossip
+	nodeA.PeerTable.AddPeer("10.0.0.1:9876", 1, "", 0.7)
+	nodeA.sendGossip()
+	waitFor(t, "gossiped peer on node b", func() bool {
+		_, exists := nodeB.PeerTable.GetPeer("10.0.0.1:9876")
+		return exists
+	})
+
+	// Blocks node A creates are announced to its peers
+	nodeA.Blockchain.SetBlockAnnouncer(nodeA)
+	blocks, err := nodeA.Blockchain.GenerateBlocks(1)
+	if err != nil {
+		t.Fatalf("Failed to generate block: %v", err)
+	}
+	block := blocks[0]
+	waitFor(t, "block on node b", func() bool {
+		latest, err := nodeB.Blockchain.GetLatestBlock()
+		return err == nil && latest.Hash == block.Hash
+	})
+}
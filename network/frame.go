@@ -0,0 +1,123 @@
+package network
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Mesh wire protocol framing
+//
+// Every message on the mesh port is sent as a frame:
+//
+//	magic (4) | network (4) | type (1) | length (4) | checksum (4) | payload (length)
+//
+// The network field is the first 4 bytes of sha256(networkID) so nodes on
+// different networks reject each other's traffic. The checksum is the first
+// 4 bytes of double sha256 of the payload.
+const (
+	FrameMagic      uint32 = 0x54434846 // "TCHF"
+	FrameHeaderSize        = 17
+	MaxFrameSize           = 8 * 1024 * 1024 // 8MB max payload
+)
+
+// FrameType identifies the kind of payload carried by a frame
+type FrameType uint8
+
+const (
+	FrameTypeMessage   FrameType = iota + 1 // JSON encoded NetworkMessage
+	FrameTypePing                           // Ping with an 8-byte timestamp
+	FrameTypePong                           // Pong echoing the ping timestamp
+	FrameTypeHandshake                      // JSON encoded handshake step
+)
+
+// NetworkMagic returns the 4-byte network identifier used in frame headers
+func NetworkMagic(networkID string) [4]byte {
+	var magic [4]byte
+	hash := sha256.Sum256([]byte(networkID))
+	copy(magic[:], hash[:4])
+	return magic
+}
+
+// frameChecksum returns the first 4 bytes of double sha256 of the payload
+func frameChecksum(payload []byte) [4]byte {
+	var checksum [4]byte
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	copy(checksum[:], second[:4])
+	return checksum
+}
+
+// EncodeFrame builds a complete frame for the given payload
+func EncodeFrame(networkID string, frameType FrameType, payload []byte) ([]byte, error) {
+	if len(payload) > MaxFrameSize {
+		return nil, fmt.Errorf("frame payload too large: %d bytes (max %d)", len(payload), MaxFrameSize)
+	}
+
+	frame := make([]byte, FrameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], FrameMagic)
+	magic := NetworkMagic(networkID)
+	copy(frame[4:8], magic[:])
+	frame[8] = byte(frameType)
+	binary.BigEndian.PutUint32(frame[9:13], uint32(len(payload)))
+	checksum := frameChecksum(payload)
+	copy(frame[13:17], checksum[:])
+	copy(frame[FrameHeaderSize:], payload)
+
+	return frame, nil
+}
+
+// WriteFrame writes a single frame to w
+func WriteFrame(w io.Writer, networkID string, frameType FrameType, payload []byte) error {
+	frame, err := EncodeFrame(networkID, frameType, payload)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(frame); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	return nil
+}
+
+// ReadFrame reads a single frame from r and verifies its header and checksum
+// Any error means the stream can no longer be trusted and the connection should be closed.
+func ReadFrame(r io.Reader, networkID string) (FrameType, []byte, error) {
+	header := make([]byte, FrameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	if magic := binary.BigEndian.Uint32(header[0:4]); magic != FrameMagic {
+		return 0, nil, fmt.Errorf("invalid frame magic: %08x", magic)
+	}
+
+	expectedNetwork := NetworkMagic(networkID)
+	if !bytes.Equal(header[4:8], expectedNetwork[:]) {
+		return 0, nil, fmt.Errorf("frame from a different network: %x", header[4:8])
+	}
+
+	frameType := FrameType(header[8])
+	if frameType < FrameTypeMessage || frameType > FrameTypeHandshake {
+		return 0, nil, fmt.Errorf("unknown frame type: %d", frameType)
+	}
+
+	length := binary.BigEndian.Uint32(header[9:13])
+	if length > MaxFrameSize {
+		return 0, nil, fmt.Errorf("frame payload too large: %d bytes (max %d)", length, MaxFrameSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("failed to read frame payload: %w", err)
+	}
+
+	checksum := frameChecksum(payload)
+	if !bytes.Equal(header[13:17], checksum[:]) {
+		return 0, nil, fmt.Errorf("frame checksum mismatch")
+	}
+
+	return frameType, payload, nil
+}
@@ -0,0 +1,165 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+
+	// Two frames written back to back must be read back separately
+	large := []byte(strings.Repeat("x", 10000))
+	if err := WriteFrame(&buf, chain.MainnetNetworkID, FrameTypeMessage, large); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	if err := WriteFrame(&buf, chain.MainnetNetworkID, FrameTypePing, []byte("ping")); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+
+	frameType, payload, err := ReadFrame(&buf, chain.MainnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to read first frame: %v", err)
+	}
+	if frameType != FrameTypeMessage || !bytes.Equal(payload, large) {
+		t.Errorf("First frame mismatch: type %d, %d bytes", frameType, len(payload))
+	}
+
+	frameType, payload, err = ReadFrame(&buf, chain.MainnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to read second frame: %v", err)
+	}
+	if frameType != FrameTypePing || string(payload) != "ping" {
+		t.Errorf("Second frame mismatch: type %d, payload %q", frameType, payload)
+	}
+
+	if _, _, err := ReadFrame(&buf, chain.MainnetNetworkID); err != io.EOF {
+		t.Errorf("Expected EOF after last frame, got %v", err)
+	}
+}
+
+func TestReadFrameRejectsMalformed(t *testing.T) {
+	valid, err := EncodeFrame(chain.MainnetNetworkID, FrameTypeMessage, []byte("{}"))
+	if err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+
+	corrupt := func(modify func(frame []byte)) []byte {
+		frame := append([]byte(nil), valid...)
+		modify(frame)
+		return frame
+	}
+
+	testCases := []struct {
+		name  string
+		frame []byte
+	}{
+		{"bad magic", corrupt(func(f []byte) { f[0] ^= 0xff })},
+		{"unknown type", corrupt(func(f []byte) { f[8] = 0x7f })},
+		{"bad checksum", corrupt(func(f []byte) { f[FrameHeaderSize] ^= 0xff })},
+		{"oversized", corrupt(func(f []byte) { binary.BigEndian.PutUint32(f[9:13], MaxFrameSize+1) })},
+		{"truncated", valid[:FrameHeaderSize+1]},
+		{"http request", []byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")},
+	}
+
+	for _, tc := range testCases {
+		if _, _, err := ReadFrame(bytes.NewReader(tc.frame), chain.MainnetNetworkID); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+
+	// Frames from another network are rejected
+	if _, _, err := ReadFrame(bytes.NewReader(valid), chain.TestnetNetworkID); err == nil {
+		t.Error("Expected frame from another network to be rejected")
+	}
+
+	// Oversized payloads cannot be encoded
+	if _, err := EncodeFrame(chain.MainnetNetworkID, FrameTypeMessage, make([]byte, MaxFrameSize+1)); err == nil {
+		t.Error("Expected oversized payload to be rejected")
+	}
+}
+
+// newFramedTestConnection connects a mesh manager to one end of an in-memory pipe
+func newFramedTestConnection(t *testing.T) (*TrustNetwork, *MeshManager, net.Conn) {
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+
+	tn := NewTrustNetwork("node-a", w, nil, nil, nil, 0, "missing-bootstrap.json")
+	mm := NewMeshManager(tn)
+
+	local, remote := net.Pipe()
+	meshConn := &MeshConnection{
+		Address:     "peer-b",
+		Conn:        local,
+		IsConnected: true,
+		LastPing:    time.Now(),
+	}
+	mm.connections[meshConn.Address] = meshConn
+	go mm.handleConnection(meshConn)
+
+	t.Cleanup(func() { remote.Close() })
+	return tn, mm, remote
+}
+
+func TestMeshConnectionFraming(t *testing.T) {
+	tn, _, remote := newFramedTestConnection(t)
+
+	// A message larger than the old 4KB read buffer and a second message in the same write
+	first, _ := EncodeNetworkMessage(&NetworkMessage{Type: MessageTypeGossip, Source: strings.Repeat("a", 6000), Payload: []*MeshPeer{}, TTL: 3})
+	second, _ := EncodeNetworkMessage(&NetworkMessage{Type: MessageTypePing, Source: "peer-b", TTL: 1})
+	frame1, _ := EncodeFrame(chain.MainnetNetworkID, FrameTypeMessage, first)
+	frame2, _ := EncodeFrame(chain.MainnetNetworkID, FrameTypeMessage, second)
+	go remote.Write(append(frame1, frame2...))
+
+	for _, expected := range []MessageType{MessageTypeGossip, MessageTypePing} {
+		select {
+		case msg := <-tn.MessageChan:
+			if msg.Type != expected {
+				t.Errorf("Expected message type %d, got %d", expected, msg.Type)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for message type %d", expected)
+		}
+	}
+
+	// Ping frames are answered with a pong echoing the payload
+	go WriteFrame(remote, chain.MainnetNetworkID, FrameTypePing, []byte("12345678"))
+	remote.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frameType, payload, err := ReadFrame(bufio.NewReader(remote), chain.MainnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to read pong: %v", err)
+	}
+	if frameType != FrameTypePong || string(payload) != "12345678" {
+		t.Errorf("Expected pong echoing ping payload, got type %d payload %q", frameType, payload)
+	}
+}
+
+func TestMeshConnectionDropsMalformedFrame(t *testing.T) {
+	_, mm, remote := newFramedTestConnection(t)
+
+	go remote.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+
+	// The connection is closed and removed
+	remote.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := remote.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected connection to be closed after malformed frame")
+	}
+
+	mm.mu.RLock()
+	_, exists := mm.connections["peer-b"]
+	mm.mu.RUnlock()
+	if exists {
+		t.Error("Expected connection to be removed after malformed frame")
+	}
+}
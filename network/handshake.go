@@ -0,0 +1,322 @@
+package network
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/blindxfish/truthchain/blockchain"
+	"github.com/blindxfish/truthchain/wallet"
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// ProtocolVersion is the mesh protocol version spoken by this node
+const ProtocolVersion = 1
+
+// HandshakeTimeout bounds the whole handshake exchange
+const HandshakeTimeout = 10 * time.Second
+
+// errSelfConnection is returned when a node connects to itself
+var errSelfConnection = errors.New("self-connection")
+
+// NodeIdentity is what a node presents and proves during the handshake
+type NodeIdentity struct {
+	Wallet     *wallet.Wallet         // Node key used to answer challenges and derive session keys
+	NetworkID  string                 // Network the node belongs to
+	Blockchain *blockchain.Blockchain // Source of the advertised chain tip (optional)
+	Encrypt    bool                   // Offer an encrypted session
+}
+
+// PeerSession is an authenticated connection returned by the handshake
+type PeerSession struct {
+	Peer      *HandshakeHello // The peer's verified hello
+	Conn      net.Conn        // Connection to use after the handshake (encrypted if negotiated)
+	Reader    *bufio.Reader   // Buffered reader over Conn
+	Encrypted bool            // Whether the session is encrypted
+}
+
+// HandshakeHello introduces a node and challenges the peer to prove key ownership
+//
+// The exchange is:
+//
+//	initiator -> responder: hello (nonce A)
+//	responder -> initiator: hello (nonce B, signature over the transcript)
+//	initiator -> responder: proof (signature over the transcript)
+//
+// The transcript covers both hellos in full, so neither signature can be replayed
+// on another connection or relayed with a hello altered on the way.
+type HandshakeHello struct {
+	Version   int    `json:"version"`             // Protocol version
+	NetworkID string `json:"network_id"`          // Network the node belongs to
+	Address   string `json:"address"`             // Wallet address of the node
+	PublicKey string `json:"public_key"`          // Compressed public key (hex)
+	Height    int    `json:"height"`              // Best block index (-1 if no blocks)
+	BestHash  string `json:"best_hash"`           // Hash of the best block
+	Nonce     string `json:"nonce"`               // Challenge for the peer to sign (hex)
+	Encrypt   bool   `json:"encrypt,omitempty"`   // Offers an encrypted session (absent on older nodes)
+	Signature string `json:"signature,omitempty"` // Answer to the peer's challenge (responder only)
+}
+
+// HandshakeProof answers the responder's challenge
+type HandshakeProof struct {
+	Signature string `json:"signature"`
+}
+
+// Handshake roles, signed with the transcript so a proof cannot be reflected back as an answer
+const (
+	roleInitiator = "initiator"
+	roleResponder = "responder"
+)
+
+// handshakeTranscript hashes both hellos as sent, without their signatures
+// Keys, nonces and encryption offers of both sides are included, so stripping the
+// encryption offer or swapping a key makes the signatures fail.
+func handshakeTranscript(networkID string, initiator, responder *HandshakeHello) []byte {
+	h := sha256.New()
+	writeString := func(s string) {
+		binary.Write(h, binary.BigEndian, uint32(len(s)))
+		h.Write([]byte(s))
+	}
+	writeInt := func(v int) {
+		binary.Write(h, binary.BigEndian, int64(v))
+	}
+
+	writeString("truthchain-handshake")
+	writeString(networkID)
+	for _, hello := range []*HandshakeHello{initiator, responder} {
+		writeInt(hello.Version)
+		writeString(hello.NetworkID)
+		writeString(hello.Address)
+		writeString(hello.PublicKey)
+		writeInt(hello.Height)
+		writeString(hello.BestHash)
+		writeString(hello.Nonce)
+		if hello.Encrypt {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	}
+	return h.Sum(nil)
+}
+
+// handshakeChallenge returns the data a node signs in a role to prove key ownership
+func handshakeChallenge(transcript []byte, role string) []byte {
+	return append([]byte(fmt.Sprintf("truthchain-handshake:%d:%s:", ProtocolVersion, role)), transcript...)
+}
+
+// newHandshakeHello creates our hello with a fresh challenge nonce
+func (id *NodeIdentity) newHandshakeHello() (*HandshakeHello, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	hello := &HandshakeHello{
+		Version:   ProtocolVersion,
+		NetworkID: id.NetworkID,
+		Address:   id.Wallet.GetAddress(),
+		PublicKey: id.Wallet.ExportPublicKeyHex(),
+		Height:    -1,
+		Nonce:     hex.EncodeToString(nonce),
+		Encrypt:   id.Encrypt,
+	}
+
+	// Advertise our best block
+	if id.Blockchain != nil {
+		if latest, err := id.Blockchain.GetLatestBlock(); err == nil {
+			hello.Height = latest.Index
+			hello.BestHash = latest.Hash
+		}
+	}
+
+	return hello, nil
+}
+
+// signChallenge signs the handshake transcript in our role
+func (id *NodeIdentity) signChallenge(transcript []byte, role string) (string, error) {
+	signature, err := id.Wallet.Sign(handshakeChallenge(transcript, role))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign challenge: %w", err)
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+// checkHello validates a peer's hello before trusting anything in it
+func (id *NodeIdentity) checkHello(hello *HandshakeHello) (*btcec.PublicKey, error) {
+	if hello.Version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d (want %d)", hello.Version, ProtocolVersion)
+	}
+	if hello.NetworkID != id.NetworkID {
+		return nil, fmt.Errorf("network mismatch: peer is on %s, we are on %s", hello.NetworkID, id.NetworkID)
+	}
+	if hello.Address == id.Wallet.GetAddress() {
+		return nil, errSelfConnection
+	}
+	if len(hello.Nonce) != 64 {
+		return nil, fmt.Errorf("invalid challenge nonce")
+	}
+
+	pubKeyBytes, err := hex.DecodeString(hello.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	pubKey, err := btcec.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if !wallet.PublicKeyMatchesAddress(pubKey, hello.Address) {
+		return nil, fmt.Errorf("address %s does not belong to public key", hello.Address)
+	}
+
+	return pubKey, nil
+}
+
+// verifyChallenge checks that the peer signed the transcript in its role with its wallet key
+func (id *NodeIdentity) verifyChallenge(transcript []byte, role, signatureHex string, peer *HandshakeHello, pubKey *btcec.PublicKey) error {
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	valid, err := wallet.VerifySignature(handshakeChallenge(transcript, role), signature, pubKey)
+	if err != nil {
+		return fmt.Errorf("challenge verification failed: %w", err)
+	}
+	if !valid {
+		return fmt.Errorf("peer %s failed to prove key ownership", peer.Address)
+	}
+	return nil
+}
+
+// writeHandshake sends a handshake step as a frame
+func (id *NodeIdentity) writeHandshake(conn net.Conn, step interface{}) error {
+	payload, err := json.Marshal(step)
+	if err != nil {
+		return fmt.Errorf("failed to marshal handshake: %w", err)
+	}
+	return WriteFrame(conn, id.NetworkID, FrameTypeHandshake, payload)
+}
+
+// readHandshake reads a handshake step from a frame
+func (id *NodeIdentity) readHandshake(reader *bufio.Reader, step interface{}) error {
+	frameType, payload, err := ReadFrame(reader, id.NetworkID)
+	if err != nil {
+		return fmt.Errorf("failed to read handshake: %w", err)
+	}
+	if frameType != FrameTypeHandshake {
+		return fmt.Errorf("expected handshake frame, got type %d", frameType)
+	}
+	if err := json.Unmarshal(payload, step); err != nil {
+		return fmt.Errorf("invalid handshake: %w", err)
+	}
+	return nil
+}
+
+// Handshake authenticates a new connection
+// The initiator is the side that opened the connection. When both sides offer
+// encryption the returned session wraps the connection in an encrypted layer,
+// otherwise it stays plaintext so older nodes can still connect.
+func (id *NodeIdentity) Handshake(conn net.Conn, reader *bufio.Reader, initiator bool) (*PeerSession, error) {
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	ourHello, err := id.newHandshakeHello()
+	if err != nil {
+		return nil, err
+	}
+
+	var peerHello HandshakeHello
+	var pubKey *btcec.PublicKey
+
+	if initiator {
+		// Send our hello and challenge
+		if err := id.writeHandshake(conn, ourHello); err != nil {
+			return nil, err
+		}
+
+		// Receive the responder's hello with the answer to our challenge
+		if err := id.readHandshake(reader, &peerHello); err != nil {
+			return nil, err
+		}
+		pubKey, err = id.checkHello(&peerHello)
+		if err != nil {
+			return nil, err
+		}
+		transcript := handshakeTranscript(id.NetworkID, ourHello, &peerHello)
+		if err := id.verifyChallenge(transcript, roleResponder, peerHello.Signature, &peerHello, pubKey); err != nil {
+			return nil, err
+		}
+
+		// Answer the responder's challenge
+		signature, err := id.signChallenge(transcript, roleInitiator)
+		if err != nil {
+			return nil, err
+		}
+		if err := id.writeHandshake(conn, &HandshakeProof{Signature: signature}); err != nil {
+			return nil, err
+		}
+
+		return id.newPeerSession(conn, reader, &peerHello, pubKey, transcript, true)
+	}
+
+	// Receive the initiator's hello and challenge
+	if err := id.readHandshake(reader, &peerHello); err != nil {
+		return nil, err
+	}
+	pubKey, err = id.checkHello(&peerHello)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send our hello with the answer to their challenge
+	transcript := handshakeTranscript(id.NetworkID, &peerHello, ourHello)
+	ourHello.Signature, err = id.signChallenge(transcript, roleResponder)
+	if err != nil {
+		return nil, err
+	}
+	if err := id.writeHandshake(conn, ourHello); err != nil {
+		return nil, err
+	}
+
+	// Receive the answer to our challenge
+	var proof HandshakeProof
+	if err := id.readHandshake(reader, &proof); err != nil {
+		return nil, err
+	}
+	if err := id.verifyChallenge(transcript, roleInitiator, proof.Signature, &peerHello, pubKey); err != nil {
+		return nil, err
+	}
+
+	return id.newPeerSession(conn, reader, &peerHello, pubKey, transcript, false)
+}
+
+// newPeerSession sets up the session negotiated by a completed handshake
+// Both encryption offers are part of the signed transcript, so a session stays
+// plaintext only if one side really did not offer encryption; an offer stripped
+// on the path has already failed the signature checks.
+func (id *NodeIdentity) newPeerSession(conn net.Conn, reader *bufio.Reader, peer *HandshakeHello, pubKey *btcec.PublicKey, transcript []byte, initiator bool) (*PeerSession, error) {
+	if !id.Encrypt || !peer.Encrypt {
+		return &PeerSession{Peer: peer, Conn: conn, Reader: reader}, nil
+	}
+
+	send, recv, err := deriveSessionKeys(id.Wallet.PrivateKey, pubKey, transcript, initiator)
+	if err != nil {
+		return nil, err
+	}
+
+	secure := newSecureConn(conn, reader, send, recv)
+	return &PeerSession{
+		Peer:      peer,
+		Conn:      secure,
+		Reader:    bufio.NewReader(secure),
+		Encrypted: true,
+	}, nil
+}
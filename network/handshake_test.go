@@ -0,0 +1,217 @@
+package network
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+	"github.com/blindxfish/truthchain/wallet"
+)
+
+// newTestIdentity creates a node identity with a fresh wallet on the given network
+func newTestIdentity(t *testing.T, networkID string) *NodeIdentity {
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatalf("Failed to create wallet: %v", err)
+	}
+	return &NodeIdentity{Wallet: w, NetworkID: networkID, Encrypt: true}
+}
+
+// runHandshake performs a handshake between an initiator and a responder over conn pair
+func runHandshake(initiator, responder *NodeIdentity, connA, connB net.Conn) (*PeerSession, *PeerSession, error, error) {
+	type result struct {
+		session *PeerSession
+		err     error
+	}
+	responderResult := make(chan result, 1)
+	go func() {
+		session, err := responder.Handshake(connB, bufio.NewReader(connB), false)
+		if err != nil {
+			connB.Close()
+		}
+		responderResult <- result{session, err}
+	}()
+
+	initiatorSession, initiatorErr := initiator.Handshake(connA, bufio.NewReader(connA), true)
+	if initiatorErr != nil {
+		connA.Close()
+	}
+	r := <-responderResult
+	return initiatorSession, r.session, initiatorErr, r.err
+}
+
+// runPipeHandshake performs a handshake over an in-memory pipe
+func runPipeHandshake(initiator, responder *NodeIdentity) (*PeerSession, *PeerSession, error, error) {
+	connA, connB := net.Pipe()
+	defer connA.Close()
+	defer connB.Close()
+	return runHandshake(initiator, responder, connA, connB)
+}
+
+func TestHandshakeSuccess(t *testing.T) {
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := newTestIdentity(t, chain.MainnetNetworkID)
+
+	sessionA, sessionB, errA, errB := runPipeHandshake(a, b)
+	if errA != nil || errB != nil {
+		t.Fatalf("Handshake failed: initiator %v, responder %v", errA, errB)
+	}
+	helloFromB, helloFromA := sessionA.Peer, sessionB.Peer
+
+	if helloFromB.Address != b.Wallet.GetAddress() {
+		t.Errorf("Initiator saw address %s, expected %s", helloFromB.Address, b.Wallet.GetAddress())
+	}
+	if helloFromA.Address != a.Wallet.GetAddress() {
+		t.Errorf("Responder saw address %s, expected %s", helloFromA.Address, a.Wallet.GetAddress())
+	}
+	if helloFromA.Height != -1 || helloFromA.Version != ProtocolVersion {
+		t.Errorf("Unexpected hello contents: %+v", helloFromA)
+	}
+}
+
+func TestHandshakeRejectsMismatches(t *testing.T) {
+	// Different network
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := newTestIdentity(t, chain.TestnetNetworkID)
+	if _, _, errA, errB := runPipeHandshake(a, b); errA == nil || errB == nil {
+		t.Errorf("Expected handshake across networks to fail: initiator %v, responder %v", errA, errB)
+	}
+
+	// Self-connection
+	self := newTestIdentity(t, chain.MainnetNetworkID)
+	if _, _, errA, errB := runPipeHandshake(self, self); errA == nil || errB != errSelfConnection {
+		t.Errorf("Expected self-connection to be rejected: initiator %v, responder %v", errA, errB)
+	}
+
+	// Different protocol version
+	responder := newTestIdentity(t, chain.MainnetNetworkID)
+	other := newTestIdentity(t, chain.MainnetNetworkID)
+	hello, err := other.newHandshakeHello()
+	if err != nil {
+		t.Fatalf("Failed to create hello: %v", err)
+	}
+	hello.Version = ProtocolVersion + 1
+	if _, err := responder.checkHello(hello); err == nil {
+		t.Error("Expected hello with another protocol version to be rejected")
+	}
+}
+
+func TestHandshakeRejectsForgedIdentity(t *testing.T) {
+	responder := newTestIdentity(t, chain.MainnetNetworkID)
+	victim := newTestIdentity(t, chain.MainnetNetworkID)
+	attacker := newTestIdentity(t, chain.MainnetNetworkID)
+
+	// An address that does not belong to the advertised key is rejected outright
+	hello, err := attacker.newHandshakeHello()
+	if err != nil {
+		t.Fatalf("Failed to create hello: %v", err)
+	}
+	hello.Address = victim.Wallet.GetAddress()
+	if _, err := responder.checkHello(hello); err == nil {
+		t.Error("Expected hello with mismatched address and key to be rejected")
+	}
+
+	// Claiming the victim's address and key fails without the victim's private key
+	connA, connB := net.Pipe()
+	defer connA.Close()
+	defer connB.Close()
+
+	responderErr := make(chan error, 1)
+	go func() {
+		_, err := responder.Handshake(connB, bufio.NewReader(connB), false)
+		responderErr <- err
+	}()
+
+	forged, err := victim.newHandshakeHello()
+	if err != nil {
+		t.Fatalf("Failed to create hello: %v", err)
+	}
+	reader := bufio.NewReader(connA)
+	connA.SetDeadline(time.Now().Add(2 * time.Second))
+	if err := attacker.writeHandshake(connA, forged); err != nil {
+		t.Fatalf("Failed to send hello: %v", err)
+	}
+	var reply HandshakeHello
+	if err := attacker.readHandshake(reader, &reply); err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+
+	// The attacker can only sign with its own key
+	signature, err := attacker.Wallet.Sign(handshakeChallenge(handshakeTranscript(chain.MainnetNetworkID, forged, &reply), roleInitiator))
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := attacker.writeHandshake(connA, &HandshakeProof{Signature: hex.EncodeToString(signature)}); err != nil {
+		t.Fatalf("Failed to send proof: %v", err)
+	}
+
+	if err := <-responderErr; err == nil {
+		t.Error("Expected forged identity to be rejected")
+	}
+}
+
+func TestAcceptInboundConnectionRecordsPeer(t *testing.T) {
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := NewMeshManager(NewTrustNetwork("node-b", newTestIdentity(t, chain.MainnetNetworkID).Wallet, nil, nil, nil, 0, "missing-bootstrap.json"))
+
+	connA, connB := net.Pipe()
+	t.Cleanup(func() { connA.Close() })
+	go b.AcceptInboundConnection(connB, "peer-a")
+
+	if _, err := a.Handshake(connA, bufio.NewReader(connA), true); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+
+	waitFor(t, "inbound connection", func() bool {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+		conn, exists := b.connections["peer-a"]
+		return exists && conn.WalletAddress == a.Wallet.GetAddress() && conn.BestHeight == -1 && conn.Encrypted
+	})
+}
+
+func TestHandshakeSignatureBindsTranscript(t *testing.T) {
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := newTestIdentity(t, chain.MainnetNetworkID)
+	relay := newTestIdentity(t, chain.MainnetNetworkID)
+
+	helloA, err := a.newHandshakeHello()
+	if err != nil {
+		t.Fatalf("Failed to create hello: %v", err)
+	}
+	helloB, err := b.newHandshakeHello()
+	if err != nil {
+		t.Fatalf("Failed to create hello: %v", err)
+	}
+	helloRelay, err := relay.newHandshakeHello()
+	if err != nil {
+		t.Fatalf("Failed to create hello: %v", err)
+	}
+	pubKeyB, err := a.checkHello(helloB)
+	if err != nil {
+		t.Fatalf("Hello rejected: %v", err)
+	}
+
+	transcript := handshakeTranscript(chain.MainnetNetworkID, helloA, helloB)
+	signature, err := b.signChallenge(transcript, roleResponder)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := a.verifyChallenge(transcript, roleResponder, signature, helloB, pubKeyB); err != nil {
+		t.Fatalf("Valid answer rejected: %v", err)
+	}
+
+	// An answer given to the relay cannot be passed on to another initiator
+	relayed := handshakeTranscript(chain.MainnetNetworkID, helloRelay, helloB)
+	if err := a.verifyChallenge(relayed, roleResponder, signature, helloB, pubKeyB); err == nil {
+		t.Error("Expected answer from another handshake to be rejected")
+	}
+
+	// Nor replayed in the other role
+	if err := a.verifyChallenge(transcript, roleInitiator, signature, helloB, pubKeyB); err == nil {
+		t.Error("Expected answer in the wrong role to be rejected")
+	}
+}
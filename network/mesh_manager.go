@@ -2,11 +2,10 @@ package network
 
 import (
 	"bufio"
-	"encoding/json"
+	"encoding/binary"
 	"fmt"
 	"log"
 	"net"
-	"strings"
 	"sync"
 	"time"
 )
@@ -21,6 +20,22 @@ type MeshConnection struct {
 	TrustScore  float64
 	HopDistance int
 	mu          sync.RWMutex
+
+	// Peer identity and chain tip, verified during the handshake
+	WalletAddress string
+	BestHeight    int
+	BestHash      string
+	Encrypted     bool // Whether traffic is sent over an encrypted session
+
+	reader  *bufio.Reader // Buffered reader shared with the handshake
+	writeMu sync.Mutex    // Serializes frame writes
+}
+
+// writeFrame writes a single frame to the connection
+func (mc *MeshConnection) writeFrame(networkID string, frameType FrameType, payload []byte) error {
+	mc.writeMu.Lock()
+	defer mc.writeMu.Unlock()
+	return WriteFrame(mc.Conn, networkID, frameType, payload)
 }
 
 // MeshManager handles mesh peer connections and selection
@@ -34,6 +49,10 @@ type MeshManager struct {
 	connChan chan ConnectionEvent
 	stopChan chan struct{}
 
+	// Sync requests waiting for a response, keyed by request ID
+	pendingSync   map[string]*pendingSyncRequest
+	pendingSyncMu sync.Mutex
+
 	// Configuration
 	selectionInterval time.Duration
 	pingInterval      time.Duration
@@ -68,6 +87,7 @@ func NewMeshManager(network *TrustNetwork) *MeshManager {
 		targetCount:       3, // Default: maintain 3 mesh connections
 		connChan:          make(chan ConnectionEvent, 100),
 		stopChan:          make(chan struct{}),
+		pendingSync:       make(map[string]*pendingSyncRequest),
 		selectionInterval: 30 * time.Second, // Re-select peers every 30 seconds
 		pingInterval:      10 * time.Second, // Ping peers every 10 seconds
 		connectionTimeout: 5 * time.Second,  // Connection timeout
@@ -176,37 +196,27 @@ func (mm *MeshManager) establishConnection(address string) {
 		return
 	}
 
-	// --- Wallet handshake ---
-	// Send our wallet address
-	ourWallet := mm.network.Wallet.GetAddress()
-	_, err = conn.Write([]byte(ourWallet + "\n"))
+	// Authenticate the peer
+	session, err := mm.network.Identity().Handshake(conn, bufio.NewReader(conn), true)
 	if err != nil {
-		log.Printf("Failed to send handshake to %s: %v", address, err)
-		conn.Close()
-		return
-	}
-	// Read remote wallet address
-	remoteReader := bufio.NewReader(conn)
-	remoteWallet, err := remoteReader.ReadString('\n')
-	if err != nil {
-		log.Printf("Failed to read handshake from %s: %v", address, err)
-		conn.Close()
-		return
-	}
-	remoteWallet = strings.TrimSpace(remoteWallet)
-	if remoteWallet == ourWallet {
-		// Self-connection, close quietly
+		if err != errSelfConnection {
+			log.Printf("Handshake with %s failed: %v", address, err)
+		}
 		conn.Close()
 		return
 	}
-	// --- End handshake ---
 
 	// Create mesh connection
 	meshConn := &MeshConnection{
-		Address:     address,
-		Conn:        conn,
-		IsConnected: true,
-		LastPing:    time.Now(),
+		Address:       address,
+		Conn:          session.Conn,
+		IsConnected:   true,
+		LastPing:      time.Now(),
+		WalletAddress: session.Peer.Address,
+		BestHeight:    session.Peer.Height,
+		BestHash:      session.Peer.BestHash,
+		Encrypted:     session.Encrypted,
+		reader:        session.Reader,
 	}
 
 	// Add to connections
@@ -256,6 +266,9 @@ func (mm *MeshManager) dropConnection(address string) {
 	mm.mu.Unlock()
 
 	if exists {
+		// Fail sync requests that can no longer be answered
+		mm.failPendingSync(address)
+
 		// Update peer table
 		mm.network.PeerTable.MarkDisconnected(address)
 
@@ -277,68 +290,58 @@ func (mm *MeshManager) handleConnection(meshConn *MeshConnection) {
 		mm.dropConnection(meshConn.Address)
 	}()
 
-	// Set up connection for reading
-	buffer := make([]byte, 4096)
+	if meshConn.reader == nil {
+		meshConn.reader = bufio.NewReader(meshConn.Conn)
+	}
 
 	for {
 		// Set read deadline
 		meshConn.Conn.SetReadDeadline(time.Now().Add(30 * time.Second))
 
-		// Read data
-		n, err := meshConn.Conn.Read(buffer)
+		// Read the next complete frame; a malformed frame ends the connection
+		frameType, payload, err := ReadFrame(meshConn.reader, mm.network.NetworkID)
 		if err != nil {
 			log.Printf("Connection read error from %s: %v", meshConn.Address, err)
 			return
 		}
 
-		if n > 0 {
-			// Process received data
-			data := buffer[:n]
-			mm.processReceivedData(meshConn.Address, data)
+		if err := mm.processFrame(meshConn, frameType, payload); err != nil {
+			log.Printf("Dropping mesh peer %s: %v", meshConn.Address, err)
+			return
 		}
 	}
 }
 
-// processReceivedData processes data received from a mesh peer
-func (mm *MeshManager) processReceivedData(address string, data []byte) {
-	// Convert to string for easier processing
-	dataStr := string(data)
-
-	// Check if it's a ping message
-	if strings.HasPrefix(dataStr, "PING:") {
-		// Handle ping message (could implement pong response here)
-		log.Printf("Received ping from %s", address)
-		return
-	}
-
-	// Check if it looks like HTTP (starts with HTTP method)
-	if strings.HasPrefix(dataStr, "GET ") || strings.HasPrefix(dataStr, "POST ") ||
-		strings.HasPrefix(dataStr, "PUT ") || strings.HasPrefix(dataStr, "DELETE ") ||
-		strings.HasPrefix(dataStr, "HEAD ") || strings.HasPrefix(dataStr, "OPTIONS ") {
-		log.Printf("Received HTTP request on mesh port from %s - ignoring (use API port 8080 for HTTP)", address)
-		return
-	}
-
-	// Check if it looks like JSON (starts with { or [)
-	if len(dataStr) > 0 && (dataStr[0] == '{' || dataStr[0] == '[') {
-		// Try to decode as NetworkMessage
-		if err := mm.ReceiveNetworkMessage(data); err != nil {
-			log.Printf("Failed to decode JSON mesh message from %s: %v", address, err)
+// processFrame processes a frame received from a mesh peer
+func (mm *MeshManager) processFrame(meshConn *MeshConnection, frameType FrameType, payload []byte) error {
+	switch frameType {
+	case FrameTypePing:
+		// Echo the timestamp back so the sender can measure round-trip latency
+		if err := meshConn.writeFrame(mm.network.NetworkID, FrameTypePong, payload); err != nil {
+			return fmt.Errorf("failed to send pong: %w", err)
+		}
+	case FrameTypePong:
+		if len(payload) != 8 {
+			return fmt.Errorf("invalid pong payload length: %d", len(payload))
 		}
-	} else {
-		// Unknown protocol - log but don't spam
-		if len(dataStr) > 50 {
-			dataStr = dataStr[:50] + "..."
+		sent := time.Unix(0, int64(binary.BigEndian.Uint64(payload)))
+		mm.updatePeerLatency(meshConn, time.Since(sent))
+	case FrameTypeMessage:
+		msg, err := DecodeNetworkMessage(payload)
+		if err != nil {
+			return fmt.Errorf("failed to decode mesh message: %w", err)
 		}
-		log.Printf("Received unknown protocol data from %s: %s", address, dataStr)
+		mm.dispatchMessage(meshConn, msg)
+	default:
+		return fmt.Errorf("unexpected frame type: %d", frameType)
 	}
 
 	// Update last ping time
-	mm.mu.Lock()
-	if conn, exists := mm.connections[address]; exists {
-		conn.LastPing = time.Now()
-	}
-	mm.mu.Unlock()
+	meshConn.mu.Lock()
+	meshConn.LastPing = time.Now()
+	meshConn.mu.Unlock()
+
+	return nil
 }
 
 // connectionManager handles connection events
@@ -400,19 +403,16 @@ func (mm *MeshManager) pingAllPeers() {
 
 // pingPeer pings a specific peer
 func (mm *MeshManager) pingPeer(peer *MeshConnection) {
-	start := time.Now()
-
-	// Send ping message
-	pingMsg := fmt.Sprintf("PING:%d", start.UnixNano())
-	_, err := peer.Conn.Write([]byte(pingMsg))
-	if err != nil {
+	// Send ping frame carrying the send time; latency is measured when the pong arrives
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+	if err := peer.writeFrame(mm.network.NetworkID, FrameTypePing, payload); err != nil {
 		log.Printf("Failed to ping %s: %v", peer.Address, err)
-		return
 	}
+}
 
-	// Update latency (will be refined when we implement proper ping/pong)
-	latency := time.Since(start)
-
+// updatePeerLatency records a measured round-trip latency for a peer
+func (mm *MeshManager) updatePeerLatency(peer *MeshConnection, latency time.Duration) {
 	peer.mu.Lock()
 	peer.Latency = latency
 	peer.LastPing = time.Now()
@@ -436,7 +436,7 @@ func (mm *MeshManager) pingPeer(peer *MeshConnection) {
 	}
 }
 
-// SendToMesh sends a message to all mesh peers
+// SendToMesh sends a message frame to all mesh peers
 func (mm *MeshManager) SendToMesh(message []byte) error {
 	mm.mu.RLock()
 	peers := make([]*MeshConnection, 0, len(mm.connections))
@@ -447,8 +447,7 @@ func (mm *MeshManager) SendToMesh(message []byte) error {
 
 	var lastError error
 	for _, peer := range peers {
-		_, err := peer.Conn.Write(message)
-		if err != nil {
+		if err := peer.writeFrame(mm.network.NetworkID, FrameTypeMessage, message); err != nil {
 			log.Printf("Failed to send to mesh peer %s: %v", peer.Address, err)
 			lastError = err
 		}
@@ -459,36 +458,29 @@ func (mm *MeshManager) SendToMesh(message []byte) error {
 
 // AcceptInboundConnection accepts an inbound connection and adds to mesh
 func (mm *MeshManager) AcceptInboundConnection(conn net.Conn, remoteAddr string) {
-	// --- Wallet handshake ---
-	ourWallet := mm.network.Wallet.GetAddress()
-	remoteReader := bufio.NewReader(conn)
-	remoteWallet, err := remoteReader.ReadString('\n')
-	if err != nil {
-		conn.Close()
-		return
-	}
-	remoteWallet = strings.TrimSpace(remoteWallet)
-	// Send our wallet address in response
-	_, err = conn.Write([]byte(ourWallet + "\n"))
+	// Authenticate the peer
+	session, err := mm.network.Identity().Handshake(conn, bufio.NewReader(conn), false)
 	if err != nil {
+		if err != errSelfConnection {
+			log.Printf("Handshake with %s failed: %v", remoteAddr, err)
+		}
 		conn.Close()
 		return
 	}
-	if remoteWallet == ourWallet {
-		// Self-connection, close quietly
-		conn.Close()
-		return
-	}
-	// --- End handshake ---
 
 	log.Printf("Accepting inbound connection from: %s", remoteAddr)
 
 	// Create mesh connection
 	meshConn := &MeshConnection{
-		Address:     remoteAddr,
-		Conn:        conn,
-		IsConnected: true,
-		LastPing:    time.Now(),
+		Address:       remoteAddr,
+		Conn:          session.Conn,
+		IsConnected:   true,
+		LastPing:      time.Now(),
+		WalletAddress: session.Peer.Address,
+		BestHeight:    session.Peer.Height,
+		BestHash:      session.Peer.BestHash,
+		Encrypted:     session.Encrypted,
+		reader:        session.Reader,
 	}
 
 	// Add to connections
@@ -526,7 +518,7 @@ func (mm *MeshManager) AcceptInboundConnection(conn net.Conn, remoteAddr string)
 
 // SendNetworkMessage sends a NetworkMessage to all mesh peers
 func (mm *MeshManager) SendNetworkMessage(msg *NetworkMessage) error {
-	data, err := json.Marshal(msg)
+	data, err := EncodeNetworkMessage(msg)
 	if err != nil {
 		return err
 	}
@@ -535,11 +527,25 @@ func (mm *MeshManager) SendNetworkMessage(msg *NetworkMessage) error {
 
 // ReceiveNetworkMessage decodes a NetworkMessage from bytes and forwards to MessageChan
 func (mm *MeshManager) ReceiveNetworkMessage(data []byte) error {
-	var msg NetworkMessage
-	if err := json.Unmarshal(data, &msg); err != nil {
+	msg, err := DecodeNetworkMessage(data)
+	if err != nil {
 		return err
 	}
 	// Forward to network's message channel
 	mm.network.MessageChan <- msg
 	return nil
 }
+
+// dispatchMessage routes a message received on a connection
+// Sync messages are answered or matched on the connection they arrived on,
+// everything else goes to the network's message channel.
+func (mm *MeshManager) dispatchMessage(meshConn *MeshConnection, msg NetworkMessage) {
+	switch msg.Type {
+	case MessageTypeSyncRequest:
+		go mm.serveSyncRequest(meshConn, msg.Payload.(*SyncRequestMessage))
+	case MessageTypeSyncResponse:
+		mm.deliverSyncResponse(meshConn, msg.Payload.(*SyncResponseMessage))
+	default:
+		mm.network.MessageChan <- msg
+	}
+}
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// SyncRequestMessage asks a directly connected peer for blocks or headers
+type SyncRequestMessage struct {
+	ID      string                 `json:"id"`
+	Request chain.ChainSyncRequest `json:"request"`
+}
+
+// SyncResponseMessage answers the sync request with the same ID
+type SyncResponseMessage struct {
+	ID       string                   `json:"id"`
+	Response *chain.ChainSyncResponse `json:"response,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// pendingSyncRequest is a sync request waiting for its response
+type pendingSyncRequest struct {
+	peer     string // Connection the request was sent on
+	response chan *SyncResponseMessage
+}
+
+// newSyncRequestID returns a random request ID
+func newSyncRequestID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate request ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// RequestSyncFromPeer sends a sync request over the mesh connection to a peer and waits for the response
+func (mm *MeshManager) RequestSyncFromPeer(address string, req chain.ChainSyncRequest, timeout time.Duration) (*chain.ChainSyncResponse, error) {
+	mm.mu.RLock()
+	meshConn, exists := mm.connections[address]
+	mm.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("no mesh connection to peer %s", address)
+	}
+
+	id, err := newSyncRequestID()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := &pendingSyncRequest{
+		peer:     address,
+		response: make(chan *SyncResponseMessage, 1),
+	}
+	mm.pendingSyncMu.Lock()
+	mm.pendingSync[id] = pending
+	mm.pendingSyncMu.Unlock()
+
+	defer func() {
+		mm.pendingSyncMu.Lock()
+		delete(mm.pendingSync, id)
+		mm.pendingSyncMu.Unlock()
+	}()
+
+	data, err := EncodeNetworkMessage(&NetworkMessage{
+		Type:      MessageTypeSyncRequest,
+		Source:    mm.network.NodeID,
+		Payload:   &SyncRequestMessage{ID: id, Request: req},
+		Timestamp: time.Now().Unix(),
+		TTL:       1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := meshConn.writeFrame(mm.network.NetworkID, FrameTypeMessage, data); err != nil {
+		return nil, fmt.Errorf("failed to send sync request to %s: %w", address, err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-pending.response:
+		if resp == nil {
+			return nil, fmt.Errorf("connection to %s closed before sync response", address)
+		}
+		if resp.Error != "" {
+			return nil, fmt.Errorf("peer %s failed sync request: %s", address, resp.Error)
+		}
+		if resp.Response == nil {
+			return nil, fmt.Errorf("empty sync response from %s", address)
+		}
+		return resp.Response, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("sync request to %s timed out after %v", address, timeout)
+	case <-mm.stopChan:
+		return nil, fmt.Errorf("mesh manager stopped")
+	}
+}
+
+// RequestPostProof asks a peer for the inclusion proof of a post
+// The proof is not verified here; light clients check it with chain.VerifyPostProof.
+func (mm *MeshManager) RequestPostProof(address, postHash string, timeout time.Duration) (*chain.PostProof, error) {
+	resp, err := mm.RequestSyncFromPeer(address, chain.ChainSyncRequest{
+		NodeID:        mm.network.NodeID,
+		Timestamp:     time.Now().Unix(),
+		ProofPostHash: postHash,
+	}, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp.PostProof == nil {
+		return nil, fmt.Errorf("peer %s has no proof for post %s", address, postHash)
+	}
+	if resp.PostProof.PostHash != postHash {
+		return nil, fmt.Errorf("peer %s sent a proof for post %s", address, resp.PostProof.PostHash)
+	}
+	return resp.PostProof, nil
+}
+
+// serveSyncRequest answers a sync request on the connection it arrived on
+func (mm *MeshManager) serveSyncRequest(meshConn *MeshConnection, req *SyncRequestMessage) {
+	resp := &SyncResponseMessage{ID: req.ID}
+	if mm.network.Blockchain == nil {
+		resp.Error = "no blockchain available"
+	} else {
+		chainResp := buildSyncResponse(mm.network.Blockchain, mm.network.NodeID, req.Request)
+		resp.Response = &chainResp
+	}
+
+	data, err := EncodeNetworkMessage(&NetworkMessage{
+		Type:      MessageTypeSyncResponse,
+		Source:    mm.network.NodeID,
+		Payload:   resp,
+		Timestamp: time.Now().Unix(),
+		TTL:       1,
+	})
+	if err != nil {
+		log.Printf("[MeshSync] Failed to encode sync response for %s: %v", meshConn.Address, err)
+		return
+	}
+
+	if err := meshConn.writeFrame(mm.network.NetworkID, FrameTypeMessage, data); err != nil {
+		log.Printf("[MeshSync] Failed to send sync response to %s: %v", meshConn.Address, err)
+	}
+}
+
+// deliverSyncResponse hands a response to the request waiting for it
+// Responses are only accepted from the connection the request was sent on.
+func (mm *MeshManager) deliverSyncResponse(meshConn *MeshConnection, resp *SyncResponseMessage) {
+	mm.pendingSyncMu.Lock()
+	pending, exists := mm.pendingSync[resp.ID]
+	if exists && pending.peer == meshConn.Address {
+		delete(mm.pendingSync, resp.ID)
+	}
+	mm.pendingSyncMu.Unlock()
+
+	if !exists || pending.peer != meshConn.Address {
+		log.Printf("[MeshSync] Ignoring unexpected sync response %s from %s", resp.ID, meshConn.Address)
+		return
+	}
+	pending.response <- resp
+}
+
+// failPendingSync fails all sync requests waiting on a peer
+func (mm *MeshManager) failPendingSync(address string) {
+	mm.pendingSyncMu.Lock()
+	defer mm.pendingSyncMu.Unlock()
+
+	for id, pending := range mm.pendingSync {
+		if pending.peer == address {
+			delete(mm.pendingSync, id)
+			pending.response <- nil
+		}
+	}
+}
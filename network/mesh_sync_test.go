@@ -0,0 +1,212 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// newTestBlock builds a block with two posts by the test author on top of the node's tip
+func newTestBlock(t *testing.T, tn *TrustNetwork, content string) *chain.Block {
+	parent, err := tn.Blockchain.GetLatestBlock()
+	if err != nil {
+		t.Fatalf("Failed to get latest block: %v", err)
+	}
+
+	author := testAuthor(t)
+	params := chain.ConsensusParamsAt(testNetworkID, parent.Index+1)
+	posts := []chain.Post{
+		{Author: author.GetAddress(), Content: content + " one", Timestamp: time.Now().Unix(), Version: params.Encoding},
+		{Author: author.GetAddress(), Content: content + " two", Timestamp: time.Now().Unix(), Version: params.Encoding},
+	}
+	for i := range posts {
+		if err := posts[i].Sign(author, testNetworkID); err != nil {
+			t.Fatalf("Failed to sign post: %v", err)
+		}
+	}
+	block := chain.CreateBlock(params, parent.Index+1, parent.Hash, posts, []chain.Transfer{}, nil)
+
+	// Seal the block with the state it produces on top of its parent
+	state := chain.NewStateManagerWithStore(tn.Storage)
+	if err := state.LoadStateFromStateRoot(parent.StateRoot, chain.ConsensusParamsAt(testNetworkID, parent.Index)); err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if err := state.ApplyBlock(block, params); err != nil {
+		t.Fatalf("Failed to apply block: %v", err)
+	}
+	if block.StateRoot, err = state.CalculateStateRoot(block.Index, params); err != nil {
+		t.Fatalf("Failed to calculate state root: %v", err)
+	}
+	block.SetHash()
+	return block
+}
+
+// appendTestBlock builds a block on top of the node's tip and integrates it
+func appendTestBlock(t *testing.T, tn *TrustNetwork, content string) *chain.Block {
+	block := newTestBlock(t, tn, content)
+	if _, _, err := tn.Blockchain.IntegrateBlocksFromSync([]*chain.Block{block}); err != nil {
+		t.Fatalf("Failed to integrate block: %v", err)
+	}
+	return block
+}
+
+func TestSyncOverMeshConnection(t *testing.T) {
+	nodeA := newTestTrustNetwork(t, "mesh_sync_a")
+	nodeB := newTestTrustNetwork(t, "mesh_sync_b")
+	appendTestBlock(t, nodeA, "first")
+	tip := appendTestBlock(t, nodeA, "second")
+
+	// Node B only knows node A by the connection it accepted (no dialable address)
+	connectTestNetworks(nodeA, nodeB)
+
+	result, err := nodeB.MeshSyncManager.SyncFromPeer(&MeshPeer{Address: nodeA.NodeID}, 2, -1)
+	if err != nil {
+		t.Fatalf("Sync over mesh failed: %v", err)
+	}
+	if result.BlocksAdded != 2 {
+		t.Errorf("Expected 2 blocks added, got %d", result.BlocksAdded)
+	}
+
+	latest, err := nodeB.Blockchain.GetLatestBlock()
+	if err != nil || latest.Hash != tip.Hash {
+		t.Errorf("Expected node B to reach node A's tip %s", tip.Hash)
+	}
+
+	// A peer already at the same height answers with no headers
+	result, err = nodeB.MeshSyncManager.SyncFromPeer(&MeshPeer{Address: nodeA.NodeID}, 4, -1)
+	if err != nil {
+		t.Fatalf("Sync with nothing new failed: %v", err)
+	}
+	if result.BlocksAdded != 0 {
+		t.Errorf("Expected no blocks added, got %d", result.BlocksAdded)
+	}
+
+	// Concurrent requests are matched to their own responses
+	errs := make(chan error, 2)
+	for _, headersOnly := range []bool{true, false} {
+		go func(headersOnly bool) {
+			resp, err := nodeB.MeshManager.RequestSyncFromPeer(nodeA.NodeID, chain.ChainSyncRequest{FromIndex: 0, ToIndex: -1, HeadersOnly: headersOnly}, 2*time.Second)
+			if err == nil && headersOnly && (len(resp.Headers) != 4 || len(resp.Blocks) != 0) {
+				t.Errorf("Header request got %d headers and %d blocks", len(resp.Headers), len(resp.Blocks))
+			}
+			if err == nil && !headersOnly && (len(resp.Blocks) != 4 || len(resp.Headers) != 0) {
+				t.Errorf("Block request got %d blocks and %d headers", len(resp.Blocks), len(resp.Headers))
+			}
+			errs <- err
+		}(headersOnly)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Concurrent sync request failed: %v", err)
+		}
+	}
+}
+
+func TestSyncRequestTimeoutAndDisconnect(t *testing.T) {
+	_, mm, remote := newFramedTestConnection(t)
+
+	// Drain frames without answering
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := remote.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	_, err := mm.RequestSyncFromPeer("peer-b", chain.ChainSyncRequest{FromIndex: 0, ToIndex: -1}, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Timeout took too long: %v", time.Since(start))
+	}
+
+	// A dropped connection fails the waiting request immediately
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		remote.Close()
+	}()
+	start = time.Now()
+	if _, err := mm.RequestSyncFromPeer("peer-b", chain.ChainSyncRequest{FromIndex: 0, ToIndex: -1}, 5*time.Second); err == nil {
+		t.Fatal("Expected error after connection closed")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Disconnect was not noticed promptly: %v", time.Since(start))
+	}
+
+	mm.pendingSyncMu.Lock()
+	pending := len(mm.pendingSync)
+	mm.pendingSyncMu.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected no pending sync requests, got %d", pending)
+	}
+
+	// Unknown peers are rejected without sending anything
+	if _, err := mm.RequestSyncFromPeer("unknown", chain.ChainSyncRequest{}, time.Second); err == nil {
+		t.Error("Expected error for peer without a mesh connection")
+	}
+}
+
+func TestSyncResponseFromOtherPeerIgnored(t *testing.T) {
+	_, mm, _ := newFramedTestConnection(t)
+
+	local, remote := net.Pipe()
+	t.Cleanup(func() { local.Close(); remote.Close() })
+	intruder := &MeshConnection{Address: "peer-c", Conn: local, IsConnected: true}
+
+	pending := &pendingSyncRequest{peer: "peer-b", response: make(chan *SyncResponseMessage, 1)}
+	mm.pendingSync["request"] = pending
+
+	mm.deliverSyncResponse(intruder, &SyncResponseMessage{ID: "request", Response: &chain.ChainSyncResponse{}})
+	select {
+	case <-pending.response:
+		t.Error("Response from another connection must not be delivered")
+	default:
+	}
+}
+
+func TestPostProofOverMesh(t *testing.T) {
+	nodeA := newTestTrustNetwork(t, "proof_a")
+	light := newTestTrustNetwork(t, "proof_light")
+	block := appendTestBlock(t, nodeA, "proven")
+	appendTestBlock(t, nodeA, "on top")
+	connectTestNetworks(nodeA, light)
+
+	postHash := block.Posts[1].Hash
+	proof, err := light.MeshManager.RequestPostProof(nodeA.NodeID, postHash, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to request proof: %v", err)
+	}
+
+	// The light client checks the proof against headers it fetched itself
+	resp, err := light.MeshManager.RequestSyncFromPeer(nodeA.NodeID, chain.ChainSyncRequest{FromIndex: 0, ToIndex: -1, HeadersOnly: true}, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to request headers: %v", err)
+	}
+	confirmations, err := chain.VerifyPostProof(proof, resp.Headers, light.NetworkID)
+	if err != nil {
+		t.Fatalf("Proof did not verify: %v", err)
+	}
+	if confirmations != 2 || proof.Confirmations != 2 {
+		t.Errorf("Expected 2 confirmations, got %d (node reported %d)", confirmations, proof.Confirmations)
+	}
+
+	// A header with a forged posts root no longer hashes to its own hash
+	forged := *resp.Headers[2]
+	forged.PostsRoot = chain.MerkleRoot([]string{postHash})
+	headers := []*chain.BlockHeader{resp.Headers[0], resp.Headers[1], &forged, resp.Headers[3]}
+	if _, err := chain.VerifyPostProof(proof, headers, light.NetworkID); err == nil {
+		t.Error("Expected forged header to be rejected")
+	}
+
+	// Proofs for posts the peer does not have are refused
+	if _, err := light.MeshManager.RequestPostProof(nodeA.NodeID, "unknown", 2*time.Second); err == nil {
+		t.Error("Expected error for unknown post")
+	}
+}
@@ -32,9 +32,11 @@ type TrustNetwork struct {
 	MeshSyncManager  *MeshSyncManager  // Chain sync manager
 
 	// Configuration
-	ListenPort    int
-	MaxPeers      int
-	MinTrustScore float64
+	NetworkID        string // Network this node belongs to (checked on every mesh frame)
+	EncryptTransport bool   // Offer encrypted sessions to peers (plaintext peers are still accepted)
+	ListenPort       int
+	MaxPeers         int
+	MinTrustScore    float64
 
 	// State
 	IsRunning bool
@@ -72,6 +74,8 @@ const (
 	MessageTypeBlock
 	MessageTypePing
 	MessageTypePong
+	MessageTypeSyncRequest  // Point-to-point chain sync request
+	MessageTypeSyncResponse // Response to a sync request, matched by ID
 )
 
 // PeerEvent represents peer-related events
@@ -117,9 +121,11 @@ func NewTrustNetwork(
 		BootstrapManager: NewBootstrapManager(bootstrapConfig),
 		MeshSyncManager:  nil, // Will be initialized after network is created
 
-		ListenPort:    listenPort,
-		MaxPeers:      10,  // Default max 10 direct peers
-		MinTrustScore: 0.3, // Minimum trust score for connections
+		NetworkID:        chain.MainnetNetworkID,
+		EncryptTransport: true,
+		ListenPort:       listenPort,
+		MaxPeers:         10,  // Default max 10 direct peers
+		MinTrustScore:    0.3, // Minimum trust score for connections
 
 		IsRunning:   false,
 		MessageChan: make(chan NetworkMessage, 100),
@@ -142,6 +148,16 @@ func NewTrustNetwork(
 	return network
 }
 
+// Identity returns the identity this node presents during peer handshakes
+func (tn *TrustNetwork) Identity() *NodeIdentity {
+	return &NodeIdentity{
+		Wallet:     tn.Wallet,
+		NetworkID:  tn.NetworkID,
+		Blockchain: tn.Blockchain,
+		Encrypt:    tn.EncryptTransport,
+	}
+}
+
 // Start begins the network node operation
 func (tn *TrustNetwork) Start() error {
 	tn.mu.Lock()
@@ -316,6 +332,35 @@ func (tn *TrustNetwork) BroadcastTransfer(transfer *chain.Transfer) error {
 	return nil
 }
 
+// BroadcastBlock broadcasts a block to all mesh peers
+func (tn *TrustNetwork) BroadcastBlock(block *chain.Block) error {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	if !tn.IsRunning {
+		return fmt.Errorf("network is not running")
+	}
+
+	// Create network message
+	msg := NetworkMessage{
+		Type:      MessageTypeBlock,
+		Source:    tn.NodeID,
+		Payload:   block,
+		Timestamp: time.Now().Unix(),
+		TTL:       10, // Allow up to 10 hops
+	}
+
+	// Remember our own block so it is not re-applied when gossiped back
+	tn.recentMsgHashes[block.Hash] = time.Now().Unix()
+
+	if tn.MeshManager != nil {
+		_ = tn.MeshManager.SendNetworkMessage(&msg)
+	}
+
+	log.Printf("Broadcasting block: %d (%s)", block.Index, block.Hash)
+	return nil
+}
+
 // GetNetworkStats returns comprehensive network statistics
 func (tn *TrustNetwork) GetNetworkStats() map[string]interface{} {
 	tn.mu.RLock()
@@ -397,8 +442,13 @@ func (tn *TrustNetwork) sendGossip() {
 		Timestamp: time.Now().Unix(),
 		TTL:       10,
 	}
+	meshManager := tn.MeshManager
 	tn.mu.RUnlock()
-	tn.MessageChan <- msg
+
+	// Peer tables are shared with mesh peers, not processed locally
+	if meshManager != nil {
+		_ = meshManager.SendNetworkMessage(&msg)
+	}
 }
 
 // peerManager handles peer-related events
@@ -448,6 +498,8 @@ func (tn *TrustNetwork) handleMessage(msg NetworkMessage) {
 		tn.handlePostMessage(msg)
 	case MessageTypeTransfer:
 		tn.handleTransferMessage(msg)
+	case MessageTypeBlock:
+		tn.handleBlockMessage(msg)
 	case MessageTypePing:
 		tn.handlePingMessage(msg)
 	case MessageTypePong:
@@ -501,7 +553,12 @@ func (tn *TrustNetwork) handlePostMessage(msg NetworkMessage) {
 		return
 	}
 	// Add to pending posts (if not present)
-	if err := tn.Storage.SavePendingPost(*post); err != nil {
+	if tn.Blockchain != nil {
+		if err := tn.Blockchain.AddPost(*post); err != nil {
+			log.Printf("Failed to add post to pending: %v", err)
+			return
+		}
+	} else if err := tn.Storage.SavePendingPost(*post); err != nil {
 		log.Printf("Failed to add post to pending: %v", err)
 		return
 	}
@@ -548,6 +605,47 @@ func (tn *TrustNetwork) handleTransferMessage(msg NetworkMessage) {
 	log.Printf("Received transfer from %s: %s", msg.Source, transfer.Hash)
 }
 
+// handleBlockMessage processes block messages
+func (tn *TrustNetwork) handleBlockMessage(msg NetworkMessage) {
+	block, ok := msg.Payload.(*chain.Block)
+	if !ok {
+		log.Printf("Invalid block message payload")
+		return
+	}
+
+	// Check TTL
+	if msg.TTL <= 0 {
+		return // Drop message
+	}
+
+	tn.mu.Lock()
+	if _, seen := tn.recentMsgHashes[block.Hash]; seen {
+		tn.mu.Unlock()
+		return // Already seen, drop
+	}
+	tn.recentMsgHashes[block.Hash] = time.Now().Unix()
+	tn.mu.Unlock()
+
+	if tn.Blockchain == nil {
+		return
+	}
+
+	// Only blocks extending our tip are applied here; gaps are filled by chain sync
+	blocksAdded, _, err := tn.Blockchain.IntegrateBlocksFromSync([]*chain.Block{block})
+	if err != nil {
+		log.Printf("Failed to integrate block %d from %s: %v", block.Index, msg.Source, err)
+		return
+	}
+
+	// Gossip to selected peers
+	if blocksAdded > 0 && msg.TTL > 1 {
+		msg.TTL--
+		tn.gossipToPeers(&msg, msg.Source)
+	}
+
+	log.Printf("Received block from %s: %d (%s)", msg.Source, block.Index, block.Hash)
+}
+
 // handlePingMessage processes ping messages
 func (tn *TrustNetwork) handlePingMessage(msg NetworkMessage) {
 	// Respond with pong (implementation will be added)
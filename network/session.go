@@ -0,0 +1,161 @@
+package network
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// Encrypted session layer
+//
+// When both peers offer encryption during the handshake, everything after the
+// handshake is sent as AEAD records:
+//
+//	length (4) | ciphertext (length)
+//
+// Keys are derived from an ECDH shared secret between the two node keys and the
+// signed handshake transcript, so every session uses fresh keys and a relay that
+// altered either hello ends up with different keys. Each direction has its
+// own key and a record counter as nonce, so records cannot be replayed,
+// reordered or altered without the connection failing.
+const (
+	MaxSessionRecordSize = 64 * 1024 // Max plaintext bytes per record
+	sessionRecordHeader  = 4
+)
+
+// SecureConn is a net.Conn that encrypts everything written to it
+type SecureConn struct {
+	net.Conn
+	reader io.Reader // Source of records (may hold bytes buffered during the handshake)
+
+	sendAEAD    cipher.AEAD
+	sendCounter uint64
+	writeMu     sync.Mutex
+
+	recvAEAD    cipher.AEAD
+	recvCounter uint64
+	readBuf     []byte
+	readMu      sync.Mutex
+}
+
+// deriveSessionKeys derives the send and receive ciphers for one side of a session
+func deriveSessionKeys(privateKey *btcec.PrivateKey, peerKey *btcec.PublicKey, transcript []byte, initiator bool) (cipher.AEAD, cipher.AEAD, error) {
+	shared := btcec.GenerateSharedSecret(privateKey, peerKey)
+
+	deriveKey := func(label string) (cipher.AEAD, error) {
+		h := sha256.New()
+		h.Write([]byte(label))
+		h.Write(shared)
+		h.Write(transcript)
+
+		block, err := aes.NewCipher(h.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+
+	toResponder, err := deriveKey("truthchain-session:initiator")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive session key: %w", err)
+	}
+	toInitiator, err := deriveKey("truthchain-session:responder")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive session key: %w", err)
+	}
+
+	if initiator {
+		return toResponder, toInitiator, nil
+	}
+	return toInitiator, toResponder, nil
+}
+
+// newSecureConn wraps conn in an encrypted session
+func newSecureConn(conn net.Conn, reader io.Reader, send, recv cipher.AEAD) *SecureConn {
+	return &SecureConn{
+		Conn:     conn,
+		reader:   reader,
+		sendAEAD: send,
+		recvAEAD: recv,
+	}
+}
+
+// recordNonce builds the AEAD nonce for a record counter
+func recordNonce(aead cipher.AEAD, counter uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	return nonce
+}
+
+// Write encrypts p into one or more records
+func (sc *SecureConn) Write(p []byte) (int, error) {
+	sc.writeMu.Lock()
+	defer sc.writeMu.Unlock()
+
+	written := 0
+	for written < len(p) {
+		end := written + MaxSessionRecordSize
+		if end > len(p) {
+			end = len(p)
+		}
+
+		if sc.sendCounter == math.MaxUint64 {
+			return written, fmt.Errorf("session record limit reached")
+		}
+
+		record := make([]byte, sessionRecordHeader, sessionRecordHeader+end-written+sc.sendAEAD.Overhead())
+		binary.BigEndian.PutUint32(record, uint32(end-written+sc.sendAEAD.Overhead()))
+		record = sc.sendAEAD.Seal(record, recordNonce(sc.sendAEAD, sc.sendCounter), p[written:end], record[:sessionRecordHeader])
+		sc.sendCounter++
+
+		if _, err := sc.Conn.Write(record); err != nil {
+			return written, err
+		}
+		written = end
+	}
+
+	return written, nil
+}
+
+// Read decrypts the next record when no plaintext is buffered
+// Any error means the session can no longer be trusted and the connection should be closed.
+func (sc *SecureConn) Read(p []byte) (int, error) {
+	sc.readMu.Lock()
+	defer sc.readMu.Unlock()
+
+	if len(sc.readBuf) == 0 {
+		header := make([]byte, sessionRecordHeader)
+		if _, err := io.ReadFull(sc.reader, header); err != nil {
+			return 0, err
+		}
+
+		length := binary.BigEndian.Uint32(header)
+		if length < uint32(sc.recvAEAD.Overhead()) || length > uint32(MaxSessionRecordSize+sc.recvAEAD.Overhead()) {
+			return 0, fmt.Errorf("invalid session record length: %d", length)
+		}
+
+		ciphertext := make([]byte, length)
+		if _, err := io.ReadFull(sc.reader, ciphertext); err != nil {
+			return 0, fmt.Errorf("failed to read session record: %w", err)
+		}
+
+		plaintext, err := sc.recvAEAD.Open(ciphertext[:0], recordNonce(sc.recvAEAD, sc.recvCounter), ciphertext, header)
+		if err != nil {
+			return 0, fmt.Errorf("session record authentication failed")
+		}
+		sc.recvCounter++
+		sc.readBuf = plaintext
+	}
+
+	n := copy(p, sc.readBuf)
+	sc.readBuf = sc.readBuf[n:]
+	return n, nil
+}
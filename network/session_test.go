@@ -0,0 +1,259 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blindxfish/truthchain/chain"
+)
+
+// recordingConn records everything written to the wire
+type recordingConn struct {
+	net.Conn
+	mu      sync.Mutex
+	written bytes.Buffer
+}
+
+func (rc *recordingConn) Write(p []byte) (int, error) {
+	rc.mu.Lock()
+	rc.written.Write(p)
+	rc.mu.Unlock()
+	if rc.Conn == nil {
+		return len(p), nil
+	}
+	return rc.Conn.Write(p)
+}
+
+func (rc *recordingConn) Bytes() []byte {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]byte(nil), rc.written.Bytes()...)
+}
+
+// dialLoopback returns both ends of a TCP connection over loopback
+func dialLoopback(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	server := <-accepted
+	if server == nil {
+		t.Fatal("Failed to accept connection")
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestEncryptedSessionOverLoopback(t *testing.T) {
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := newTestIdentity(t, chain.MainnetNetworkID)
+
+	client, server := dialLoopback(t)
+	wire := &recordingConn{Conn: client}
+	sessionA, sessionB, errA, errB := runHandshake(a, b, wire, server)
+	if errA != nil || errB != nil {
+		t.Fatalf("Handshake failed: initiator %v, responder %v", errA, errB)
+	}
+	if !sessionA.Encrypted || !sessionB.Encrypted {
+		t.Fatal("Expected both sides to negotiate an encrypted session")
+	}
+	handshakeBytes := len(wire.Bytes())
+
+	// Frames flow in both directions, including payloads spanning several records
+	secret := []byte("secret gossip payload")
+	large := []byte(strings.Repeat("block data ", 20000))
+
+	go WriteFrame(sessionA.Conn, chain.MainnetNetworkID, FrameTypeMessage, secret)
+	frameType, payload, err := ReadFrame(sessionB.Reader, chain.MainnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if frameType != FrameTypeMessage || !bytes.Equal(payload, secret) {
+		t.Errorf("Frame mismatch: type %d, payload %q", frameType, payload)
+	}
+
+	go WriteFrame(sessionB.Conn, chain.MainnetNetworkID, FrameTypeMessage, large)
+	_, payload, err = ReadFrame(sessionA.Reader, chain.MainnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to read large frame: %v", err)
+	}
+	if !bytes.Equal(payload, large) {
+		t.Errorf("Large frame mismatch: got %d bytes, expected %d", len(payload), len(large))
+	}
+
+	// Observers on the path only see ciphertext
+	traffic := wire.Bytes()[handshakeBytes:]
+	if len(traffic) == 0 {
+		t.Fatal("Expected session traffic on the wire")
+	}
+	if bytes.Contains(traffic, secret) {
+		t.Error("Plaintext payload visible on the wire")
+	}
+	magic := NetworkMagic(chain.MainnetNetworkID)
+	if bytes.Contains(traffic, magic[:]) {
+		t.Error("Frame header visible on the wire")
+	}
+}
+
+func TestSessionRejectsTamperedRecords(t *testing.T) {
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := newTestIdentity(t, chain.MainnetNetworkID)
+	transcript := []byte(strings.Repeat("t", 32))
+
+	sendA, _, err := deriveSessionKeys(a.Wallet.PrivateKey, b.Wallet.PublicKey, transcript, true)
+	if err != nil {
+		t.Fatalf("Failed to derive keys: %v", err)
+	}
+	_, recvB, err := deriveSessionKeys(b.Wallet.PrivateKey, a.Wallet.PublicKey, transcript, false)
+	if err != nil {
+		t.Fatalf("Failed to derive keys: %v", err)
+	}
+
+	wire := &recordingConn{}
+	sender := newSecureConn(wire, nil, sendA, nil)
+	if _, err := sender.Write([]byte("hello")); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	record := wire.Bytes()
+
+	read := func(data []byte) error {
+		receiver := newSecureConn(nil, bytes.NewReader(data), nil, recvB)
+		_, err := receiver.Read(make([]byte, 64))
+		return err
+	}
+
+	if err := read(record); err != nil {
+		t.Fatalf("Failed to read untouched record: %v", err)
+	}
+
+	tampered := append([]byte(nil), record...)
+	tampered[len(tampered)-1] ^= 0x01
+	if err := read(tampered); err == nil {
+		t.Error("Expected tampered record to be rejected")
+	}
+
+	// A replayed record does not match the next counter
+	receiver := newSecureConn(nil, bytes.NewReader(append(append([]byte(nil), record...), record...)), nil, recvB)
+	buf := make([]byte, 64)
+	if _, err := receiver.Read(buf); err != nil {
+		t.Fatalf("Failed to read first record: %v", err)
+	}
+	if _, err := receiver.Read(buf); err == nil {
+		t.Error("Expected replayed record to be rejected")
+	}
+}
+
+func TestPlaintextFallbackOverLoopback(t *testing.T) {
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := newTestIdentity(t, chain.MainnetNetworkID)
+	b.Encrypt = false // Peer without encryption support
+
+	client, server := dialLoopback(t)
+	sessionA, sessionB, errA, errB := runHandshake(a, b, client, server)
+	if errA != nil || errB != nil {
+		t.Fatalf("Handshake failed: initiator %v, responder %v", errA, errB)
+	}
+	if sessionA.Encrypted || sessionB.Encrypted {
+		t.Fatal("Expected plaintext session when the peer does not offer encryption")
+	}
+
+	go WriteFrame(sessionA.Conn, chain.MainnetNetworkID, FrameTypePing, []byte("12345678"))
+	frameType, payload, err := ReadFrame(sessionB.Reader, chain.MainnetNetworkID)
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	if frameType != FrameTypePing || string(payload) != "12345678" {
+		t.Errorf("Frame mismatch: type %d, payload %q", frameType, payload)
+	}
+}
+
+func TestHandshakeRejectsStrippedEncryption(t *testing.T) {
+	a := newTestIdentity(t, chain.MainnetNetworkID)
+	b := newTestIdentity(t, chain.MainnetNetworkID)
+
+	// A relay on the path clears the initiator's encryption offer and passes everything else on
+	connA, relayA := net.Pipe()
+	relayB, connB := net.Pipe()
+	defer relayA.Close()
+	defer relayB.Close()
+	go func() {
+		defer relayB.Close()
+		reader := bufio.NewReader(relayA)
+		_, payload, err := ReadFrame(reader, chain.MainnetNetworkID)
+		if err != nil {
+			return
+		}
+		var hello HandshakeHello
+		if err := json.Unmarshal(payload, &hello); err != nil {
+			return
+		}
+		hello.Encrypt = false
+		if err := a.writeHandshake(relayB, &hello); err != nil {
+			return
+		}
+		go io.Copy(relayA, relayB)
+		io.Copy(relayB, reader)
+	}()
+
+	sessionA, sessionB, errA, errB := runHandshake(a, b, connA, connB)
+	if errA == nil || errB == nil {
+		t.Fatalf("Expected downgraded handshake to fail: initiator %v (encrypted %v), responder %v (encrypted %v)",
+			errA, sessionA != nil && sessionA.Encrypted, errB, sessionB != nil && sessionB.Encrypted)
+	}
+}
+
+func TestSecureSyncOverLoopback(t *testing.T) {
+	server := newTestTrustNetwork(t, "sync_server")
+	client := newTestIdentity(t, testNetworkID)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go serveSync(ln, server.Blockchain, server.NodeID, server.Identity())
+
+	// Encrypted request
+	resp, err := SyncFromPeerSecure(ln.Addr().String(), 0, 0, "client", false, client)
+	if err != nil {
+		t.Fatalf("Secure sync failed: %v", err)
+	}
+	if len(resp.Blocks) != 1 || resp.Blocks[0].Hash != chain.RegtestGenesisHash {
+		t.Errorf("Expected genesis block from secure sync, got %d blocks", len(resp.Blocks))
+	}
+
+	// Older clients still get plaintext service
+	resp, err = SyncFromPeerTCPWithHeaders(ln.Addr().String(), 0, 0, "legacy", true)
+	if err != nil {
+		t.Fatalf("Plaintext sync failed: %v", err)
+	}
+	if len(resp.Headers) != 1 {
+		t.Errorf("Expected 1 header from plaintext sync, got %d", len(resp.Headers))
+	}
+}
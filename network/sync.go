@@ -20,11 +20,14 @@ type MeshSyncManager struct {
 	maxConcurrentSync int
 	syncTimeout       time.Duration
 	headerSyncTimeout time.Duration
+	headerBatchSize   int // Headers per request during headers-first sync
+	blockBatchSize    int // Blocks per request during block download
 
 	// State
 	isRunning      bool
 	lastSyncTime   time.Time
 	syncInProgress bool
+	progress       SyncProgress
 	mu             sync.RWMutex
 
 	// Channels
@@ -59,6 +62,9 @@ func NewMeshSyncManager(trustNetwork *TrustNetwork, blockchain *blockchain.Block
 		maxConcurrentSync: 3,
 		syncTimeout:       chain.BlockSyncTimeout,
 		headerSyncTimeout: chain.HeaderSyncTimeout,
+		headerBatchSize:   chain.MaxHeadersPerRequest,
+		blockBatchSize:    chain.MaxBlocksPerRequest,
+		progress:          SyncProgress{Phase: SyncPhaseIdle},
 		stopChan:          make(chan struct{}),
 		syncRequestChan:   make(chan SyncRequest, 100),
 	}
@@ -154,129 +160,148 @@ func (msm *MeshSyncManager) processSyncRequest(req SyncRequest) {
 	msm.lastSyncTime = time.Now()
 }
 
-// SyncFromPeer performs the actual sync operation with Bitcoin-style header-first sync
+// SyncFromPeer performs a headers-first sync
+// Headers are fetched from the given peer in batches and validated as a chain,
+// then the missing blocks are downloaded in parallel from the best connected
+// peers and connected in order.
 func (msm *MeshSyncManager) SyncFromPeer(peer *MeshPeer, fromIndex, toIndex int) (*SyncResult, error) {
 	startTime := time.Now()
+	msm.updateProgress(func(p *SyncProgress) {
+		*p = SyncProgress{Phase: SyncPhaseHeaders, HeaderPeer: peer.Address, StartedAt: startTime}
+	})
 
-	// Step 1: Header-only sync (Bitcoin-style)
-	log.Printf("[MeshSync] Starting header-only sync from %s (blocks %d-%d)", peer.Address, fromIndex, toIndex)
+	result, err := msm.syncFromPeer(peer, fromIndex, toIndex)
+	if err != nil {
+		msm.updateProgress(func(p *SyncProgress) { p.Phase = SyncPhaseFailed })
+		return nil, err
+	}
+
+	msm.updateProgress(func(p *SyncProgress) { p.Phase = SyncPhaseDone })
+	result.Success = true
+	result.PeerID = peer.Address
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
 
-	headerReq := chain.ChainSyncRequest{
-		FromIndex:   fromIndex,
-		ToIndex:     toIndex,
-		NodeID:      msm.trustNetwork.NodeID,
-		Timestamp:   time.Now().Unix(),
-		HeadersOnly: true,
+// syncFromPeer runs the header and block download phases of SyncFromPeer
+func (msm *MeshSyncManager) syncFromPeer(peer *MeshPeer, fromIndex, toIndex int) (*SyncResult, error) {
+	if fromIndex < 0 {
+		fromIndex = 0
 	}
 
-	// Send header request
-	headerResponse, err := msm.sendSyncRequest(peer, headerReq)
+	// Step 1: Headers-first (Bitcoin-style)
+	log.Printf("[MeshSync] Starting header sync from %s (blocks %d-%d)", peer.Address, fromIndex, toIndex)
+	headers, err := msm.fetchHeaderChain(peer, fromIndex, toIndex)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get headers: %w", err)
+		return nil, err
 	}
 
-	// Validate headers
-	if err := chain.ValidateChainHeaders(headerResponse.Headers); err != nil {
-		return nil, fmt.Errorf("invalid headers: %w", err)
+	// Nothing to do if the peer has no blocks past the requested index
+	if len(headers) == 0 {
+		return &SyncResult{}, nil
 	}
 
-	log.Printf("[MeshSync] Validated %d headers from %s", len(headerResponse.Headers), peer.Address)
-
-	// Step 2: Check if we need full blocks
 	currentLength, err := msm.blockchain.GetChainLength()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current chain length: %w", err)
 	}
 
-	// If we have no blocks, we need the full chain
-	if currentLength == 0 {
-		log.Printf("[MeshSync] No local chain - downloading full blocks from %s", peer.Address)
-
-		// Request full blocks
-		blockReq := chain.ChainSyncRequest{
-			FromIndex:   fromIndex,
-			ToIndex:     toIndex,
-			NodeID:      msm.trustNetwork.NodeID,
-			Timestamp:   time.Now().Unix(),
-			HeadersOnly: false,
-		}
-
-		blockResponse, err := msm.sendSyncRequest(peer, blockReq)
+	// Step 2: Find where the peer's header chain meets ours
+	ancestor, err := msm.findHeaderAncestor(headers, currentLength)
+	if err != nil {
+		return nil, err
+	}
+	if ancestor < fromIndex-1 && fromIndex > 0 {
+		// The headers do not connect to our chain; fetch the peer's chain from genesis to find the fork point
+		log.Printf("[MeshSync] Headers from %s do not connect at %d, looking for fork point", peer.Address, fromIndex)
+		headers, err = msm.fetchHeaderChain(peer, 0, toIndex)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get blocks: %w", err)
+			return nil, err
 		}
-
-		// Validate and integrate the full chain
-		blocksAdded, blocksSkipped, err := msm.blockchain.ValidateAndIntegrateChain(blockResponse.Blocks)
+		if len(headers) == 0 {
+			return &SyncResult{}, nil
+		}
+		ancestor, err = msm.findHeaderAncestor(headers, currentLength)
 		if err != nil {
-			return nil, fmt.Errorf("failed to integrate chain: %w", err)
+			return nil, err
 		}
+	}
 
-		result := &SyncResult{
-			Success:       true,
-			BlocksAdded:   blocksAdded,
-			BlocksSkipped: blocksSkipped,
-			PeerID:        peer.Address,
-			Duration:      time.Since(startTime),
-		}
+	log.Printf("[MeshSync] Validated %d headers from %s (common ancestor %d)", len(headers), peer.Address, ancestor)
 
-		return result, nil
-	}
+	// Blocks on the way to the assume-valid block can skip signature checks when they arrive
+	msm.blockchain.NoteHeaderChain(headers)
 
-	// Step 3: For existing chains, check if headers indicate a better chain
-	latestHeader := headerResponse.Headers[len(headerResponse.Headers)-1]
+	// Peer's chain is not longer than ours
+	latestHeader := headers[len(headers)-1]
 	if latestHeader.Index <= currentLength-1 {
-		// Peer's chain is not longer than ours
-		return &SyncResult{
-			Success:       true,
-			BlocksAdded:   0,
-			BlocksSkipped: 0,
-			PeerID:        peer.Address,
-			Duration:      time.Since(startTime),
-		}, nil
+		return &SyncResult{}, nil
 	}
 
-	// Step 4: Download full blocks for the new portion
-	log.Printf("[MeshSync] Downloading new blocks from %s (index %d-%d)", peer.Address, currentLength, latestHeader.Index)
-
-	blockReq := chain.ChainSyncRequest{
-		FromIndex:   currentLength,
-		ToIndex:     latestHeader.Index,
-		NodeID:      msm.trustNetwork.NodeID,
-		Timestamp:   time.Now().Unix(),
-		HeadersOnly: false,
+	// Step 3: Download the missing blocks in parallel
+	var missing []*chain.BlockHeader
+	for _, header := range headers {
+		if header.Index > ancestor {
+			missing = append(missing, header)
+		}
 	}
-
-	blockResponse, err := msm.sendSyncRequest(peer, blockReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get new blocks: %w", err)
+	peers := msm.downloadPeers(peer)
+	log.Printf("[MeshSync] Downloading blocks %d-%d from %d peers", missing[0].Index, latestHeader.Index, len(peers))
+
+	result := &SyncResult{}
+
+	if currentLength == 0 || ancestor == currentLength-1 {
+		// The peer's chain extends ours (or we have none): connect ranges as they arrive
+		err = msm.downloadBlocks(missing, peers, func(blocks []*chain.Block) error {
+			added, skipped, err := msm.blockchain.IntegrateBlocksFromSync(blocks)
+			result.BlocksAdded += added
+			result.BlocksSkipped += skipped
+			if err != nil {
+				return fmt.Errorf("failed to integrate blocks: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
 	}
 
-	// Integrate new blocks
-	blocksAdded, blocksSkipped, err := msm.blockchain.IntegrateBlocksFromSync(blockResponse.Blocks)
+	// The peer's chain forks from ours: compare the branch by its headers before
+	// downloading it, so only a bounded branch that claims more burn is buffered
+	if err := msm.blockchain.CheckBranchHeaders(ancestor, missing); err != nil {
+		return nil, fmt.Errorf("rejected fork from %s: %w", peer.Address, err)
+	}
+	var branch []*chain.Block
+	err = msm.downloadBlocks(missing, peers, func(blocks []*chain.Block) error {
+		branch = append(branch, blocks...)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to integrate new blocks: %w", err)
+		return nil, err
 	}
 
-	result := &SyncResult{
-		Success:       true,
-		BlocksAdded:   blocksAdded,
-		BlocksSkipped: blocksSkipped,
-		PeerID:        peer.Address,
-		Duration:      time.Since(startTime),
+	added, err := msm.blockchain.IntegrateBranch(ancestor, branch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to integrate branch: %w", err)
 	}
-
+	result.BlocksAdded = added
+	result.BlocksSkipped = ancestor + 1
 	return result, nil
 }
 
-// sendSyncRequest sends a sync request via the mesh network
+// sendSyncRequest sends a sync request over the mesh connection to the peer
+// Works for any connected peer, including inbound peers we cannot dial back.
 func (msm *MeshSyncManager) sendSyncRequest(peer *MeshPeer, req chain.ChainSyncRequest) (*chain.ChainSyncResponse, error) {
-	// TODO: Implement actual mesh network communication
-	// For now, use the transport layer directly
+	if msm.trustNetwork.MeshManager == nil {
+		return nil, fmt.Errorf("mesh manager not initialized")
+	}
 
-	// Parse address to get IP and port
-	// For now, assume peer.Address is in format "IP:port"
-	return SyncFromPeerTCPWithHeaders(peer.Address, req.FromIndex, req.ToIndex, req.NodeID, req.HeadersOnly)
+	timeout := msm.syncTimeout
+	if req.HeadersOnly {
+		timeout = msm.headerSyncTimeout
+	}
+	return msm.trustNetwork.MeshManager.RequestSyncFromPeer(peer.Address, req, timeout)
 }
 
 // updatePeerTrust updates peer trust score based on sync result
@@ -400,6 +425,7 @@ func (msm *MeshSyncManager) GetSyncStats() map[string]interface{} {
 	stats["mesh_sync_in_progress"] = msm.syncInProgress
 	stats["mesh_last_sync_time"] = msm.lastSyncTime
 	stats["mesh_sync_interval"] = msm.syncInterval.String()
+	stats["mesh_sync_progress"] = msm.progress
 
 	return stats
 }
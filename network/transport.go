@@ -3,6 +3,7 @@ package network
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -14,25 +15,61 @@ import (
 
 // StartSyncServer starts a TCP server to handle chain sync requests
 func StartSyncServer(bindAddr string, bc *blockchain.Blockchain, nodeID string) error {
+	return StartSecureSyncServer(bindAddr, bc, nodeID, nil)
+}
+
+// StartSecureSyncServer starts a sync server that also accepts handshaked sessions
+// Clients that open with a handshake frame are authenticated and, if both sides
+// offer it, served over an encrypted session. Plain JSON requests from older
+// clients are still served. A nil identity serves plaintext requests only.
+func StartSecureSyncServer(bindAddr string, bc *blockchain.Blockchain, nodeID string, identity *NodeIdentity) error {
 	ln, err := net.Listen("tcp", bindAddr)
 	if err != nil {
 		return fmt.Errorf("failed to start sync server: %w", err)
 	}
 	fmt.Printf("[SyncServer] Listening on %s\n", bindAddr)
+	return serveSync(ln, bc, nodeID, identity)
+}
+
+// serveSync accepts sync connections until the listener is closed
+func serveSync(ln net.Listener, bc *blockchain.Blockchain, nodeID string, identity *NodeIdentity) error {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
 			fmt.Printf("[SyncServer] Accept error: %v\n", err)
 			continue
 		}
-		go handleSyncConnection(conn, bc, nodeID)
+		go handleSyncConnection(conn, bc, nodeID, identity)
 	}
 }
 
-func handleSyncConnection(conn net.Conn, bc *blockchain.Blockchain, nodeID string) {
+func handleSyncConnection(conn net.Conn, bc *blockchain.Blockchain, nodeID string, identity *NodeIdentity) {
 	defer conn.Close()
 	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
+	var stream io.Writer = conn
+
+	// Requests from older clients start with a JSON object, everything else is a handshake
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+	if first[0] != '{' {
+		if identity == nil {
+			fmt.Printf("[SyncServer] Handshake not supported, dropping %s\n", conn.RemoteAddr())
+			return
+		}
+		session, err := identity.Handshake(conn, reader, false)
+		if err != nil {
+			fmt.Printf("[SyncServer] Handshake failed: %v\n", err)
+			return
+		}
+		reader = session.Reader
+		stream = session.Conn
+	}
+	writer := bufio.NewWriter(stream)
 
 	// Read request
 	line, err := reader.ReadBytes('\n')
@@ -49,14 +86,47 @@ func handleSyncConnection(conn net.Conn, bc *blockchain.Blockchain, nodeID strin
 		return
 	}
 
-	// Prepare response
+	resp := buildSyncResponse(bc, nodeID, req)
+	respBytes, _ := json.Marshal(resp)
+	writer.Write(respBytes)
+	writer.WriteByte('\n')
+	writer.Flush()
+	fmt.Printf("[SyncServer] Served sync request from %s: blocks %d-%d\n", req.NodeID, resp.FromIndex, resp.ToIndex)
+}
+
+// buildSyncResponse collects the blocks or headers asked for by a sync request
+// Ranges are capped so a response always fits in a single mesh frame; callers
+// can see the served range in FromIndex/ToIndex and ask again for the rest.
+func buildSyncResponse(bc *blockchain.Blockchain, nodeID string, req chain.ChainSyncRequest) chain.ChainSyncResponse {
+	// Light clients ask for a single post proof instead of a block range
+	if req.ProofPostHash != "" {
+		resp := chain.ChainSyncResponse{NodeID: nodeID, Timestamp: time.Now().Unix()}
+		if proof, err := bc.GetPostProof(req.ProofPostHash); err == nil {
+			resp.PostProof = proof
+			resp.FromIndex = proof.Header.Index
+			resp.ToIndex = proof.Header.Index
+		}
+		return resp
+	}
+
 	from := req.FromIndex
+	if from < 0 {
+		from = 0
+	}
 	to := req.ToIndex
 	if to < 0 || to < from {
 		chainLength, _ := bc.GetChainLength()
 		to = chainLength - 1
 	}
 
+	limit := chain.MaxBlocksPerRequest
+	if req.HeadersOnly {
+		limit = chain.MaxHeadersPerRequest
+	}
+	if to-from+1 > limit {
+		to = from + limit - 1
+	}
+
 	var resp chain.ChainSyncResponse
 	resp.FromIndex = from
 	resp.ToIndex = to
@@ -69,15 +139,7 @@ func handleSyncConnection(conn net.Conn, bc *blockchain.Blockchain, nodeID strin
 		for i := from; i <= to; i++ {
 			block, err := bc.GetBlockByIndex(i)
 			if err == nil && block != nil {
-				header := &chain.BlockHeader{
-					Index:     block.Index,
-					Timestamp: block.Timestamp,
-					PrevHash:  block.PrevHash,
-					Hash:      block.Hash,
-					CharCount: block.CharCount,
-					PostCount: block.GetPostCount(),
-				}
-				headers = append(headers, header)
+				headers = append(headers, block.Header())
 			}
 		}
 		resp.Headers = headers
@@ -92,11 +154,8 @@ func handleSyncConnection(conn net.Conn, bc *blockchain.Blockchain, nodeID strin
 		}
 		resp.Blocks = blocks
 	}
-	respBytes, _ := json.Marshal(resp)
-	writer.Write(respBytes)
-	writer.WriteByte('\n')
-	writer.Flush()
-	fmt.Printf("[SyncServer] Served sync request from %s: blocks %d-%d\n", req.NodeID, from, to)
+
+	return resp
 }
 
 // SyncFromPeerTCP connects to a peer and requests blocks via TCP
@@ -111,21 +170,51 @@ func SyncFromPeerTCPWithHeaders(peerAddr string, fromIndex int, toIndex int, nod
 		return nil, fmt.Errorf("failed to connect to peer %s: %w", peerAddr, err)
 	}
 	defer conn.Close()
-	writer := bufio.NewWriter(conn)
-	reader := bufio.NewReader(conn)
 
-	// Send request
-	req := chain.ChainSyncRequest{
+	return exchangeSyncRequest(conn, bufio.NewReader(conn), newSyncRequest(fromIndex, toIndex, nodeID, headersOnly))
+}
+
+// SyncFromPeerSecure requests blocks or headers over an authenticated session
+// If the peer does not complete the handshake (e.g. an older node), the request
+// is retried over a plaintext connection.
+func SyncFromPeerSecure(peerAddr string, fromIndex int, toIndex int, nodeID string, headersOnly bool, identity *NodeIdentity) (*chain.ChainSyncResponse, error) {
+	conn, err := net.DialTimeout("tcp", peerAddr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to peer %s: %w", peerAddr, err)
+	}
+	defer conn.Close()
+
+	session, err := identity.Handshake(conn, bufio.NewReader(conn), true)
+	if err != nil {
+		fmt.Printf("[Sync] Handshake with %s failed (%v), falling back to plaintext\n", peerAddr, err)
+		return SyncFromPeerTCPWithHeaders(peerAddr, fromIndex, toIndex, nodeID, headersOnly)
+	}
+
+	return exchangeSyncRequest(session.Conn, session.Reader, newSyncRequest(fromIndex, toIndex, nodeID, headersOnly))
+}
+
+// newSyncRequest builds a chain sync request
+func newSyncRequest(fromIndex int, toIndex int, nodeID string, headersOnly bool) chain.ChainSyncRequest {
+	return chain.ChainSyncRequest{
 		FromIndex:   fromIndex,
 		ToIndex:     toIndex,
 		NodeID:      nodeID,
 		Timestamp:   time.Now().Unix(),
 		HeadersOnly: headersOnly,
 	}
+}
+
+// exchangeSyncRequest sends a sync request and reads the response
+func exchangeSyncRequest(conn net.Conn, reader *bufio.Reader, req chain.ChainSyncRequest) (*chain.ChainSyncResponse, error) {
+	writer := bufio.NewWriter(conn)
+
+	// Send request
 	reqBytes, _ := json.Marshal(req)
 	writer.Write(reqBytes)
 	writer.WriteByte('\n')
-	writer.Flush()
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
 
 	// Read response
 	line, err := reader.ReadBytes('\n')
@@ -1,7 +1,6 @@
 package store
 
 import (
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -19,26 +18,28 @@ type Storage interface {
 	GetLatestBlock() (*chain.Block, error)
 	GetBlockCount() (int, error)
 	DeleteBlock(index int) error
+	ReplaceBlocks(ancestorIndex int, branch []*chain.Block, stateNodes map[string][]byte) error
 
 	// Post operations
 	SavePost(post chain.Post) error
 	GetPost(hash string) (*chain.Post, error)
 	PostExists(hash string) (bool, error)
+	GetPostBlockIndex(hash string) (int, error)
 
 	// Pending posts operations
-	SavePendingPost(post chain.Post) error
-	GetPendingPosts() ([]chain.Post, error)
-	RemovePendingPost(hash string) error
+	chain.PendingPostStore
 	ClearPendingPosts() error
 
-	// Character balance operations
-	GetCharacterBalance(address string) (int, error)
-	UpdateCharacterBalance(address string, amount int) error
+	// Pending transfers operations
+	chain.PendingTransferStore
 
 	// Heartbeat operations
 	SaveHeartbeat(heartbeat []byte) error
 	GetHeartbeats() ([][]byte, error)
 
+	// State tree operations
+	chain.StateNodeStore
+
 	// Utility operations
 	Close() error
 }
@@ -55,9 +56,14 @@ var (
 	blocksBucket       = []byte("blocks")
 	postsBucket        = []byte("posts")
 	pendingPostsBucket = []byte("pending_posts")
-	balancesBucket     = []byte("balances")
+	pendingTxBucket    = []byte("pending_transfers") // Transfer hash -> transfer waiting in the mempool
 	metadataBucket     = []byte("metadata")
 	heartbeatsBucket   = []byte("heartbeats")
+	postBlocksBucket   = []byte("post_blocks") // Post hash -> index of the block containing it
+	stateNodesBucket   = []byte("state_nodes") // State tree node hash -> node
+
+	// Balances kept outside the state tree by older versions
+	legacyBalancesBucket = []byte("balances")
 )
 
 // NewBoltDBStorage creates a new BoltDB storage instance
@@ -85,7 +91,7 @@ func NewBoltDBStorage(dbPath string) (*BoltDBStorage, error) {
 // initializeBuckets creates the necessary buckets if they don't exist
 func (s *BoltDBStorage) initializeBuckets() error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
-		buckets := [][]byte{blocksBucket, postsBucket, pendingPostsBucket, balancesBucket, metadataBucket, heartbeatsBucket}
+		buckets := [][]byte{blocksBucket, postsBucket, pendingPostsBucket, pendingTxBucket, metadataBucket, heartbeatsBucket, postBlocksBucket, stateNodesBucket}
 
 		for _, bucketName := range buckets {
 			_, err := tx.CreateBucketIfNotExists(bucketName)
@@ -94,6 +100,13 @@ func (s *BoltDBStorage) initializeBuckets() error {
 			}
 		}
 
+		// Balances now live only in the state tree
+		if tx.Bucket(legacyBalancesBucket) != nil {
+			if err := tx.DeleteBucket(legacyBalancesBucket); err != nil {
+				return fmt.Errorf("failed to drop legacy balances bucket: %w", err)
+			}
+		}
+
 		return nil
 	})
 }
@@ -104,34 +117,47 @@ func (s *BoltDBStorage) SaveBlock(block *chain.Block) error {
 	defer s.mu.Unlock()
 
 	return s.db.Update(func(tx *bbolt.Tx) error {
-		// Serialize block
-		blockData, err := json.Marshal(block)
-		if err != nil {
-			return fmt.Errorf("failed to marshal block: %w", err)
-		}
+		return putBlock(tx, block)
+	})
+}
 
-		// Save block by index
-		blocksBucket := tx.Bucket(blocksBucket)
-		indexKey := fmt.Sprintf("%d", block.Index)
-		if err := blocksBucket.Put([]byte(indexKey), blockData); err != nil {
-			return fmt.Errorf("failed to save block: %w", err)
-		}
+// putBlock writes a block, its post index and the latest block index in tx
+func putBlock(tx *bbolt.Tx, block *chain.Block) error {
+	// Serialize block
+	blockData, err := block.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to marshal block: %w", err)
+	}
 
-		// Save block by hash for quick lookup
-		if err := blocksBucket.Put([]byte(block.Hash), blockData); err != nil {
-			return fmt.Errorf("failed to save block by hash: %w", err)
-		}
+	// Save block by index
+	blocksBucket := tx.Bucket(blocksBucket)
+	indexKey := fmt.Sprintf("%d", block.Index)
+	if err := blocksBucket.Put([]byte(indexKey), blockData); err != nil {
+		return fmt.Errorf("failed to save block: %w", err)
+	}
 
-		// Update latest block index in metadata
-		metadataBucket := tx.Bucket(metadataBucket)
-		latestKey := []byte("latest_block_index")
-		latestData := fmt.Sprintf("%d", block.Index)
-		if err := metadataBucket.Put(latestKey, []byte(latestData)); err != nil {
-			return fmt.Errorf("failed to update latest block index: %w", err)
+	// Save block by hash for quick lookup
+	if err := blocksBucket.Put([]byte(block.Hash), blockData); err != nil {
+		return fmt.Errorf("failed to save block by hash: %w", err)
+	}
+
+	// Index posts by the block that contains them
+	postBlocksBucket := tx.Bucket(postBlocksBucket)
+	for _, post := range block.Posts {
+		if err := postBlocksBucket.Put([]byte(post.Hash), []byte(indexKey)); err != nil {
+			return fmt.Errorf("failed to index post: %w", err)
 		}
+	}
 
-		return nil
-	})
+	// Update latest block index in metadata
+	metadataBucket := tx.Bucket(metadataBucket)
+	latestKey := []byte("latest_block_index")
+	latestData := fmt.Sprintf("%d", block.Index)
+	if err := metadataBucket.Put(latestKey, []byte(latestData)); err != nil {
+		return fmt.Errorf("failed to update latest block index: %w", err)
+	}
+
+	return nil
 }
 
 // GetBlock retrieves a block by index
@@ -149,10 +175,11 @@ func (s *BoltDBStorage) GetBlock(index int) (*chain.Block, error) {
 			return fmt.Errorf("block not found: %d", index)
 		}
 
-		block = &chain.Block{}
-		if err := json.Unmarshal(blockData, block); err != nil {
-			return fmt.Errorf("failed to unmarshal block: %w", err)
+		decoded, err := chain.DecodeBlock(blockData)
+		if err != nil {
+			return fmt.Errorf("failed to decode block: %w", err)
 		}
+		block = decoded
 
 		return nil
 	})
@@ -174,10 +201,11 @@ func (s *BoltDBStorage) GetBlockByHash(hash string) (*chain.Block, error) {
 			return fmt.Errorf("block not found: %s", hash)
 		}
 
-		block = &chain.Block{}
-		if err := json.Unmarshal(blockData, block); err != nil {
-			return fmt.Errorf("failed to unmarshal block: %w", err)
+		decoded, err := chain.DecodeBlock(blockData)
+		if err != nil {
+			return fmt.Errorf("failed to decode block: %w", err)
 		}
+		block = decoded
 
 		return nil
 	})
@@ -209,10 +237,11 @@ func (s *BoltDBStorage) GetLatestBlock() (*chain.Block, error) {
 			return fmt.Errorf("latest block not found")
 		}
 
-		block = &chain.Block{}
-		if err := json.Unmarshal(blockData, block); err != nil {
-			return fmt.Errorf("failed to unmarshal block: %w", err)
+		decoded, err := chain.DecodeBlock(blockData)
+		if err != nil {
+			return fmt.Errorf("failed to decode block: %w", err)
 		}
+		block = decoded
 
 		return nil
 	})
@@ -226,55 +255,110 @@ func (s *BoltDBStorage) DeleteBlock(index int) error {
 	defer s.mu.Unlock()
 
 	return s.db.Update(func(tx *bbolt.Tx) error {
-		blocksBucket := tx.Bucket(blocksBucket)
-		indexKey := fmt.Sprintf("%d", index)
+		return removeBlock(tx, index)
+	})
+}
 
-		// Get the block first to get its hash
-		blockData := blocksBucket.Get([]byte(indexKey))
-		if blockData == nil {
-			return fmt.Errorf("block not found: %d", index)
-		}
+// removeBlock deletes a block and its post index entries in tx
+func removeBlock(tx *bbolt.Tx, index int) error {
+	blocksBucket := tx.Bucket(blocksBucket)
+	indexKey := fmt.Sprintf("%d", index)
 
-		block := &chain.Block{}
-		if err := json.Unmarshal(blockData, block); err != nil {
-			return fmt.Errorf("failed to unmarshal block: %w", err)
-		}
+	// Get the block first to get its hash
+	blockData := blocksBucket.Get([]byte(indexKey))
+	if blockData == nil {
+		return fmt.Errorf("block not found: %d", index)
+	}
 
-		// Delete by index
-		if err := blocksBucket.Delete([]byte(indexKey)); err != nil {
-			return fmt.Errorf("failed to delete block by index: %w", err)
-		}
+	block, err := chain.DecodeBlock(blockData)
+	if err != nil {
+		return fmt.Errorf("failed to decode block: %w", err)
+	}
 
-		// Delete by hash
-		if err := blocksBucket.Delete([]byte(block.Hash)); err != nil {
-			return fmt.Errorf("failed to delete block by hash: %w", err)
+	// Delete by index
+	if err := blocksBucket.Delete([]byte(indexKey)); err != nil {
+		return fmt.Errorf("failed to delete block by index: %w", err)
+	}
+
+	// Delete by hash
+	if err := blocksBucket.Delete([]byte(block.Hash)); err != nil {
+		return fmt.Errorf("failed to delete block by hash: %w", err)
+	}
+
+	// Drop the post index entries that point at this block
+	postBlocksBucket := tx.Bucket(postBlocksBucket)
+	for _, post := range block.Posts {
+		if string(postBlocksBucket.Get([]byte(post.Hash))) != indexKey {
+			continue
 		}
+		if err := postBlocksBucket.Delete([]byte(post.Hash)); err != nil {
+			return fmt.Errorf("failed to delete post index: %w", err)
+		}
+	}
 
-		// Update latest block index if this was the latest
-		metadataBucket := tx.Bucket(metadataBucket)
-		latestKey := []byte("latest_block_index")
-		latestData := metadataBucket.Get(latestKey)
+	// Update latest block index if this was the latest
+	metadataBucket := tx.Bucket(metadataBucket)
+	latestKey := []byte("latest_block_index")
+	latestData := metadataBucket.Get(latestKey)
 
-		if latestData != nil {
-			var latestIndex int
-			if _, err := fmt.Sscanf(string(latestData), "%d", &latestIndex); err == nil {
-				if latestIndex == index {
-					// Simply set to previous index, or remove if it was the only block
-					if index > 0 {
-						newLatestData := fmt.Sprintf("%d", index-1)
-						if err := metadataBucket.Put(latestKey, []byte(newLatestData)); err != nil {
-							return fmt.Errorf("failed to update latest block index: %w", err)
-						}
-					} else {
-						// This was the genesis block, remove the metadata
-						if err := metadataBucket.Delete(latestKey); err != nil {
-							return fmt.Errorf("failed to remove latest block index: %w", err)
-						}
+	if latestData != nil {
+		var latestIndex int
+		if _, err := fmt.Sscanf(string(latestData), "%d", &latestIndex); err == nil {
+			if latestIndex == index {
+				// Simply set to previous index, or remove if it was the only block
+				if index > 0 {
+					newLatestData := fmt.Sprintf("%d", index-1)
+					if err := metadataBucket.Put(latestKey, []byte(newLatestData)); err != nil {
+						return fmt.Errorf("failed to update latest block index: %w", err)
+					}
+				} else {
+					// This was the genesis block, remove the metadata
+					if err := metadataBucket.Delete(latestKey); err != nil {
+						return fmt.Errorf("failed to remove latest block index: %w", err)
 					}
 				}
 			}
 		}
+	}
+
+	return nil
+}
+
+// ReplaceBlocks swaps the blocks above ancestorIndex for branch in one transaction
+// The state tree nodes the branch needs are written in the same transaction, so a
+// crash leaves either the old chain or the new one, never a mix.
+func (s *BoltDBStorage) ReplaceBlocks(ancestorIndex int, branch []*chain.Block, stateNodes map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		// Delete from the tip down so the latest block index stays consistent
+		latestData := tx.Bucket(metadataBucket).Get([]byte("latest_block_index"))
+		if latestData == nil {
+			return fmt.Errorf("no blocks found")
+		}
+		var latestIndex int
+		if _, err := fmt.Sscanf(string(latestData), "%d", &latestIndex); err != nil {
+			return fmt.Errorf("failed to parse latest block index: %w", err)
+		}
+		for i := latestIndex; i > ancestorIndex; i-- {
+			if err := removeBlock(tx, i); err != nil {
+				return fmt.Errorf("failed to delete block %d: %w", i, err)
+			}
+		}
 
+		stateNodesBucket := tx.Bucket(stateNodesBucket)
+		for hash, node := range stateNodes {
+			if err := stateNodesBucket.Put([]byte(hash), node); err != nil {
+				return fmt.Errorf("failed to save state node: %w", err)
+			}
+		}
+
+		for _, block := range branch {
+			if err := putBlock(tx, block); err != nil {
+				return fmt.Errorf("failed to save block %d: %w", block.Index, err)
+			}
+		}
 		return nil
 	})
 }
@@ -315,7 +399,7 @@ func (s *BoltDBStorage) SavePost(post chain.Post) error {
 
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		// Serialize post
-		postData, err := json.Marshal(post)
+		postData, err := post.MarshalBinary()
 		if err != nil {
 			return fmt.Errorf("failed to marshal post: %w", err)
 		}
@@ -344,10 +428,11 @@ func (s *BoltDBStorage) GetPost(hash string) (*chain.Post, error) {
 			return fmt.Errorf("post not found: %s", hash)
 		}
 
-		post = &chain.Post{}
-		if err := json.Unmarshal(postData, post); err != nil {
-			return fmt.Errorf("failed to unmarshal post: %w", err)
+		decoded, err := chain.DecodePost(postData)
+		if err != nil {
+			return fmt.Errorf("failed to decode post: %w", err)
 		}
+		post = decoded
 
 		return nil
 	})
@@ -371,61 +456,62 @@ func (s *BoltDBStorage) PostExists(hash string) (bool, error) {
 	return exists, err
 }
 
-// GetCharacterBalance retrieves the character balance for an address
-func (s *BoltDBStorage) GetCharacterBalance(address string) (int, error) {
+// GetPostBlockIndex returns the index of the block containing a post
+func (s *BoltDBStorage) GetPostBlockIndex(hash string) (int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var balance int
+	var index int
 	err := s.db.View(func(tx *bbolt.Tx) error {
-		balancesBucket := tx.Bucket(balancesBucket)
-		balanceData := balancesBucket.Get([]byte(address))
+		postBlocksBucket := tx.Bucket(postBlocksBucket)
+		indexData := postBlocksBucket.Get([]byte(hash))
 
-		if balanceData == nil {
-			balance = 0
-			return nil
+		if indexData == nil {
+			return fmt.Errorf("post not in any block: %s", hash)
 		}
 
-		if _, err := fmt.Sscanf(string(balanceData), "%d", &balance); err != nil {
-			return fmt.Errorf("failed to parse balance: %w", err)
+		if _, err := fmt.Sscanf(string(indexData), "%d", &index); err != nil {
+			return fmt.Errorf("failed to parse block index: %w", err)
 		}
 
 		return nil
 	})
 
-	return balance, err
+	return index, err
 }
 
-// UpdateCharacterBalance updates the character balance for an address
-func (s *BoltDBStorage) UpdateCharacterBalance(address string, amount int) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// GetStateNode retrieves a state tree node by hash
+func (s *BoltDBStorage) GetStateNode(hash []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return s.db.Update(func(tx *bbolt.Tx) error {
-		balancesBucket := tx.Bucket(balancesBucket)
+	var node []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		nodeData := tx.Bucket(stateNodesBucket).Get(hash)
+		if nodeData == nil {
+			return fmt.Errorf("state node not found: %x", hash)
+		}
 
-		// Get current balance
-		currentBalanceData := balancesBucket.Get([]byte(address))
-		currentBalance := 0
+		// Copy out of the transaction's memory
+		node = append([]byte(nil), nodeData...)
+		return nil
+	})
 
-		if currentBalanceData != nil {
-			if _, err := fmt.Sscanf(string(currentBalanceData), "%d", &currentBalance); err != nil {
-				return fmt.Errorf("failed to parse current balance: %w", err)
-			}
-		}
+	return node, err
+}
 
-		// Calculate new balance
-		newBalance := currentBalance + amount
-		if newBalance < 0 {
-			return fmt.Errorf("insufficient balance: %d, trying to subtract %d", currentBalance, -amount)
-		}
+// SaveStateNodes saves state tree nodes keyed by hash in one transaction
+func (s *BoltDBStorage) SaveStateNodes(nodes map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		// Save new balance
-		newBalanceData := fmt.Sprintf("%d", newBalance)
-		if err := balancesBucket.Put([]byte(address), []byte(newBalanceData)); err != nil {
-			return fmt.Errorf("failed to update balance: %w", err)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		stateNodesBucket := tx.Bucket(stateNodesBucket)
+		for hash, node := range nodes {
+			if err := stateNodesBucket.Put([]byte(hash), node); err != nil {
+				return fmt.Errorf("failed to save state node: %w", err)
+			}
 		}
-
 		return nil
 	})
 }
@@ -437,7 +523,7 @@ func (s *BoltDBStorage) SavePendingPost(post chain.Post) error {
 
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		// Serialize post
-		postData, err := json.Marshal(post)
+		postData, err := post.MarshalBinary()
 		if err != nil {
 			return fmt.Errorf("failed to marshal pending post: %w", err)
 		}
@@ -462,11 +548,11 @@ func (s *BoltDBStorage) GetPendingPosts() ([]chain.Post, error) {
 		pendingBucket := tx.Bucket(pendingPostsBucket)
 
 		return pendingBucket.ForEach(func(key, value []byte) error {
-			var post chain.Post
-			if err := json.Unmarshal(value, &post); err != nil {
-				return fmt.Errorf("failed to unmarshal pending post: %w", err)
+			post, err := chain.DecodePost(value)
+			if err != nil {
+				return fmt.Errorf("failed to decode pending post: %w", err)
 			}
-			posts = append(posts, post)
+			posts = append(posts, *post)
 			return nil
 		})
 	})
@@ -498,6 +584,59 @@ func (s *BoltDBStorage) ClearPendingPosts() error {
 	})
 }
 
+// SavePendingTransfer saves a transfer to the pending transfers bucket
+func (s *BoltDBStorage) SavePendingTransfer(transfer chain.Transfer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		transferData, err := transfer.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("failed to marshal pending transfer: %w", err)
+		}
+
+		pendingBucket := tx.Bucket(pendingTxBucket)
+		if err := pendingBucket.Put([]byte(transfer.Hash), transferData); err != nil {
+			return fmt.Errorf("failed to save pending transfer: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// GetPendingTransfers retrieves all pending transfers
+func (s *BoltDBStorage) GetPendingTransfers() ([]chain.Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var transfers []chain.Transfer
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		pendingBucket := tx.Bucket(pendingTxBucket)
+
+		return pendingBucket.ForEach(func(key, value []byte) error {
+			var transfer chain.Transfer
+			if err := transfer.UnmarshalBinary(value); err != nil {
+				return fmt.Errorf("failed to decode pending transfer: %w", err)
+			}
+			transfers = append(transfers, transfer)
+			return nil
+		})
+	})
+
+	return transfers, err
+}
+
+// RemovePendingTransfer removes a pending transfer by hash
+func (s *BoltDBStorage) RemovePendingTransfer(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		pendingBucket := tx.Bucket(pendingTxBucket)
+		return pendingBucket.Delete([]byte(hash))
+	})
+}
+
 // SaveHeartbeat saves a heartbeat to storage
 func (s *BoltDBStorage) SaveHeartbeat(heartbeat []byte) error {
 	s.mu.Lock()
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"os"
 	"testing"
 	"time"
@@ -280,9 +281,9 @@ func TestPostExists(t *testing.T) {
 	}
 }
 
-func TestCharacterBalance(t *testing.T) {
+func TestConcurrentAccess(t *testing.T) {
 	// Create temporary database file
-	dbPath := "test_balance.db"
+	dbPath := "test_concurrent.db"
 	defer os.Remove(dbPath)
 
 	// Create storage
@@ -292,69 +293,86 @@ func TestCharacterBalance(t *testing.T) {
 	}
 	defer storage.Close()
 
-	testAddress := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
+	// Test concurrent pending post writes
+	done := make(chan bool, 10)
 
-	// Test initial balance (should be 0)
-	balance, err := storage.GetCharacterBalance(testAddress)
-	if err != nil {
-		t.Fatalf("Failed to get initial balance: %v", err)
-	}
-	if balance != 0 {
-		t.Errorf("Expected initial balance 0, got %d", balance)
+	for i := 0; i < 10; i++ {
+		go func(n int) {
+			post := chain.Post{
+				Author:    "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa",
+				Content:   fmt.Sprintf("Concurrent post %d", n),
+				Timestamp: int64(n),
+				Hash:      fmt.Sprintf("hash%d", n),
+			}
+			if err := storage.SavePendingPost(post); err != nil {
+				t.Errorf("Failed to save pending post %d: %v", n, err)
+			}
+			done <- true
+		}(i)
 	}
 
-	// Add characters
-	if err := storage.UpdateCharacterBalance(testAddress, 1000); err != nil {
-		t.Fatalf("Failed to add characters: %v", err)
+	// Wait for all goroutines to complete
+	for i := 0; i < 10; i++ {
+		<-done
 	}
 
-	// Check balance
-	balance, err = storage.GetCharacterBalance(testAddress)
+	// Verify every post was saved
+	posts, err := storage.GetPendingPosts()
 	if err != nil {
-		t.Fatalf("Failed to get balance: %v", err)
+		t.Fatalf("Failed to get pending posts: %v", err)
 	}
-	if balance != 1000 {
-		t.Errorf("Expected balance 1000, got %d", balance)
+	if len(posts) != 10 {
+		t.Errorf("Expected 10 pending posts, got %d", len(posts))
 	}
+}
 
-	// Add more characters
-	if err := storage.UpdateCharacterBalance(testAddress, 500); err != nil {
-		t.Fatalf("Failed to add more characters: %v", err)
-	}
+func TestPostBlockIndex(t *testing.T) {
+	// Create temporary database file
+	dbPath := "test_post_index.db"
+	defer os.Remove(dbPath)
 
-	// Check updated balance
-	balance, err = storage.GetCharacterBalance(testAddress)
+	// Create storage
+	storage, err := NewBoltDBStorage(dbPath)
 	if err != nil {
-		t.Fatalf("Failed to get updated balance: %v", err)
+		t.Fatalf("Failed to create storage: %v", err)
 	}
-	if balance != 1500 {
-		t.Errorf("Expected balance 1500, got %d", balance)
+	defer storage.Close()
+
+	post := chain.Post{Author: "author", Content: "indexed post", Timestamp: time.Now().Unix(), Signature: "signature"}
+	post.SetHash()
+	block := &chain.Block{
+		Index:     3,
+		Timestamp: time.Now().Unix(),
+		PrevHash:  "0000000000000000000000000000000000000000000000000000000000000000",
+		Posts:     []chain.Post{post},
+		CharCount: post.GetCharacterCount(chain.ConsensusParamsAt(chain.TestnetNetworkID, 3)),
 	}
+	block.SetHash()
 
-	// Subtract characters
-	if err := storage.UpdateCharacterBalance(testAddress, -300); err != nil {
-		t.Fatalf("Failed to subtract characters: %v", err)
+	if err := storage.SaveBlock(block); err != nil {
+		t.Fatalf("Failed to save block: %v", err)
 	}
 
-	// Check final balance
-	balance, err = storage.GetCharacterBalance(testAddress)
+	index, err := storage.GetPostBlockIndex(post.Hash)
 	if err != nil {
-		t.Fatalf("Failed to get final balance: %v", err)
+		t.Fatalf("Failed to get post block index: %v", err)
 	}
-	if balance != 1200 {
-		t.Errorf("Expected balance 1200, got %d", balance)
+	if index != 3 {
+		t.Errorf("Expected post in block 3, got %d", index)
 	}
 
-	// Test insufficient balance
-	err = storage.UpdateCharacterBalance(testAddress, -2000)
-	if err == nil {
-		t.Error("Expected error for insufficient balance")
+	// Deleting the block removes the index entry
+	if err := storage.DeleteBlock(3); err != nil {
+		t.Fatalf("Failed to delete block: %v", err)
+	}
+	if _, err := storage.GetPostBlockIndex(post.Hash); err == nil {
+		t.Error("Expected post to be unindexed after its block was deleted")
 	}
 }
 
-func TestConcurrentAccess(t *testing.T) {
+func TestReplaceBlocks(t *testing.T) {
 	// Create temporary database file
-	dbPath := "test_concurrent.db"
+	dbPath := "test_replace_blocks.db"
 	defer os.Remove(dbPath)
 
 	// Create storage
@@ -364,31 +382,55 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 	defer storage.Close()
 
-	// Test concurrent balance updates
-	testAddress := "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"
-	done := make(chan bool, 10)
-
-	for i := 0; i < 10; i++ {
-		go func(amount int) {
-			if err := storage.UpdateCharacterBalance(testAddress, amount); err != nil {
-				t.Errorf("Failed to update balance by %d: %v", amount, err)
-			}
-			done <- true
-		}(i + 1) // Add 1-10 characters
+	newBlock := func(index int, prevHash string, fork string) *chain.Block {
+		block := &chain.Block{Index: index, Timestamp: time.Now().Unix(), PrevHash: prevHash + fork, Posts: []chain.Post{}}
+		block.SetHash()
+		return block
+	}
+	b0 := newBlock(0, "", "")
+	b1 := newBlock(1, b0.Hash, "")
+	b2 := newBlock(2, b1.Hash, "")
+	for _, block := range []*chain.Block{b0, b1, b2} {
+		if err := storage.SaveBlock(block); err != nil {
+			t.Fatalf("Failed to save block %d: %v", block.Index, err)
+		}
 	}
 
-	// Wait for all goroutines to complete
-	for i := 0; i < 10; i++ {
-		<-done
+	// Swap block 2 for a two-block branch with its state node
+	c2 := newBlock(2, b1.Hash, "fork")
+	c3 := newBlock(3, c2.Hash, "fork")
+	nodes := map[string][]byte{"node": []byte("state")}
+	if err := storage.ReplaceBlocks(1, []*chain.Block{c2, c3}, nodes); err != nil {
+		t.Fatalf("Failed to replace blocks: %v", err)
+	}
+	if count, _ := storage.GetBlockCount(); count != 4 {
+		t.Errorf("Expected 4 blocks after replace, got %d", count)
+	}
+	if block, err := storage.GetBlock(2); err != nil || block.Hash != c2.Hash {
+		t.Errorf("Expected block 2 from the new branch, got %v (%v)", block, err)
+	}
+	if _, err := storage.GetBlockByHash(b2.Hash); err == nil {
+		t.Error("Expected replaced block to be gone by hash")
+	}
+	if node, err := storage.GetStateNode([]byte("node")); err != nil || string(node) != "state" {
+		t.Errorf("Expected state node to be saved, got %q (%v)", node, err)
 	}
 
-	// Verify final balance (should be sum of 1+2+...+10 = 55)
-	balance, err := storage.GetCharacterBalance(testAddress)
-	if err != nil {
-		t.Fatalf("Failed to get final balance: %v", err)
+	// A replace that fails midway leaves storage untouched
+	if err := storage.DeleteBlock(2); err != nil {
+		t.Fatalf("Failed to delete block: %v", err)
+	}
+	d1 := newBlock(1, b0.Hash, "other")
+	if err := storage.ReplaceBlocks(0, []*chain.Block{d1}, map[string][]byte{"other": []byte("state")}); err == nil {
+		t.Fatal("Expected replace over a missing block to fail")
+	}
+	if block, err := storage.GetBlock(3); err != nil || block.Hash != c3.Hash {
+		t.Errorf("Expected block 3 to survive the failed replace, got %v (%v)", block, err)
+	}
+	if block, err := storage.GetBlock(1); err != nil || block.Hash != b1.Hash {
+		t.Errorf("Expected block 1 to survive the failed replace, got %v (%v)", block, err)
 	}
-	expectedBalance := 55 // 1+2+3+...+10
-	if balance != expectedBalance {
-		t.Errorf("Expected balance %d, got %d", expectedBalance, balance)
+	if _, err := storage.GetStateNode([]byte("other")); err == nil {
+		t.Error("Expected state node of the failed replace not to be saved")
 	}
 }
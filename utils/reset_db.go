@@ -11,8 +11,9 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run cmd/reset_db.go <database_path>")
-		fmt.Println("Example: go run cmd/reset_db.go truthchain.db")
+		fmt.Println("Usage: go run cmd/reset_db.go <database_path> [signed_genesis.json]")
+		fmt.Println("Example: go run cmd/reset_db.go truthchain.db genesis.json")
+		fmt.Println("Without a signed genesis block the node syncs it from peers.")
 		os.Exit(1)
 	}
 
@@ -40,19 +41,25 @@ func main() {
 	}
 	defer storage.Close()
 
-	// Create and save genesis block
-	fmt.Printf("Creating new genesis block...\n")
-	genesis := chain.CreateGenesisBlock()
-	if err := storage.SaveBlock(genesis); err != nil {
-		log.Fatalf("Failed to save genesis block: %v", err)
+	// The mainnet genesis block must be signed by the genesis authority
+	if len(os.Args) < 3 {
+		fmt.Printf("\n✅ Database reset completed - the node will sync the genesis block from peers\n")
+		return
 	}
-	fmt.Printf("✅ Created new genesis block\n")
 
-	// Verify the genesis block
-	if !chain.IsMainnetGenesis(genesis) {
-		fmt.Printf("❌ Genesis block doesn't match mainnet!\n")
+	fmt.Printf("Importing signed genesis block...\n")
+	genesis, err := chain.LoadGenesisBlock(os.Args[2])
+	if err != nil {
+		log.Fatalf("Failed to load genesis block: %v", err)
+	}
+	if err := chain.ValidateCanonicalGenesis(chain.MainnetNetworkID, genesis); err != nil {
+		fmt.Printf("❌ Genesis block doesn't match mainnet: %v\n", err)
 		os.Exit(1)
 	}
+	if err := storage.SaveBlock(genesis); err != nil {
+		log.Fatalf("Failed to save genesis block: %v", err)
+	}
+	fmt.Printf("✅ Imported signed genesis block\n")
 
 	// Verify final state
 	blockCount, err := storage.GetBlockCount()
@@ -2,7 +2,6 @@ package wallet
 
 import (
 	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -25,6 +24,9 @@ const (
 	TruthChainMultisigVersion = 0x05
 )
 
+// compactSignatureSize is the length of a recoverable compact signature
+const compactSignatureSize = 65
+
 // WalletMetadata contains additional information about the wallet
 type WalletMetadata struct {
 	Name        string    `json:"name"`
@@ -233,14 +235,34 @@ func (w *Wallet) Verify(data []byte, signature []byte) (bool, error) {
 }
 
 // VerifySignature verifies a signature against data and a given public key
+// Both compact signatures (as produced by Sign) and ASN.1 signatures are accepted.
 func VerifySignature(data []byte, signature []byte, publicKey *btcec.PublicKey) (bool, error) {
 	// Hash the data first
 	hash := sha256.Sum256(data)
 
+	// Compact signatures carry a recovery byte - recover and compare the key
+	if len(signature) == compactSignatureSize {
+		recoveredPubKey, _, err := btcecdsa.RecoverCompact(signature, hash[:])
+		if err != nil {
+			return false, fmt.Errorf("failed to recover public key: %w", err)
+		}
+		return recoveredPubKey.IsEqual(publicKey), nil
+	}
+
 	// Verify the signature using ECDSA
 	return ecdsa.VerifyASN1(publicKey.ToECDSA(), hash[:], signature), nil
 }
 
+// PublicKeyMatchesAddress checks that an address was derived from the public key
+// The address's own version byte is used, so testnet addresses match as well.
+func PublicKeyMatchesAddress(publicKey *btcec.PublicKey, address string) bool {
+	decoded := base58.Decode(address)
+	if len(decoded) != 25 {
+		return false
+	}
+	return generateAddressWithVersion(publicKey, decoded[0]) == address
+}
+
 // generateAddress creates a Bitcoin-style Base58Check address from the public key
 func generateAddress(publicKey *btcec.PublicKey) string {
 	return generateAddressWithVersion(publicKey, TruthChainMainnetVersion)
@@ -280,15 +302,16 @@ func ValidateAddress(address string) bool {
 
 // ValidateAddressWithVersion checks if a given address is valid for a specific version
 func ValidateAddressWithVersion(address string, expectedVersion byte) bool {
+	version, ok := AddressVersion(address)
+	return ok && version == expectedVersion
+}
+
+// AddressVersion returns the version byte of a well-formed Base58Check address
+func AddressVersion(address string) (byte, bool) {
 	// Decode Base58Check
 	decoded := base58.Decode(address)
 	if len(decoded) < 5 {
-		return false
-	}
-
-	// Check version byte
-	if decoded[0] != expectedVersion {
-		return false
+		return 0, false
 	}
 
 	// Extract payload and checksum
@@ -301,11 +324,17 @@ func ValidateAddressWithVersion(address string, expectedVersion byte) bool {
 
 	for i := 0; i < 4; i++ {
 		if checksum[i] != calculatedChecksum[i] {
-			return false
+			return 0, false
 		}
 	}
 
-	return true
+	return decoded[0], true
+}
+
+// ValidateAddressFormat checks that an address is well formed, whatever its network
+func ValidateAddressFormat(address string) bool {
+	_, ok := AddressVersion(address)
+	return ok
 }
 
 // LoadOrCreateWallet loads an existing wallet or creates a new one
@@ -401,19 +430,13 @@ func NewMultisigWallet(name string) (*Wallet, error) {
 	return NewWalletWithMetadata(name, TruthChainMultisigVersion)
 }
 
-// SignMessage signs a message with a private key and returns hex-encoded signature
-func SignMessage(message []byte, privateKey *ecdsa.PrivateKey) (string, error) {
-	// Create hash of the message
-	hash := sha256.Sum256(message)
-
-	// Sign the hash
-	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, hash[:])
-	if err != nil {
-		return "", fmt.Errorf("failed to sign message: %w", err)
+// SignHash signs a 32-byte digest as is, returning a recoverable compact signature
+// Use it for entries that are identified by their hash, so the signature commits to that hash.
+func (w *Wallet) SignHash(hash []byte) ([]byte, error) {
+	if len(hash) != sha256.Size {
+		return nil, fmt.Errorf("hash must be %d bytes, got %d", sha256.Size, len(hash))
 	}
-
-	// Return hex-encoded signature
-	return hex.EncodeToString(signature), nil
+	return btcecdsa.SignCompact(w.PrivateKey, hash, true), nil
 }
 
 // RecoverPublicKeyFromSignature recovers the public key from a compact signature and message hash (hex)
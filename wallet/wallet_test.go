@@ -148,6 +148,50 @@ func TestSignAndVerify(t *testing.T) {
 	}
 }
 
+func TestVerifySignatureCompact(t *testing.T) {
+	signer, _ := NewWallet()
+	other, _ := NewWallet()
+	testData := []byte("Hello, TruthChain!")
+
+	signature, err := signer.Sign(testData)
+	if err != nil {
+		t.Fatalf("Failed to sign data: %v", err)
+	}
+
+	valid, err := VerifySignature(testData, signature, signer.PublicKey)
+	if err != nil || !valid {
+		t.Errorf("Compact signature should verify against signer key: %v", err)
+	}
+
+	valid, _ = VerifySignature(testData, signature, other.PublicKey)
+	if valid {
+		t.Error("Compact signature should not verify against another key")
+	}
+
+	valid, _ = VerifySignature([]byte("Different data"), signature, signer.PublicKey)
+	if valid {
+		t.Error("Compact signature should not verify different data")
+	}
+}
+
+func TestPublicKeyMatchesAddress(t *testing.T) {
+	mainnet, _ := NewWallet()
+	testnet, _ := NewTestnetWallet("test")
+
+	if !PublicKeyMatchesAddress(mainnet.PublicKey, mainnet.GetAddress()) {
+		t.Error("Mainnet address should match its public key")
+	}
+	if !PublicKeyMatchesAddress(testnet.PublicKey, testnet.GetAddress()) {
+		t.Error("Testnet address should match its public key")
+	}
+	if PublicKeyMatchesAddress(mainnet.PublicKey, testnet.GetAddress()) {
+		t.Error("Address should not match another public key")
+	}
+	if PublicKeyMatchesAddress(mainnet.PublicKey, "invalid") {
+		t.Error("Invalid address should not match")
+	}
+}
+
 func TestExportMethods(t *testing.T) {
 	wallet, _ := NewWallet()
 